@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	logmon "github.com/jjrumi/accesslogmonitor/pkg"
+)
+
+// runConfig checks a config file with the check command: its syntax, its fields and their values.
+// It returns the exit code.
+func runConfig(args []string) int {
+	fs := flag.NewFlagSet("config", flag.ExitOnError)
+	path := fs.String("config", os.Getenv(envName("config")), "YAML config file to check, if not given as an argument")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s config check [OPTIONS] [FILE]\n\n", os.Args[0])
+		fmt.Fprintln(os.Stderr, "OPTIONS:")
+		fs.PrintDefaults()
+	}
+
+	if len(args) < 1 || args[0] != "check" {
+		fs.Usage()
+		return 2
+	}
+	_ = fs.Parse(args[1:])
+	if fs.NArg() > 0 {
+		*path = fs.Arg(0)
+	}
+	if *path == "" {
+		fs.Usage()
+		return 2
+	}
+
+	config, err := logmon.LoadConfig(*path)
+	if err != nil {
+		fmt.Printf("%s:\n%v\n", *path, err)
+		return 1
+	}
+
+	fmt.Printf("%s: ok, %d sources, %d notifiers\n", *path, len(config.Sources), len(config.Notifiers))
+	return 0
+}
+
+// reloadConfig reloads the config file, then overrides it with the env vars and the command line flags again.
+func reloadConfig(path string) (logmon.Config, error) {
+	config, _, err := loadConfig(path, os.Args[1:], flag.ContinueOnError)
+	return config, err
+}
+
+// watchConfig reloads the config file on SIGHUP, or once it changes if -config-watch is set, until the context is done.
+// It sends every configuration reloaded, or the error reloading it, to the monitor.
+func watchConfig(ctx context.Context, args arguments, reloads chan<- logmon.ConfigReload) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var poll <-chan time.Time
+	if args.configWatch > 0 {
+		ticker := time.NewTicker(args.configWatch)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+	modified := configModTime(args.configPath)
+
+	for {
+		select {
+		case sig := <-hup:
+			log.Printf("signal captured: %v", sig)
+		case <-poll:
+			// A file being replaced cannot be read for a moment: it is reloaded once it is there.
+			if t := configModTime(args.configPath); t.IsZero() || t.Equal(modified) {
+				continue
+			}
+		case <-ctx.Done():
+			return
+		}
+
+		modified = configModTime(args.configPath)
+		c, err := reloadConfig(args.configPath)
+		select {
+		case reloads <- logmon.ConfigReload{Config: c, Err: err}:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// configModTime returns the modification time of a config file, or zero if it cannot be read.
+func configModTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
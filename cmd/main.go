@@ -7,17 +7,146 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
+	"strings"
+	"time"
 
 	logmon "github.com/jjrumi/accesslogmonitor/pkg"
 )
 
-var (
-	// Command line flags.
-	logFilePath     string
-	refreshInterval int
-	alertThreshold  int
-	alertWindow     int
-)
+// arguments are the command line flags that are not values of the config file, e.g. notifiers to add to its ones.
+type arguments struct {
+	configPath      string
+	configWatch     time.Duration
+	webhookURL      string
+	webhookRetries  int
+	webhookTemplate string
+	webhookKey      string
+	execCommand     string
+	smtpAddr        string
+	smtpFrom        string
+	smtpTo          string
+	smtpUser        string
+}
+
+// definitionFlags collects definitions given with repeated flags, e.g. SLOs, checked by a parse function.
+// The first definition replaces the ones of the config file.
+type definitionFlags struct {
+	values *[]string
+	parse  func(string) error
+	set    bool
+}
+
+func newDefinitionFlags(values *[]string, parse func(string) error) *definitionFlags {
+	return &definitionFlags{values: values, parse: parse}
+}
+
+func (f *definitionFlags) String() string {
+	if f.values == nil || len(*f.values) == 0 {
+		return ""
+	}
+	return fmt.Sprint(*f.values)
+}
+
+func (f *definitionFlags) Set(value string) error {
+	if err := f.parse(value); err != nil {
+		return err
+	}
+	if !f.set {
+		*f.values = nil
+		f.set = true
+	}
+	*f.values = append(*f.values, value)
+	return nil
+}
+
+// listFlag is a comma separated list of values.
+type listFlag struct {
+	values *[]string
+}
+
+func (f listFlag) String() string {
+	if f.values == nil {
+		return ""
+	}
+	return strings.Join(*f.values, ",")
+}
+
+func (f listFlag) Set(value string) error {
+	*f.values = nil
+	if value != "" {
+		*f.values = strings.Split(value, ",")
+	}
+	return nil
+}
+
+// windowsFlag is a comma separated list of periods.
+type windowsFlag struct {
+	windows *[]time.Duration
+}
+
+func (f windowsFlag) String() string {
+	if f.windows == nil {
+		return ""
+	}
+	var periods []string
+	for _, w := range *f.windows {
+		periods = append(periods, w.String())
+	}
+	return strings.Join(periods, ",")
+}
+
+func (f windowsFlag) Set(value string) error {
+	windows, err := logmon.ParseWindows(value)
+	if err != nil {
+		return err
+	}
+	*f.windows = windows
+	return nil
+}
+
+// sourceFlag replaces the sources of the config file with a single log file.
+type sourceFlag struct {
+	sources *[]logmon.SourceConfig
+}
+
+func (f sourceFlag) String() string {
+	if f.sources == nil || len(*f.sources) == 0 {
+		return ""
+	}
+	return (*f.sources)[0].Path
+}
+
+func (f sourceFlag) Set(value string) error {
+	*f.sources = []logmon.SourceConfig{{Path: value, Parser: logmon.CommonLogFormat}}
+	return nil
+}
+
+// subscriberFlags collects the buffers and overflow policies of the hub subscribers given with repeated flags.
+type subscriberFlags struct {
+	subscribers *map[string]string
+}
+
+func (f subscriberFlags) String() string {
+	if f.subscribers == nil || len(*f.subscribers) == 0 {
+		return ""
+	}
+	return fmt.Sprint(*f.subscribers)
+}
+
+func (f subscriberFlags) Set(value string) error {
+	kv := strings.SplitN(value, "=", 2)
+	if len(kv) != 2 || !strings.Contains(kv[0], "/") {
+		return fmt.Errorf("invalid subscriber %q: expected hub/subscriber=buffer:policy", value)
+	}
+	if _, err := logmon.ParseSubscriberOpts(kv[1]); err != nil {
+		return err
+	}
+	if *f.subscribers == nil {
+		*f.subscribers = make(map[string]string)
+	}
+	(*f.subscribers)[kv[0]] = kv[1]
+	return nil
+}
 
 // setLogger uses a file to log while on "debug" mode. No logging otherwise.
 func setLogger() *os.File {
@@ -39,38 +168,216 @@ func setLogger() *os.File {
 	return f
 }
 
-func setArguments() {
-	flag.StringVar(&logFilePath, "source", "/tmp/access.log", "log file path to monitor")
-	flag.IntVar(&refreshInterval, "refresh", 10, "refresh interval at which traffic stats are computed, in seconds")
-	flag.IntVar(&alertThreshold, "threshold", 10, "alert condition, in requests per second")
-	flag.IntVar(&alertWindow, "window", 120, "time period to check the alert condition, in seconds")
+// setArguments defines the flags of a set, overriding the values of a configuration.
+func setArguments(fs *flag.FlagSet, c *logmon.Config, a *arguments) {
+	fs.StringVar(&a.configPath, "config", a.configPath, "YAML config file; the env vars and flags override its values (env: LOGMON_CONFIG); reloaded on SIGHUP")
+	fs.DurationVar(&a.configWatch, "config-watch", a.configWatch, "interval to check the config file for changes and reload it, e.g. 5s (0 to only reload on SIGHUP)")
+	fs.Var(sourceFlag{&c.Sources}, "source", "log file path to monitor, instead of the sources of the config file")
+	fs.IntVar(&c.Refresh, "refresh", c.Refresh, "refresh interval at which traffic stats are computed, in seconds")
+	fs.IntVar(&c.Alerts.Threshold, "threshold", c.Alerts.Threshold, "alert condition, in requests per second")
+	fs.Var(windowsFlag{&c.Windows}, "rolling-windows", "comma separated periods of the rolling windows of the traffic panels, multiples of -refresh, switched with the w key")
+	fs.IntVar(&c.Alerts.Window, "window", c.Alerts.Window, "time period to check the alert condition, in seconds, a multiple of -refresh")
+	fs.IntVar(&c.Alerts.Floor, "floor", c.Alerts.Floor, "low traffic alert condition, in requests per second (0 to disable)")
+	fs.IntVar(&c.Alerts.NoData, "nodata", c.Alerts.NoData, "time without log lines before alerting of a dead source, in seconds (0 to disable)")
+	fs.Float64Var(&c.Alerts.Anomaly.Sigmas, "anomaly", c.Alerts.Anomaly.Sigmas, "anomaly alert condition, in standard deviations from the learnt baseline (0 to disable)")
+	fs.Float64Var(&c.Alerts.Anomaly.Alpha, "anomaly-alpha", c.Alerts.Anomaly.Alpha, "weight of the latest interval in the learnt baseline, between 0 and 1")
+	fs.BoolVar(&c.Alerts.Anomaly.Seasonal, "seasonal", c.Alerts.Anomaly.Seasonal, "learn a different baseline for every hour of the day")
+	fs.IntVar(&c.Alerts.Spike.Percent, "spike", c.Alerts.Spike.Percent, "spike alert condition, as a relative change in percent against the preceding window (0 to disable)")
+	fs.IntVar(&c.Alerts.Spike.Window, "spike-window", c.Alerts.Spike.Window, "most recent period compared against the preceding window, in seconds, a multiple of -refresh at most half of -window")
+	fs.StringVar(&c.Clients.Key, "clients", c.Clients.Key, "how to aggregate the requests of the clients: host, user or cidr/N")
+	fs.IntVar(&c.Clients.Capacity, "clients-capacity", c.Clients.Capacity, "maximum number of clients tracked per refresh interval")
+	fs.IntVar(&c.Alerts.Clients.Rate, "client-rate", c.Alerts.Clients.Rate, "abuse alert condition, in requests per second of a single client (0 to disable)")
+	fs.IntVar(&c.Alerts.Clients.Errors, "client-errors", c.Alerts.Clients.Errors, "abuse alert condition, in percent of 4xx and 5xx responses of a single client (0 to disable)")
+	fs.StringVar(&a.webhookURL, "webhook", "", "URL to post alerts to as JSON")
+	fs.IntVar(&a.webhookRetries, "webhook-retries", 3, "number of retries of a failed webhook delivery")
+	fs.StringVar(&a.webhookTemplate, "webhook-template", "", "payload of the webhook: slack, pagerduty or the path of a Go text/template file (default: the alert as JSON)")
+	fs.StringVar(&a.webhookKey, "webhook-key", "", "key available to the webhook template, e.g. a PagerDuty routing key")
+	fs.StringVar(&a.execCommand, "exec", "", "shell command to run on every alert, with the alert as JSON on stdin and LOGMON_ALERT_* env vars")
+	fs.StringVar(&a.smtpAddr, "smtp", "", "SMTP server to email alerts to, as host:port")
+	fs.StringVar(&a.smtpFrom, "smtp-from", "logmon@localhost", "sender of the alert emails")
+	fs.StringVar(&a.smtpTo, "smtp-to", "", "comma separated recipients of the alert emails")
+	fs.StringVar(&a.smtpUser, "smtp-user", "", "SMTP username; the password is read from the LOGMON_SMTP_PASSWORD env var")
+	fs.StringVar(&c.History, "history", c.History, "file to record every alert into as JSON lines; open alerts are restored from it on startup")
+	fs.StringVar(&c.Silences.Path, "silences", c.Silences.Path, "file to keep the silences into, shared with the silence subcommand (empty to disable)")
+	fs.DurationVar(&c.Silences.For, "silence-for", c.Silences.For, "duration of the silences created from the dashboard")
+	fs.Var(newDefinitionFlags(&c.Silences.Maintenance, func(v string) error {
+		_, err := logmon.ParseMaintenanceWindow(v)
+		return err
+	}), "maintenance", "maintenance window silencing all alerts as a cron schedule and a duration, e.g. \"0 2 * * 0 2h\" (repeatable)")
+	fs.StringVar(&c.Outputs.Metrics.Addr, "metrics", c.Outputs.Metrics.Addr, "address to serve Prometheus metrics on /metrics, e.g. :9100")
+	fs.IntVar(&c.Outputs.Metrics.Sections, "metrics-sections", c.Outputs.Metrics.Sections, "maximum number of sections with their own label in the metrics; the rest are counted as \"other\"")
+	fs.StringVar(&c.Outputs.StatsD.Addr, "statsd", c.Outputs.StatsD.Addr, "StatsD server to send the stats and alerts to over UDP, as host:port")
+	fs.StringVar(&c.Outputs.StatsD.Prefix, "statsd-prefix", c.Outputs.StatsD.Prefix, "prefix of the StatsD metric names")
+	fs.Var(listFlag{&c.Outputs.StatsD.Tags}, "statsd-tags", "comma separated key:value tags of every StatsD metric, e.g. env:prod (DogStatsD only)")
+	fs.BoolVar(&c.Outputs.StatsD.DogStatsD, "dogstatsd", c.Outputs.StatsD.DogStatsD, "send DogStatsD tags and events to the StatsD server")
+	fs.StringVar(&c.Outputs.Influx.URL, "influx", c.Outputs.Influx.URL, "InfluxDB write URL, e.g. http://localhost:8086/write?db=logmon or udp://localhost:8089; the token is read from the LOGMON_INFLUX_TOKEN env var")
+	fs.Var(listFlag{&c.Outputs.Influx.Tags}, "influx-tags", "comma separated key=value tags of every InfluxDB point, e.g. host=web-1")
+	fs.StringVar(&c.Outputs.Graphite.Addr, "graphite", c.Outputs.Graphite.Addr, "Graphite plaintext listener to write the stats and alerts to, as host:port")
+	fs.StringVar(&c.Outputs.Graphite.Prefix, "graphite-prefix", c.Outputs.Graphite.Prefix, "prefix of the Graphite metric paths")
+	fs.StringVar(&c.Outputs.API.Addr, "api", c.Outputs.API.Addr, "address to serve the JSON query API on, e.g. :8081")
+	fs.DurationVar(&c.Outputs.API.Retention, "api-retention", c.Outputs.API.Retention, "period of traffic stats kept for the query API")
+	fs.StringVar(&c.Outputs.Store.Path, "store", c.Outputs.Store.Path, "directory to persist the traffic stats into, rolled up into 1m and 1h resolutions")
+	fs.StringVar(&c.Outputs.Store.Retention, "store-retention", c.Outputs.Store.Retention, "retention of every resolution of the store")
+	fs.StringVar(&c.Outputs.Dashboard.Addr, "dashboard", c.Outputs.Dashboard.Addr, "address to serve a live web dashboard on, e.g. :8080")
+	fs.BoolVar(&c.UI.Headless, "headless", c.UI.Headless, "write the stats and alerts on stdout instead of running the terminal UI; stops on SIGINT or SIGTERM")
+	fs.StringVar(&c.UI.Output, "output", c.UI.Output, "format of the headless output: json or logfmt")
+	fs.StringVar(&c.Filter, "filter", c.Filter, "only aggregate the log entries matching an expression, e.g. 'status >= 500 and path ~ \"^/api\"'; editable from the UI with the / key")
+	fs.StringVar(&c.UI.Layout, "layout", c.UI.Layout, "panels of the terminal UI, as rows of columns of panels with weights, e.g. \"Traffic*2: traffic, config; Alerts*3: alerts, history+slos\"")
+	fs.StringVar(&c.UI.CompactLayout, "compact-layout", c.UI.CompactLayout, "panels of the terminal UI on small terminals, where the rows with the same name form a tab")
+	fs.StringVar(&c.UI.Theme, "theme", c.UI.Theme, "colours of the terminal UI: default, high-contrast, monochrome or a theme of the config file")
+	fs.Var(subscriberFlags{&c.Subscribers}, "subscriber", "buffer and overflow policy (block, drop-oldest or drop-newest) of a hub subscriber, e.g. stats/ui=10:drop-oldest (repeatable)")
+	fs.Var(newDefinitionFlags(&c.Alerts.SLOs, func(v string) error {
+		_, err := logmon.ParseSLO(v)
+		return err
+	}), "slo", "availability SLO as name:target:period, e.g. availability:99.9:720h (repeatable)")
 
-	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: %s [OPTIONS]\n\n", os.Args[0])
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [OPTIONS]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s silence add|list|expire [OPTIONS] [ID]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s config check [FILE]\n\n", os.Args[0])
 		fmt.Fprintln(os.Stderr, "OPTIONS:")
-		flag.PrintDefaults()
+		fs.PrintDefaults()
+		fmt.Fprintln(os.Stderr, "\nEvery option can be set with an env var too, e.g. LOGMON_THRESHOLD=20 for -threshold.")
+		fmt.Fprintln(os.Stderr, "On SIGHUP, the config file is reloaded and applied without losing the traffic stats and open alerts.")
+	}
+}
+
+// envName is the env var of a flag, e.g. LOGMON_CLIENT_RATE for -client-rate.
+func envName(flagName string) string {
+	return "LOGMON_" + strings.ToUpper(strings.Replace(flagName, "-", "_", -1))
+}
+
+// setFromEnv sets the flags of a set with an env var. The command line flags are parsed afterwards, to override them.
+func setFromEnv(fs *flag.FlagSet) error {
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if value, ok := os.LookupEnv(envName(f.Name)); ok && err == nil {
+			if setErr := fs.Set(f.Name, value); setErr != nil {
+				err = fmt.Errorf("invalid value %q for env var %s: %w", value, envName(f.Name), setErr)
+			}
+		}
+	})
+	return err
+}
+
+// findConfigPath returns the config file given with -config, or else with the LOGMON_CONFIG env var.
+// The file is loaded before the flags are parsed, for them to override its values.
+func findConfigPath(args []string) string {
+	for i, arg := range args {
+		switch {
+		case arg == "-config" || arg == "--config":
+			if i+1 < len(args) {
+				return args[i+1]
+			}
+		case strings.HasPrefix(arg, "-config="), strings.HasPrefix(arg, "--config="):
+			return arg[strings.Index(arg, "=")+1:]
+		}
+	}
+	return os.Getenv(envName("config"))
+}
+
+// addNotifiers adds the notifiers set up with command line flags to the ones of the config file.
+func addNotifiers(c *logmon.Config, a arguments) {
+	if a.webhookURL != "" {
+		retries := a.webhookRetries
+		c.Notifiers = append(c.Notifiers, logmon.NotifierConfig{
+			Type:     logmon.WebhookNotifier,
+			URL:      a.webhookURL,
+			Retries:  &retries,
+			Template: a.webhookTemplate,
+			Key:      a.webhookKey,
+		})
+	}
+	if a.execCommand != "" {
+		c.Notifiers = append(c.Notifiers, logmon.NotifierConfig{Type: logmon.ExecNotifier, Command: a.execCommand})
+	}
+	if a.smtpAddr != "" {
+		// Without -smtp-to, the notifier has no recipient and is reported as invalid.
+		var to []string
+		if a.smtpTo != "" {
+			to = strings.Split(a.smtpTo, ",")
+		}
+		c.Notifiers = append(c.Notifiers, logmon.NotifierConfig{
+			Type: logmon.SMTPNotifier,
+			Addr: a.smtpAddr,
+			From: a.smtpFrom,
+			To:   to,
+			User: a.smtpUser,
+		})
 	}
 }
 
+// loadConfig returns the configuration of the monitor: the defaults, overridden by the config file if any,
+// then by the env vars, then by the command line flags.
+func loadConfig(path string, args []string, handling flag.ErrorHandling) (logmon.Config, arguments, error) {
+	config := logmon.DefaultConfig()
+	if path != "" {
+		var err error
+		config, err = logmon.LoadConfig(path)
+		if err != nil {
+			return logmon.Config{}, arguments{}, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	a := arguments{configPath: path}
+	fs := flag.NewFlagSet(os.Args[0], handling)
+	setArguments(fs, &config, &a)
+	if err := setFromEnv(fs); err != nil {
+		return logmon.Config{}, arguments{}, err
+	}
+	if err := fs.Parse(args); err != nil {
+		return logmon.Config{}, arguments{}, err
+	}
+	addNotifiers(&config, a)
+	return config, a, nil
+}
+
 func main() {
 	logFile := setLogger()
 	if logFile != nil {
 		defer logFile.Close()
 	}
 
-	setArguments()
-	flag.Parse()
+	if len(os.Args) > 1 && os.Args[1] == "silence" {
+		os.Exit(runSilence(os.Args[2:]))
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		os.Exit(runConfig(os.Args[2:]))
+	}
+
+	config, args, err := loadConfig(findConfigPath(os.Args[1:]), os.Args[1:], flag.ExitOnError)
+	if err != nil {
+		fmt.Printf("error: %v\n", err)
+		os.Exit(2)
+	}
+
+	opts, err := config.MonitorOpts()
+	if err != nil {
+		fmt.Printf("error: %v\n", err)
+		os.Exit(2)
+	}
 
-	opts := logmon.MonitorOpts{
-		LogFilePath:     logFilePath,
-		RefreshInterval: refreshInterval,
-		AlertThreshold:  alertThreshold,
-		AlertWindow:     alertWindow,
+	if config.History != "" {
+		opts.History, err = logmon.LoadAlertHistory(config.History)
+		if err != nil {
+			fmt.Printf("error: %v\n", err)
+			os.Exit(1)
+		}
 	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if args.configPath != "" {
+		reloads := make(chan logmon.ConfigReload)
+		go watchConfig(ctx, args, reloads)
+		opts.Reloads = reloads
+	}
+
 	monitor := logmon.NewMonitor(opts)
 
 	// UI loops until an interrupt signal is captured.
-	err := monitor.Run(context.Background())
+	err = monitor.Run(ctx)
+	cancel()
 	if err != nil {
 		fmt.Printf("error: %v\n", err)
 		os.Exit(1)
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	logmon "github.com/jjrumi/accesslogmonitor/pkg"
+)
+
+// runSilence manages the silences of a monitor with the add, list and expire commands.
+// The silences file is the one of the monitor: the default, overridden by the config file, then by the env var,
+// then by the -silences flag. It returns the exit code.
+func runSilence(args []string) int {
+	config := logmon.DefaultConfig()
+	configPath := findConfigPath(args)
+	if configPath != "" {
+		var err error
+		config, err = logmon.LoadConfig(configPath)
+		if err != nil {
+			fmt.Printf("error: %s: %v\n", configPath, err)
+			return 2
+		}
+	}
+
+	fs := flag.NewFlagSet("silence", flag.ExitOnError)
+	fs.String("config", configPath, "YAML config file of the monitor, to read the silences file from (env: LOGMON_CONFIG)")
+	path := fs.String("silences", config.Silences.Path, "file to keep the silences into")
+	match := fs.String("match", "", "alerts to silence as label=pattern pairs, e.g. kind=abuse,name=10.0.0.* (labels: kind, name, id)")
+	duration := fs.Duration("for", time.Hour, "duration of the silence")
+	comment := fs.String("comment", "", "reason of the silence")
+	all := fs.Bool("all", false, "list the expired silences too")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s silence add|list|expire [OPTIONS] [ID]\n\n", os.Args[0])
+		fmt.Fprintln(os.Stderr, "OPTIONS:")
+		fs.PrintDefaults()
+	}
+
+	if len(args) < 1 {
+		fs.Usage()
+		return 2
+	}
+	command := args[0]
+	if err := setFromEnv(fs); err != nil {
+		fmt.Printf("error: %v\n", err)
+		return 2
+	}
+	_ = fs.Parse(args[1:])
+	if *path == "" {
+		fmt.Println("error: the silences are disabled: no -silences file")
+		return 2
+	}
+	store := logmon.NewSilenceStore(*path)
+
+	switch command {
+	case "add":
+		matchers, err := logmon.ParseMatchers(*match)
+		if err != nil || *duration <= 0 {
+			fmt.Printf("error: a -match and a positive -for are required: %v\n", err)
+			return 2
+		}
+
+		silence := logmon.NewSilence(matchers, *duration, *comment)
+		if err := store.Add(silence); err != nil {
+			fmt.Printf("error: %v\n", err)
+			return 1
+		}
+		fmt.Println(silence.ID)
+	case "list":
+		silences, err := store.Load()
+		if err != nil {
+			fmt.Printf("error: %v\n", err)
+			return 1
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tMATCHERS\tEXPIRES\tCOMMENT")
+		for _, s := range silences {
+			if *all || s.Active(time.Now()) {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", s.ID, s.Matchers, s.Expires.Format(time.RFC3339), s.Comment)
+			}
+		}
+		w.Flush()
+	case "expire":
+		if fs.NArg() != 1 {
+			fs.Usage()
+			return 2
+		}
+		if err := store.Expire(fs.Arg(0)); err != nil {
+			fmt.Printf("error: %v\n", err)
+			return 1
+		}
+	default:
+		fs.Usage()
+		return 2
+	}
+	return 0
+}
@@ -11,4 +11,5 @@ require (
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/stretchr/testify v1.2.2
 	golang.org/x/sys v0.0.0-20200427175716-29b57079015a // indirect
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -3,31 +3,167 @@ package logmon
 import (
 	"container/list"
 	"context"
+	"fmt"
 	"log"
+	"strings"
 	"time"
 )
 
+// AlertKind identifies the condition that triggered an alert.
+type AlertKind int
+
+const (
+	HighTraffic AlertKind = iota // Average traffic above the threshold.
+	LowTraffic                   // Average traffic below the floor.
+	NoData                       // No log lines received for a while: the source might be dead.
+	Anomaly                      // Traffic deviates from the learnt baseline.
+	Spike                        // Sudden jump or drop of the traffic against the preceding window.
+	BurnRate                     // An SLO error budget is being consumed too fast.
+	Abuse                        // A single client sends too many requests or errors.
+)
+
+// abuseMinRequests is the number of requests a client needs before checking its ratio of errors.
+const abuseMinRequests = 10
+
+// String returns a human readable name of the alert kind.
+func (k AlertKind) String() string {
+	switch k {
+	case HighTraffic:
+		return "high traffic"
+	case LowTraffic:
+		return "low traffic"
+	case NoData:
+		return "no data"
+	case Anomaly:
+		return "anomaly"
+	case Spike:
+		return "spike"
+	case BurnRate:
+		return "burn rate"
+	case Abuse:
+		return "abuse"
+	}
+	return "unknown"
+}
+
+// MarshalText encodes the alert kind as its name in snake case, e.g. "high_traffic".
+func (k AlertKind) MarshalText() ([]byte, error) {
+	return []byte(strings.ReplaceAll(k.String(), " ", "_")), nil
+}
+
+// UnmarshalText decodes an alert kind encoded by MarshalText.
+func (k *AlertKind) UnmarshalText(text []byte) error {
+	for kind := HighTraffic; kind <= Abuse; kind++ {
+		if name, _ := kind.MarshalText(); string(name) == string(text) {
+			*k = kind
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown alert kind %q", text)
+}
+
 // ThresholdAlert defines an alert.
 type ThresholdAlert struct {
-	Open bool // true: Unresolved alert; false: Recovered alert.
-	Hits float64
-	Time time.Time
+	Kind      AlertKind `json:"kind"`
+	Name      string    `json:"name,omitempty"` // Tells apart alerts of the same kind, e.g. the offending client of an abuse alert.
+	Open      bool      `json:"open"`           // true: Unresolved alert; false: Recovered alert.
+	Hits      float64   `json:"hits"`
+	Idle      int       `json:"idle,omitempty"`      // Seconds without receiving log lines.
+	Expected  float64   `json:"expected,omitempty"`  // Expected traffic, in requests per second (anomaly and spike alerts only).
+	Deviation float64   `json:"deviation,omitempty"` // Distance to the baseline, in standard deviations (anomaly alerts only).
+	Change    float64   `json:"change,omitempty"`    // Relative change against the preceding window, in percent (spike alerts only).
+	Burn      float64   `json:"burn,omitempty"`      // Error budget burn rate on the long window (burn rate alerts only).
+	Budget    float64   `json:"budget,omitempty"`    // Ratio of the error budget left (burn rate alerts only).
+	Errors    float64   `json:"errors,omitempty"`    // Ratio of 4xx and 5xx responses of the client (abuse alerts only).
+	Silenced  bool      `json:"silenced,omitempty"`  // Matched by a silence or a maintenance window: not notified.
+	Time      time.Time `json:"time"`
+}
+
+// ID identifies the condition of the alert: an open alert and its recovery share the same ID.
+func (a ThresholdAlert) ID() string {
+	if a.Name == "" {
+		return a.Kind.String()
+	}
+	return a.Kind.String() + "/" + a.Name
+}
+
+// Summary describes the alert in plain text.
+func (a ThresholdAlert) Summary() string {
+	var detail string
+	switch a.Kind {
+	case NoData:
+		detail = fmt.Sprintf("no log lines received for %ds", a.Idle)
+	case Anomaly:
+		detail = fmt.Sprintf("hits = %.2f req/s, expected = %.2f req/s (%+.1f sigma)", a.Hits, a.Expected, a.Deviation)
+	case Spike:
+		detail = fmt.Sprintf("hits = %.2f req/s, previously = %.2f req/s (%+.0f%%)", a.Hits, a.Expected, a.Change)
+	case BurnRate:
+		detail = fmt.Sprintf("burn rate = %.1fx, budget left = %.1f%%", a.Burn, a.Budget*100)
+	case Abuse:
+		detail = fmt.Sprintf("hits = %.2f req/s, errors = %.0f%%", a.Hits, a.Errors*100)
+	default:
+		detail = fmt.Sprintf("hits = %.2f req/s", a.Hits)
+	}
+
+	state := "triggered"
+	if !a.Open {
+		state = "recovered"
+	}
+	return fmt.Sprintf("%s alert %s - %s", a.ID(), state, detail)
 }
 
 // AlertSupervisor consumes traffic stats and produces alerts.
+// Its rules can be reconfigured while it runs.
 type AlertSupervisor interface {
 	Run(ctx context.Context, stats <-chan TrafficStats, alerts chan<- ThresholdAlert)
+	Reconfigure(opts AlertSupervisorOpts)
 }
 
 // NewAlertsSupervisor creates an AlertSupervisor.
 func NewAlertsSupervisor(opts AlertSupervisorOpts) AlertSupervisor {
-	return &alertSupervisor{
+	a := newAlertSupervisor(opts)
+	a.pending = newPendingOpts()
+	return a
+}
+
+func newAlertSupervisor(opts AlertSupervisorOpts) *alertSupervisor {
+	var anomaly *anomalyDetector
+	if opts.AnomalySigmas > 0 {
+		anomaly = newAnomalyDetector(opts.AnomalySigmas, opts.AnomalyAlpha, opts.RefreshInterval, opts.AnomalySeasonal)
+	}
+
+	spikeIntervals := opts.SpikeWindow / opts.RefreshInterval
+	if spikeIntervals < 1 {
+		spikeIntervals = 1
+	}
+
+	a := &alertSupervisor{
 		statsBuffer: list.New(),
 		capacity:    opts.AlertWindow / opts.RefreshInterval, // Store as many stats as intervals fit in the monitoring window.
-		ongoing:     false,
+		ongoing:     make(map[string]bool),
 		threshold:   opts.AlertThreshold,
+		floor:       opts.AlertFloor,
+		noData:      opts.NoDataTimeout,
+		interval:    opts.RefreshInterval,
 		window:      opts.AlertWindow,
+		anomaly:     anomaly,
+		spike:       opts.SpikePercent,
+		spikeLen:    spikeIntervals,
+		clientRate:  opts.ClientRate,
+		clientErrs:  opts.ClientErrors,
+		offenders:   make(map[string]bool),
+		restored:    make(map[string]bool),
 	}
+
+	for _, alert := range opts.OpenAlerts {
+		a.ongoing[alert.ID()] = true
+		a.restored[alert.ID()] = true
+		if alert.Kind == Abuse {
+			a.offenders[alert.Name] = true
+		}
+	}
+
+	return a
 }
 
 // AlertSupervisorOpts defines the options required to build an AlertSupervisor.
@@ -35,21 +171,45 @@ type AlertSupervisorOpts struct {
 	AlertThreshold  int
 	RefreshInterval int
 	AlertWindow     int
+	AlertFloor      int              // Low traffic condition, in requests per second. Zero disables it.
+	NoDataTimeout   int              // Seconds without log lines before raising a no data alert. Zero disables it.
+	AnomalySigmas   float64          // Deviation from the baseline, in standard deviations, to raise an anomaly alert. Zero disables it.
+	AnomalyAlpha    float64          // Weight of the latest interval in the baseline, between 0 and 1.
+	AnomalySeasonal bool             // Learn a different baseline for every hour of the day.
+	SpikePercent    int              // Relative change against the preceding window, in percent, to raise a spike alert. Zero disables it.
+	SpikeWindow     int              // Most recent period compared against the preceding window, in seconds.
+	ClientRate      int              // Requests per second of a single client to raise an abuse alert. Zero disables it.
+	ClientErrors    int              // Ratio of 4xx and 5xx responses of a single client, in percent, to raise an abuse alert. Zero disables it.
+	OpenAlerts      []ThresholdAlert // Alerts left open by a previous run, e.g. from the alert history.
 }
 
 // alertSupervisor implements the AlertSupervisor interface.
 // It stores the traffic stats of a monitoring window in a linked-list.
 type alertSupervisor struct {
-	statsBuffer  *list.List // Buffer to store all the stats within the alert window.
-	capacity     int        // Number of stats to store.
-	ongoing      bool       // Is the alert active?
-	reqsInWindow int        // Counter for requests within the alert window.
-	threshold    int        // ThresholdAlert condition, in requests per second.
-	window       int        // Alert window, in seconds.
+	statsBuffer  *list.List       // Buffer to store all the stats within the alert window.
+	capacity     int              // Number of stats to store.
+	ongoing      map[string]bool  // Which alerts are active? By alert ID.
+	reqsInWindow int              // Counter for requests within the alert window.
+	idle         int              // Seconds since the sources last read a log line.
+	threshold    int              // ThresholdAlert condition, in requests per second.
+	floor        int              // Low traffic condition, in requests per second.
+	noData       int              // No data condition, in seconds.
+	interval     int              // Refresh interval, in seconds.
+	window       int              // Alert window, in seconds.
+	anomaly      *anomalyDetector // Baseline of the traffic. Nil when anomalies are not tracked.
+	spike        int              // Spike condition, in percent.
+	spikeLen     int              // Number of recent stats compared against the rest of the buffer.
+	clientRate   int              // Abuse condition, in requests per second of a client.
+	clientErrs   int              // Abuse condition, in percent of errors of a client.
+	offenders    map[string]bool  // Clients with an open abuse alert.
+	restored     map[string]bool  // Alerts left open by a previous run. Unless their rule is gone, they cannot recover until the window is full.
+	pending      *pendingOpts     // Options set by Reconfigure, applied by Run.
 }
 
 // Run consumes traffic stats and produces alerts.
 func (a *alertSupervisor) Run(ctx context.Context, stats <-chan TrafficStats, alerts chan<- ThresholdAlert) {
+	a.resolveDisabled(a, alerts) // Alerts restored for rules disabled since the previous run.
+
 LOOP:
 	for {
 		select {
@@ -59,6 +219,10 @@ LOOP:
 			}
 
 			a.trackAlerts(s, alerts)
+		case <-a.pending.ready:
+			if opts, ok := a.pending.take().(AlertSupervisorOpts); ok {
+				a.reconfigure(opts, alerts)
+			}
 		case <-ctx.Done():
 			break LOOP
 		}
@@ -68,10 +232,92 @@ LOOP:
 	close(alerts)
 }
 
+// Reconfigure replaces the alert rules. They apply from the next traffic stats on.
+// The open alerts of the rules removed are recovered; the other ones are kept open. See reconfigure.
+func (a *alertSupervisor) Reconfigure(opts AlertSupervisorOpts) {
+	a.pending.set(opts)
+}
+
+// reconfigure replaces the alert rules, keeping as much of the state of the unchanged ones as they can reuse.
+// With the same refresh interval, the stats buffered are kept up to the new window, and the anomaly baseline is kept
+// unless its weight changes. Otherwise, they start over.
+// The alerts still open cannot recover until the window is full again, as the alerts restored on startup:
+// otherwise, a window shorter than the one they were raised on would recover them spuriously.
+// OpenAlerts of the options are ignored.
+func (a *alertSupervisor) reconfigure(opts AlertSupervisorOpts, alerts chan<- ThresholdAlert) {
+	opts.OpenAlerts = nil
+	next := newAlertSupervisor(opts)
+	next.pending = a.pending
+
+	a.resolveDisabled(next, alerts)
+
+	if next.interval == a.interval {
+		for a.statsBuffer.Len() > next.capacity {
+			oldStat := a.statsBuffer.Remove(a.statsBuffer.Back())
+			a.reqsInWindow -= oldStat.(TrafficStats).TotalReqs
+		}
+		next.statsBuffer, next.reqsInWindow = a.statsBuffer, a.reqsInWindow
+
+		if a.anomaly != nil && next.anomaly != nil && a.anomaly.sameBaselines(next.anomaly) {
+			next.anomaly.baselines = a.anomaly.baselines
+		}
+	}
+	next.idle = a.idle
+
+	for id := range a.ongoing {
+		next.ongoing[id] = true
+		if next.statsBuffer.Len() < next.capacity {
+			next.restored[id] = true
+		}
+	}
+	for client := range a.offenders {
+		next.offenders[client] = true
+	}
+
+	*a = *next
+	log.Printf("alert supervisor reconfigured: %d alerts kept open", len(a.ongoing))
+}
+
+// resolveDisabled recovers the open alerts of the rules disabled in the given rules.
+func (a *alertSupervisor) resolveDisabled(rules *alertSupervisor, alerts chan<- ThresholdAlert) {
+	if rules.floor == 0 {
+		a.resolve(ThresholdAlert{Kind: LowTraffic}, alerts)
+	}
+	if rules.noData == 0 {
+		a.resolve(ThresholdAlert{Kind: NoData}, alerts)
+	}
+	if rules.anomaly == nil {
+		a.resolve(ThresholdAlert{Kind: Anomaly}, alerts)
+	}
+	if rules.spike == 0 {
+		a.resolve(ThresholdAlert{Kind: Spike}, alerts)
+	}
+	if rules.clientRate == 0 && rules.clientErrs == 0 {
+		for client := range a.offenders {
+			a.resolve(ThresholdAlert{Kind: Abuse, Name: client}, alerts)
+		}
+	}
+}
+
+// resolve recovers an open alert, regardless of the monitoring window: its rule no longer applies.
+func (a *alertSupervisor) resolve(alert ThresholdAlert, alerts chan<- ThresholdAlert) {
+	if !a.ongoing[alert.ID()] {
+		return
+	}
+	delete(a.restored, alert.ID())
+	if alert.Kind == Abuse {
+		delete(a.offenders, alert.Name)
+	}
+	a.toggle(false, alert, alerts)
+}
+
 // trackAlerts updates the storage of stats for the current monitoring window.
 // It adds new stats to the front of the list.
 // It removes old stats from the back of the list.
 // Alert threshold is checked against a pre-calculated value, updated on every new traffic stats.
+// Low traffic is only checked once the monitoring window is full, so a fresh start does not raise it.
+// The time since the sources last read a line tells a silent source apart from a low traffic one, even if the lines
+// are all unparsable or filtered out. Without it, the intervals without requests are accumulated instead.
 func (a *alertSupervisor) trackAlerts(s TrafficStats, alerts chan<- ThresholdAlert) {
 	// Keep track of the stats within the alert window:
 	a.statsBuffer.PushFront(s)
@@ -84,22 +330,172 @@ func (a *alertSupervisor) trackAlerts(s TrafficStats, alerts chan<- ThresholdAle
 		a.reqsInWindow -= oldStat.(TrafficStats).TotalReqs
 	}
 
-	// Check alert condition:
+	// Keep track of the time without log lines:
+	switch {
+	case !s.LastRead.IsZero():
+		a.idle = 0
+		if idle := s.Time.Sub(s.LastRead); idle > 0 {
+			a.idle = int(idle / time.Second)
+		}
+	case s.TotalReqs == 0:
+		a.idle += a.interval
+	default:
+		a.idle = 0
+	}
+
+	// Check alert conditions:
 	reqsPerSec := float64(a.reqsInWindow) / float64(a.window)
 
-	if a.ongoing {
-		if reqsPerSec <= float64(a.threshold) {
-			a.ongoing = false
-			alert := ThresholdAlert{Open: false, Hits: reqsPerSec, Time: time.Now()}
-			log.Printf("close ongoing alert: %v", alert)
-			alerts <- alert
+	a.toggle(reqsPerSec > float64(a.threshold), ThresholdAlert{Kind: HighTraffic, Hits: reqsPerSec}, alerts)
+
+	if a.floor > 0 && a.statsBuffer.Len() >= a.capacity {
+		a.toggle(reqsPerSec < float64(a.floor), ThresholdAlert{Kind: LowTraffic, Hits: reqsPerSec}, alerts)
+	}
+
+	if a.noData > 0 {
+		a.toggle(a.idle >= a.noData, ThresholdAlert{Kind: NoData, Hits: reqsPerSec, Idle: a.idle}, alerts)
+	}
+
+	if a.anomaly != nil {
+		rate := float64(s.TotalReqs) / float64(a.interval)
+		expected, deviation, ready := a.anomaly.observe(rate, s.Time)
+		if ready {
+			alert := ThresholdAlert{Kind: Anomaly, Hits: rate, Expected: expected, Deviation: deviation}
+			a.toggle(a.anomaly.anomalous(deviation), alert, alerts)
 		}
-	} else {
-		if reqsPerSec > float64(a.threshold) {
-			a.ongoing = true
-			alert := ThresholdAlert{Open: true, Hits: reqsPerSec, Time: time.Now()}
-			log.Printf("create alert: %v", alert)
-			alerts <- alert
+	}
+
+	if a.spike > 0 {
+		if recent, previous, ok := a.spikeRates(); ok && previous > 0 {
+			change := (recent - previous) / previous * 100
+			alert := ThresholdAlert{Kind: Spike, Hits: recent, Expected: previous, Change: change}
+			a.toggle(a.spiked(recent, previous), alert, alerts)
+		} else if ok {
+			// Without traffic in the preceding window, the change is undefined: a jump from nothing is left to the
+			// no data alert, and an open spike recovers.
+			a.toggle(false, ThresholdAlert{Kind: Spike, Hits: recent}, alerts)
+		}
+	}
+
+	a.trackBurnRates(s, reqsPerSec, alerts)
+
+	if a.clientRate > 0 || a.clientErrs > 0 {
+		a.trackOffenders(s, alerts)
+	}
+}
+
+// trackBurnRates checks the burn rate conditions of the SLOs accounted by the TrafficSupervisor.
+// The alerts of the SLOs no longer accounted, e.g. removed by a config reload or since the previous run, are recovered.
+func (a *alertSupervisor) trackBurnRates(s TrafficStats, reqsPerSec float64, alerts chan<- ThresholdAlert) {
+	tracked := make(map[string]bool)
+	for _, slo := range s.SLOs {
+		for _, b := range slo.BurnRates {
+			alert := ThresholdAlert{
+				Kind:   BurnRate,
+				Name:   slo.SLO.Name + " " + b.Window.String(),
+				Hits:   reqsPerSec,
+				Burn:   b.Long,
+				Budget: slo.Budget,
+			}
+			tracked[alert.Name] = true
+			a.toggle(b.Burning(), alert, alerts)
+		}
+	}
+
+	prefix := BurnRate.String() + "/"
+	for id := range a.ongoing {
+		if name := strings.TrimPrefix(id, prefix); name != id && !tracked[name] {
+			a.resolve(ThresholdAlert{Kind: BurnRate, Name: name, Hits: reqsPerSec}, alerts)
 		}
 	}
 }
+
+// trackOffenders checks the abuse condition on the clients of the interval.
+// Only the guaranteed requests of a client are considered, so it is never blamed for an overestimation.
+// Offenders that no longer meet the condition, or are no longer among the clients of the interval, are recovered.
+func (a *alertSupervisor) trackOffenders(s TrafficStats, alerts chan<- ThresholdAlert) {
+	seen := make(map[string]bool)
+	for _, c := range s.Clients {
+		seen[c.Client] = true
+		hits := c.Hits - c.Error
+		rate := float64(hits) / float64(a.interval)
+		errors := float64(c.Errors) / float64(c.Hits)
+		alert := ThresholdAlert{Kind: Abuse, Name: c.Client, Hits: rate, Errors: errors}
+
+		abusive := a.clientRate > 0 && rate > float64(a.clientRate)
+		if a.clientErrs > 0 && hits >= abuseMinRequests && errors*100 > float64(a.clientErrs) {
+			abusive = true
+		}
+		if abusive {
+			a.offenders[c.Client] = true
+			a.toggle(true, alert, alerts)
+		} else if a.offenders[c.Client] && a.toggle(false, alert, alerts) {
+			delete(a.offenders, c.Client)
+		}
+	}
+
+	for client := range a.offenders {
+		if !seen[client] && a.toggle(false, ThresholdAlert{Kind: Abuse, Name: client}, alerts) {
+			delete(a.offenders, client)
+		}
+	}
+}
+
+// spikeRates splits the buffer into the most recent stats and the preceding ones.
+// It returns the req/s of both periods.
+// It is not ok until both periods have stats. The relative change is undefined if the preceding one has no traffic.
+func (a *alertSupervisor) spikeRates() (recent float64, previous float64, ok bool) {
+	if a.statsBuffer.Len() <= a.spikeLen {
+		return 0, 0, false
+	}
+
+	var recentReqs, previousReqs int
+	i := 0
+	for e := a.statsBuffer.Front(); e != nil; e = e.Next() {
+		if i < a.spikeLen {
+			recentReqs += e.Value.(TrafficStats).TotalReqs
+		} else {
+			previousReqs += e.Value.(TrafficStats).TotalReqs
+		}
+		i++
+	}
+
+	recent = float64(recentReqs) / float64(a.spikeLen*a.interval)
+	previous = float64(previousReqs) / float64((i-a.spikeLen)*a.interval)
+	return recent, previous, true
+}
+
+// spiked tells whether the change between both rates exceeds the spike condition.
+// Jumps and drops are symmetric: +300% is a 4x increase, so a 4x decrease (-75%) is a drop.
+func (a *alertSupervisor) spiked(recent float64, previous float64) bool {
+	factor := 1 + float64(a.spike)/100
+	return recent >= previous*factor || recent*factor <= previous
+}
+
+// toggle produces the given alert when its condition changes its state. It tells whether it did.
+// Alerts restored from a previous run are not recovered until the monitoring window is full again:
+// otherwise, the partial window right after a restart would recover them spuriously.
+func (a *alertSupervisor) toggle(breached bool, alert ThresholdAlert, alerts chan<- ThresholdAlert) bool {
+	if a.ongoing[alert.ID()] == breached {
+		return false
+	}
+	if !breached && a.restored[alert.ID()] && a.statsBuffer.Len() < a.capacity {
+		return false
+	}
+	delete(a.restored, alert.ID())
+
+	if breached {
+		a.ongoing[alert.ID()] = true
+	} else {
+		delete(a.ongoing, alert.ID())
+	}
+	alert.Open = breached
+	alert.Time = time.Now()
+	if breached {
+		log.Printf("create alert: %v", alert)
+	} else {
+		log.Printf("close ongoing alert: %v", alert)
+	}
+	alerts <- alert
+	return true
+}
@@ -2,7 +2,10 @@ package logmon_test
 
 import (
 	"context"
+	"encoding/json"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
@@ -67,6 +70,34 @@ func TestAlertSupervisor_AlertsWithHighTraffic(t *testing.T) {
 // | | | | | | | | | | | | | | | | | | | | |
 // |----------------------------------------->t
 //             ^- Alert!         ^- Recover!
+func TestAlertSupervisor_NoDataIsBasedOnTheLinesRead(t *testing.T) {
+	// Stats without requests, but with lines read, e.g. unparsable or filtered out:
+	now := time.Now()
+	stats := make(chan logmon.TrafficStats, 3)
+	stats <- logmon.TrafficStats{Time: now, LastRead: now.Add(-5 * time.Second)}
+	stats <- logmon.TrafficStats{Time: now.Add(10 * time.Second), LastRead: now.Add(8 * time.Second)}
+	stats <- logmon.TrafficStats{Time: now.Add(20 * time.Second), LastRead: now.Add(-5 * time.Second)} // Silent source.
+	close(stats)
+
+	manager := logmon.NewAlertsSupervisor(logmon.AlertSupervisorOpts{
+		AlertThreshold:  10, // req/s
+		RefreshInterval: 10, // seconds
+		AlertWindow:     30, // seconds
+		NoDataTimeout:   20, // seconds
+	})
+	alerts := make(chan logmon.ThresholdAlert, 2)
+	manager.Run(context.Background(), stats, alerts)
+
+	a, ok := <-alerts
+	require.True(t, ok, "alerts channel should be open")
+	require.Equal(t, logmon.NoData, a.Kind, "no data alert expected")
+	require.Equal(t, 25, a.Idle, "alert after 25s without lines read")
+	require.True(t, a.Open, "alert is open")
+
+	a, ok = <-alerts
+	require.False(t, ok, "a single alert expected, got:", a)
+}
+
 func TestAlertSupervisor_AlertsAreRecovered(t *testing.T) {
 	// Fill up stats channel with stats that force an alert:
 	numWindows := 4
@@ -122,6 +153,442 @@ func TestAlertSupervisor_ContextCancellationEndsTheSupervisor(t *testing.T) {
 	require.False(t, ok, "alerts channel should be closed")
 }
 
+func TestAlertSupervisor_AlertsWithLowTraffic(t *testing.T) {
+	// Fill up stats channel with stats that force a low traffic alert:
+	numWindows := 2
+	numEntries := 5
+	stats := make(chan logmon.TrafficStats, numWindows*numEntries)
+	sendStats(stats, logmon.TrafficStats{TotalReqs: 1}, numEntries) // Simulate 1 req/s - low traffic
+	sendStats(stats, logmon.TrafficStats{TotalReqs: 5}, numEntries) // Simulate 5 req/s - recovered
+	close(stats)
+
+	// Run alert supervisor:
+	manager := logmon.NewAlertsSupervisor(logmon.AlertSupervisorOpts{
+		AlertThreshold:  10, // req/s
+		RefreshInterval: 1,  // seconds
+		AlertWindow:     5,  // seconds
+		AlertFloor:      2,  // req/s
+	})
+	alerts := make(chan logmon.ThresholdAlert, 2)
+	manager.Run(context.Background(), stats, alerts)
+
+	// The alert is only raised once the window is full:
+	a, ok := <-alerts
+	require.True(t, ok, "alerts channel should be open")
+	require.Equal(t, logmon.LowTraffic, a.Kind, "low traffic alert expected")
+	require.Equal(t, 1.0, a.Hits, "alert for 1 req/s expected")
+	require.True(t, a.Open, "alert is open")
+
+	// 2.6 req/s expected => 3 x 1req + 2 x 5req = 13req over a 5s window ==> 13/5 = 2.6
+	a, ok = <-alerts
+	require.True(t, ok, "alerts channel should be open")
+	require.Equal(t, logmon.LowTraffic, a.Kind, "low traffic alert expected")
+	require.Equal(t, 2.6, a.Hits, "alert recovered when hits are above the floor")
+	require.False(t, a.Open, "alert is recovered")
+
+	a, ok = <-alerts
+	require.False(t, ok, "alerts channel should be closed, got:", a)
+}
+
+func TestAlertSupervisor_AlertsWithoutData(t *testing.T) {
+	// Fill up stats channel with stats that force a no data alert:
+	numWindows := 3
+	numEntries := 3
+	stats := make(chan logmon.TrafficStats, numWindows*numEntries)
+	sendStats(stats, logmon.TrafficStats{TotalReqs: 1}, numEntries) // Simulate traffic
+	sendStats(stats, logmon.TrafficStats{TotalReqs: 0}, numEntries) // Simulate a silent source
+	sendStats(stats, logmon.TrafficStats{TotalReqs: 1}, numEntries) // Simulate traffic again
+	close(stats)
+
+	// Run alert supervisor:
+	manager := logmon.NewAlertsSupervisor(logmon.AlertSupervisorOpts{
+		AlertThreshold:  10, // req/s
+		RefreshInterval: 10, // seconds
+		AlertWindow:     30, // seconds
+		NoDataTimeout:   20, // seconds
+	})
+	alerts := make(chan logmon.ThresholdAlert, 2)
+	manager.Run(context.Background(), stats, alerts)
+
+	a, ok := <-alerts
+	require.True(t, ok, "alerts channel should be open")
+	require.Equal(t, logmon.NoData, a.Kind, "no data alert expected")
+	require.Equal(t, 20, a.Idle, "alert after 20s without log lines")
+	require.True(t, a.Open, "alert is open")
+
+	a, ok = <-alerts
+	require.True(t, ok, "alerts channel should be open")
+	require.Equal(t, logmon.NoData, a.Kind, "no data alert expected")
+	require.Equal(t, 0, a.Idle, "log lines are received again")
+	require.False(t, a.Open, "alert is recovered")
+
+	a, ok = <-alerts
+	require.False(t, ok, "alerts channel should be closed, got:", a)
+}
+
+func TestAlertSupervisor_AlertsOnAnomalies(t *testing.T) {
+	// Fill up stats channel with stats that learn a baseline and then deviate from it:
+	stats := make(chan logmon.TrafficStats, 30)
+	sendStats(stats, logmon.TrafficStats{TotalReqs: 10}, 20) // Simulate 10 req/s - baseline
+	sendStats(stats, logmon.TrafficStats{TotalReqs: 100}, 1) // Simulate 100 req/s - anomaly
+	sendStats(stats, logmon.TrafficStats{TotalReqs: 10}, 1)  // Simulate 10 req/s - recovered
+	close(stats)
+
+	// Run alert supervisor:
+	manager := logmon.NewAlertsSupervisor(logmon.AlertSupervisorOpts{
+		AlertThreshold:  1000, // req/s
+		RefreshInterval: 1,    // seconds
+		AlertWindow:     10,   // seconds
+		AnomalySigmas:   3,
+		AnomalyAlpha:    0.1,
+	})
+	alerts := make(chan logmon.ThresholdAlert, 2)
+	manager.Run(context.Background(), stats, alerts)
+
+	a, ok := <-alerts
+	require.True(t, ok, "alerts channel should be open")
+	require.Equal(t, logmon.Anomaly, a.Kind, "anomaly alert expected")
+	require.Equal(t, 100.0, a.Hits, "alert for 100 req/s expected")
+	require.Equal(t, 10.0, a.Expected, "the learnt baseline is 10 req/s")
+	require.True(t, a.Deviation > 3, "deviation above 3 sigma expected")
+	require.True(t, a.Open, "alert is open")
+
+	a, ok = <-alerts
+	require.True(t, ok, "alerts channel should be open")
+	require.Equal(t, logmon.Anomaly, a.Kind, "anomaly alert expected")
+	require.False(t, a.Open, "alert is recovered")
+
+	a, ok = <-alerts
+	require.False(t, ok, "alerts channel should be closed, got:", a)
+}
+
+func TestAlertSupervisor_AlertsOnSpikes(t *testing.T) {
+	// Fill up stats channel with stats that jump and drop against the preceding window:
+	stats := make(chan logmon.TrafficStats, 10)
+	sendStats(stats, logmon.TrafficStats{TotalReqs: 10}, 5) // Simulate 1 req/s
+	sendStats(stats, logmon.TrafficStats{TotalReqs: 40}, 1) // Simulate 4 req/s - jump of +300%
+	sendStats(stats, logmon.TrafficStats{TotalReqs: 10}, 1) // Simulate 1 req/s - recovered
+	sendStats(stats, logmon.TrafficStats{TotalReqs: 0}, 1)  // Simulate 0 req/s - drop
+	close(stats)
+
+	// Run alert supervisor:
+	manager := logmon.NewAlertsSupervisor(logmon.AlertSupervisorOpts{
+		AlertThreshold:  1000, // req/s
+		RefreshInterval: 10,   // seconds
+		AlertWindow:     60,   // seconds
+		SpikePercent:    300,
+		SpikeWindow:     10, // seconds
+	})
+	alerts := make(chan logmon.ThresholdAlert, 3)
+	manager.Run(context.Background(), stats, alerts)
+
+	a, ok := <-alerts
+	require.True(t, ok, "alerts channel should be open")
+	require.Equal(t, logmon.Spike, a.Kind, "spike alert expected")
+	require.Equal(t, 4.0, a.Hits, "alert for 4 req/s expected")
+	require.Equal(t, 1.0, a.Expected, "the preceding window had 1 req/s")
+	require.Equal(t, 300.0, a.Change, "alert for a +300% change expected")
+	require.True(t, a.Open, "alert is open")
+
+	a, ok = <-alerts
+	require.True(t, ok, "alerts channel should be open")
+	require.Equal(t, logmon.Spike, a.Kind, "spike alert expected")
+	require.False(t, a.Open, "alert is recovered")
+
+	a, ok = <-alerts
+	require.True(t, ok, "alerts channel should be open")
+	require.Equal(t, logmon.Spike, a.Kind, "spike alert expected")
+	require.Equal(t, -100.0, a.Change, "alert for a -100% change expected")
+	require.True(t, a.Open, "alert is open")
+
+	a, ok = <-alerts
+	require.False(t, ok, "alerts channel should be closed, got:", a)
+}
+
+func TestAlertSupervisor_SpikesRecoverWithoutTrafficToCompareWith(t *testing.T) {
+	// Fill up stats channel with a drop, then with no traffic at all:
+	stats := make(chan logmon.TrafficStats, 10)
+	sendStats(stats, logmon.TrafficStats{TotalReqs: 10}, 2) // Simulate 1 req/s
+	sendStats(stats, logmon.TrafficStats{TotalReqs: 0}, 1)  // Simulate 0 req/s - drop
+	sendStats(stats, logmon.TrafficStats{TotalReqs: 0}, 3)  // Simulate 0 req/s on the preceding window too - recovered
+	sendStats(stats, logmon.TrafficStats{TotalReqs: 40}, 1) // Simulate 4 req/s - a jump from nothing is no spike
+	close(stats)
+
+	// Run alert supervisor:
+	manager := logmon.NewAlertsSupervisor(logmon.AlertSupervisorOpts{
+		AlertThreshold:  1000, // req/s
+		RefreshInterval: 10,   // seconds
+		AlertWindow:     30,   // seconds
+		SpikePercent:    300,
+		SpikeWindow:     10, // seconds
+	})
+	alerts := make(chan logmon.ThresholdAlert, 3)
+	manager.Run(context.Background(), stats, alerts)
+
+	a, ok := <-alerts
+	require.True(t, ok, "alerts channel should be open")
+	require.Equal(t, logmon.Spike, a.Kind, "spike alert expected")
+	require.Equal(t, -100.0, a.Change, "alert for a -100% change expected")
+	require.True(t, a.Open, "alert is open")
+
+	a, ok = <-alerts
+	require.True(t, ok, "alerts channel should be open")
+	require.Equal(t, logmon.Spike, a.Kind, "spike alert expected")
+	require.False(t, a.Open, "alert is recovered")
+
+	a, ok = <-alerts
+	require.False(t, ok, "alerts channel should be closed, got:", a)
+}
+
+func TestAlertSupervisor_NoSLOBurnRateAlertsOnShortBlips(t *testing.T) {
+	slo := logmon.SLO{Name: "availability", Target: 0.9, Period: time.Hour}
+	window := logmon.BurnRateWindow{Long: time.Minute, Short: 10 * time.Second, BurnRate: 2}
+
+	// Fill up stats channel with stats that only burn the error budget on the short window:
+	stats := make(chan logmon.TrafficStats, 1)
+	sendStats(stats, logmon.TrafficStats{TotalReqs: 10, SLOs: []logmon.SLOStatus{{
+		SLO:       slo,
+		Budget:    0.9,
+		BurnRates: []logmon.BurnRateStatus{{Window: window, Long: 0.83, Short: 5}},
+	}}}, 1)
+	close(stats)
+
+	// Run alert supervisor:
+	manager := logmon.NewAlertsSupervisor(logmon.AlertSupervisorOpts{
+		AlertThreshold:  1000, // req/s
+		RefreshInterval: 10,   // seconds
+		AlertWindow:     60,   // seconds
+	})
+	alerts := make(chan logmon.ThresholdAlert, 2)
+	manager.Run(context.Background(), stats, alerts)
+
+	a, ok := <-alerts
+	require.False(t, ok, "no alerts expected while the long window is under the burn rate, got:", a)
+}
+
+func TestAlertSupervisor_AlertsOnSLOBurnRateOnBothWindows(t *testing.T) {
+	slo := logmon.SLO{Name: "availability", Target: 0.9, Period: time.Hour}
+	window := logmon.BurnRateWindow{Long: time.Minute, Short: 10 * time.Second, BurnRate: 2.2}
+	burning := func(long float64, short float64) logmon.TrafficStats {
+		return logmon.TrafficStats{TotalReqs: 10, SLOs: []logmon.SLOStatus{{
+			SLO:       slo,
+			Budget:    -1.5,
+			BurnRates: []logmon.BurnRateStatus{{Window: window, Long: long, Short: short}},
+		}}}
+	}
+
+	// Fill up stats channel with stats that burn the error budget and then recover:
+	stats := make(chan logmon.TrafficStats, 3)
+	sendStats(stats, burning(2, 5), 1)   // Burning on the short window only
+	sendStats(stats, burning(2.5, 5), 1) // Burning on both windows
+	sendStats(stats, burning(2.5, 0), 1) // No errors on the short window - recovered
+	close(stats)
+
+	// Run alert supervisor:
+	manager := logmon.NewAlertsSupervisor(logmon.AlertSupervisorOpts{
+		AlertThreshold:  1000, // req/s
+		RefreshInterval: 10,   // seconds
+		AlertWindow:     60,   // seconds
+	})
+	alerts := make(chan logmon.ThresholdAlert, 2)
+	manager.Run(context.Background(), stats, alerts)
+
+	a, ok := <-alerts
+	require.True(t, ok, "alerts channel should be open")
+	require.Equal(t, logmon.BurnRate, a.Kind, "burn rate alert expected")
+	require.Equal(t, "burn rate/availability 1m0s/10s", a.ID(), "alert identifies the SLO and windows")
+	require.Equal(t, 2.5, a.Burn, "burn rate of the long window expected")
+	require.Equal(t, -1.5, a.Budget, "budget of the SLO expected")
+	require.True(t, a.Open, "alert is open")
+
+	a, ok = <-alerts
+	require.True(t, ok, "alerts channel should be open")
+	require.Equal(t, logmon.BurnRate, a.Kind, "burn rate alert expected")
+	require.False(t, a.Open, "alert is recovered")
+
+	a, ok = <-alerts
+	require.False(t, ok, "alerts channel should be closed, got:", a)
+}
+
+func TestAlertSupervisor_RecoversTheBurnRatesOfSLOsNoLongerAccounted(t *testing.T) {
+	slo := logmon.SLO{Name: "availability", Target: 0.9, Period: time.Hour}
+	window := logmon.BurnRateWindow{Long: time.Minute, Short: 10 * time.Second, BurnRate: 2}
+
+	stats := make(chan logmon.TrafficStats, 2)
+	sendStats(stats, logmon.TrafficStats{TotalReqs: 10, SLOs: []logmon.SLOStatus{{
+		SLO:       slo,
+		BurnRates: []logmon.BurnRateStatus{{Window: window, Long: 5, Short: 5}},
+	}}}, 1)
+	sendStats(stats, logmon.TrafficStats{TotalReqs: 10}, 1) // The SLO is removed, e.g. by a config reload
+	close(stats)
+
+	manager := logmon.NewAlertsSupervisor(logmon.AlertSupervisorOpts{
+		AlertThreshold:  1000, // req/s
+		RefreshInterval: 10,   // seconds
+		AlertWindow:     60,   // seconds
+	})
+	alerts := make(chan logmon.ThresholdAlert, 2)
+	manager.Run(context.Background(), stats, alerts)
+
+	a := <-alerts
+	require.True(t, a.Open, "alert is open")
+	a = <-alerts
+	require.Equal(t, "burn rate/availability 1m0s/10s", a.ID())
+	require.False(t, a.Open, "alert is recovered")
+}
+
+func TestAlertSupervisor_AlertsOnAbusiveClients(t *testing.T) {
+	// Fill up stats channel with a client exceeding the rate and another exceeding the ratio of errors:
+	stats := make(chan logmon.TrafficStats, 3)
+	sendStats(stats, logmon.TrafficStats{TotalReqs: 40, Clients: []logmon.ClientHits{
+		{Client: "10.0.0.1", Hits: 30},
+		{Client: "10.0.0.2", Hits: 10, Errors: 8},
+	}}, 1)
+	sendStats(stats, logmon.TrafficStats{TotalReqs: 40, Clients: []logmon.ClientHits{
+		{Client: "10.0.0.1", Hits: 10},
+		{Client: "10.0.0.2", Hits: 15, Errors: 3},
+	}}, 1)
+	close(stats)
+
+	// Run alert supervisor:
+	manager := logmon.NewAlertsSupervisor(logmon.AlertSupervisorOpts{
+		AlertThreshold:  1000, // req/s
+		RefreshInterval: 10,   // seconds
+		AlertWindow:     60,   // seconds
+		ClientRate:      2,    // req/s
+		ClientErrors:    50,   // percent
+	})
+	alerts := make(chan logmon.ThresholdAlert, 4)
+	manager.Run(context.Background(), stats, alerts)
+
+	a := <-alerts
+	require.Equal(t, "abuse/10.0.0.1", a.ID(), "alert names the offender")
+	require.Equal(t, 3.0, a.Hits, "alert for 3 req/s expected")
+	require.True(t, a.Open, "alert is open")
+
+	a = <-alerts
+	require.Equal(t, "abuse/10.0.0.2", a.ID(), "alert names the offender")
+	require.Equal(t, 0.8, a.Errors, "alert for 80% of errors expected")
+	require.True(t, a.Open, "alert is open")
+
+	a = <-alerts
+	require.Equal(t, "abuse/10.0.0.1", a.ID(), "offender is recovered")
+	require.False(t, a.Open, "alert is recovered")
+
+	a = <-alerts
+	require.Equal(t, "abuse/10.0.0.2", a.ID(), "offender is recovered")
+	require.False(t, a.Open, "alert is recovered")
+
+	a, ok := <-alerts
+	require.False(t, ok, "alerts channel should be closed, got:", a)
+}
+
+func TestAlertSupervisor_RestoresOpenAlerts(t *testing.T) {
+	// Fill up stats channel with stats below the threshold:
+	stats := make(chan logmon.TrafficStats, 10)
+	sendStats(stats, logmon.TrafficStats{TotalReqs: 5}, 3) // Partial window after the restart - not recovered yet
+	sendStats(stats, logmon.TrafficStats{TotalReqs: 5}, 1) // Full window - recovered
+	close(stats)
+
+	// Run alert supervisor with an alert left open by a previous run:
+	manager := logmon.NewAlertsSupervisor(logmon.AlertSupervisorOpts{
+		AlertThreshold:  1,  // req/s
+		RefreshInterval: 10, // seconds
+		AlertWindow:     40, // seconds
+		OpenAlerts:      []logmon.ThresholdAlert{{Kind: logmon.HighTraffic, Open: true}},
+	})
+	alerts := make(chan logmon.ThresholdAlert, 2)
+	manager.Run(context.Background(), stats, alerts)
+
+	// The restored alert is not opened again, nor recovered on a partial window:
+	a, ok := <-alerts
+	require.True(t, ok, "alerts channel should be open")
+	require.Equal(t, logmon.HighTraffic, a.Kind, "high traffic alert expected")
+	require.False(t, a.Open, "alert is recovered once the window is full")
+
+	a, ok = <-alerts
+	require.False(t, ok, "alerts channel should be closed, got:", a)
+}
+
+func TestAlertSupervisor_RecoversTheRestoredAlertsOfRulesDisabled(t *testing.T) {
+	stats := make(chan logmon.TrafficStats, 1)
+	sendStats(stats, logmon.TrafficStats{TotalReqs: 50}, 1)
+	close(stats)
+
+	// Run alert supervisor without the rules of the alerts left open by a previous run:
+	manager := logmon.NewAlertsSupervisor(logmon.AlertSupervisorOpts{
+		AlertThreshold:  10, // req/s
+		RefreshInterval: 10, // seconds
+		AlertWindow:     40, // seconds
+		OpenAlerts: []logmon.ThresholdAlert{
+			{Kind: logmon.NoData, Open: true},
+			{Kind: logmon.Abuse, Name: "10.0.0.1", Open: true},
+		},
+	})
+	alerts := make(chan logmon.ThresholdAlert, 3)
+	manager.Run(context.Background(), stats, alerts)
+
+	// The restored alerts are recovered right away, even on a partial window:
+	recovered := make(map[string]bool)
+	for a := range alerts {
+		require.False(t, a.Open, "only recoveries expected, got:", a)
+		recovered[a.ID()] = true
+	}
+	require.Equal(t, map[string]bool{"no data": true, "abuse/10.0.0.1": true}, recovered)
+}
+
+func TestAlertSupervisor_ReconfigureKeepsTheStateOfTheRulesKept(t *testing.T) {
+	// Fill up stats channel with stats that raise a high traffic alert, then a no data alert:
+	stats := make(chan logmon.TrafficStats, 12)
+	sendStats(stats, logmon.TrafficStats{TotalReqs: 30}, 10) // Simulate 3 req/s - new alert
+	sendStats(stats, logmon.TrafficStats{TotalReqs: 0}, 2)   // Simulate 2.4 req/s on the window - no data alert
+
+	opts := logmon.AlertSupervisorOpts{
+		AlertThreshold:  2,   // req/s
+		RefreshInterval: 10,  // seconds
+		AlertWindow:     100, // seconds
+		NoDataTimeout:   20,  // seconds
+	}
+	manager := logmon.NewAlertsSupervisor(opts)
+	alerts := make(chan logmon.ThresholdAlert)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go manager.Run(ctx, stats, alerts)
+
+	for _, kind := range []logmon.AlertKind{logmon.HighTraffic, logmon.NoData} {
+		a := <-alerts
+		require.Equal(t, kind, a.Kind)
+		require.True(t, a.Open, "alert is open")
+	}
+
+	// Disable the no data alerts:
+	opts.NoDataTimeout = 0
+	manager.Reconfigure(opts)
+	a := <-alerts
+	require.Equal(t, logmon.NoData, a.Kind, "the alert of the rule removed is recovered")
+	require.False(t, a.Open, "the alert of the rule removed is recovered")
+
+	// The high traffic alert is kept open, over the stats buffered before the reconfiguration:
+	sendStats(stats, logmon.TrafficStats{TotalReqs: 0}, 1) // Simulate 2.1 req/s on the window
+	sendStats(stats, logmon.TrafficStats{TotalReqs: 0}, 1) // Simulate 1.8 req/s on the window - alert recovered
+	a = <-alerts
+	require.Equal(t, logmon.HighTraffic, a.Kind, "high traffic alert expected")
+	require.False(t, a.Open, "alert is recovered")
+	require.Equal(t, 1.8, a.Hits, "recovered with the stats buffered before the reconfiguration")
+}
+
+func TestThresholdAlert_JSONRoundTrip(t *testing.T) {
+	alert := logmon.ThresholdAlert{Kind: logmon.BurnRate, Name: "availability 1h0m0s/5m0s", Open: true, Burn: 14.5}
+	b, err := json.Marshal(alert)
+	require.NoError(t, err)
+	require.True(t, strings.Contains(string(b), `"kind":"burn_rate"`), "the kind is encoded by name")
+
+	var decoded logmon.ThresholdAlert
+	require.NoError(t, json.Unmarshal(b, &decoded))
+	require.Equal(t, alert.ID(), decoded.ID())
+	require.Equal(t, alert.Burn, decoded.Burn)
+}
+
 func sendStats(stats chan logmon.TrafficStats, trafficStats logmon.TrafficStats, entries int) int {
 	expectedHits := 0
 	for i := 0; i < entries; i++ {
@@ -0,0 +1,83 @@
+package logmon
+
+import (
+	"math"
+	"time"
+)
+
+// anomalyWarmup is the number of observations a baseline needs before it can be trusted.
+const anomalyWarmup = 10
+
+// anomalyDetector learns the expected traffic and measures how far an interval deviates from it.
+// With daily seasonality, a separate baseline is learnt for every hour of the day.
+type anomalyDetector struct {
+	sigmas    float64         // Deviation, in standard deviations, considered an anomaly.
+	interval  float64         // Refresh interval, in seconds.
+	baselines []*ewmaBaseline // One baseline per season.
+}
+
+// newAnomalyDetector creates an anomalyDetector.
+func newAnomalyDetector(sigmas float64, alpha float64, interval int, seasonal bool) *anomalyDetector {
+	seasons := 1
+	if seasonal {
+		seasons = 24
+	}
+
+	baselines := make([]*ewmaBaseline, seasons)
+	for i := range baselines {
+		baselines[i] = &ewmaBaseline{alpha: alpha}
+	}
+
+	return &anomalyDetector{sigmas: sigmas, interval: float64(interval), baselines: baselines}
+}
+
+// observe compares a rate, in requests per second, against the baseline of its season.
+// It returns the expected rate and the deviation in standard deviations, then it learns from the rate.
+// The result is not ready until the baseline has seen enough observations.
+func (d *anomalyDetector) observe(rate float64, at time.Time) (expected float64, deviation float64, ready bool) {
+	b := d.baselines[at.UTC().Hour()%len(d.baselines)]
+
+	expected = b.mean
+	ready = b.samples >= anomalyWarmup
+
+	// Traffic is a count of events: a flat baseline still has the noise of a Poisson process.
+	sigma := math.Max(math.Sqrt(b.variance), math.Sqrt(b.mean/d.interval))
+	if sigma > 0 {
+		deviation = (rate - b.mean) / sigma
+	}
+
+	b.update(rate)
+	return expected, deviation, ready
+}
+
+// sameBaselines tells whether another detector learns its baselines the same way, to take them over.
+func (d *anomalyDetector) sameBaselines(other *anomalyDetector) bool {
+	return d.interval == other.interval && len(d.baselines) == len(other.baselines) &&
+		d.baselines[0].alpha == other.baselines[0].alpha
+}
+
+// anomalous tells whether a deviation is considered an anomaly.
+func (d *anomalyDetector) anomalous(deviation float64) bool {
+	return math.Abs(deviation) > d.sigmas
+}
+
+// ewmaBaseline keeps an exponentially weighted moving average and variance of a series.
+type ewmaBaseline struct {
+	alpha    float64 // Weight of the newest observation, between 0 and 1.
+	mean     float64
+	variance float64
+	samples  int
+}
+
+// update adds an observation to the baseline.
+func (b *ewmaBaseline) update(x float64) {
+	b.samples++
+	if b.samples == 1 {
+		b.mean = x
+		return
+	}
+
+	diff := x - b.mean
+	b.mean += b.alpha * diff
+	b.variance = (1 - b.alpha) * (b.variance + b.alpha*diff*diff)
+}
@@ -0,0 +1,383 @@
+package logmon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// QueryAPI is a StatsSink that keeps the recent traffic stats and alerts, and serves them as a JSON API.
+type QueryAPI interface {
+	StatsSink
+	http.Handler
+}
+
+// QueryAPIOpts defines the options required to build a QueryAPI.
+type QueryAPIOpts struct {
+	Addr            string           // Address to serve the API on, e.g. ":8081".
+	RefreshInterval int              // In seconds.
+	Retention       time.Duration    // Period of traffic stats kept.
+	History         []ThresholdAlert // Alerts recorded by previous runs, oldest first.
+	Store           StatsStore       // Store to look back beyond the retention, if any.
+}
+
+const (
+	defaultRetention = 6 * time.Hour
+	defaultTopWindow = 5 * time.Minute
+)
+
+// NewQueryAPI creates a QueryAPI.
+func NewQueryAPI(opts QueryAPIOpts) QueryAPI {
+	retention := opts.Retention
+	if retention <= 0 {
+		retention = defaultRetention
+	}
+	refresh := opts.RefreshInterval
+	if refresh < 1 {
+		refresh = 1
+	}
+
+	return &queryAPI{
+		addr:     opts.Addr,
+		interval: refresh,
+		series:   newTrafficSeries(int(retention / (time.Duration(refresh) * time.Second))),
+		board:    newAlertBoard(opts.History),
+		store:    opts.Store,
+	}
+}
+
+// queryAPI implements the QueryAPI interface.
+type queryAPI struct {
+	addr     string
+	interval int
+	server   *http.Server
+	series   *trafficSeries
+	store    StatsStore
+
+	mu    sync.Mutex
+	board *alertBoard
+}
+
+// Name identifies the sink.
+func (q *queryAPI) Name() string {
+	return "api"
+}
+
+// Setup starts serving the API.
+// It returns a callback to stop the HTTP server.
+func (q *queryAPI) Setup() (func(), error) {
+	listener, err := net.Listen("tcp", q.addr)
+	if err != nil {
+		return nil, fmt.Errorf("listen for api: %w", err)
+	}
+
+	q.server = &http.Server{Handler: q}
+	go func() {
+		if err := q.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("error serving api: %v", err)
+		}
+	}()
+
+	cleanup := func() {
+		log.Printf("clean up: stop api server...")
+		q.server.Close()
+	}
+	return cleanup, nil
+}
+
+// Run consumes traffic stats and alerts and keeps them, until both streams are closed.
+func (q *queryAPI) Run(ctx context.Context, stats <-chan TrafficStats, alerts <-chan ThresholdAlert) {
+LOOP:
+	for stats != nil || alerts != nil {
+		select {
+		case s, ok := <-stats:
+			if !ok {
+				stats = nil
+				continue
+			}
+			q.series.add(newSeriesInterval(s, q.interval))
+		case a, ok := <-alerts:
+			if !ok {
+				alerts = nil
+				continue
+			}
+			q.mu.Lock()
+			q.board.record(a)
+			q.mu.Unlock()
+		case <-ctx.Done():
+			break LOOP
+		}
+	}
+}
+
+// ServeHTTP serves the endpoints of the API:
+// - GET /stats?from=&to=&section=&resolution= returns the intervals within a period, optionally of a single section.
+// - GET /alerts?state= returns the recent alerts: all of them, the open ones or the recovered ones.
+// - GET /top/sections?window=&limit= returns the sections with the most requests within the latest period.
+// Periods beyond the retention, and resolutions other than the refresh interval, are read from the store.
+func (q *queryAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, errors.New("only GET is supported"))
+		return
+	}
+
+	var body interface{}
+	var err error
+	switch r.URL.Path {
+	case "/stats":
+		body, err = q.stats(r)
+	case "/alerts":
+		body, err = q.alerts(r)
+	case "/top/sections":
+		body, err = q.topSections(r)
+	default:
+		writeAPIError(w, http.StatusNotFound, fmt.Errorf("unknown endpoint %s", r.URL.Path))
+		return
+	}
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Printf("error writing api response: %v", err)
+	}
+}
+
+// sectionInterval is an interval of the stats of a single section.
+type sectionInterval struct {
+	Time    time.Time `json:"time"`
+	Section string    `json:"section"`
+	Hits    int       `json:"hits"`
+}
+
+func (q *queryAPI) stats(r *http.Request) (interface{}, error) {
+	from, err := parseAPITime(r.URL.Query().Get("from"), time.Time{})
+	if err != nil {
+		return nil, fmt.Errorf("invalid from: %w", err)
+	}
+	to, err := parseAPITime(r.URL.Query().Get("to"), time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("invalid to: %w", err)
+	}
+
+	intervals, err := q.intervals(from, to, r.URL.Query().Get("resolution"))
+	if err != nil {
+		return nil, err
+	}
+	section := r.URL.Query().Get("section")
+	if section == "" {
+		return intervals, nil
+	}
+
+	hits := make([]sectionInterval, 0, len(intervals))
+	for _, i := range intervals {
+		hits = append(hits, sectionInterval{Time: i.Time, Section: section, Hits: i.Sections[section]})
+	}
+	return hits, nil
+}
+
+func (q *queryAPI) alerts(r *http.Request) (interface{}, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	switch state := r.URL.Query().Get("state"); state {
+	case "open":
+		return q.board.openAlerts(), nil
+	case "", "all", "recovered":
+		alerts := make([]ThresholdAlert, 0, len(q.board.history))
+		for i := len(q.board.history) - 1; i >= 0; i-- { // Newest first.
+			if a := q.board.history[i]; state != "recovered" || !a.Open {
+				alerts = append(alerts, a)
+			}
+		}
+		return alerts, nil
+	default:
+		return nil, fmt.Errorf("invalid state %q: expected open, recovered or all", state)
+	}
+}
+
+// sectionHits is the hits of a section within a period.
+type sectionHits struct {
+	Section string `json:"section"`
+	Hits    int    `json:"hits"`
+}
+
+func (q *queryAPI) topSections(r *http.Request) (interface{}, error) {
+	window := defaultTopWindow
+	if w := r.URL.Query().Get("window"); w != "" {
+		d, err := time.ParseDuration(w)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid window %q: expected a duration, e.g. 5m", w)
+		}
+		window = d
+	}
+	limit := defaultTopSections
+	if l := r.URL.Query().Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid limit %q: expected a positive number", l)
+		}
+		limit = n
+	}
+
+	now := time.Now()
+	intervals, err := q.intervals(now.Add(-window), now, "")
+	if err != nil {
+		return nil, err
+	}
+	totals := make(map[string]int)
+	for _, i := range intervals {
+		for section, hits := range i.Sections {
+			totals[section] += hits
+		}
+	}
+
+	top := make([]sectionHits, 0, limit)
+	for _, e := range sortedEntries(totals, limit) {
+		top = append(top, sectionHits{Section: e.key, Hits: e.val})
+	}
+	return top, nil
+}
+
+// intervals returns the intervals ending within [from, to], from memory or, if needed, from the store.
+func (q *queryAPI) intervals(from, to time.Time, resolution string) ([]seriesInterval, error) {
+	if q.store == nil {
+		if resolution != "" {
+			return nil, errors.New("invalid resolution: no stats store")
+		}
+		return q.series.between(from, to), nil
+	}
+	if resolution == "" && !from.Before(q.series.oldest()) {
+		return q.series.between(from, to), nil
+	}
+
+	stored, err := q.store.Query(from, to, resolution)
+	if err != nil {
+		return nil, err
+	}
+	intervals := make([]seriesInterval, 0, len(stored))
+	for _, i := range stored {
+		var rate float64
+		if i.Duration > 0 {
+			rate = float64(i.Requests) / float64(i.Duration)
+		}
+		intervals = append(intervals, seriesInterval{
+			Time:      i.Time,
+			Requests:  i.Requests,
+			Bytes:     i.Bytes,
+			ReqPerSec: rate,
+			Sections:  i.Sections,
+			Methods:   i.Methods,
+			Statuses:  i.Statuses,
+		})
+	}
+	return intervals, nil
+}
+
+// parseAPITime parses a time as RFC 3339 or as Unix seconds. It returns the fallback for empty values.
+func parseAPITime(value string, fallback time.Time) (time.Time, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	if secs, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(secs, 0), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("expected RFC 3339 or Unix seconds, got %q", value)
+	}
+	return t, nil
+}
+
+func writeAPIError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
+
+// seriesInterval is the stats of an interval, as kept by a trafficSeries.
+type seriesInterval struct {
+	Time      time.Time      `json:"time"`
+	Requests  int            `json:"requests"`
+	Bytes     int            `json:"bytes"`
+	ReqPerSec float64        `json:"req_per_sec"`
+	Sections  map[string]int `json:"sections"`
+	Methods   map[string]int `json:"methods"`
+	Statuses  map[string]int `json:"statuses"`
+}
+
+func newSeriesInterval(s TrafficStats, interval int) seriesInterval {
+	return seriesInterval{
+		Time:      s.Time,
+		Requests:  s.TotalReqs,
+		Bytes:     s.Bytes,
+		ReqPerSec: float64(s.TotalReqs) / float64(interval),
+		Sections:  s.SectionHits,
+		Methods:   s.MethodHits,
+		Statuses:  s.StatusClassHits,
+	}
+}
+
+// trafficSeries keeps the latest intervals in a ring buffer, in order of time.
+type trafficSeries struct {
+	mu        sync.Mutex
+	intervals []seriesInterval
+	next      int // Position of the next interval once the buffer is full.
+	capacity  int
+}
+
+func newTrafficSeries(capacity int) *trafficSeries {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &trafficSeries{capacity: capacity}
+}
+
+// add appends an interval, evicting the oldest one once the buffer is full.
+func (t *trafficSeries) add(i seriesInterval) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.intervals) < t.capacity {
+		t.intervals = append(t.intervals, i)
+		return
+	}
+	t.intervals[t.next] = i
+	t.next = (t.next + 1) % t.capacity
+}
+
+// oldest returns the end of the oldest interval, or the current time if there are none.
+// Earlier intervals might have been evicted.
+func (t *trafficSeries) oldest() time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.intervals) == 0 {
+		return time.Now()
+	}
+	return t.intervals[t.next].Time
+}
+
+// between returns the intervals ending within [from, to], oldest first.
+func (t *trafficSeries) between(from, to time.Time) []seriesInterval {
+	t.mu.Lock()
+	ordered := append(append([]seriesInterval(nil), t.intervals[t.next:]...), t.intervals[:t.next]...)
+	t.mu.Unlock()
+
+	start := sort.Search(len(ordered), func(i int) bool { return !ordered[i].Time.Before(from) })
+	end := sort.Search(len(ordered), func(i int) bool { return ordered[i].Time.After(to) })
+	if start >= end {
+		return []seriesInterval{}
+	}
+	return ordered[start:end]
+}
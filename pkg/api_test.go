@@ -0,0 +1,178 @@
+package logmon_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	logmon "github.com/jjrumi/accesslogmonitor/pkg"
+)
+
+func TestQueryAPI_Endpoints(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	api := givenAQueryAPIWith(now, []logmon.TrafficStats{
+		givenStatsAt(now.Add(-20*time.Minute), "/old", "/old"),
+		givenStatsAt(now.Add(-2*time.Minute), "/api", "/api", "/users"),
+		givenStatsAt(now.Add(-1*time.Minute), "/api", "/users", "/users", "/users"),
+	})
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	from := strconv.FormatInt(now.Add(-5*time.Minute).Unix(), 10)
+	tests := map[string]struct {
+		path     string
+		status   int
+		expected string
+	}{
+		"stats within a period": {
+			"/stats?from=" + from + "&section=/users",
+			http.StatusOK,
+			`[{"time":"` + now.Add(-2*time.Minute).Format(time.RFC3339) + `","section":"/users","hits":1},
+			  {"time":"` + now.Add(-1*time.Minute).Format(time.RFC3339) + `","section":"/users","hits":3}]`,
+		},
+		"stats of an empty period": {
+			"/stats?to=" + now.Add(-time.Hour).Format(time.RFC3339),
+			http.StatusOK,
+			`[]`,
+		},
+		"top sections within a window": {
+			"/top/sections?window=5m",
+			http.StatusOK,
+			`[{"section":"/users","hits":4},{"section":"/api","hits":3}]`,
+		},
+		"top sections with a limit": {
+			"/top/sections?window=1h&limit=1",
+			http.StatusOK,
+			`[{"section":"/users","hits":4}]`,
+		},
+		"open alerts": {
+			"/alerts?state=open",
+			http.StatusOK,
+			`[{"kind":"abuse","name":"10.0.0.1","open":true,"hits":12.5,"time":"` + now.Format(time.RFC3339) + `"}]`,
+		},
+		"invalid window": {
+			"/top/sections?window=soon",
+			http.StatusBadRequest,
+			`{"error":"invalid window \"soon\": expected a duration, e.g. 5m"}`,
+		},
+		"invalid state": {
+			"/alerts?state=closed",
+			http.StatusBadRequest,
+			`{"error":"invalid state \"closed\": expected open, recovered or all"}`,
+		},
+		"unknown endpoint": {
+			"/nothing",
+			http.StatusNotFound,
+			`{"error":"unknown endpoint /nothing"}`,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			resp, err := http.Get(server.URL + tc.path)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			var body json.RawMessage
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+			require.Equal(t, tc.status, resp.StatusCode)
+			require.JSONEq(t, tc.expected, string(body))
+		})
+	}
+}
+
+func TestQueryAPI_EvictsIntervalsBeyondTheRetention(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	api := logmon.NewQueryAPI(logmon.QueryAPIOpts{RefreshInterval: 10, Retention: 30 * time.Second})
+	stats := make(chan logmon.TrafficStats, 5)
+	for i := 5; i > 0; i-- {
+		stats <- givenStatsAt(now.Add(-time.Duration(i)*10*time.Second), "/api")
+	}
+	close(stats)
+	alerts := make(chan logmon.ThresholdAlert)
+	close(alerts)
+	api.Run(context.Background(), stats, alerts)
+
+	req := httptest.NewRequest(http.MethodGet, "/stats", nil)
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+
+	var intervals []map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &intervals))
+	require.Len(t, intervals, 3)
+	require.Equal(t, now.Add(-30*time.Second).Format(time.RFC3339), intervals[0]["time"])
+}
+
+func givenAQueryAPIWith(now time.Time, intervals []logmon.TrafficStats) logmon.QueryAPI {
+	api := logmon.NewQueryAPI(logmon.QueryAPIOpts{RefreshInterval: 60, Retention: time.Hour})
+
+	stats := make(chan logmon.TrafficStats, len(intervals))
+	for _, s := range intervals {
+		stats <- s
+	}
+	close(stats)
+	alerts := make(chan logmon.ThresholdAlert, 2)
+	alerts <- logmon.ThresholdAlert{Kind: logmon.Abuse, Name: "10.0.0.1", Open: true, Hits: 12.5, Time: now}
+	alerts <- logmon.ThresholdAlert{Kind: logmon.HighTraffic, Open: false, Hits: 1, Time: now}
+	close(alerts)
+
+	api.Run(context.Background(), stats, alerts)
+	return api
+}
+
+func givenStatsAt(at time.Time, paths ...string) logmon.TrafficStats {
+	s := logmon.NewEmptyTrafficStats()
+	for _, path := range paths {
+		s.Update(logmon.LogEntry{ReqMethod: "GET", ReqPath: path, StatusCode: 200, Bytes: 10})
+	}
+	s.Time = at
+	return s
+}
+
+func TestQueryAPI_ReadsOlderIntervalsFromTheStore(t *testing.T) {
+	dir := givenATempDir(t)
+	defer os.RemoveAll(dir)
+	now := time.Now().Truncate(time.Minute)
+
+	// A previous run stored two minutes of traffic:
+	store := logmon.NewStatsStore(logmon.StatsStoreOpts{Dir: dir, RefreshInterval: 30})
+	givenAStoreFedWith(t, store, []logmon.TrafficStats{
+		givenStatsAt(now.Add(-150*time.Second), "/api"),
+		givenStatsAt(now.Add(-120*time.Second), "/api", "/api"),
+		givenStatsAt(now.Add(-90*time.Second), "/api"),
+		givenStatsAt(now.Add(-60*time.Second), "/api"),
+		givenStatsAt(now.Add(-30*time.Second), "/api"),
+	})
+	api := logmon.NewQueryAPI(logmon.QueryAPIOpts{RefreshInterval: 30, Store: store})
+
+	tests := map[string]struct {
+		path     string
+		expected []int
+	}{
+		"beyond the intervals in memory": {"/stats?from=" + now.Add(-time.Hour).Format(time.RFC3339), []int{1, 2, 1, 1, 1}},
+		"at another resolution":          {"/stats?resolution=1m&from=" + now.Add(-time.Hour).Format(time.RFC3339), []int{3, 2}},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			api.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.path, nil))
+			require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+			var intervals []struct{ Requests int }
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &intervals))
+			var requests []int
+			for _, i := range intervals {
+				requests = append(requests, i.Requests)
+			}
+			require.Equal(t, tc.expected, requests)
+		})
+	}
+}
@@ -0,0 +1,185 @@
+package logmon
+
+import (
+	"fmt"
+	"image"
+
+	ui "github.com/gizak/termui/v3"
+	"github.com/gizak/termui/v3/widgets"
+)
+
+// chartIntervals is the number of intervals kept for the charts of the UI.
+// The charts display as many of the latest ones as fit in their panels.
+const chartIntervals = 500
+
+// rateHistory keeps the rates of the latest intervals, oldest first.
+type rateHistory struct {
+	refresh  int
+	reqs     []float64 // Requests per second.
+	errors4x []float64 // 4xx responses per second.
+	errors5x []float64 // 5xx responses per second.
+	alerting []bool    // Whether a high traffic alert is open at the end of the interval.
+}
+
+func newRateHistory(refresh int) *rateHistory {
+	return &rateHistory{refresh: refresh}
+}
+
+// add appends the rates of an interval.
+func (h *rateHistory) add(s TrafficStats, alerting bool) {
+	h.reqs = appendBounded(h.reqs, h.rate(s.TotalReqs))
+	h.errors4x = appendBounded(h.errors4x, h.rate(s.StatusClassHits["4xx"]))
+	h.errors5x = appendBounded(h.errors5x, h.rate(s.StatusClassHits["5xx"]))
+
+	h.alerting = append(h.alerting, alerting)
+	if len(h.alerting) > chartIntervals {
+		h.alerting = h.alerting[len(h.alerting)-chartIntervals:]
+	}
+}
+
+// markAlerting updates the latest interval with the state of the high traffic alert.
+// The alert of an interval is received after its stats.
+func (h *rateHistory) markAlerting(alerting bool) {
+	if len(h.alerting) > 0 {
+		h.alerting[len(h.alerting)-1] = alerting
+	}
+}
+
+func (h *rateHistory) rate(hits int) float64 {
+	if h.refresh <= 0 {
+		return 0
+	}
+	return float64(hits) / float64(h.refresh)
+}
+
+func appendBounded(values []float64, v float64) []float64 {
+	values = append(values, v)
+	if len(values) > chartIntervals {
+		values = values[len(values)-chartIntervals:]
+	}
+	return values
+}
+
+// latest returns the last n values, at most.
+func latest(values []float64, n int) []float64 {
+	if n < 0 {
+		n = 0
+	}
+	if len(values) > n {
+		return values[len(values)-n:]
+	}
+	return values
+}
+
+func peak(values []float64) float64 {
+	var max float64
+	for _, v := range values {
+		if v > max {
+			max = v
+		}
+	}
+	return max
+}
+
+// rateChart is a line chart of the requests per second, with the alert threshold as a reference line.
+// It highlights the intervals with a high traffic alert open.
+type rateChart struct {
+	*widgets.Plot
+	alerting []bool
+	band     ui.Style // Style of the intervals with an alert open: its background and modifier.
+}
+
+// Axes of the plot, as drawn by termui: the labels of the Y axis and the axis line take 5 columns,
+// and the labels of the X axis and the axis line take 2 rows.
+const (
+	plotAxesWidth  = 5
+	plotAxesHeight = 2
+)
+
+func (u terminalUI) buildRateChart() *rateChart {
+	plot := widgets.NewPlot()
+	plot.Title = "Requests per second - waiting for inputs..."
+	plot.Marker = widgets.MarkerBraille
+	plot.LineColors = []ui.Color{u.theme.style(u.theme.Requests).Fg, u.theme.style(u.theme.Threshold).Fg}
+	plot.AxesColor = u.theme.style(u.theme.Text).Fg
+	plot.SetRect(0, 0, 50, 8)
+
+	return &rateChart{Plot: plot, band: u.theme.style(u.theme.AlertBand)}
+}
+
+func (u terminalUI) buildErrorSparklines() *widgets.SparklineGroup {
+	errors4x := widgets.NewSparkline()
+	errors4x.Title = "4xx per second"
+	errors4x.LineColor = u.theme.style(u.theme.Errors4xx).Fg
+	errors5x := widgets.NewSparkline()
+	errors5x.Title = "5xx per second"
+	errors5x.LineColor = u.theme.style(u.theme.Errors5xx).Fg
+
+	sparklines := widgets.NewSparklineGroup(errors4x, errors5x)
+	sparklines.Title = "Error rates"
+	sparklines.SetRect(0, 0, 50, 8)
+
+	return sparklines
+}
+
+// renderRates updates the charts with the latest intervals that fit in their panels.
+func (u terminalUI) renderRates(h *rateHistory, chart *rateChart, sparklines *widgets.SparklineGroup) {
+	n := chart.Inner.Dx() - plotAxesWidth
+	reqs := latest(h.reqs, n)
+	if len(reqs) > 1 {
+		threshold := make([]float64, len(reqs))
+		for i := range threshold {
+			threshold[i] = float64(u.alertThreshold)
+		}
+		chart.Data = [][]float64{reqs, threshold}
+		chart.MaxVal = 1.2 * peak(append([]float64{float64(u.alertThreshold), 1}, reqs...))
+		chart.alerting = h.alerting[len(h.alerting)-len(reqs):]
+		chart.Title = fmt.Sprintf(
+			"Requests per second - last %v intervals: %.2f, threshold %v",
+			len(reqs), reqs[len(reqs)-1], u.alertThreshold,
+		)
+	}
+
+	rates := []struct {
+		class  string
+		values []float64
+	}{
+		{"4xx", h.errors4x},
+		{"5xx", h.errors5x},
+	}
+	for i, r := range rates {
+		sparkline := sparklines.Sparklines[i]
+		sparkline.Data = latest(r.values, sparklines.Inner.Dx())
+		sparkline.MaxVal = peak(sparkline.Data)
+		if sparkline.MaxVal == 0 {
+			sparkline.MaxVal = 1
+		}
+		if len(r.values) > 0 {
+			sparkline.Title = fmt.Sprintf("%s per second: %.2f", r.class, r.values[len(r.values)-1])
+		}
+	}
+}
+
+// Draw draws the plot, then the background of the intervals with an alert open.
+func (c *rateChart) Draw(buf *ui.Buffer) {
+	c.Plot.Draw(buf)
+
+	area := image.Rect(
+		c.Inner.Min.X+plotAxesWidth, c.Inner.Min.Y,
+		c.Inner.Max.X, c.Inner.Max.Y-plotAxesHeight,
+	)
+	for i, alerting := range c.alerting {
+		x := area.Min.X + i*c.HorizontalScale
+		if !alerting || x >= area.Max.X {
+			continue
+		}
+		for y := area.Min.Y; y < area.Max.Y; y++ {
+			cell := buf.GetCell(image.Pt(x, y))
+			if c.band.Bg != ui.ColorClear {
+				cell.Style.Bg = c.band.Bg
+			}
+			cell.Style.Modifier |= c.band.Modifier
+			buf.SetCell(cell, image.Pt(x, y))
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package logmon_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	logmon "github.com/jjrumi/accesslogmonitor/pkg"
+)
+
+func TestLatest(t *testing.T) {
+	values := []float64{1, 2, 3}
+	tests := map[string]struct {
+		n        int
+		expected []float64
+	}{
+		"negative": {-1, []float64{}},
+		"none":     {0, []float64{}},
+		"some":     {2, []float64{2, 3}},
+		"all":      {3, []float64{1, 2, 3}},
+		"more":     {5, []float64{1, 2, 3}},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, tc.expected, logmon.Latest(values, tc.n))
+		})
+	}
+}
+
+func TestRateHistory_KeepsTheLatestIntervals(t *testing.T) {
+	tests := map[string]struct {
+		intervals int
+		kept      int
+		oldest    float64 // Requests per second of the oldest interval kept.
+	}{
+		"partial":    {10, 10, 0},
+		"full":       {logmon.ChartIntervals, logmon.ChartIntervals, 0},
+		"wraparound": {logmon.ChartIntervals + 25, logmon.ChartIntervals, 2.5},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			h := givenARateHistory(tc.intervals, func(i int) bool { return i%2 == 0 })
+
+			require.Len(t, h.Reqs(), tc.kept)
+			require.Len(t, h.Alerting(), tc.kept, "an alert marker per interval")
+			require.Equal(t, tc.oldest, h.Reqs()[0])
+			require.Equal(t, float64(tc.intervals-1)/10, h.Reqs()[tc.kept-1])
+
+			// The markers stay aligned with their intervals:
+			first := tc.intervals - tc.kept
+			for i, alerting := range h.Alerting() {
+				require.Equal(t, (first+i)%2 == 0, alerting, "marker of interval %d", first+i)
+			}
+		})
+	}
+}
+
+func TestRateHistory_MarkAlerting(t *testing.T) {
+	h := logmon.NewRateHistory(10)
+	h.MarkAlerting(true) // Nothing to mark yet.
+	require.Empty(t, h.Alerting())
+
+	h.Add(logmon.TrafficStats{TotalReqs: 10}, false)
+	h.Add(logmon.TrafficStats{TotalReqs: 20}, false)
+	h.MarkAlerting(true)
+	require.Equal(t, []bool{false, true}, h.Alerting(), "the alert of an interval is received after its stats")
+}
+
+func TestRenderRates_AlignsTheAlertMarkers(t *testing.T) {
+	tests := map[string]struct {
+		intervals int
+		width     int
+		reqs      []float64
+		alerting  []bool
+		bands     []int
+	}{
+		"narrower than the history": {
+			intervals: 6,
+			width:     4,
+			reqs:      []float64{0.2, 0.3, 0.4, 0.5},
+			alerting:  []bool{false, false, true, false},
+			bands:     []int{2},
+		},
+		"wider than the history": {
+			intervals: 3,
+			width:     10,
+			reqs:      []float64{0, 0.1, 0.2},
+			alerting:  []bool{true, false, false},
+			bands:     []int{0},
+		},
+		"after a wraparound": {
+			intervals: logmon.ChartIntervals + 5,
+			width:     3,
+			reqs:      []float64{50.2, 50.3, 50.4},
+			alerting:  []bool{false, false, true},
+			bands:     []int{2},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			h := givenARateHistory(tc.intervals, func(i int) bool { return i%4 == 0 })
+
+			rendered := logmon.RenderRates(h, 10, tc.width)
+			require.InDeltaSlice(t, tc.reqs, rendered.Reqs, 1e-9)
+			require.Equal(t, tc.alerting, rendered.Alerting)
+			require.Equal(t, tc.bands, rendered.Bands, "the band is drawn on the columns of the intervals alerting")
+		})
+	}
+}
+
+// givenARateHistory creates a rate history of 10 seconds intervals, the interval i with i requests.
+func givenARateHistory(intervals int, alerting func(i int) bool) logmon.RateHistory {
+	h := logmon.NewRateHistory(10)
+	for i := 0; i < intervals; i++ {
+		h.Add(logmon.TrafficStats{TotalReqs: i}, alerting(i))
+	}
+	return h
+}
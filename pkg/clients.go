@@ -0,0 +1,169 @@
+package logmon
+
+import (
+	"container/heap"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ClientKey builds the key under which the requests of a client are aggregated.
+type ClientKey func(entry LogEntry) string
+
+// ParseClientKey creates a ClientKey from a specification:
+// - "host": aggregate by remote host.
+// - "user": aggregate by authenticated username.
+// - "cidr/N": aggregate by the network of the remote host, e.g. "cidr/24".
+// Anonymous requests, logged with the "-" username, are aggregated by remote host instead of username:
+// otherwise they would all be counted as a single client, which could be taken for an abuser.
+func ParseClientKey(spec string) (ClientKey, error) {
+	switch {
+	case spec == "host":
+		return func(entry LogEntry) string { return entry.RemoteHost }, nil
+	case spec == "user":
+		return func(entry LogEntry) string {
+			if entry.Username == "" || entry.Username == "-" {
+				return entry.RemoteHost
+			}
+			return entry.Username
+		}, nil
+	case strings.HasPrefix(spec, "cidr/"):
+		ones, err := strconv.Atoi(strings.TrimPrefix(spec, "cidr/"))
+		if err != nil || ones < 0 || ones > 128 {
+			return nil, fmt.Errorf("invalid client key %q: expected a prefix length", spec)
+		}
+		return func(entry LogEntry) string { return networkOf(entry.RemoteHost, ones) }, nil
+	}
+	return nil, fmt.Errorf("invalid client key %q: expected host, user or cidr/N", spec)
+}
+
+// networkOf returns the network of an IP address in CIDR notation.
+// Hosts that are not IP addresses are returned as they are.
+func networkOf(host string, ones int) string {
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return host
+	}
+
+	bits := 128
+	if v4 := ip.To4(); v4 != nil {
+		ip, bits = v4, 32
+	}
+	if ones > bits {
+		ones = bits
+	}
+
+	network := net.IPNet{IP: ip.Mask(net.CIDRMask(ones, bits)), Mask: net.CIDRMask(ones, bits)}
+	return network.String()
+}
+
+// ClientHits defines the requests of a client during an interval.
+type ClientHits struct {
+	Client string
+	Hits   int // Requests of the client. It might be overestimated by up to Error requests.
+	Errors int // Requests of the client answered with a 4xx or 5xx status code.
+	Error  int // Maximum overestimation of Hits.
+}
+
+// heavyHitters counts the requests of the clients with the most requests in bounded memory.
+// It counts the paths of a section with the most requests too.
+// It implements the Space-Saving algorithm: when full, the client with the fewest requests is evicted
+// and the new client inherits its count as a possible overestimation.
+type heavyHitters struct {
+	capacity int
+	counters map[string]*hitCounter
+	heap     hitHeap // Min-heap of counters by hits, to find the client to evict.
+}
+
+// newHeavyHitters creates a heavyHitters that tracks up to capacity clients.
+func newHeavyHitters(capacity int) *heavyHitters {
+	return &heavyHitters{capacity: capacity, counters: make(map[string]*hitCounter)}
+}
+
+// add accounts a request of a client.
+func (h *heavyHitters) add(client string, failed bool) {
+	errors := 0
+	if failed {
+		errors = 1
+	}
+
+	if c, ok := h.counters[client]; ok {
+		c.Hits++
+		c.Errors += errors
+		heap.Fix(&h.heap, c.index)
+		return
+	}
+
+	if len(h.counters) < h.capacity {
+		c := &hitCounter{ClientHits: ClientHits{Client: client, Hits: 1, Errors: errors}}
+		h.counters[client] = c
+		heap.Push(&h.heap, c)
+		return
+	}
+
+	// Evict the client with the fewest requests:
+	c := h.heap[0]
+	delete(h.counters, c.Client)
+	c.ClientHits = ClientHits{Client: client, Hits: c.Hits + 1, Errors: errors, Error: c.Hits}
+	h.counters[client] = c
+	heap.Fix(&h.heap, c.index)
+}
+
+// top returns the tracked clients sorted by requests, most requested first.
+func (h *heavyHitters) top() []ClientHits {
+	top := make([]ClientHits, 0, len(h.heap))
+	for _, c := range h.heap {
+		top = append(top, c.ClientHits)
+	}
+
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Hits == top[j].Hits {
+			return top[i].Client < top[j].Client
+		}
+		return top[i].Hits > top[j].Hits
+	})
+	return top
+}
+
+// hits returns the requests of the tracked clients, by client.
+func (h *heavyHitters) hits() map[string]int {
+	hits := make(map[string]int, len(h.counters))
+	for client, c := range h.counters {
+		hits[client] = c.Hits
+	}
+	return hits
+}
+
+// hitCounter is an entry of the heavyHitters heap.
+type hitCounter struct {
+	ClientHits
+	index int
+}
+
+// hitHeap implements heap.Interface on the number of requests of the counters.
+type hitHeap []*hitCounter
+
+func (h hitHeap) Len() int {
+	return len(h)
+}
+func (h hitHeap) Less(i, j int) bool {
+	return h[i].Hits < h[j].Hits
+}
+func (h hitHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+func (h *hitHeap) Push(x interface{}) {
+	c := x.(*hitCounter)
+	c.index = len(*h)
+	*h = append(*h, c)
+}
+func (h *hitHeap) Pop() interface{} {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
@@ -0,0 +1,109 @@
+package logmon_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	logmon "github.com/jjrumi/accesslogmonitor/pkg"
+)
+
+func TestParseClientKey(t *testing.T) {
+	entry := logmon.LogEntry{RemoteHost: "192.168.10.20", Username: "alice"}
+	entryV6 := logmon.LogEntry{RemoteHost: "2001:db8::1"}
+	entryName := logmon.LogEntry{RemoteHost: "example.com"}
+
+	for name, tc := range map[string]struct {
+		spec        string
+		entry       logmon.LogEntry
+		expectedKey string
+
+		succeeds bool
+	}{
+		"it aggregates by host": {
+			spec:        "host",
+			entry:       entry,
+			expectedKey: "192.168.10.20",
+			succeeds:    true,
+		},
+		"it aggregates by user": {
+			spec:        "user",
+			entry:       entry,
+			expectedKey: "alice",
+			succeeds:    true,
+		},
+		"it aggregates anonymous users by host": {
+			spec:        "user",
+			entry:       logmon.LogEntry{RemoteHost: "192.168.10.20", Username: "-"},
+			expectedKey: "192.168.10.20",
+			succeeds:    true,
+		},
+		"it aggregates users without a name by host": {
+			spec:        "user",
+			entry:       logmon.LogEntry{RemoteHost: "192.168.10.20"},
+			expectedKey: "192.168.10.20",
+			succeeds:    true,
+		},
+		"it aggregates IPv4 hosts by network": {
+			spec:        "cidr/24",
+			entry:       entry,
+			expectedKey: "192.168.10.0/24",
+			succeeds:    true,
+		},
+		"it aggregates IPv6 hosts by network": {
+			spec:        "cidr/32",
+			entry:       entryV6,
+			expectedKey: "2001:db8::/32",
+			succeeds:    true,
+		},
+		"it keeps hostnames by network": {
+			spec:        "cidr/24",
+			entry:       entryName,
+			expectedKey: "example.com",
+			succeeds:    true,
+		},
+		"it fails with invalid prefix lengths": {
+			spec:     "cidr/abc",
+			succeeds: false,
+		},
+		"it fails with unknown specifications": {
+			spec:     "country",
+			succeeds: false,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			key, err := logmon.ParseClientKey(tc.spec)
+			require.Equal(t, tc.succeeds, err == nil)
+			if tc.succeeds {
+				require.Equal(t, tc.expectedKey, key(tc.entry))
+			}
+		})
+	}
+}
+
+func TestTrafficSupervisor_TracksHeavyHitterClients(t *testing.T) {
+	// Fill up entries channel with a heavy hitter among many light clients:
+	hosts := []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4", "10.0.0.5", "10.0.0.6"}
+	entries := make(chan logmon.LogEntry, 100)
+	for i := 0; i < 50; i++ {
+		entries <- logmon.LogEntry{RemoteHost: "10.0.0.100", StatusCode: 404}
+		entries <- logmon.LogEntry{RemoteHost: hosts[i%len(hosts)], StatusCode: 200}
+	}
+
+	// Run supervisor:
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	supervisor := logmon.NewTrafficSupervisor(logmon.TrafficSupervisorOpts{RefreshInterval: 50, ClientCapacity: 3})
+	stats := make(chan logmon.TrafficStats)
+	go supervisor.Run(ctx, entries, stats)
+
+	// Ensure the heavy hitter is tracked within the bounded capacity:
+	data, ok := <-stats
+	require.True(t, ok, "stats channel is open")
+	require.Len(t, data.Clients, 3, "clients are bounded by the capacity")
+	require.Equal(t, "10.0.0.100", data.Clients[0].Client, "the heavy hitter is the most requested client")
+	require.True(t, data.Clients[0].Hits-data.Clients[0].Error <= 50, "guaranteed hits are never overestimated")
+	require.True(t, data.Clients[0].Hits >= 50, "hits are never underestimated")
+	require.Equal(t, 50, data.Clients[0].Errors, "errors of the heavy hitter are tracked")
+}
@@ -0,0 +1,690 @@
+package logmon
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the configuration of a monitor, as written in a YAML file.
+// Intervals are given in seconds, as with the command line flags, and durations as Go durations, e.g. "90s" or "1h".
+type Config struct {
+	Sources     []SourceConfig    `yaml:"sources"`
+	Filter      string            `yaml:"filter"`
+	Refresh     int               `yaml:"refresh"`
+	Windows     []time.Duration   `yaml:"windows"`
+	Clients     ClientsConfig     `yaml:"clients"`
+	Alerts      AlertsConfig      `yaml:"alerts"`
+	Notifiers   []NotifierConfig  `yaml:"notifiers"`
+	History     string            `yaml:"history"`
+	Silences    SilencesConfig    `yaml:"silences"`
+	Outputs     OutputsConfig     `yaml:"outputs"`
+	Subscribers map[string]string `yaml:"subscribers"` // Buffer and overflow policy by hub/subscriber, e.g. "10:drop-oldest".
+	UI          UIConfig          `yaml:"ui"`
+}
+
+// SourceConfig is a log file to monitor.
+type SourceConfig struct {
+	Path   string `yaml:"path"`
+	Parser string `yaml:"parser"` // CommonLogFormat if empty.
+}
+
+// ClientsConfig defines how the requests of the clients are aggregated.
+type ClientsConfig struct {
+	Key      string `yaml:"key"`
+	Capacity int    `yaml:"capacity"`
+}
+
+// AlertsConfig defines the alert rules. The rules with a zero condition are disabled.
+type AlertsConfig struct {
+	Threshold int                `yaml:"threshold"`
+	Window    int                `yaml:"window"`
+	Floor     int                `yaml:"floor"`
+	NoData    int                `yaml:"nodata"`
+	Anomaly   AnomalyConfig      `yaml:"anomaly"`
+	Spike     SpikeConfig        `yaml:"spike"`
+	Clients   ClientAlertsConfig `yaml:"clients"`
+	SLOs      []string           `yaml:"slos"` // As parsed by ParseSLO.
+}
+
+// AnomalyConfig defines the anomaly alert rule.
+type AnomalyConfig struct {
+	Sigmas   float64 `yaml:"sigmas"`
+	Alpha    float64 `yaml:"alpha"`
+	Seasonal bool    `yaml:"seasonal"`
+}
+
+// SpikeConfig defines the spike alert rule.
+type SpikeConfig struct {
+	Percent int `yaml:"percent"`
+	Window  int `yaml:"window"`
+}
+
+// ClientAlertsConfig defines the abuse alert rules.
+type ClientAlertsConfig struct {
+	Rate   int `yaml:"rate"`
+	Errors int `yaml:"errors"`
+}
+
+// Types of notifiers.
+const (
+	WebhookNotifier = "webhook"
+	ExecNotifier    = "exec"
+	SMTPNotifier    = "smtp"
+)
+
+// NotifierConfig is a sink of the alerts. Its fields depend on its type.
+type NotifierConfig struct {
+	Type string `yaml:"type"` // WebhookNotifier, ExecNotifier or SMTPNotifier.
+
+	URL      string `yaml:"url"`
+	Retries  *int   `yaml:"retries"`  // 3 if nil.
+	Template string `yaml:"template"` // Built-in template or template file; the alert as JSON if empty.
+	Key      string `yaml:"key"`
+
+	Command string `yaml:"command"`
+
+	Addr        string   `yaml:"addr"`
+	From        string   `yaml:"from"` // logmon@localhost if empty.
+	To          []string `yaml:"to"`
+	User        string   `yaml:"user"`
+	PasswordEnv string   `yaml:"password_env"` // Env var of the password, LOGMON_SMTP_PASSWORD if empty.
+}
+
+// SilencesConfig defines the silences and the maintenance windows.
+type SilencesConfig struct {
+	Path        string        `yaml:"path"` // Silences are disabled if empty.
+	For         time.Duration `yaml:"for"`
+	Maintenance []string      `yaml:"maintenance"` // As parsed by ParseMaintenanceWindow.
+}
+
+// OutputsConfig defines where the stats and alerts are shipped and served. The outputs without address are disabled.
+type OutputsConfig struct {
+	Metrics   MetricsConfig   `yaml:"metrics"`
+	StatsD    StatsDConfig    `yaml:"statsd"`
+	Influx    InfluxConfig    `yaml:"influx"`
+	Graphite  GraphiteConfig  `yaml:"graphite"`
+	Dashboard DashboardConfig `yaml:"dashboard"`
+	API       APIConfig       `yaml:"api"`
+	Store     StoreConfig     `yaml:"store"`
+}
+
+// MetricsConfig defines the Prometheus exporter.
+type MetricsConfig struct {
+	Addr     string `yaml:"addr"`
+	Sections int    `yaml:"sections"`
+}
+
+// StatsDConfig defines the StatsD emitter.
+type StatsDConfig struct {
+	Addr      string   `yaml:"addr"`
+	Prefix    string   `yaml:"prefix"`
+	Tags      []string `yaml:"tags"`
+	DogStatsD bool     `yaml:"dogstatsd"`
+}
+
+// InfluxConfig defines the InfluxDB writer.
+type InfluxConfig struct {
+	URL      string   `yaml:"url"`
+	Tags     []string `yaml:"tags"`
+	TokenEnv string   `yaml:"token_env"` // Env var of the token, LOGMON_INFLUX_TOKEN if empty.
+}
+
+// GraphiteConfig defines the Graphite writer.
+type GraphiteConfig struct {
+	Addr   string `yaml:"addr"`
+	Prefix string `yaml:"prefix"`
+}
+
+// DashboardConfig defines the web dashboard.
+type DashboardConfig struct {
+	Addr string `yaml:"addr"`
+}
+
+// APIConfig defines the query API.
+type APIConfig struct {
+	Addr      string        `yaml:"addr"`
+	Retention time.Duration `yaml:"retention"`
+}
+
+// StoreConfig defines the stats store.
+type StoreConfig struct {
+	Path      string `yaml:"path"`
+	Retention string `yaml:"retention"` // As parsed by ParseStoreRetention.
+}
+
+// UIConfig defines the terminal UI, or the headless output.
+type UIConfig struct {
+	Headless      bool                   `yaml:"headless"`
+	Output        string                 `yaml:"output"` // Format of the headless output.
+	Layout        string                 `yaml:"layout"`
+	CompactLayout string                 `yaml:"compact_layout"`
+	Theme         string                 `yaml:"theme"` // A built-in theme, or one of Themes.
+	Themes        map[string]ThemeConfig `yaml:"themes"`
+}
+
+// ThemeConfig is a custom theme: the styles set override the ones of a built-in theme.
+type ThemeConfig struct {
+	Base  string `yaml:"base"` // DefaultTheme if empty.
+	Theme `yaml:",inline"`
+}
+
+// DefaultConfig returns the configuration used when neither a file nor flags set a value.
+func DefaultConfig() Config {
+	return Config{
+		Sources: []SourceConfig{{Path: "/tmp/access.log", Parser: CommonLogFormat}},
+		Refresh: 10,
+		Windows: []time.Duration{time.Minute, 5 * time.Minute, time.Hour},
+		Clients: ClientsConfig{Key: "host", Capacity: 100},
+		Alerts: AlertsConfig{
+			Threshold: 10,
+			Window:    120,
+			Anomaly:   AnomalyConfig{Alpha: 0.1},
+			Spike:     SpikeConfig{Window: 60},
+		},
+		Silences: SilencesConfig{Path: DefaultSilencesPath(), For: time.Hour},
+		Outputs: OutputsConfig{
+			Metrics:  MetricsConfig{Sections: 50},
+			StatsD:   StatsDConfig{Prefix: "logmon"},
+			Graphite: GraphiteConfig{Prefix: "logmon"},
+			API:      APIConfig{Retention: 6 * time.Hour},
+			Store:    StoreConfig{Retention: "raw=24h,1m=168h,1h=2160h"},
+		},
+		UI: UIConfig{
+			Output:        JSONFormat,
+			Layout:        DefaultLayout,
+			CompactLayout: DefaultCompactLayout,
+			Theme:         DefaultTheme.Name,
+		},
+	}
+}
+
+// DefaultSilencesPath returns the file shared by the monitor and the silence subcommand: logmon/silences.json in the
+// config directory of the user. It is empty, so silences are disabled, if the user has no config directory.
+func DefaultSilencesPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "logmon", "silences.json")
+}
+
+// LoadConfig reads a configuration file over the default configuration. See ParseConfig.
+func LoadConfig(path string) (Config, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Config{}, fmt.Errorf("read config: %w", err)
+	}
+	return ParseConfig(content)
+}
+
+// ParseConfig parses a YAML configuration over the default configuration, and validates it.
+// Unknown fields and values of the wrong type are rejected. The errors tell the line of the values at fault.
+func ParseConfig(content []byte) (Config, error) {
+	config := DefaultConfig()
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(content, &root); err != nil {
+		return Config{}, err
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&config); err != nil && !errors.Is(err, io.EOF) {
+		return Config{}, err
+	}
+
+	lines := make(map[string]int)
+	nodeLines(&root, "", lines)
+	if errs := config.validate(lines); len(errs) > 0 {
+		return Config{}, errs
+	}
+	return config, nil
+}
+
+// nodeLines records the line of every value of a YAML document, by path, e.g. "alerts.threshold" or "sources[0]".
+func nodeLines(node *yaml.Node, path string, lines map[string]int) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			nodeLines(child, path, lines)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			p := key.Value
+			if path != "" {
+				p = path + "." + key.Value
+			}
+			lines[p] = key.Line
+			nodeLines(value, p, lines)
+		}
+	case yaml.SequenceNode:
+		for i, item := range node.Content {
+			p := fmt.Sprintf("%s[%d]", path, i)
+			lines[p] = item.Line
+			nodeLines(item, p, lines)
+		}
+	}
+}
+
+// ConfigError is an invalid value of a configuration, at a path like "notifiers[0].url".
+// Line is the line of the value in the configuration file, or of its closest parent. 0 if unknown.
+type ConfigError struct {
+	Line int
+	Path string
+	Err  error
+}
+
+func (e ConfigError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("line %d: %s: %v", e.Line, e.Path, e.Err)
+	}
+	return fmt.Sprintf("%s: %v", e.Path, e.Err)
+}
+
+func (e ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// ConfigErrors are the errors of a configuration, one per line.
+type ConfigErrors []ConfigError
+
+func (e ConfigErrors) Error() string {
+	var lines []string
+	for _, err := range e {
+		lines = append(lines, err.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Validate checks every value of the configuration, e.g. once it is overridden by flags.
+func (c Config) Validate() error {
+	if errs := c.validate(nil); len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// configValidation collects the errors of a configuration, located with the lines of its file.
+type configValidation struct {
+	lines map[string]int
+	errs  ConfigErrors
+}
+
+// check records an error of a value, if any.
+func (v *configValidation) check(path string, err error) {
+	if err == nil {
+		return
+	}
+
+	line := 0
+	for p := path; p != "" && line == 0; {
+		line = v.lines[p]
+		i := strings.LastIndexAny(p, ".[")
+		if i < 0 {
+			break
+		}
+		p = p[:i]
+	}
+	v.errs = append(v.errs, ConfigError{Line: line, Path: path, Err: err})
+}
+
+// require records an error unless a condition holds.
+func (v *configValidation) require(path string, ok bool, format string, args ...interface{}) {
+	if !ok {
+		v.check(path, fmt.Errorf(format, args...))
+	}
+}
+
+func (c Config) validate(lines map[string]int) ConfigErrors {
+	v := &configValidation{lines: lines}
+
+	v.require("sources", len(c.Sources) > 0, "at least one source is required")
+	paths := make(map[string]bool)
+	for i, source := range c.Sources {
+		path := fmt.Sprintf("sources[%d]", i)
+		v.require(path+".path", source.Path != "", "a path is required")
+		v.require(path+".path", !paths[source.Path], "%s is monitored twice", source.Path)
+		paths[source.Path] = true
+		_, err := source.parser()
+		v.check(path+".parser", err)
+	}
+
+	_, err := ParseFilter(c.Filter)
+	v.check("filter", err)
+	v.require("refresh", c.Refresh > 0, "must be a positive number of seconds")
+	for i, w := range c.Windows {
+		path := fmt.Sprintf("windows[%d]", i)
+		v.require(path, w > 0, "must be a positive duration")
+		if refresh := time.Duration(c.Refresh) * time.Second; w > 0 && refresh > 0 {
+			v.require(path, w%refresh == 0, "must be a multiple of the refresh interval (%v)", refresh)
+		}
+	}
+	_, err = ParseClientKey(c.Clients.Key)
+	v.check("clients.key", err)
+	v.require("clients.capacity", c.Clients.Capacity > 0, "must be positive")
+
+	c.Alerts.validate(v, c.Refresh)
+	for i, n := range c.Notifiers {
+		n.validate(v, fmt.Sprintf("notifiers[%d]", i))
+	}
+
+	v.require("silences.for", c.Silences.For > 0, "must be a positive duration")
+	for i, w := range c.Silences.Maintenance {
+		_, err := ParseMaintenanceWindow(w)
+		v.check(fmt.Sprintf("silences.maintenance[%d]", i), err)
+	}
+
+	v.require("outputs.metrics.sections", c.Outputs.Metrics.Sections > 0, "must be positive")
+	v.require("outputs.api.retention", c.Outputs.API.Retention > 0, "must be a positive duration")
+	v.check("outputs.store.retention", ParseStoreRetention(c.Outputs.Store.Retention, &StatsStoreOpts{}))
+
+	for _, key := range subscriberKeys(c.Subscribers) {
+		definition := c.Subscribers[key]
+		path := "subscribers." + key
+		v.require(path, strings.Contains(key, "/"), "expected hub/subscriber=buffer:policy")
+		_, err := ParseSubscriberOpts(definition)
+		v.check(path, err)
+	}
+
+	c.UI.validate(v)
+
+	sort.SliceStable(v.errs, func(i, j int) bool {
+		return v.errs[i].Line < v.errs[j].Line
+	})
+	return v.errs
+}
+
+// validate checks the alert rules, whose windows hold whole refresh intervals.
+func (a AlertsConfig) validate(v *configValidation, refresh int) {
+	v.require("alerts.threshold", a.Threshold > 0, "must be a positive number of requests per second")
+	v.require("alerts.window", a.Window > 0, "must be a positive number of seconds")
+	if a.Window > 0 && refresh > 0 {
+		interval := time.Duration(refresh) * time.Second
+		v.require("alerts.window", a.Window >= refresh, "must be at least the refresh interval (%v)", interval)
+		v.require("alerts.window", a.Window%refresh == 0, "must be a multiple of the refresh interval (%v)", interval)
+	}
+	v.require("alerts.floor", a.Floor >= 0, "must not be negative")
+	v.require("alerts.nodata", a.NoData >= 0, "must not be negative")
+	v.require("alerts.anomaly.sigmas", a.Anomaly.Sigmas >= 0, "must not be negative")
+	v.require("alerts.anomaly.alpha", a.Anomaly.Alpha > 0 && a.Anomaly.Alpha <= 1, "must be between 0 and 1")
+	v.require("alerts.spike.percent", a.Spike.Percent >= 0, "must not be negative")
+	v.require("alerts.spike.window", a.Spike.Window > 0, "must be a positive number of seconds")
+	if a.Spike.Percent > 0 && a.Spike.Window > 0 && a.Window > 0 {
+		// The alert window must hold the most recent period and a preceding one as long to compare it with:
+		v.require("alerts.spike.window", a.Spike.Window*2 <= a.Window, "must be at most half of alerts.window")
+	}
+	if a.Spike.Percent > 0 && a.Spike.Window > 0 && refresh > 0 {
+		v.require("alerts.spike.window", a.Spike.Window%refresh == 0, "must be a multiple of the refresh interval (%v)", time.Duration(refresh)*time.Second)
+	}
+	v.require("alerts.clients.rate", a.Clients.Rate >= 0, "must not be negative")
+	v.require("alerts.clients.errors", a.Clients.Errors >= 0 && a.Clients.Errors <= 100, "must be a percentage")
+	for i, slo := range a.SLOs {
+		_, err := ParseSLO(slo)
+		v.check(fmt.Sprintf("alerts.slos[%d]", i), err)
+	}
+}
+
+func (n NotifierConfig) validate(v *configValidation, path string) {
+	switch n.Type {
+	case WebhookNotifier:
+		v.require(path+".url", n.URL != "", "a url is required by a webhook")
+		v.require(path+".retries", n.Retries == nil || *n.Retries >= 0, "must not be negative")
+		if n.Template != "" {
+			_, err := LoadPayloadTemplate(n.Template)
+			v.check(path+".template", err)
+		}
+	case ExecNotifier:
+		v.require(path+".command", n.Command != "", "a command is required by an exec notifier")
+	case SMTPNotifier:
+		v.require(path+".addr", n.Addr != "", "an addr is required by an smtp notifier")
+		v.require(path+".to", len(n.To) > 0, "at least one recipient is required by an smtp notifier")
+		for i, to := range n.To {
+			v.require(fmt.Sprintf("%s.to[%d]", path, i), strings.TrimSpace(to) != "", "must not be empty")
+		}
+	default:
+		v.check(path+".type", fmt.Errorf("unknown notifier %q: expected %s, %s or %s", n.Type, WebhookNotifier, ExecNotifier, SMTPNotifier))
+	}
+}
+
+func (u UIConfig) validate(v *configValidation) {
+	v.require("ui.output", u.Output == JSONFormat || u.Output == LogfmtFormat, "expected %s or %s", JSONFormat, LogfmtFormat)
+	_, err := ParseLayout(u.Layout)
+	v.check("ui.layout", err)
+	_, err = ParseLayout(u.CompactLayout)
+	v.check("ui.compact_layout", err)
+	var names []string
+	for name := range u.Themes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		_, err := u.theme(name)
+		v.check("ui.themes."+name, err)
+	}
+	if _, ok := u.Themes[u.Theme]; !ok {
+		_, err := LookupTheme(u.Theme)
+		v.check("ui.theme", err)
+	}
+}
+
+// theme returns a theme of the configuration: a custom one, or else a built-in one.
+func (u UIConfig) theme(name string) (Theme, error) {
+	custom, ok := u.Themes[name]
+	if !ok {
+		return LookupTheme(name)
+	}
+
+	base := DefaultTheme
+	if custom.Base != "" {
+		var err error
+		if base, err = LookupTheme(custom.Base); err != nil {
+			return Theme{}, err
+		}
+	}
+
+	theme := base
+	theme.Name = name
+	for _, s := range []struct {
+		style  *string
+		custom string
+	}{
+		{&theme.Text, custom.Text},
+		{&theme.Title, custom.Title},
+		{&theme.Border, custom.Border},
+		{&theme.Focus, custom.Focus},
+		{&theme.Value, custom.Value},
+		{&theme.OK, custom.OK},
+		{&theme.Alert, custom.Alert},
+		{&theme.Warning, custom.Warning},
+		{&theme.Key, custom.Key},
+		{&theme.Requests, custom.Requests},
+		{&theme.Threshold, custom.Threshold},
+		{&theme.Errors4xx, custom.Errors4xx},
+		{&theme.Errors5xx, custom.Errors5xx},
+		{&theme.AlertBand, custom.AlertBand},
+	} {
+		if s.custom != "" {
+			*s.style = s.custom
+		}
+	}
+	return theme, theme.Validate()
+}
+
+func subscriberKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (s SourceConfig) parser() (LogParser, error) {
+	if s.Parser == "" {
+		return NewLogParser(CommonLogFormat)
+	}
+	return NewLogParser(s.Parser)
+}
+
+// MonitorOpts builds the options of a monitor from a valid configuration, along with its sinks.
+// The alert history of previous runs is left to load, and the reloads of the configuration to set.
+func (c Config) MonitorOpts() (MonitorOpts, error) {
+	if err := c.Validate(); err != nil {
+		return MonitorOpts{}, err
+	}
+
+	var sources []LogSource
+	for _, s := range c.Sources {
+		parser, _ := s.parser()
+		sources = append(sources, LogSource{Path: s.Path, Parser: parser})
+	}
+
+	var slos []SLO
+	for _, definition := range c.Alerts.SLOs {
+		slo, _ := ParseSLO(definition)
+		slos = append(slos, slo)
+	}
+	var maintenance []MaintenanceWindow
+	for _, definition := range c.Silences.Maintenance {
+		w, _ := ParseMaintenanceWindow(definition)
+		maintenance = append(maintenance, w)
+	}
+	subscribers := make(map[string]SubscriberOpts)
+	for key, definition := range c.Subscribers {
+		subscribers[key], _ = ParseSubscriberOpts(definition)
+	}
+
+	filter, _ := ParseFilter(c.Filter)
+	key, _ := ParseClientKey(c.Clients.Key)
+	var retention StatsStoreOpts
+	_ = ParseStoreRetention(c.Outputs.Store.Retention, &retention)
+	layout, _ := ParseLayout(c.UI.Layout)
+	compactLayout, _ := ParseLayout(c.UI.CompactLayout)
+	theme, _ := c.UI.theme(c.UI.Theme)
+
+	sinks, err := c.sinks()
+	if err != nil {
+		return MonitorOpts{}, err
+	}
+
+	return MonitorOpts{
+		Sources:         sources,
+		RefreshInterval: c.Refresh,
+		AlertThreshold:  c.Alerts.Threshold,
+		AlertWindow:     c.Alerts.Window,
+		AlertFloor:      c.Alerts.Floor,
+		NoDataTimeout:   c.Alerts.NoData,
+		AnomalySigmas:   c.Alerts.Anomaly.Sigmas,
+		AnomalyAlpha:    c.Alerts.Anomaly.Alpha,
+		AnomalySeasonal: c.Alerts.Anomaly.Seasonal,
+		SpikePercent:    c.Alerts.Spike.Percent,
+		SpikeWindow:     c.Alerts.Spike.Window,
+		SLOs:            slos,
+		ClientKey:       key,
+		ClientCapacity:  c.Clients.Capacity,
+		Windows:         c.Windows,
+		ClientRate:      c.Alerts.Clients.Rate,
+		ClientErrors:    c.Alerts.Clients.Errors,
+		Sinks:           sinks,
+		HistoryPath:     c.History,
+		SilencesPath:    c.Silences.Path,
+		SilenceDuration: c.Silences.For,
+		Maintenance:     maintenance,
+		MetricsAddr:     c.Outputs.Metrics.Addr,
+		MetricsSections: c.Outputs.Metrics.Sections,
+		DashboardAddr:   c.Outputs.Dashboard.Addr,
+		APIAddr:         c.Outputs.API.Addr,
+		APIRetention:    c.Outputs.API.Retention,
+		StorePath:       c.Outputs.Store.Path,
+		StoreRetention:  retention,
+		Filter:          filter,
+		StatsSinks:      c.statsSinks(),
+		Layout:          layout,
+		CompactLayout:   compactLayout,
+		Theme:           theme,
+		Headless:        c.UI.Headless,
+		OutputFormat:    c.UI.Output,
+		Subscribers:     subscribers,
+		Config:          c,
+	}, nil
+}
+
+// sinks creates the notification sinks of the notifiers.
+func (c Config) sinks() ([]Sink, error) {
+	var sinks []Sink
+	for _, n := range c.Notifiers {
+		switch n.Type {
+		case WebhookNotifier:
+			opts := WebhookSinkOpts{URL: n.URL, Retries: 3, Key: n.Key}
+			if n.Retries != nil {
+				opts.Retries = *n.Retries
+			}
+			if n.Template != "" {
+				tmpl, err := LoadPayloadTemplate(n.Template)
+				if err != nil {
+					return nil, err
+				}
+				opts.Template = tmpl
+			}
+			sinks = append(sinks, NewWebhookSink(opts))
+		case ExecNotifier:
+			sinks = append(sinks, NewExecSink(ExecSinkOpts{Command: n.Command}))
+		case SMTPNotifier:
+			from, passwordEnv := n.From, n.PasswordEnv
+			if from == "" {
+				from = "logmon@localhost"
+			}
+			if passwordEnv == "" {
+				passwordEnv = "LOGMON_SMTP_PASSWORD"
+			}
+			sinks = append(sinks, NewSMTPSink(SMTPSinkOpts{
+				Addr:     n.Addr,
+				From:     from,
+				To:       n.To,
+				Username: n.User,
+				Password: os.Getenv(passwordEnv),
+			}))
+		}
+	}
+	return sinks, nil
+}
+
+// statsSinks creates the stats sinks of the outputs.
+// The Prometheus exporter, the dashboard, the query API and the store are built by the monitor itself.
+func (c Config) statsSinks() []StatsSink {
+	var sinks []StatsSink
+	if o := c.Outputs.StatsD; o.Addr != "" {
+		sinks = append(sinks, NewStatsDEmitter(StatsDEmitterOpts{
+			Addr:      o.Addr,
+			Prefix:    o.Prefix,
+			Tags:      o.Tags,
+			DogStatsD: o.DogStatsD,
+		}))
+	}
+	if o := c.Outputs.Influx; o.URL != "" {
+		tokenEnv := o.TokenEnv
+		if tokenEnv == "" {
+			tokenEnv = "LOGMON_INFLUX_TOKEN"
+		}
+		sinks = append(sinks, NewInfluxWriter(InfluxWriterOpts{
+			URL:   o.URL,
+			Token: os.Getenv(tokenEnv),
+			Tags:  o.Tags,
+		}))
+	}
+	if o := c.Outputs.Graphite; o.Addr != "" {
+		sinks = append(sinks, NewGraphiteWriter(GraphiteWriterOpts{Addr: o.Addr, Prefix: o.Prefix}))
+	}
+	return sinks
+}
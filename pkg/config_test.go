@@ -0,0 +1,140 @@
+package logmon_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	logmon "github.com/jjrumi/accesslogmonitor/pkg"
+)
+
+func TestLoadConfig_Example(t *testing.T) {
+	config, err := logmon.LoadConfig("../doc/logmon.example.yaml")
+	require.NoError(t, err)
+	require.Equal(t, []logmon.SourceConfig{{Path: "/tmp/access.log", Parser: "common"}}, config.Sources)
+	require.Equal(t, []time.Duration{time.Minute, 5 * time.Minute, time.Hour}, config.Windows)
+	require.Equal(t, 3.0, config.Alerts.Anomaly.Sigmas)
+	require.Equal(t, []string{"oncall@example.com"}, config.Notifiers[2].To)
+
+	opts, err := config.MonitorOpts()
+	require.NoError(t, err)
+	require.Len(t, opts.Sources, 1)
+	require.Len(t, opts.Sinks, 3)
+	require.Len(t, opts.StatsSinks, 1, "the statsd emitter; the other outputs are built by the monitor")
+	require.Equal(t, "projector", opts.Theme.Name)
+	require.Equal(t, "fg:white,mod:bold", opts.Theme.Value)
+	require.Equal(t, logmon.Themes["high-contrast"].Alert, opts.Theme.Alert)
+	require.InDelta(t, 0.999, opts.SLOs[0].Target, 1e-9)
+}
+
+func TestParseConfig_KeepsTheDefaultsOfTheValuesLeftOut(t *testing.T) {
+	config, err := logmon.ParseConfig([]byte("alerts:\n  threshold: 20\n"))
+	require.NoError(t, err)
+
+	expected := logmon.DefaultConfig()
+	expected.Alerts.Threshold = 20
+	require.Equal(t, expected, config)
+
+	config, err = logmon.ParseConfig(nil)
+	require.NoError(t, err)
+	require.Equal(t, logmon.DefaultConfig(), config)
+}
+
+func TestParseConfig_ReportsErrorsWithLines(t *testing.T) {
+	tests := map[string]struct {
+		config string
+		errors []string
+	}{
+		"invalid syntax": {
+			config: "refresh: [10\n",
+			errors: []string{"yaml: line 1"},
+		},
+		"unknown field": {
+			config: "alerts:\n  treshold: 20\n",
+			errors: []string{"line 2: field treshold not found"},
+		},
+		"wrong type": {
+			config: "refresh: 10\nwindows: [1m, soon]\n",
+			errors: []string{"line 2: cannot unmarshal !!str `soon`"},
+		},
+		"windows not a multiple of the refresh interval": {
+			config: "refresh: 10\nwindows: [1m, 45s]\n",
+			errors: []string{"line 2: windows[1]: must be a multiple of the refresh interval (10s)"},
+		},
+		"invalid values": {
+			config: "refresh: 0\nsources:\n  - path: /tmp/a.log\n    parser: xml\n  - parser: common\n",
+			errors: []string{
+				"line 1: refresh: must be a positive number of seconds",
+				`line 4: sources[0].parser: invalid log format "xml"`,
+				"line 5: sources[1].path: a path is required",
+			},
+		},
+		"invalid notifiers": {
+			config: "notifiers:\n  - type: smtp\n    addr: localhost:25\n  - type: pager\n",
+			errors: []string{
+				"line 2: notifiers[0].to: at least one recipient is required",
+				`line 4: notifiers[1].type: unknown notifier "pager"`,
+			},
+		},
+		"empty recipient": {
+			config: "notifiers:\n  - type: smtp\n    addr: localhost:25\n    to: [ops@example.com, \"\"]\n",
+			errors: []string{"line 4: notifiers[0].to[1]: must not be empty"},
+		},
+		"invalid rules": {
+			config: "filter: status >\nalerts:\n  anomaly:\n    alpha: 2\n  slos: [availability]\n",
+			errors: []string{
+				`line 1: filter: invalid filter "status >"`,
+				"line 4: alerts.anomaly.alpha: must be between 0 and 1",
+				`line 5: alerts.slos[0]: invalid slo "availability"`,
+			},
+		},
+		"spike window too long": {
+			config: "alerts:\n  window: 100\n  spike:\n    percent: 200\n    window: 60\n",
+			errors: []string{"line 5: alerts.spike.window: must be at most half of alerts.window"},
+		},
+		"alert window shorter than the refresh interval": {
+			config: "refresh: 2\nalerts:\n  window: 1\n",
+			errors: []string{
+				"line 3: alerts.window: must be at least the refresh interval (2s)",
+				"line 3: alerts.window: must be a multiple of the refresh interval (2s)",
+			},
+		},
+		"alert windows not a multiple of the refresh interval": {
+			config: "refresh: 10\nalerts:\n  window: 125\n  spike:\n    percent: 200\n    window: 45\n",
+			errors: []string{
+				"line 3: alerts.window: must be a multiple of the refresh interval (10s)",
+				"line 6: alerts.spike.window: must be a multiple of the refresh interval (10s)",
+			},
+		},
+		"invalid ui": {
+			config: "ui:\n  layout: traffic, graph\n  theme: projector\n",
+			errors: []string{
+				`line 2: ui.layout: unknown panel "graph"`,
+				`line 3: ui.theme: unknown theme "projector"`,
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := logmon.ParseConfig([]byte(tc.config))
+			require.Error(t, err)
+			for _, e := range tc.errors {
+				require.Contains(t, err.Error(), e)
+			}
+		})
+	}
+}
+
+func TestConfig_ValidateOverriddenValues(t *testing.T) {
+	config := logmon.DefaultConfig()
+	config.Alerts.Threshold = 0
+	config.Sources = nil
+
+	err := config.Validate()
+	require.EqualError(t, err, "sources: at least one source is required\nalerts.threshold: must be a positive number of requests per second")
+
+	_, err = config.MonitorOpts()
+	require.Error(t, err)
+}
@@ -0,0 +1,338 @@
+package logmon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Dashboard is a StatsSink that serves a web page with the panels of the terminal UI, updated live.
+type Dashboard interface {
+	StatsSink
+	http.Handler
+	// Reload displays the alert settings of a config reload, unless it failed.
+	Reload(report ReloadReport)
+}
+
+// DashboardOpts defines the options required to build a Dashboard.
+type DashboardOpts struct {
+	Addr            string           // Address to serve the dashboard on, e.g. ":8080".
+	RefreshInterval int              // In seconds.
+	AlertThreshold  int              // In requests per second.
+	AlertWindow     int              // In seconds.
+	History         []ThresholdAlert // Alerts recorded by previous runs, oldest first.
+	Store           StatsStore       // Store to show the traffic of the last day on startup, if any.
+}
+
+const (
+	dashboardTopSections = 20
+	dashboardTopLists    = 10
+	dashboardHistory     = 50
+	dashboardKeepAlive   = 15 * time.Second
+	dashboardTraffic     = 24 * time.Hour // Period of the traffic chart.
+)
+
+// NewDashboard creates a Dashboard.
+func NewDashboard(opts DashboardOpts) Dashboard {
+	d := &dashboard{
+		addr:     opts.Addr,
+		interval: opts.RefreshInterval,
+		board:    newAlertBoard(opts.History),
+		clients:  make(map[chan []byte]bool),
+		store:    opts.Store,
+	}
+	d.state = dashboardState{
+		Threshold: opts.AlertThreshold,
+		Window:    opts.AlertWindow,
+		Refresh:   opts.RefreshInterval,
+	}
+	d.updateAlerts()
+	return d
+}
+
+// dashboard implements the Dashboard interface.
+// It keeps the state of the panels, and pushes it to every connected page with Server-Sent Events on every change.
+type dashboard struct {
+	addr     string
+	interval int
+	server   *http.Server
+	store    StatsStore
+
+	mu      sync.Mutex
+	board   *alertBoard
+	state   dashboardState
+	clients map[chan []byte]bool // Latest state not sent yet of every connected page.
+}
+
+// dashboardState is the content of the panels, as sent to the page.
+type dashboardState struct {
+	Time       time.Time        `json:"time"`
+	Refresh    int              `json:"refresh"`
+	Threshold  int              `json:"threshold"`
+	Window     int              `json:"window"`
+	Requests   int              `json:"requests"`
+	Bytes      int              `json:"bytes"`
+	ReqPerSec  float64          `json:"req_per_sec"`
+	Sections   []dashboardHits  `json:"sections"`
+	Statuses   []dashboardHits  `json:"statuses"`
+	Methods    []dashboardHits  `json:"methods"`
+	Clients    []dashboardHits  `json:"clients"`
+	OpenAlerts []dashboardAlert `json:"open_alerts"`
+	History    []dashboardAlert `json:"history"` // Newest first.
+	Traffic    []dashboardPoint `json:"traffic"` // Requests per minute, oldest first.
+}
+
+type dashboardHits struct {
+	Key    string `json:"key"`
+	Hits   int    `json:"hits"`
+	Errors int    `json:"errors,omitempty"`
+}
+
+type dashboardPoint struct {
+	Time     time.Time `json:"time"` // End of the minute.
+	Requests int       `json:"requests"`
+}
+
+type dashboardAlert struct {
+	Time     time.Time `json:"time"`
+	Kind     string    `json:"kind"`
+	Name     string    `json:"name,omitempty"`
+	Open     bool      `json:"open"`
+	Silenced bool      `json:"silenced"`
+	Summary  string    `json:"summary"`
+}
+
+// Name identifies the sink.
+func (d *dashboard) Name() string {
+	return "dashboard"
+}
+
+// Setup loads the traffic of the last day from the store, if any, and starts serving the dashboard.
+// It returns a callback to stop the HTTP server.
+func (d *dashboard) Setup() (func(), error) {
+	if d.store != nil {
+		now := time.Now()
+		stored, err := d.store.Query(now.Add(-dashboardTraffic), now, MinuteResolution)
+		if err != nil {
+			log.Printf("error loading dashboard traffic: %v", err)
+		}
+		for _, i := range stored {
+			d.state.Traffic = append(d.state.Traffic, dashboardPoint{Time: i.Time, Requests: i.Requests})
+		}
+	}
+
+	listener, err := net.Listen("tcp", d.addr)
+	if err != nil {
+		return nil, fmt.Errorf("listen for dashboard: %w", err)
+	}
+
+	d.server = &http.Server{Handler: d}
+	go func() {
+		if err := d.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("error serving dashboard: %v", err)
+		}
+	}()
+
+	cleanup := func() {
+		log.Printf("clean up: stop dashboard server...")
+		d.server.Close()
+	}
+	return cleanup, nil
+}
+
+// Run consumes traffic stats and alerts and pushes the updated panels to the pages, until both streams are closed.
+func (d *dashboard) Run(ctx context.Context, stats <-chan TrafficStats, alerts <-chan ThresholdAlert) {
+LOOP:
+	for stats != nil || alerts != nil {
+		select {
+		case s, ok := <-stats:
+			if !ok {
+				stats = nil
+				continue
+			}
+			d.mu.Lock()
+			d.updateStats(s)
+			d.mu.Unlock()
+			d.publish()
+		case a, ok := <-alerts:
+			if !ok {
+				alerts = nil
+				continue
+			}
+			d.mu.Lock()
+			d.board.record(a)
+			d.updateAlerts()
+			d.mu.Unlock()
+			d.publish()
+		case <-ctx.Done():
+			break LOOP
+		}
+	}
+}
+
+// Reload displays the alert settings of a config reload, unless it failed.
+// The refresh interval is kept until a restart, as the rates are computed with it. See DiffConfig.
+func (d *dashboard) Reload(report ReloadReport) {
+	if report.Err != nil {
+		return
+	}
+
+	d.mu.Lock()
+	d.state.Threshold = report.Opts.AlertThreshold
+	d.state.Window = report.Opts.AlertWindow
+	d.mu.Unlock()
+	d.publish()
+}
+
+// ServeHTTP serves the page on /, its state as JSON on /state and the updates of the state on /events.
+func (d *dashboard) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		io.WriteString(w, dashboardPage)
+	case "/state":
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(d.snapshot())
+	case "/events":
+		d.serveEvents(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// serveEvents streams the state with Server-Sent Events: the current one first, then every update.
+// A page that falls behind only gets the latest state.
+func (d *dashboard) serveEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	updates := make(chan []byte, 1)
+	updates <- d.snapshot()
+	d.mu.Lock()
+	d.clients[updates] = true
+	d.mu.Unlock()
+	defer func() {
+		d.mu.Lock()
+		delete(d.clients, updates)
+		d.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(dashboardKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case state := <-updates:
+			fmt.Fprintf(w, "event: state\ndata: %s\n\n", state)
+		case <-keepAlive.C:
+			io.WriteString(w, ": keep-alive\n\n")
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// publish sends the state to every connected page, replacing the state they have not received yet.
+func (d *dashboard) publish() {
+	state := d.snapshot()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for updates := range d.clients {
+		select {
+		case <-updates:
+		default:
+		}
+		updates <- state
+	}
+}
+
+func (d *dashboard) snapshot() []byte {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	state, err := json.Marshal(d.state)
+	if err != nil {
+		log.Printf("error encoding dashboard state: %v", err)
+	}
+	return state
+}
+
+// updateStats updates the traffic panels. It must be called with the lock held.
+func (d *dashboard) updateStats(s TrafficStats) {
+	d.state.Time = s.Time
+	d.state.Requests = s.TotalReqs
+	d.state.Bytes = s.Bytes
+	if d.interval > 0 {
+		d.state.ReqPerSec = float64(s.TotalReqs) / float64(d.interval)
+	}
+	d.state.Sections = dashboardTop(s.SectionHits, dashboardTopSections)
+	d.state.Statuses = dashboardTop(s.StatusClassHits, dashboardTopLists)
+	d.state.Methods = dashboardTop(s.MethodHits, dashboardTopLists)
+
+	end := s.Time.Add(-time.Nanosecond).Truncate(time.Minute).Add(time.Minute)
+	if last := len(d.state.Traffic) - 1; last >= 0 && d.state.Traffic[last].Time.Equal(end) {
+		d.state.Traffic[last].Requests += s.TotalReqs
+	} else {
+		d.state.Traffic = append(d.state.Traffic, dashboardPoint{Time: end, Requests: s.TotalReqs})
+	}
+	for len(d.state.Traffic) > 0 && d.state.Traffic[0].Time.Before(s.Time.Add(-dashboardTraffic)) {
+		d.state.Traffic = d.state.Traffic[1:]
+	}
+
+	d.state.Clients = nil
+	for i, c := range s.Clients {
+		if i >= dashboardTopSections {
+			break
+		}
+		d.state.Clients = append(d.state.Clients, dashboardHits{Key: c.Client, Hits: c.Hits, Errors: c.Errors})
+	}
+}
+
+// updateAlerts updates the alert panels from the alert board. It must be called with the lock held.
+func (d *dashboard) updateAlerts() {
+	d.state.OpenAlerts = nil
+	for _, a := range d.board.openAlerts() {
+		d.state.OpenAlerts = append(d.state.OpenAlerts, newDashboardAlert(a))
+	}
+
+	d.state.History = nil
+	for i := len(d.board.history) - 1; i >= 0 && len(d.state.History) < dashboardHistory; i-- {
+		d.state.History = append(d.state.History, newDashboardAlert(d.board.history[i]))
+	}
+}
+
+func newDashboardAlert(a ThresholdAlert) dashboardAlert {
+	return dashboardAlert{
+		Time:     a.Time,
+		Kind:     kindLabel(a.Kind),
+		Name:     a.Name,
+		Open:     a.Open,
+		Silenced: a.Silenced,
+		Summary:  a.Summary(),
+	}
+}
+
+func dashboardTop(hits map[string]int, max int) []dashboardHits {
+	var top []dashboardHits
+	for _, e := range sortedEntries(hits, max) {
+		top = append(top, dashboardHits{Key: e.key, Hits: e.val})
+	}
+	return top
+}
@@ -0,0 +1,146 @@
+package logmon
+
+// dashboardPage is the self-contained page of the Dashboard.
+// It renders the state received from /events, and reconnects on its own when the connection is lost.
+const dashboardPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>logmon</title>
+<style>
+  body { margin: 0; padding: 1em; background: #111; color: #ddd; font: 14px/1.4 monospace; }
+  h1 { margin: 0 0 .5em; font-size: 1.2em; }
+  #status { float: right; color: #888; }
+  #status.live { color: #5c5; }
+  .grid { display: grid; grid-template-columns: repeat(auto-fill, minmax(22em, 1fr)); gap: 1em; }
+  .panel { border: 1px solid #444; padding: .5em 1em; min-height: 6em; }
+  .panel.wide { grid-column: 1 / -1; }
+  .panel h2 { margin: 0 0 .5em; font-size: 1em; color: #aaa; }
+  table { width: 100%; border-collapse: collapse; }
+  td { padding: 0 .5em 0 0; white-space: nowrap; }
+  td.num { text-align: right; color: #6af; width: 5em; }
+  .empty { color: #777; }
+  .open { color: #e55; }
+  .recovered { color: #5c5; }
+  .silenced { color: #db3; }
+  svg { width: 100%; height: 8em; }
+  svg polyline { fill: none; stroke: #6af; stroke-width: 1.5; vector-effect: non-scaling-stroke; }
+</style>
+</head>
+<body>
+<h1>logmon <span id="status">connecting...</span></h1>
+<div class="grid">
+  <div class="panel"><h2>Traffic</h2><div id="traffic" class="empty">waiting for inputs...</div></div>
+  <div class="panel"><h2>Config</h2><div id="config"></div></div>
+  <div class="panel"><h2>Top sections</h2><div id="sections" class="empty">waiting for inputs...</div></div>
+  <div class="panel"><h2>HTTP status</h2><div id="statuses" class="empty">waiting for inputs...</div></div>
+  <div class="panel"><h2>HTTP methods</h2><div id="methods" class="empty">waiting for inputs...</div></div>
+  <div class="panel"><h2>Top clients</h2><div id="clients" class="empty">waiting for inputs...</div></div>
+  <div class="panel wide"><h2>Requests per minute (last 24h) <span id="peak"></span></h2><div id="traffic-chart" class="empty">waiting for inputs...</div></div>
+  <div class="panel wide"><h2>Alerts</h2><div id="alerts"></div></div>
+  <div class="panel wide"><h2>Alert history</h2><div id="history"></div></div>
+</div>
+<script>
+(function () {
+  function el(tag, text, cls) {
+    var e = document.createElement(tag);
+    if (text !== undefined) { e.textContent = text; }
+    if (cls) { e.className = cls; }
+    return e;
+  }
+
+  function fill(id, rows, empty) {
+    var panel = document.getElementById(id);
+    panel.textContent = "";
+    panel.className = "";
+    if (!rows || rows.length === 0) {
+      panel.textContent = empty;
+      panel.className = "empty";
+      return;
+    }
+    var table = el("table");
+    rows.forEach(function (cells) {
+      var tr = el("tr");
+      cells.forEach(function (c) { tr.appendChild(el("td", c.text, c.cls)); });
+      table.appendChild(tr);
+    });
+    panel.appendChild(table);
+  }
+
+  function hits(list) {
+    return (list || []).map(function (h) {
+      var row = [{ text: h.hits, cls: "num" }, { text: h.key }];
+      if (h.errors) { row.push({ text: h.errors + " errors", cls: "open" }); }
+      return row;
+    });
+  }
+
+  function alerts(list) {
+    return (list || []).map(function (a) {
+      var state = a.open ? { text: "!!", cls: "open" } : { text: "OK", cls: "recovered" };
+      var row = [state, { text: new Date(a.time).toLocaleString() }, { text: a.summary }];
+      if (a.silenced) { row.push({ text: "(silenced)", cls: "silenced" }); }
+      return row;
+    });
+  }
+
+  function chart(points) {
+    var panel = document.getElementById("traffic-chart");
+    panel.textContent = "";
+    panel.className = "";
+    if (!points || points.length < 2) {
+      panel.textContent = "waiting for inputs...";
+      panel.className = "empty";
+      return;
+    }
+    var first = new Date(points[0].time).getTime();
+    var span = Math.max(new Date(points[points.length - 1].time).getTime() - first, 1);
+    var peak = Math.max.apply(null, points.map(function (p) { return p.requests; }).concat([1]));
+    var svg = document.createElementNS("http://www.w3.org/2000/svg", "svg");
+    svg.setAttribute("viewBox", "0 0 1000 100");
+    svg.setAttribute("preserveAspectRatio", "none");
+    var line = document.createElementNS("http://www.w3.org/2000/svg", "polyline");
+    line.setAttribute("points", points.map(function (p) {
+      var x = (new Date(p.time).getTime() - first) / span * 1000;
+      var y = 100 - p.requests / peak * 95;
+      return x.toFixed(1) + "," + y.toFixed(1);
+    }).join(" "));
+    svg.appendChild(line);
+    panel.appendChild(svg);
+    document.getElementById("peak").textContent = "- peak " + peak;
+  }
+
+  function render(s) {
+    if (s.time && s.time.indexOf("0001-") !== 0) {
+      fill("traffic", [
+        [{ text: "Interval end" }, { text: new Date(s.time).toLocaleString(), cls: "num" }],
+        [{ text: "Total requests" }, { text: s.requests, cls: "num" }],
+        [{ text: "Requests per second" }, { text: s.req_per_sec.toFixed(2), cls: "num" }],
+        [{ text: "Bytes transferred" }, { text: s.bytes, cls: "num" }]
+      ], "waiting for inputs...");
+      fill("sections", hits(s.sections), "no requests");
+      fill("statuses", hits(s.statuses), "no requests");
+      fill("methods", hits(s.methods), "no requests");
+      fill("clients", hits(s.clients), "no requests");
+    }
+    fill("config", [
+      [{ text: "Refresh interval" }, { text: s.refresh + "s", cls: "num" }],
+      [{ text: "Alert threshold" }, { text: s.threshold + " req/s", cls: "num" }],
+      [{ text: "Alert window" }, { text: s.window + "s", cls: "num" }]
+    ], "");
+    chart(s.traffic);
+    fill("alerts", alerts(s.open_alerts), "no alerts triggered");
+    fill("history", alerts(s.history), "no alerts recorded");
+  }
+
+  var status = document.getElementById("status");
+  var events = new EventSource("events");
+  events.addEventListener("state", function (e) { render(JSON.parse(e.data)); });
+  events.onopen = function () { status.textContent = "live"; status.className = "live"; };
+  events.onerror = function () { status.textContent = "reconnecting..."; status.className = ""; };
+})();
+</script>
+</body>
+</html>
+`
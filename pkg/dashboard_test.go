@@ -0,0 +1,124 @@
+package logmon_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	logmon "github.com/jjrumi/accesslogmonitor/pkg"
+)
+
+func TestDashboard_ServesThePage(t *testing.T) {
+	server := httptest.NewServer(logmon.NewDashboard(logmon.DashboardOpts{RefreshInterval: 10}))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Contains(t, string(body), `new EventSource("events")`)
+}
+
+func TestDashboard_StreamsUpdates(t *testing.T) {
+	history := []logmon.ThresholdAlert{givenAnAlert(true)}
+	dashboard := logmon.NewDashboard(logmon.DashboardOpts{RefreshInterval: 10, AlertThreshold: 5, History: history})
+	server := httptest.NewServer(dashboard)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/events")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	events := bufio.NewReader(resp.Body)
+
+	// The current state comes first:
+	state := givenTheNextState(t, events)
+	require.Equal(t, float64(5), state["threshold"])
+	require.Len(t, state["open_alerts"], 1)
+
+	stats := make(chan logmon.TrafficStats)
+	alerts := make(chan logmon.ThresholdAlert)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go dashboard.Run(ctx, stats, alerts)
+
+	s := logmon.NewEmptyTrafficStats()
+	s.Update(logmon.LogEntry{ReqMethod: "GET", ReqPath: "/api/users", StatusCode: 200, Bytes: 10})
+	stats <- s
+	state = givenTheNextState(t, events)
+	require.Equal(t, float64(1), state["requests"])
+	require.Equal(t, 0.1, state["req_per_sec"])
+	require.Equal(t, []interface{}{map[string]interface{}{"key": "/api", "hits": float64(1)}}, state["sections"])
+
+	alerts <- givenAnAlert(false)
+	state = givenTheNextState(t, events)
+	require.Nil(t, state["open_alerts"])
+	require.Len(t, state["history"], 2)
+}
+
+func TestDashboard_DisplaysTheAlertSettingsOfAReload(t *testing.T) {
+	dashboard := logmon.NewDashboard(logmon.DashboardOpts{RefreshInterval: 10, AlertThreshold: 5, AlertWindow: 120})
+	server := httptest.NewServer(dashboard)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/events")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	events := bufio.NewReader(resp.Body)
+	state := givenTheNextState(t, events)
+	require.Equal(t, float64(5), state["threshold"])
+
+	dashboard.Reload(logmon.ReloadReport{Opts: logmon.MonitorOpts{RefreshInterval: 5, AlertThreshold: 20, AlertWindow: 60}})
+	state = givenTheNextState(t, events)
+	require.Equal(t, float64(20), state["threshold"])
+	require.Equal(t, float64(60), state["window"])
+	require.Equal(t, float64(10), state["refresh"], "the refresh interval applies on restart")
+
+	dashboard.Reload(logmon.ReloadReport{Err: errors.New("read config: no such file")})
+	resp, err = http.Get(server.URL + "/state")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&state))
+	require.Equal(t, float64(20), state["threshold"], "a failed reload changes nothing")
+}
+
+// givenTheNextState reads the next state event of a stream.
+func givenTheNextState(t *testing.T, events *bufio.Reader) map[string]interface{} {
+	lines := make(chan string)
+	go func() {
+		for {
+			line, err := events.ReadString('\n')
+			if err != nil {
+				close(lines)
+				return
+			}
+			if strings.HasPrefix(line, "data: ") {
+				lines <- strings.TrimPrefix(line, "data: ")
+				return
+			}
+		}
+	}()
+
+	select {
+	case line, ok := <-lines:
+		require.True(t, ok, "stream closed")
+		var state map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(line), &state))
+		return state
+	case <-time.After(time.Second):
+		t.Fatal("no state received")
+	}
+	return nil
+}
@@ -0,0 +1,243 @@
+package logmon
+
+import (
+	"context"
+	"image"
+	"sort"
+	"strings"
+	"sync"
+
+	ui "github.com/gizak/termui/v3"
+)
+
+// Hooks into the unexported code of the UI and the reloads, for the external tests of the package.
+
+// ChartIntervals is the number of intervals kept for the charts.
+const ChartIntervals = chartIntervals
+
+// Latest returns the last n values, at most.
+var Latest = latest
+
+// RateHistory wraps a rateHistory.
+type RateHistory struct {
+	h *rateHistory
+}
+
+func NewRateHistory(refresh int) RateHistory {
+	return RateHistory{h: newRateHistory(refresh)}
+}
+
+func (r RateHistory) Add(s TrafficStats, alerting bool) {
+	r.h.add(s, alerting)
+}
+
+func (r RateHistory) MarkAlerting(alerting bool) {
+	r.h.markAlerting(alerting)
+}
+
+func (r RateHistory) Reqs() []float64 {
+	return r.h.reqs
+}
+
+func (r RateHistory) Alerting() []bool {
+	return r.h.alerting
+}
+
+// RenderedRates is what the rate chart displays.
+type RenderedRates struct {
+	Reqs     []float64 // Requests per second.
+	Alerting []bool    // Alert markers of the requests per second.
+	Bands    []int     // Columns of the plot area drawn with the alert band.
+}
+
+// RenderRates renders a history on a rate chart with room for width intervals, and draws it.
+func RenderRates(r RateHistory, threshold, width int) RenderedRates {
+	u := terminalUI{alertThreshold: threshold, theme: DefaultTheme}
+	chart := u.buildRateChart()
+	chart.SetRect(0, 0, width+plotAxesWidth+2, 12)
+	sparklines := u.buildErrorSparklines()
+	u.renderRates(r.h, chart, sparklines)
+
+	var rendered RenderedRates
+	if len(chart.Data) > 0 {
+		rendered.Reqs = chart.Data[0]
+	}
+	rendered.Alerting = chart.alerting
+
+	buf := ui.NewBuffer(chart.GetRect())
+	chart.Draw(buf)
+	band := u.theme.style(u.theme.AlertBand).Bg
+	min := chart.Inner.Min.X + plotAxesWidth
+	for x := min; x < chart.Inner.Max.X; x++ {
+		if buf.GetCell(image.Pt(x, chart.Inner.Min.Y)).Style.Bg == band {
+			rendered.Bands = append(rendered.Bands, x-min)
+		}
+	}
+	return rendered
+}
+
+// EscapeMarkup makes a text safe to display within the markup of a panel.
+var EscapeMarkup = escapeMarkup
+
+// Screen wraps the screen of the terminal UI, without a terminal: its views are drawn into buffers.
+type Screen struct {
+	s *screen
+}
+
+// NewScreen creates a screen with the given layouts, for a terminal of the given size.
+func NewScreen(layout, compactLayout string, width, height int) (Screen, error) {
+	full, err := ParseLayout(layout)
+	if err != nil {
+		return Screen{}, err
+	}
+	compact, err := ParseLayout(compactLayout)
+	if err != nil {
+		return Screen{}, err
+	}
+
+	u := terminalUI{refresh: 10, layout: full, compactLayout: compact, theme: DefaultTheme}
+	return Screen{s: u.newScreen(width, height)}, nil
+}
+
+func (s Screen) Resize(width, height int) {
+	s.s.resize(width, height)
+}
+
+func (s Screen) SelectPage(page int) {
+	s.s.selectPage(page)
+}
+
+func (s Screen) Compact() bool {
+	return s.s.compact
+}
+
+func (s Screen) Page() int {
+	return s.s.page
+}
+
+// FocusPanel focuses a panel by its name in the layouts.
+func (s Screen) FocusPanel(name string) {
+	_, panel := s.s.widget(name)
+	s.s.focusPanel(panel)
+}
+
+// Focused returns the name of the focused panel in the layouts.
+func (s Screen) Focused() string {
+	focused := s.s.focused()
+	for _, name := range LayoutPanels {
+		if _, panel := s.s.widget(name); panel != nil && panel == focused {
+			return name
+		}
+	}
+	return ""
+}
+
+// Help returns the area of the help overlay, and its lines.
+func (s Screen) Help() (image.Rectangle, []string) {
+	return s.s.helpBox.GetRect(), strings.Split(s.s.helpBox.Text, "\n")
+}
+
+// Rects draws the current view, and returns the area of its panels by their name in the layouts.
+func (s Screen) Rects() map[string]image.Rectangle {
+	page := s.s.full
+	if s.s.compact {
+		page = s.s.pages[s.s.page]
+	}
+	page.grid.Draw(ui.NewBuffer(page.grid.GetRect()))
+
+	rects := make(map[string]image.Rectangle)
+	for _, item := range page.grid.Items {
+		for _, name := range LayoutPanels {
+			if widget, _ := s.s.widget(name); widget == item.Entry {
+				rects[name] = widget.GetRect()
+			}
+		}
+	}
+	return rects
+}
+
+// FormatReload returns the row of the setup panel telling how a config reload went.
+func FormatReload(r ReloadReport) string {
+	u := terminalUI{theme: DefaultTheme}
+	return u.reloaded(r).formatReload()
+}
+
+// LiveConfig returns the configuration a running monitor ends up with once a new one is applied.
+var LiveConfig = liveConfig
+
+// SourceWatchers wraps the file watchers of the sources of a monitor.
+type SourceWatchers struct {
+	w *sourceWatchers
+}
+
+func NewSourceWatchers(sources []LogSource) SourceWatchers {
+	return SourceWatchers{w: newSourceWatchers(sources)}
+}
+
+func (w SourceWatchers) Setup() (func(), error) {
+	return w.w.setup()
+}
+
+func (w SourceWatchers) Launch(ctx context.Context, wg *sync.WaitGroup) <-chan LogEntry {
+	return w.w.launch(ctx, wg)
+}
+
+func (w SourceWatchers) Add(source LogSource) error {
+	return w.w.add(source)
+}
+
+func (w SourceWatchers) Remove(path string) {
+	w.w.remove(path)
+}
+
+func (w SourceWatchers) Apply(diff ConfigDiff, sources []LogSource) error {
+	return w.w.apply(diff, sources)
+}
+
+// Paths returns the paths of the sources watched, sorted.
+func (w SourceWatchers) Paths() []string {
+	w.w.mu.Lock()
+	defer w.w.mu.Unlock()
+	var paths []string
+	for path := range w.w.watchers {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Sources returns the file watchers of the sources of the monitor.
+func (m *Monitor) Sources() SourceWatchers {
+	return SourceWatchers{w: m.sources}
+}
+
+// Reload applies a configuration reloaded over the current one, as the monitor does while it runs.
+func (m *Monitor) Reload(current Config, r ConfigReload) Config {
+	return m.reload(current, r)
+}
+
+// Filter returns the filter of the entries applied by the monitor.
+func (m *Monitor) Filter() Filter {
+	return m.filter.Filter()
+}
+
+// Reloads returns the reload reports sent to the UI of the monitor, not reported yet.
+func (m *Monitor) Reloads() []ReloadReport {
+	switch u := m.ui.(type) {
+	case terminalUI:
+		return takeReloads(u.reloads)
+	case *headlessUI:
+		return takeReloads(u.reloads)
+	}
+	return nil
+}
+
+// FormatClients returns the rows of the top clients panel.
+func FormatClients(s TrafficStats) []string {
+	return terminalUI{theme: DefaultTheme}.formatClients(s)
+}
+
+// FormatAlert returns the row of an alert in the alert panels.
+func FormatAlert(a ThresholdAlert) string {
+	return terminalUI{theme: DefaultTheme}.formatAlert(a)
+}
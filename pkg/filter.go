@@ -0,0 +1,440 @@
+package logmon
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Filter matches log entries against an expression like `status >= 500 and path ~ "^/api" and method != "HEAD"`.
+// Comparisons combine with and, or, not and parentheses. The fields are:
+// - status and bytes, compared with numbers: ==, !=, <, <=, >, >=.
+// - method, path, section, host, user and protocol, compared with quoted strings: ==, != and the regular
+// expression matches ~ and !~.
+// The zero Filter matches every entry.
+type Filter struct {
+	root filterNode
+	spec string
+}
+
+// ParseFilter creates a Filter from an expression. An empty expression matches every entry.
+func ParseFilter(definition string) (Filter, error) {
+	if strings.TrimSpace(definition) == "" {
+		return Filter{}, nil
+	}
+
+	tokens, err := lexFilter(definition)
+	if err != nil {
+		return Filter{}, fmt.Errorf("invalid filter %q: %w", definition, err)
+	}
+
+	p := filterParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err == nil && p.peek().kind != tokenEnd {
+		err = p.errorf("unexpected %q", p.peek().text)
+	}
+	if err != nil {
+		return Filter{}, fmt.Errorf("invalid filter %q: %w", definition, err)
+	}
+
+	return Filter{root: root, spec: strings.TrimSpace(definition)}, nil
+}
+
+// Match tells whether an entry matches the filter.
+func (f Filter) Match(entry LogEntry) bool {
+	return f.root == nil || f.root.match(entry)
+}
+
+// String returns the filter as in its definition.
+func (f Filter) String() string {
+	return f.spec
+}
+
+// filterNode is a node of the syntax tree of a filter.
+type filterNode interface {
+	match(entry LogEntry) bool
+}
+
+type andNode struct{ left, right filterNode }
+
+func (n andNode) match(entry LogEntry) bool { return n.left.match(entry) && n.right.match(entry) }
+
+type orNode struct{ left, right filterNode }
+
+func (n orNode) match(entry LogEntry) bool { return n.left.match(entry) || n.right.match(entry) }
+
+type notNode struct{ node filterNode }
+
+func (n notNode) match(entry LogEntry) bool { return !n.node.match(entry) }
+
+// numberComparison compares a numeric field against a number.
+type numberComparison struct {
+	field func(LogEntry) int
+	op    string
+	value int
+}
+
+func (c numberComparison) match(entry LogEntry) bool {
+	v := c.field(entry)
+	switch c.op {
+	case "==":
+		return v == c.value
+	case "!=":
+		return v != c.value
+	case "<":
+		return v < c.value
+	case "<=":
+		return v <= c.value
+	case ">":
+		return v > c.value
+	}
+	return v >= c.value
+}
+
+// stringComparison compares a string field against a string, or a regular expression.
+type stringComparison struct {
+	field func(LogEntry) string
+	op    string
+	value string
+	re    *regexp.Regexp
+}
+
+func (c stringComparison) match(entry LogEntry) bool {
+	v := c.field(entry)
+	switch c.op {
+	case "==":
+		return v == c.value
+	case "!=":
+		return v != c.value
+	case "~":
+		return c.re.MatchString(v)
+	}
+	return !c.re.MatchString(v)
+}
+
+// numberFields and stringFields are the fields of the log entries available to the filters.
+var (
+	numberFields = map[string]func(LogEntry) int{
+		"status": func(e LogEntry) int { return e.StatusCode },
+		"bytes":  func(e LogEntry) int { return e.Bytes },
+	}
+	stringFields = map[string]func(LogEntry) string{
+		"method":   func(e LogEntry) string { return e.ReqMethod },
+		"path":     func(e LogEntry) string { return e.ReqPath },
+		"section":  func(e LogEntry) string { return sectionOf(e.ReqPath) },
+		"host":     func(e LogEntry) string { return e.RemoteHost },
+		"user":     func(e LogEntry) string { return e.Username },
+		"protocol": func(e LogEntry) string { return e.ReqProtocol },
+	}
+)
+
+type tokenKind int
+
+const (
+	tokenEnd tokenKind = iota
+	tokenIdent
+	tokenNumber
+	tokenString
+	tokenOperator
+	tokenLeftParen
+	tokenRightParen
+)
+
+type filterToken struct {
+	kind tokenKind
+	text string // Unquoted for strings.
+	pos  int    // Position in the expression, from 1.
+}
+
+// filterOperators are the operators of the filters, the longest first so they are matched greedily.
+var filterOperators = []string{"==", "!=", "<=", ">=", "!~", "&&", "||", "<", ">", "~", "=", "!"}
+
+func lexFilter(definition string) ([]filterToken, error) {
+	var tokens []filterToken
+	runes := []rune(definition)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, filterToken{tokenLeftParen, "(", i + 1})
+			i++
+		case r == ')':
+			tokens = append(tokens, filterToken{tokenRightParen, ")", i + 1})
+			i++
+		case r == '"' || r == '\'':
+			end := i + 1
+			for end < len(runes) && runes[end] != r {
+				if runes[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(runes) {
+				return nil, fmt.Errorf("unterminated string at position %d", i+1)
+			}
+			text := string(runes[i+1 : end])
+			if r == '"' {
+				unquoted, err := strconv.Unquote(string(runes[i : end+1]))
+				if err != nil {
+					return nil, fmt.Errorf("invalid string at position %d", i+1)
+				}
+				text = unquoted
+			}
+			tokens = append(tokens, filterToken{tokenString, text, i + 1})
+			i = end + 1
+		case unicode.IsDigit(r):
+			end := i
+			for end < len(runes) && unicode.IsDigit(runes[end]) {
+				end++
+			}
+			tokens = append(tokens, filterToken{tokenNumber, string(runes[i:end]), i + 1})
+			i = end
+		case unicode.IsLetter(r) || r == '_':
+			end := i
+			for end < len(runes) && (unicode.IsLetter(runes[end]) || unicode.IsDigit(runes[end]) || runes[end] == '_') {
+				end++
+			}
+			tokens = append(tokens, filterToken{tokenIdent, string(runes[i:end]), i + 1})
+			i = end
+		default:
+			op := ""
+			for _, candidate := range filterOperators {
+				if strings.HasPrefix(string(runes[i:]), candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected %q at position %d", r, i+1)
+			}
+			tokens = append(tokens, filterToken{tokenOperator, op, i + 1})
+			i += len([]rune(op))
+		}
+	}
+	return append(tokens, filterToken{tokenEnd, "end of filter", len(runes) + 1}), nil
+}
+
+// filterParser is a recursive descent parser of the filters:
+//
+//	or         = and { ("or" | "||") and }
+//	and        = unary { ("and" | "&&") unary }
+//	unary      = ("not" | "!") unary | "(" or ")" | comparison
+//	comparison = field operator value
+type filterParser struct {
+	tokens []filterToken
+	next   int
+}
+
+func (p *filterParser) peek() filterToken {
+	return p.tokens[p.next]
+}
+
+func (p *filterParser) take() filterToken {
+	t := p.tokens[p.next]
+	if t.kind != tokenEnd {
+		p.next++
+	}
+	return t
+}
+
+// keyword tells whether the next token is one of the given keywords or operators, and takes it if so.
+func (p *filterParser) keyword(words ...string) bool {
+	t := p.peek()
+	if t.kind != tokenIdent && t.kind != tokenOperator {
+		return false
+	}
+	for _, w := range words {
+		if strings.EqualFold(t.text, w) {
+			p.take()
+			return true
+		}
+	}
+	return false
+}
+
+func (p *filterParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%s at position %d", fmt.Sprintf(format, args...), p.peek().pos)
+}
+
+func (p *filterParser) parseOr() (filterNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("or", "||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (filterNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("and", "&&") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseUnary() (filterNode, error) {
+	if p.keyword("not", "!") {
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{node}, nil
+	}
+
+	if p.peek().kind == tokenLeftParen {
+		p.take()
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek().kind != tokenRightParen {
+			return nil, p.errorf("expected \")\" instead of %q", p.peek().text)
+		}
+		p.take()
+		return node, nil
+	}
+
+	return p.parseComparison()
+}
+
+func (p *filterParser) parseComparison() (filterNode, error) {
+	if p.peek().kind != tokenIdent {
+		return nil, p.errorf("expected a field instead of %q", p.peek().text)
+	}
+	name := strings.ToLower(p.peek().text)
+	if numberFields[name] == nil && stringFields[name] == nil {
+		return nil, p.errorf("unknown field %q", p.peek().text)
+	}
+	p.take()
+
+	if p.peek().kind != tokenOperator {
+		return nil, p.errorf("expected an operator after %s instead of %q", name, p.peek().text)
+	}
+	opToken := p.take()
+	op := opToken.text
+	if op == "=" {
+		op = "=="
+	}
+
+	if field, ok := numberFields[name]; ok {
+		switch op {
+		case "==", "!=", "<", "<=", ">", ">=":
+		default:
+			return nil, fmt.Errorf("%s is a number: %q is not allowed at position %d", name, op, opToken.pos)
+		}
+		if p.peek().kind != tokenNumber {
+			return nil, p.errorf("expected a number after %s %s instead of %q", name, op, p.peek().text)
+		}
+		value, err := strconv.Atoi(p.take().text)
+		if err != nil {
+			return nil, err
+		}
+		return numberComparison{field: field, op: op, value: value}, nil
+	}
+
+	switch op {
+	case "==", "!=", "~", "!~":
+	default:
+		return nil, fmt.Errorf("%s is a string: %q is not allowed at position %d", name, op, opToken.pos)
+	}
+	if p.peek().kind != tokenString {
+		return nil, p.errorf("expected a quoted string after %s %s instead of %q", name, op, p.peek().text)
+	}
+	value := p.take()
+	c := stringComparison{field: stringFields[name], op: op, value: value.text}
+	if op == "~" || op == "!~" {
+		re, err := regexp.Compile(value.text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression at position %d: %w", value.pos, err)
+		}
+		c.re = re
+	}
+	return c, nil
+}
+
+// EntryFilter drops the log entries that do not match a filter, before they are aggregated into traffic stats.
+// Its filter can be replaced while it runs.
+type EntryFilter interface {
+	Run(ctx context.Context, entries <-chan LogEntry, filtered chan<- LogEntry)
+	Filter() Filter
+	SetFilter(f Filter)
+}
+
+// EntryFilterOpts defines the options required to build an EntryFilter.
+type EntryFilterOpts struct {
+	Filter Filter // Filter applied from the start. Every entry is kept if zero.
+}
+
+// NewEntryFilter creates an EntryFilter.
+func NewEntryFilter(opts EntryFilterOpts) EntryFilter {
+	return &entryFilter{filter: opts.Filter}
+}
+
+// entryFilter implements the EntryFilter interface.
+type entryFilter struct {
+	mu     sync.RWMutex
+	filter Filter
+}
+
+// Run consumes log entries and produces the ones matching the current filter.
+func (f *entryFilter) Run(ctx context.Context, entries <-chan LogEntry, filtered chan<- LogEntry) {
+LOOP:
+	for {
+		select {
+		case entry, ok := <-entries:
+			if !ok {
+				break LOOP
+			}
+			if !f.Filter().Match(entry) {
+				continue
+			}
+
+			select {
+			case filtered <- entry:
+			case <-ctx.Done():
+				break LOOP
+			}
+		case <-ctx.Done():
+			break LOOP
+		}
+	}
+
+	log.Printf("clean up: close filtered log entries channel")
+	close(filtered)
+}
+
+// Filter returns the current filter.
+func (f *entryFilter) Filter() Filter {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.filter
+}
+
+// SetFilter replaces the filter. It applies to the entries consumed from then on.
+func (f *entryFilter) SetFilter(filter Filter) {
+	f.mu.Lock()
+	f.filter = filter
+	f.mu.Unlock()
+	log.Printf("filter set to %q", filter)
+}
@@ -0,0 +1,123 @@
+package logmon_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	logmon "github.com/jjrumi/accesslogmonitor/pkg"
+)
+
+func TestFilter_Match(t *testing.T) {
+	entry := logmon.LogEntry{
+		RemoteHost:  "10.0.0.1",
+		Username:    "james",
+		ReqMethod:   "GET",
+		ReqPath:     "/api/users",
+		ReqProtocol: "HTTP/1.1",
+		StatusCode:  503,
+		Bytes:       120,
+	}
+
+	tests := map[string]struct {
+		expression string
+		match      bool
+	}{
+		"empty filter":            {"", true},
+		"number comparison":       {"status >= 500", true},
+		"failed number":           {"status < 500", false},
+		"string equality":         {`method == "GET"`, true},
+		"single equal sign":       {`method = "POST"`, false},
+		"regular expression":      {`path ~ "^/api"`, true},
+		"negated regexp":          {`path !~ "^/api"`, false},
+		"section":                 {`section == "/api"`, true},
+		"and":                     {`status >= 500 and path ~ "^/api" and method != "HEAD"`, true},
+		"or":                      {`status == 200 or bytes > 100`, true},
+		"and binds tighter":       {`status == 200 and bytes > 100 or user == "james"`, true},
+		"parentheses":             {`status == 200 and (bytes > 100 or user == "james")`, false},
+		"not":                     {`not host == "10.0.0.1"`, false},
+		"symbols":                 {`!(status < 500) && (protocol == 'HTTP/1.1' || bytes == 0)`, true},
+		"case insensitive fields": {`STATUS == 503 AND Method == "GET"`, true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			filter, err := logmon.ParseFilter(tc.expression)
+			require.NoError(t, err)
+			require.Equal(t, tc.match, filter.Match(entry))
+		})
+	}
+}
+
+func TestFilter_MatchesTheSectionsOfTheTrafficStats(t *testing.T) {
+	for _, path := range []string{"/api/users", "/api", "api/users", "/", "", "/api/users/"} {
+		t.Run(path, func(t *testing.T) {
+			entry := logmon.LogEntry{ReqPath: path}
+			stats := logmon.NewEmptyTrafficStats()
+			stats.Update(entry)
+			require.Len(t, stats.SectionHits, 1)
+
+			for section := range stats.SectionHits {
+				filter, err := logmon.ParseFilter(`section == "` + section + `"`)
+				require.NoError(t, err)
+				require.True(t, filter.Match(entry), "the filter matches the section %q of the stats", section)
+			}
+		})
+	}
+}
+
+func TestParseFilter_ReportsErrors(t *testing.T) {
+	tests := map[string]struct {
+		expression string
+		error      string
+	}{
+		"unknown field":         {`size > 10`, `unknown field "size" at position 1`},
+		"missing operator":      {`status 500`, `expected an operator after status instead of "500" at position 8`},
+		"string for a number":   {`status == "500"`, `expected a number after status == instead of "500" at position 11`},
+		"number for a string":   {`method == 1`, `expected a quoted string after method == instead of "1" at position 11`},
+		"order of strings":      {`path < "/b"`, `path is a string: "<" is not allowed at position 6`},
+		"regexp of numbers":     {`status ~ "5.."`, `status is a number: "~" is not allowed at position 8`},
+		"invalid regexp":        {`path ~ "("`, `invalid regular expression at position 8`},
+		"unterminated string":   {`path == "/api`, `unterminated string at position 9`},
+		"unbalanced parenthese": {`(status == 200`, `expected ")" instead of "end of filter" at position 15`},
+		"trailing tokens":       {`status == 200 bytes`, `unexpected "bytes" at position 15`},
+		"unexpected character":  {`status == 200 ; bytes`, `unexpected ';' at position 15`},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := logmon.ParseFilter(tc.expression)
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tc.error)
+		})
+	}
+}
+
+func TestEntryFilter_AppliesTheFilterSetWhileRunning(t *testing.T) {
+	apiOnly, err := logmon.ParseFilter(`section == "/api"`)
+	require.NoError(t, err)
+	errorsOnly, err := logmon.ParseFilter(`status >= 500`)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	entries := make(chan logmon.LogEntry)
+	filtered := make(chan logmon.LogEntry)
+	filter := logmon.NewEntryFilter(logmon.EntryFilterOpts{Filter: apiOnly})
+	go filter.Run(ctx, entries, filtered)
+
+	entries <- logmon.LogEntry{ReqPath: "/home", StatusCode: 500}
+	entries <- logmon.LogEntry{ReqPath: "/api/users", StatusCode: 200}
+	require.Equal(t, "/api/users", (<-filtered).ReqPath)
+
+	filter.SetFilter(errorsOnly)
+	require.Equal(t, "status >= 500", filter.Filter().String())
+	entries <- logmon.LogEntry{ReqPath: "/api/users", StatusCode: 200}
+	entries <- logmon.LogEntry{ReqPath: "/home", StatusCode: 500}
+	require.Equal(t, "/home", (<-filtered).ReqPath)
+
+	close(entries)
+	_, ok := <-filtered
+	require.False(t, ok, "filtered channel is closed after input channel is closed")
+}
@@ -0,0 +1,116 @@
+package logmon
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// GraphiteWriterOpts defines the options required to build a Graphite StatsSink.
+type GraphiteWriterOpts struct {
+	Addr        string // Carbon plaintext listener as host:port.
+	Prefix      string // Prefix of every metric path, e.g. "logmon".
+	TopSections int    // Sections with the most requests written every interval.
+	BatchSize   int    // Maximum lines per connection.
+	MaxBuffer   int    // Maximum lines kept while the endpoint is down.
+}
+
+// NewGraphiteWriter creates a StatsSink that writes every interval and alert with the Graphite plaintext protocol.
+func NewGraphiteWriter(opts GraphiteWriterOpts) StatsSink {
+	topSections := opts.TopSections
+	if topSections < 1 {
+		topSections = defaultTopSections
+	}
+
+	prefix := strings.TrimSuffix(opts.Prefix, ".")
+	if prefix != "" {
+		prefix += "."
+	}
+
+	format := &graphiteFormat{prefix: prefix, topSections: topSections}
+	transport := &graphiteTransport{addr: opts.Addr}
+	return newLineWriter("graphite", format, transport, opts.BatchSize, opts.MaxBuffer)
+}
+
+// graphiteFormat implements the lineFormat interface with the Graphite plaintext protocol.
+type graphiteFormat struct {
+	prefix      string
+	topSections int
+}
+
+func (f *graphiteFormat) stats(s TrafficStats) []string {
+	ts := s.Time.Unix()
+	lines := []string{
+		f.line(ts, s.TotalReqs, "requests"),
+		f.line(ts, s.Bytes, "bytes"),
+	}
+	for _, e := range sortedEntries(s.MethodHits, len(s.MethodHits)) {
+		lines = append(lines, f.line(ts, e.val, "requests", "method", e.key))
+	}
+	for _, e := range sortedEntries(s.StatusClassHits, len(s.StatusClassHits)) {
+		lines = append(lines, f.line(ts, e.val, "responses", "status", e.key))
+	}
+	for _, e := range sortedEntries(s.SectionHits, f.topSections) {
+		lines = append(lines, f.line(ts, e.val, "requests", "section", e.key))
+	}
+	return lines
+}
+
+// alert writes the state of the alert: 1 when open, 0 when recovered.
+func (f *graphiteFormat) alert(a ThresholdAlert) []string {
+	open := 0
+	if a.Open {
+		open = 1
+	}
+
+	path := []string{"alerts", kindLabel(a.Kind)}
+	if a.Name != "" {
+		path = append(path, a.Name)
+	}
+	return []string{f.line(a.Time.Unix(), open, path...)}
+}
+
+// line renders a metric. The path nodes are sanitized to be valid Graphite nodes.
+func (f *graphiteFormat) line(ts int64, value int, path ...string) string {
+	nodes := make([]string, 0, len(path))
+	for _, node := range path {
+		node = metricNameSanitizer.ReplaceAllString(strings.Trim(node, "/"), "_")
+		if node == "" {
+			node = "root" // The "/" section.
+		}
+		nodes = append(nodes, node)
+	}
+	return fmt.Sprintf("%s%s %d %d", f.prefix, strings.Join(nodes, "."), value, ts)
+}
+
+// graphiteTransport implements the lineTransport interface with TCP connections.
+// It connects for every batch, so it recovers from restarts of the endpoint on its own.
+type graphiteTransport struct {
+	addr string
+}
+
+func (t *graphiteTransport) setup() (func(), error) {
+	if _, _, err := net.SplitHostPort(t.addr); err != nil {
+		return nil, fmt.Errorf("invalid graphite address %q: %w", t.addr, err)
+	}
+	return func() {}, nil
+}
+
+func (t *graphiteTransport) write(ctx context.Context, lines []string) error {
+	dialer := net.Dialer{Timeout: 5 * time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", t.addr)
+	if err != nil {
+		return fmt.Errorf("dial graphite: %w", err)
+	}
+	defer conn.Close()
+
+	if err := conn.SetWriteDeadline(time.Now().Add(10 * time.Second)); err != nil {
+		return fmt.Errorf("write metrics: %w", err)
+	}
+	if _, err := conn.Write([]byte(strings.Join(lines, "\n") + "\n")); err != nil {
+		return fmt.Errorf("write metrics: %w", err)
+	}
+	return nil
+}
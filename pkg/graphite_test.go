@@ -0,0 +1,77 @@
+package logmon_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	logmon "github.com/jjrumi/accesslogmonitor/pkg"
+)
+
+func TestGraphiteWriter_WritesStatsAndAlerts(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	// The alert might be written with the interval or on shutdown, on another connection:
+	received := make(chan string, 2)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			content, _ := ioutil.ReadAll(conn)
+			conn.Close()
+			received <- string(content)
+		}
+	}()
+
+	writer := logmon.NewGraphiteWriter(logmon.GraphiteWriterOpts{Addr: listener.Addr().String(), Prefix: "web"})
+	cleanup, err := writer.Setup()
+	require.NoError(t, err)
+	defer cleanup()
+
+	s := logmon.NewEmptyTrafficStats()
+	s.Update(logmon.LogEntry{ReqMethod: "GET", ReqPath: "/", StatusCode: 404, Bytes: 10})
+	s.Time = time.Unix(1596326410, 0)
+	stats := make(chan logmon.TrafficStats, 1)
+	stats <- s
+	close(stats)
+
+	abuse := logmon.ThresholdAlert{Kind: logmon.Abuse, Name: "10.0.0.1", Open: true, Time: time.Unix(1596326405, 0)}
+	alerts := make(chan logmon.ThresholdAlert, 1)
+	alerts <- abuse
+	close(alerts)
+
+	writer.Run(context.Background(), stats, alerts)
+
+	var lines []string
+	for len(lines) < 6 {
+		select {
+		case content := <-received:
+			lines = append(lines, strings.Split(strings.TrimSpace(content), "\n")...)
+		case <-time.After(time.Second):
+			t.Fatal("not all metrics received")
+		}
+	}
+	require.ElementsMatch(t, []string{
+		"web.requests 1 1596326410",
+		"web.bytes 10 1596326410",
+		"web.requests.method.GET 1 1596326410",
+		"web.responses.status.4xx 1 1596326410",
+		"web.requests.section.root 1 1596326410",
+		"web.alerts.abuse.10_0_0_1 1 1596326405",
+	}, lines)
+}
+
+func TestGraphiteWriter_FailsWithInvalidAddresses(t *testing.T) {
+	writer := logmon.NewGraphiteWriter(logmon.GraphiteWriterOpts{Addr: "localhost"})
+	_, err := writer.Setup()
+	require.Error(t, err)
+}
@@ -0,0 +1,283 @@
+package logmon
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Output formats of the headless UI.
+const (
+	JSONFormat   = "json"
+	LogfmtFormat = "logfmt"
+)
+
+// HeadlessUIOpts defines the options required to build a headless UI.
+type HeadlessUIOpts struct {
+	Output      io.Writer // Destination of the records, e.g. os.Stdout.
+	Format      string    // JSONFormat or LogfmtFormat.
+	Refresh     int       // Refresh interval, in seconds, to compute the req/s of every interval.
+	TopSections int       // Sections with the most requests written every interval.
+}
+
+// NewHeadlessUI creates a UI that writes every interval and alert as a record on a line, as JSON or logfmt.
+// It runs without a terminal, e.g. under systemd or in a container, and stops on SIGINT or SIGTERM.
+func NewHeadlessUI(opts HeadlessUIOpts) UI {
+	topSections := opts.TopSections
+	if topSections < 1 {
+		topSections = defaultTopSections
+	}
+
+	return &headlessUI{
+		output:      opts.Output,
+		format:      opts.Format,
+		refresh:     opts.Refresh,
+		topSections: topSections,
+		signals:     make(chan os.Signal, 1),
+		reloads:     newPendingOpts(),
+	}
+}
+
+// headlessUI implements the UI interface.
+type headlessUI struct {
+	output      io.Writer
+	format      string
+	refresh     int
+	topSections int
+	signals     chan os.Signal
+	reloads     *pendingOpts // Reports of the config reloads, written by Run.
+}
+
+// Setup validates the format and captures the interruption signals. It returns a callback to release them.
+func (u *headlessUI) Setup() (func(), error) {
+	if u.format != JSONFormat && u.format != LogfmtFormat {
+		return nil, fmt.Errorf("invalid output format %q: expected %s or %s", u.format, JSONFormat, LogfmtFormat)
+	}
+
+	signal.Notify(u.signals, syscall.SIGINT, syscall.SIGTERM)
+	cleanup := func() {
+		log.Printf("clean up: stop capturing signals...")
+		signal.Stop(u.signals)
+	}
+
+	return cleanup, nil
+}
+
+// Run writes the traffic stats and alerts until an interruption signal is captured,
+// the context is done or both streams are closed.
+func (u *headlessUI) Run(ctx context.Context, stats <-chan TrafficStats, alerts <-chan ThresholdAlert) {
+	w := bufio.NewWriter(u.output)
+
+LOOP:
+	for stats != nil || alerts != nil {
+		select {
+		case s, ok := <-stats:
+			if !ok {
+				stats = nil
+				continue
+			}
+			u.write(w, u.statsRecord(s))
+		case a, ok := <-alerts:
+			if !ok {
+				alerts = nil
+				continue
+			}
+			u.write(w, alertRecord(a))
+		case <-u.reloads.ready:
+			for _, r := range takeReloads(u.reloads) {
+				if r.Err == nil {
+					u.refresh = r.Opts.RefreshInterval
+				}
+				u.write(w, reloadRecord(r))
+			}
+		case sig := <-u.signals:
+			log.Printf("signal captured: %v", sig)
+			break LOOP
+		case <-ctx.Done():
+			break LOOP
+		}
+	}
+}
+
+// Reload reports a config reload with a record. The new refresh interval applies to the stats written from then on.
+func (u *headlessUI) Reload(report ReloadReport) {
+	queueReload(u.reloads, report)
+}
+
+// record is a list of keys and values, written in order.
+type record []interface{}
+
+func (u *headlessUI) write(w *bufio.Writer, r record) {
+	var err error
+	if u.format == JSONFormat {
+		err = writeJSONRecord(w, r)
+	} else {
+		err = writeLogfmtRecord(w, r)
+	}
+	if err == nil {
+		err = w.Flush() // A line per record, as soon as it is produced.
+	}
+	if err != nil {
+		log.Printf("error writing record: %v", err)
+	}
+}
+
+func (u *headlessUI) statsRecord(s TrafficStats) record {
+	var rate float64
+	if u.refresh > 0 {
+		rate = float64(s.TotalReqs) / float64(u.refresh)
+	}
+
+	clients := make(map[string]int)
+	for _, c := range s.Clients {
+		clients[c.Client] = c.Hits
+	}
+
+	r := record{
+		"time", s.Time.UTC().Format(time.RFC3339),
+		"type", "stats",
+		"requests", s.TotalReqs,
+		"bytes", s.Bytes,
+		"req_per_sec", rate,
+	}
+	for _, w := range s.Windows {
+		r = append(r, "req_per_sec_"+w.Label(), w.ReqPerSec())
+	}
+	return append(r,
+		"methods", s.MethodHits,
+		"statuses", s.StatusClassHits,
+		"sections", topHits(s.SectionHits, u.topSections),
+		"clients", topHits(clients, u.topSections),
+	)
+}
+
+func alertRecord(a ThresholdAlert) record {
+	r := record{
+		"time", a.Time.UTC().Format(time.RFC3339),
+		"type", "alert",
+		"kind", kindLabel(a.Kind),
+	}
+	if a.Name != "" {
+		r = append(r, "name", a.Name)
+	}
+	return append(r,
+		"open", a.Open,
+		"silenced", a.Silenced,
+		"hits", a.Hits,
+		"summary", a.Summary(),
+	)
+}
+
+func reloadRecord(r ReloadReport) record {
+	rec := record{
+		"time", r.Time.UTC().Format(time.RFC3339),
+		"type", "reload",
+		"ok", r.Err == nil,
+	}
+	if r.Err != nil {
+		rec = append(rec, "error", r.Err.Error())
+	} else {
+		rec = append(rec, "changes", nonNil(r.Changes), "restart", nonNil(r.Restart))
+	}
+	return append(rec, "summary", r.Summary())
+}
+
+// nonNil returns an empty list instead of nil, to be written as such.
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+// topHits returns the max entries with the most hits.
+func topHits(hits map[string]int, max int) map[string]int {
+	top := make(map[string]int)
+	for _, e := range sortedEntries(hits, max) {
+		top[e.key] = e.val
+	}
+	return top
+}
+
+// writeJSONRecord writes a record as a JSON object, keeping the order of its keys.
+func writeJSONRecord(w io.Writer, r record) error {
+	var line strings.Builder
+	line.WriteString("{")
+	for i := 1; i < len(r); i += 2 {
+		key, _ := json.Marshal(r[i-1])
+		value, err := json.Marshal(r[i])
+		if err != nil {
+			return fmt.Errorf("encode %s: %w", key, err)
+		}
+		if i > 1 {
+			line.WriteString(",")
+		}
+		line.Write(key)
+		line.WriteString(":")
+		line.Write(value)
+	}
+	line.WriteString("}\n")
+
+	_, err := io.WriteString(w, line.String())
+	return err
+}
+
+// writeLogfmtRecord writes a record as logfmt. Maps are flattened into dotted keys, e.g. methods.GET=12.
+func writeLogfmtRecord(w io.Writer, r record) error {
+	var pairs []string
+	for i := 1; i < len(r); i += 2 {
+		key := r[i-1].(string)
+		if m, ok := r[i].(map[string]int); ok {
+			var keys []string
+			for k := range m {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				pairs = append(pairs, key+"."+logfmtKey(k)+"="+strconv.Itoa(m[k]))
+			}
+			continue
+		}
+		pairs = append(pairs, key+"="+logfmtValue(r[i]))
+	}
+
+	_, err := io.WriteString(w, strings.Join(pairs, " ")+"\n")
+	return err
+}
+
+// logfmtKey replaces the characters not allowed in a logfmt key.
+func logfmtKey(k string) string {
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r == '=' || r == '"' {
+			return '_'
+		}
+		return r
+	}, k)
+}
+
+// logfmtValue renders a value, quoted if needed.
+func logfmtValue(v interface{}) string {
+	var s string
+	switch v := v.(type) {
+	case float64:
+		s = strconv.FormatFloat(v, 'f', -1, 64)
+	case []string:
+		s = strings.Join(v, ",")
+	default:
+		s = fmt.Sprint(v)
+	}
+	if s == "" || strings.ContainsAny(s, " =\"\\") || strings.IndexFunc(s, func(r rune) bool { return r < ' ' }) >= 0 {
+		return strconv.Quote(s)
+	}
+	return s
+}
@@ -0,0 +1,152 @@
+package logmon_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	logmon "github.com/jjrumi/accesslogmonitor/pkg"
+)
+
+func TestHeadlessUI_WritesStatsAndAlerts(t *testing.T) {
+	tests := map[string]struct {
+		format   string
+		expected []string
+	}{
+		"json": {
+			logmon.JSONFormat,
+			[]string{
+				`{"time":"2020-08-02T00:00:10Z","type":"stats","requests":2,"bytes":30,"req_per_sec":0.2,"methods":{"GET":1,"POST":1},"statuses":{"2xx":1,"5xx":1},"sections":{"/api":2},"clients":{}}`,
+				`{"time":"2020-08-02T00:00:05Z","type":"alert","kind":"high_traffic","open":true,"silenced":false,"hits":12.5,"summary":"high traffic alert triggered - hits = 12.50 req/s"}`,
+			},
+		},
+		"logfmt": {
+			logmon.LogfmtFormat,
+			[]string{
+				`time=2020-08-02T00:00:10Z type=stats requests=2 bytes=30 req_per_sec=0.2 methods.GET=1 methods.POST=1 statuses.2xx=1 statuses.5xx=1 sections./api=2`,
+				`time=2020-08-02T00:00:05Z type=alert kind=high_traffic open=true silenced=false hits=12.5 summary="high traffic alert triggered - hits = 12.50 req/s"`,
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var output bytes.Buffer
+			headless := logmon.NewHeadlessUI(logmon.HeadlessUIOpts{Output: &output, Format: tc.format, Refresh: 10})
+			cleanup, err := headless.Setup()
+			require.NoError(t, err)
+			defer cleanup()
+
+			s := logmon.NewEmptyTrafficStats()
+			s.Update(logmon.LogEntry{ReqMethod: "GET", ReqPath: "/api/users", StatusCode: 200, Bytes: 10})
+			s.Update(logmon.LogEntry{ReqMethod: "POST", ReqPath: "/api/users", StatusCode: 500, Bytes: 20})
+			s.Time = time.Date(2020, 8, 2, 0, 0, 10, 0, time.UTC)
+			stats := make(chan logmon.TrafficStats)
+			alerts := make(chan logmon.ThresholdAlert)
+			go func() {
+				stats <- s
+				alert := givenAnAlert(true)
+				alert.Time = time.Date(2020, 8, 2, 0, 0, 5, 0, time.UTC)
+				alerts <- alert
+				close(stats)
+				close(alerts)
+			}()
+
+			// Run stops once both streams are closed:
+			headless.Run(context.Background(), stats, alerts)
+
+			lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+			require.Equal(t, tc.expected, lines)
+			if tc.format == logmon.JSONFormat {
+				for _, line := range lines {
+					require.True(t, json.Valid([]byte(line)))
+				}
+			}
+		})
+	}
+}
+
+func TestHeadlessUI_WritesReloads(t *testing.T) {
+	tests := map[string]struct {
+		report   logmon.ReloadReport
+		expected string
+	}{
+		"applied": {
+			logmon.ReloadReport{Changes: []string{"alerts"}, Restart: []string{"outputs"}, Opts: logmon.MonitorOpts{RefreshInterval: 5}},
+			`{"time":"2020-08-02T00:00:10Z","type":"reload","ok":true,"changes":["alerts"],"restart":["outputs"],"summary":"config reloaded: alerts; restart to apply outputs"}`,
+		},
+		"failed": {
+			logmon.ReloadReport{Err: errors.New("read config: no such file")},
+			`{"time":"2020-08-02T00:00:10Z","type":"reload","ok":false,"error":"read config: no such file","summary":"config reload failed: read config: no such file"}`,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			r, w := io.Pipe()
+			headless := logmon.NewHeadlessUI(logmon.HeadlessUIOpts{Output: w, Format: logmon.JSONFormat, Refresh: 10})
+			cleanup, err := headless.Setup()
+			require.NoError(t, err)
+			defer cleanup()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go headless.Run(ctx, make(chan logmon.TrafficStats), make(chan logmon.ThresholdAlert))
+
+			tc.report.Time = time.Date(2020, 8, 2, 0, 0, 10, 0, time.UTC)
+			headless.Reload(tc.report)
+			line, err := bufio.NewReader(r).ReadString('\n')
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, strings.TrimSpace(line))
+		})
+	}
+}
+
+func TestHeadlessUI_KeepsTheRefreshOfAReloadFollowedByAFailedOne(t *testing.T) {
+	r, w := io.Pipe()
+	headless := logmon.NewHeadlessUI(logmon.HeadlessUIOpts{Output: w, Format: logmon.JSONFormat, Refresh: 10})
+	cleanup, err := headless.Setup()
+	require.NoError(t, err)
+	defer cleanup()
+
+	// Both reloads are reported before Run gets to them:
+	headless.Reload(logmon.ReloadReport{Changes: []string{"traffic"}, Opts: logmon.MonitorOpts{RefreshInterval: 5}})
+	headless.Reload(logmon.ReloadReport{Err: errors.New("read config: no such file")})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stats := make(chan logmon.TrafficStats)
+	go headless.Run(ctx, stats, make(chan logmon.ThresholdAlert))
+
+	output := bufio.NewReader(r)
+	for _, ok := range []bool{true, false} {
+		line, err := output.ReadString('\n')
+		require.NoError(t, err)
+		var record struct{ OK bool }
+		require.NoError(t, json.Unmarshal([]byte(line), &record))
+		require.Equal(t, ok, record.OK, "every reload is written, in order")
+	}
+
+	stats <- logmon.TrafficStats{TotalReqs: 10}
+	line, err := output.ReadString('\n')
+	require.NoError(t, err)
+	var record struct {
+		ReqPerSec float64 `json:"req_per_sec"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(line), &record))
+	require.Equal(t, 2.0, record.ReqPerSec, "the refresh interval of the first reload applies")
+}
+
+func TestHeadlessUI_FailsWithUnknownFormats(t *testing.T) {
+	headless := logmon.NewHeadlessUI(logmon.HeadlessUIOpts{Output: &bytes.Buffer{}, Format: "xml"})
+	_, err := headless.Setup()
+	require.Error(t, err)
+}
@@ -4,12 +4,16 @@ package logmon_test
 import (
 	"io/ioutil"
 	"math/rand"
+	"net"
+	"net/textproto"
 	"os"
 	"strings"
+	"testing"
 	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/stretchr/testify/require"
 
 	logmon "github.com/jjrumi/accesslogmonitor/pkg"
 )
@@ -57,7 +61,7 @@ func equalTrafficStats(a logmon.TrafficStats, b logmon.TrafficStats) bool {
 	return cmp.Equal(
 		a,
 		b,
-		cmpopts.IgnoreUnexported(logmon.TrafficStats{}),
+		cmpopts.IgnoreUnexported(logmon.TrafficStats{}, logmon.SectionStats{}),
 	)
 }
 
@@ -72,3 +76,70 @@ func equalLogEntries(a logmon.LogEntry, b logmon.LogEntry) bool {
 func givenAnEmptyLogEntry() logmon.LogEntry {
 	return logmon.LogEntry{}
 }
+
+// smtpMessage is an email received by the stand-in SMTP server.
+type smtpMessage struct {
+	from string
+	to   []string
+	data string
+}
+
+// givenAnSMTPServer runs a minimal SMTP server on a local port.
+// It returns its address, a channel with the received emails and a callback to stop it.
+func givenAnSMTPServer(t *testing.T) (string, <-chan smtpMessage, func()) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	messages := make(chan smtpMessage, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveSMTP(conn, messages)
+		}
+	}()
+
+	return listener.Addr().String(), messages, func() { listener.Close() }
+}
+
+func serveSMTP(conn net.Conn, messages chan<- smtpMessage) {
+	defer conn.Close()
+	text := textproto.NewConn(conn)
+	_ = text.PrintfLine("220 localhost ESMTP")
+
+	var msg smtpMessage
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+
+		cmd := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			_ = text.PrintfLine("250 localhost")
+		case strings.HasPrefix(cmd, "MAIL FROM:"):
+			msg = smtpMessage{from: strings.Trim(line[len("MAIL FROM:"):], "<> ")}
+			_ = text.PrintfLine("250 OK")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			msg.to = append(msg.to, strings.Trim(line[len("RCPT TO:"):], "<> "))
+			_ = text.PrintfLine("250 OK")
+		case cmd == "DATA":
+			_ = text.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+			data, err := text.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			msg.data = string(data)
+			messages <- msg
+			_ = text.PrintfLine("250 OK")
+		case cmd == "QUIT":
+			_ = text.PrintfLine("221 Bye")
+			return
+		default:
+			_ = text.PrintfLine("250 OK")
+		}
+	}
+}
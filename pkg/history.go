@@ -0,0 +1,230 @@
+package logmon
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+)
+
+// AlertHistory records every alert transition into a history file.
+type AlertHistory interface {
+	Setup() (func(), error)
+	Run(ctx context.Context, alerts <-chan ThresholdAlert)
+}
+
+// AlertHistoryOpts defines the options required to build an AlertHistory.
+type AlertHistoryOpts struct {
+	Path      string
+	MaxAlerts int // Alerts kept by a compaction of the file. DefaultHistoryAlerts if zero.
+}
+
+// DefaultHistoryAlerts is the number of alerts kept by a compaction of the history file.
+const DefaultHistoryAlerts = 10000
+
+// NewAlertHistory creates an AlertHistory.
+func NewAlertHistory(opts AlertHistoryOpts) AlertHistory {
+	if opts.MaxAlerts <= 0 {
+		opts.MaxAlerts = DefaultHistoryAlerts
+	}
+	return &alertHistory{path: opts.Path, max: opts.MaxAlerts}
+}
+
+// alertHistory implements the AlertHistory interface.
+// It appends every alert as a JSON line to a file. The file is compacted once it holds max alerts more than after
+// the last compaction: see compact.
+type alertHistory struct {
+	path      string
+	max       int
+	file      *os.File
+	lines     int // Alerts in the file.
+	compactAt int // Alerts in the file that trigger a compaction.
+}
+
+// Setup compacts the history file, creating it if needed, and opens it.
+// It returns a callback to close the file.
+func (h *alertHistory) Setup() (func(), error) {
+	if err := h.compact(); err != nil {
+		return nil, err
+	}
+
+	cleanup := func() {
+		log.Printf("clean up: close alert history...")
+		h.file.Close()
+	}
+
+	return cleanup, nil
+}
+
+// Run consumes alerts and appends them to the history file.
+// Every alert is synced to disk, so it survives a crash of the monitor.
+func (h *alertHistory) Run(ctx context.Context, alerts <-chan ThresholdAlert) {
+LOOP:
+	for {
+		select {
+		case a, ok := <-alerts:
+			if !ok {
+				break LOOP
+			}
+
+			if err := h.append(a); err != nil {
+				log.Printf("error recording alert: %v", err)
+			}
+		case <-ctx.Done():
+			break LOOP
+		}
+	}
+	log.Printf("clean up: alert history stopped")
+}
+
+func (h *alertHistory) append(a ThresholdAlert) error {
+	line, err := json.Marshal(a)
+	if err != nil {
+		return fmt.Errorf("encode alert: %w", err)
+	}
+
+	if _, err := h.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("write alert: %w", err)
+	}
+	if err := h.file.Sync(); err != nil {
+		return fmt.Errorf("write alert: %w", err)
+	}
+
+	h.lines++
+	if h.lines >= h.compactAt {
+		return h.compact()
+	}
+	return nil
+}
+
+// compact rewrites the history file with its last max alerts, plus the older alerts still open so they are restored
+// by the next run. The file is replaced atomically, then reopened for appending.
+func (h *alertHistory) compact() error {
+	history, err := LoadAlertHistory(h.path)
+	if err != nil {
+		return err
+	}
+	kept := compactHistory(history, h.max)
+
+	if len(kept) < len(history) {
+		if err := writeAlertHistory(h.path, kept); err != nil {
+			return err
+		}
+		log.Printf("alert history compacted: %d of %d alerts kept", len(kept), len(history))
+	}
+
+	if h.file != nil {
+		h.file.Close()
+	}
+	h.file, err = os.OpenFile(h.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0640)
+	if err != nil {
+		return fmt.Errorf("open alert history: %w", err)
+	}
+	h.lines = len(kept)
+	h.compactAt = h.lines + h.max
+	return nil
+}
+
+// compactHistory returns the last max alerts of a history, preceded by the older alerts that are still open.
+func compactHistory(history []ThresholdAlert, max int) []ThresholdAlert {
+	start := len(history) - max
+	if start <= 0 {
+		return history
+	}
+
+	last := make(map[string]int)
+	for i, a := range history {
+		last[a.ID()] = i
+	}
+
+	var kept []ThresholdAlert
+	for i, a := range history[:start] {
+		if a.Open && last[a.ID()] == i {
+			kept = append(kept, a)
+		}
+	}
+	return append(kept, history[start:]...)
+}
+
+// writeAlertHistory replaces a history file with the given alerts, through a temporary file renamed over it.
+func writeAlertHistory(path string, history []ThresholdAlert) error {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0640)
+	if err != nil {
+		return fmt.Errorf("compact alert history: %w", err)
+	}
+
+	w := bufio.NewWriter(f)
+	for _, a := range history {
+		line, err := json.Marshal(a)
+		if err != nil {
+			f.Close()
+			os.Remove(tmp)
+			return fmt.Errorf("encode alert: %w", err)
+		}
+		w.Write(append(line, '\n'))
+	}
+	err = w.Flush()
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("compact alert history: %w", err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("compact alert history: %w", err)
+	}
+	return nil
+}
+
+// LoadAlertHistory reads the alerts recorded in a history file, oldest first.
+// A missing file is an empty history. Lines that cannot be decoded are skipped.
+func LoadAlertHistory(path string) ([]ThresholdAlert, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open alert history: %w", err)
+	}
+	defer f.Close()
+
+	var history []ThresholdAlert
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var a ThresholdAlert
+		if err := json.Unmarshal(scanner.Bytes(), &a); err != nil {
+			log.Printf("error decoding alert history: %v", err)
+			continue
+		}
+		history = append(history, a)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read alert history: %w", err)
+	}
+
+	return history, nil
+}
+
+// OpenAlerts returns the alerts of a history that have not been recovered yet.
+func OpenAlerts(history []ThresholdAlert) []ThresholdAlert {
+	last := make(map[string]int)
+	for i, a := range history {
+		last[a.ID()] = i
+	}
+
+	var open []ThresholdAlert
+	for i, a := range history {
+		if a.Open && last[a.ID()] == i {
+			open = append(open, a)
+		}
+	}
+	return open
+}
@@ -0,0 +1,105 @@
+package logmon_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	logmon "github.com/jjrumi/accesslogmonitor/pkg"
+)
+
+func TestAlertHistory_RecordsEveryAlert(t *testing.T) {
+	dir, err := ioutil.TempDir("", "alert_history_*")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "alerts.jsonl")
+
+	// Record alerts in two runs of the history:
+	for run := 0; run < 2; run++ {
+		history := logmon.NewAlertHistory(logmon.AlertHistoryOpts{Path: path})
+		cleanup, err := history.Setup()
+		require.NoError(t, err)
+
+		alerts := make(chan logmon.ThresholdAlert, 2)
+		alerts <- givenAnAlert(true)
+		alerts <- givenAnAlert(false)
+		close(alerts)
+		history.Run(context.Background(), alerts)
+		cleanup()
+	}
+
+	recorded, err := logmon.LoadAlertHistory(path)
+	require.NoError(t, err)
+	require.Len(t, recorded, 4, "alerts of every run are appended")
+	require.True(t, recorded[0].Open, "alerts are loaded oldest first")
+	require.False(t, recorded[3].Open, "alerts are loaded oldest first")
+}
+
+func TestAlertHistory_CompactsTheFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "alert_history_*")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "alerts.jsonl")
+
+	history := logmon.NewAlertHistory(logmon.AlertHistoryOpts{Path: path, MaxAlerts: 2})
+	cleanup, err := history.Setup()
+	require.NoError(t, err)
+
+	// An abuse alert left open, followed by high traffic alerts that fill the file up twice:
+	alerts := make(chan logmon.ThresholdAlert, 5)
+	alerts <- logmon.ThresholdAlert{Kind: logmon.Abuse, Name: "10.0.0.1", Open: true}
+	alerts <- givenAnAlert(true)
+	alerts <- givenAnAlert(false)
+	alerts <- givenAnAlert(true)
+	alerts <- givenAnAlert(false)
+	close(alerts)
+	history.Run(context.Background(), alerts)
+	cleanup()
+
+	recorded, err := logmon.LoadAlertHistory(path)
+	require.NoError(t, err)
+	require.Len(t, recorded, 4, "the file is compacted once it holds 2 alerts more than after the last compaction")
+
+	// The next run compacts the file on setup:
+	history = logmon.NewAlertHistory(logmon.AlertHistoryOpts{Path: path, MaxAlerts: 2})
+	cleanup, err = history.Setup()
+	require.NoError(t, err)
+	cleanup()
+
+	recorded, err = logmon.LoadAlertHistory(path)
+	require.NoError(t, err)
+	require.Len(t, recorded, 3, "the last alerts and the older ones still open are kept")
+	require.Equal(t, "abuse/10.0.0.1", recorded[0].ID(), "open alerts are kept")
+	require.True(t, recorded[1].Open, "the last alerts are kept in order")
+	require.False(t, recorded[2].Open, "the last alerts are kept in order")
+
+	open := logmon.OpenAlerts(recorded)
+	require.Len(t, open, 1, "the open alerts survive the compaction")
+	require.Equal(t, "abuse/10.0.0.1", open[0].ID())
+}
+
+func TestLoadAlertHistory_WithMissingFile(t *testing.T) {
+	recorded, err := logmon.LoadAlertHistory("missing-alert-history.jsonl")
+	require.NoError(t, err, "a missing file is an empty history")
+	require.Empty(t, recorded)
+}
+
+func TestOpenAlerts(t *testing.T) {
+	history := []logmon.ThresholdAlert{
+		{Kind: logmon.HighTraffic, Open: true},
+		{Kind: logmon.Abuse, Name: "10.0.0.1", Open: true},
+		{Kind: logmon.HighTraffic, Open: false},
+		{Kind: logmon.Abuse, Name: "10.0.0.2", Open: true},
+		{Kind: logmon.Abuse, Name: "10.0.0.2", Open: false},
+		{Kind: logmon.Abuse, Name: "10.0.0.2", Open: true},
+	}
+
+	open := logmon.OpenAlerts(history)
+	require.Len(t, open, 2, "only the alerts not recovered are open")
+	require.Equal(t, "abuse/10.0.0.1", open[0].ID())
+	require.Equal(t, "abuse/10.0.0.2", open[1].ID())
+}
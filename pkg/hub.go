@@ -0,0 +1,184 @@
+package logmon
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// OverflowPolicy defines what a Hub does with a message for a subscriber whose buffer is full.
+type OverflowPolicy int
+
+const (
+	Block      OverflowPolicy = iota // Wait for the subscriber: it holds back the publisher and so the other subscribers.
+	DropOldest                       // Drop the oldest buffered message to make room for the new one.
+	DropNewest                       // Drop the new message.
+)
+
+// String returns the name of the policy, as accepted by ParseSubscriberOpts.
+func (p OverflowPolicy) String() string {
+	switch p {
+	case DropOldest:
+		return "drop-oldest"
+	case DropNewest:
+		return "drop-newest"
+	}
+	return "block"
+}
+
+// SubscriberOpts defines the buffer of a subscriber and what to do when it is full.
+type SubscriberOpts struct {
+	Buffer   int // Messages buffered for the subscriber. At least 1 with the drop policies.
+	Overflow OverflowPolicy
+}
+
+// ParseSubscriberOpts creates SubscriberOpts from a definition like "100:drop-oldest".
+// The policy is block, drop-oldest or drop-newest.
+func ParseSubscriberOpts(definition string) (SubscriberOpts, error) {
+	parts := strings.Split(definition, ":")
+	if len(parts) != 2 {
+		return SubscriberOpts{}, fmt.Errorf("invalid subscriber %q: expected buffer:policy", definition)
+	}
+
+	buffer, err := strconv.Atoi(parts[0])
+	if err != nil || buffer < 0 {
+		return SubscriberOpts{}, fmt.Errorf("invalid subscriber %q: buffer must not be negative", definition)
+	}
+
+	for _, policy := range []OverflowPolicy{Block, DropOldest, DropNewest} {
+		if policy.String() == parts[1] {
+			return SubscriberOpts{Buffer: buffer, Overflow: policy}, nil
+		}
+	}
+	return SubscriberOpts{}, fmt.Errorf("invalid subscriber %q: policy must be block, drop-oldest or drop-newest", definition)
+}
+
+// Hub broadcasts a stream of messages to any number of subscribers.
+// Every subscriber has its own buffer and overflow policy, so only the subscribers that block
+// can hold back the publisher, and with it the other subscribers.
+// Publish and Close must be called from a single goroutine.
+type Hub struct {
+	name        string
+	mu          sync.Mutex
+	subscribers []*Subscriber
+}
+
+// NewHub creates a Hub.
+func NewHub(name string) *Hub {
+	return &Hub{name: name}
+}
+
+// Subscribe adds a subscriber. Subscribers only receive the messages published after they subscribe.
+func (h *Hub) Subscribe(name string, opts SubscriberOpts) *Subscriber {
+	if opts.Overflow != Block && opts.Buffer < 1 {
+		opts.Buffer = 1
+	}
+
+	s := &Subscriber{name: name, overflow: opts.Overflow, c: make(chan interface{}, opts.Buffer)}
+	h.mu.Lock()
+	h.subscribers = append(h.subscribers, s)
+	h.mu.Unlock()
+	return s
+}
+
+// Publish delivers a message to every subscriber, as their overflow policies allow.
+// It returns false if the context is done while waiting for a blocking subscriber.
+func (h *Hub) Publish(ctx context.Context, msg interface{}) bool {
+	for _, s := range h.snapshot() {
+		if !s.deliver(ctx, msg) {
+			return false
+		}
+	}
+	return true
+}
+
+// Close closes the channels of all the subscribers, once they have received their buffered messages.
+func (h *Hub) Close() {
+	for _, s := range h.snapshot() {
+		close(s.c)
+	}
+}
+
+// Stats returns the state of the buffers of the subscribers.
+func (h *Hub) Stats() []SubscriberStats {
+	var stats []SubscriberStats
+	for _, s := range h.snapshot() {
+		stats = append(stats, SubscriberStats{
+			Hub:        h.name,
+			Subscriber: s.name,
+			Buffered:   len(s.c),
+			Capacity:   cap(s.c),
+			Dropped:    s.Dropped(),
+		})
+	}
+	return stats
+}
+
+func (h *Hub) snapshot() []*Subscriber {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]*Subscriber(nil), h.subscribers...)
+}
+
+// SubscriberStats defines the state of the buffer of a subscriber.
+type SubscriberStats struct {
+	Hub        string
+	Subscriber string
+	Buffered   int
+	Capacity   int
+	Dropped    uint64
+}
+
+// Subscriber receives the messages of a Hub.
+type Subscriber struct {
+	name     string
+	overflow OverflowPolicy
+	c        chan interface{}
+	dropped  uint64 // Accessed atomically.
+}
+
+// C returns the channel of the messages. It is closed when the hub is closed.
+func (s *Subscriber) C() <-chan interface{} {
+	return s.c
+}
+
+// Dropped returns the number of messages dropped because the buffer was full.
+func (s *Subscriber) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+func (s *Subscriber) deliver(ctx context.Context, msg interface{}) bool {
+	switch s.overflow {
+	case DropNewest:
+		select {
+		case s.c <- msg:
+		default:
+			atomic.AddUint64(&s.dropped, 1)
+		}
+	case DropOldest:
+		for {
+			select {
+			case s.c <- msg:
+				return true
+			default:
+			}
+
+			// Make room, unless the subscriber just did it:
+			select {
+			case <-s.c:
+				atomic.AddUint64(&s.dropped, 1)
+			default:
+			}
+		}
+	default:
+		select {
+		case s.c <- msg:
+		case <-ctx.Done():
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,93 @@
+package logmon_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	logmon "github.com/jjrumi/accesslogmonitor/pkg"
+)
+
+func TestParseSubscriberOpts(t *testing.T) {
+	tests := map[string]struct {
+		definition string
+		expected   logmon.SubscriberOpts
+		error      string
+	}{
+		"block":           {"0:block", logmon.SubscriberOpts{Buffer: 0, Overflow: logmon.Block}, ""},
+		"drop oldest":     {"100:drop-oldest", logmon.SubscriberOpts{Buffer: 100, Overflow: logmon.DropOldest}, ""},
+		"drop newest":     {"5:drop-newest", logmon.SubscriberOpts{Buffer: 5, Overflow: logmon.DropNewest}, ""},
+		"missing policy":  {"100", logmon.SubscriberOpts{}, "expected buffer:policy"},
+		"unknown policy":  {"100:drop-all", logmon.SubscriberOpts{}, "policy must be block, drop-oldest or drop-newest"},
+		"negative buffer": {"-1:block", logmon.SubscriberOpts{}, "buffer must not be negative"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			opts, err := logmon.ParseSubscriberOpts(tc.definition)
+			if tc.error != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tc.error)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, opts)
+		})
+	}
+}
+
+func TestHub_OverflowPolicies(t *testing.T) {
+	tests := map[string]struct {
+		overflow logmon.OverflowPolicy
+		received []interface{}
+		dropped  uint64
+	}{
+		"drop oldest keeps the latest messages": {logmon.DropOldest, []interface{}{3, 4}, 2},
+		"drop newest keeps the first messages":  {logmon.DropNewest, []interface{}{1, 2}, 2},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			hub := logmon.NewHub("test")
+			sub := hub.Subscribe("slow", logmon.SubscriberOpts{Buffer: 2, Overflow: tc.overflow})
+			for i := 1; i <= 4; i++ {
+				require.True(t, hub.Publish(context.Background(), i))
+			}
+			hub.Close()
+
+			require.Equal(t, tc.received, givenAllMessages(sub))
+			require.Equal(t, tc.dropped, sub.Dropped())
+			require.Equal(t, []logmon.SubscriberStats{
+				{Hub: "test", Subscriber: "slow", Buffered: 0, Capacity: 2, Dropped: tc.dropped},
+			}, hub.Stats())
+		})
+	}
+}
+
+func TestHub_BlockingSubscriberHoldsBackThePublisher(t *testing.T) {
+	hub := logmon.NewHub("test")
+	blocking := hub.Subscribe("blocking", logmon.SubscriberOpts{Buffer: 1, Overflow: logmon.Block})
+	dropping := hub.Subscribe("dropping", logmon.SubscriberOpts{Buffer: 1, Overflow: logmon.DropNewest})
+
+	require.True(t, hub.Publish(context.Background(), 1))
+
+	// The buffer of the blocking subscriber is full, so the publisher waits until the context is done:
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.False(t, hub.Publish(ctx, 2))
+
+	hub.Close()
+	require.Equal(t, []interface{}{1}, givenAllMessages(blocking))
+	require.Equal(t, []interface{}{1}, givenAllMessages(dropping))
+	require.Zero(t, blocking.Dropped())
+}
+
+func givenAllMessages(sub *logmon.Subscriber) []interface{} {
+	var messages []interface{}
+	for msg := range sub.C() {
+		messages = append(messages, msg)
+	}
+	return messages
+}
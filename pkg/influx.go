@@ -0,0 +1,178 @@
+package logmon
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// InfluxWriterOpts defines the options required to build an InfluxDB StatsSink.
+type InfluxWriterOpts struct {
+	// URL of the write API, e.g. "http://localhost:8086/write?db=logmon" or
+	// "http://localhost:8086/api/v2/write?org=ops&bucket=logmon", or of a UDP listener, e.g. "udp://localhost:8089".
+	URL         string
+	Token       string   // Authentication token of the HTTP API, if any.
+	Tags        []string // Tags of every point as key=value, e.g. host=web-1.
+	TopSections int      // Sections with the most requests written every interval.
+	BatchSize   int      // Maximum lines per write.
+	MaxBuffer   int      // Maximum lines kept while the endpoint is down.
+}
+
+// NewInfluxWriter creates a StatsSink that writes every interval and alert as InfluxDB line protocol.
+func NewInfluxWriter(opts InfluxWriterOpts) StatsSink {
+	topSections := opts.TopSections
+	if topSections < 1 {
+		topSections = defaultTopSections
+	}
+
+	var tags []string
+	for _, tag := range opts.Tags {
+		kv := strings.SplitN(tag, "=", 2)
+		if len(kv) == 2 {
+			tags = append(tags, influxEscaper.Replace(kv[0])+"="+influxEscaper.Replace(kv[1]))
+		}
+	}
+	sort.Strings(tags) // InfluxDB performs best with tags sorted by key.
+
+	format := &influxFormat{tags: strings.Join(tags, ","), topSections: topSections}
+	transport := &influxTransport{url: opts.URL, token: opts.Token}
+	return newLineWriter("influxdb", format, transport, opts.BatchSize, opts.MaxBuffer)
+}
+
+// influxFormat implements the lineFormat interface with the InfluxDB line protocol.
+type influxFormat struct {
+	tags        string // Escaped and sorted.
+	topSections int
+}
+
+func (f *influxFormat) stats(s TrafficStats) []string {
+	ts := s.Time.UnixNano()
+	lines := []string{f.point("logmon_requests", nil, fmt.Sprintf("total=%di,bytes=%di", s.TotalReqs, s.Bytes), ts)}
+	for _, e := range sortedEntries(s.MethodHits, len(s.MethodHits)) {
+		lines = append(lines, f.point("logmon_methods", []string{"method", e.key}, fmt.Sprintf("hits=%di", e.val), ts))
+	}
+	for _, e := range sortedEntries(s.StatusClassHits, len(s.StatusClassHits)) {
+		lines = append(lines, f.point("logmon_statuses", []string{"class", e.key}, fmt.Sprintf("hits=%di", e.val), ts))
+	}
+	for _, e := range sortedEntries(s.SectionHits, f.topSections) {
+		lines = append(lines, f.point("logmon_sections", []string{"section", e.key}, fmt.Sprintf("hits=%di", e.val), ts))
+	}
+	return lines
+}
+
+func (f *influxFormat) alert(a ThresholdAlert) []string {
+	tags := []string{"kind", kindLabel(a.Kind)}
+	if a.Name != "" {
+		tags = append(tags, "name", a.Name)
+	}
+	fields := fmt.Sprintf(
+		"open=%t,silenced=%t,hits=%s,summary=%s",
+		a.Open, a.Silenced, strconv.FormatFloat(a.Hits, 'f', -1, 64), `"`+influxStringEscaper.Replace(a.Summary())+`"`,
+	)
+	return []string{f.point("logmon_alerts", tags, fields, a.Time.UnixNano())}
+}
+
+// point renders a line: measurement, tags as name and value pairs, fields and a timestamp in nanoseconds.
+func (f *influxFormat) point(measurement string, tags []string, fields string, ts int64) string {
+	var line strings.Builder
+	line.WriteString(measurement)
+	for i := 1; i < len(tags); i += 2 {
+		fmt.Fprintf(&line, ",%s=%s", tags[i-1], influxEscaper.Replace(tags[i]))
+	}
+	if f.tags != "" {
+		line.WriteString("," + f.tags)
+	}
+	fmt.Fprintf(&line, " %s %d", fields, ts)
+	return line.String()
+}
+
+// influxEscaper escapes tag keys and values of the line protocol.
+var influxEscaper = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `, "\n", `\n`)
+
+// influxStringEscaper escapes string field values of the line protocol.
+var influxStringEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// influxTransport implements the lineTransport interface with the HTTP write API or UDP.
+type influxTransport struct {
+	url    string
+	token  string
+	client *http.Client
+	conn   net.Conn // Set for UDP.
+}
+
+func (t *influxTransport) setup() (func(), error) {
+	u, err := url.Parse(t.url)
+	if err != nil {
+		return nil, fmt.Errorf("parse influxdb url: %w", err)
+	}
+
+	switch u.Scheme {
+	case "http", "https":
+		t.client = &http.Client{Timeout: 10 * time.Second}
+		return func() {}, nil
+	case "udp":
+		dialer := net.Dialer{Timeout: 5 * time.Second}
+		t.conn, err = dialer.Dial("udp", u.Host)
+		if err != nil {
+			return nil, fmt.Errorf("dial influxdb: %w", err)
+		}
+		cleanup := func() {
+			log.Printf("clean up: close influxdb socket...")
+			t.conn.Close()
+		}
+		return cleanup, nil
+	}
+	return nil, fmt.Errorf("invalid influxdb url %q: expected an http, https or udp scheme", t.url)
+}
+
+func (t *influxTransport) write(ctx context.Context, lines []string) error {
+	if t.conn != nil {
+		if err := t.conn.SetWriteDeadline(time.Now().Add(10 * time.Second)); err != nil {
+			return fmt.Errorf("send points: %w", err)
+		}
+		for _, packet := range packLines(lines, maxUDPPacket) {
+			if _, err := t.conn.Write(packet); err != nil {
+				return fmt.Errorf("send points: %w", err)
+			}
+		}
+		return nil
+	}
+
+	req, err := http.NewRequest(http.MethodPost, t.url, bytes.NewBufferString(strings.Join(lines, "\n")))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if t.token != "" {
+		req.Header.Set("Authorization", "Token "+t.token)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("write points: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		return nil
+	}
+
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode >= 400 && resp.StatusCode <= 499 && resp.StatusCode != http.StatusTooManyRequests {
+		// Rejected points would be rejected again: drop them instead of retrying.
+		log.Printf("error writing to influxdb, %d lines dropped: %s: %s", len(lines), resp.Status, bytes.TrimSpace(body))
+		return nil
+	}
+	return fmt.Errorf("write points: unexpected status %s: %s", resp.Status, bytes.TrimSpace(body))
+}
@@ -0,0 +1,119 @@
+package logmon_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	logmon "github.com/jjrumi/accesslogmonitor/pkg"
+)
+
+func TestInfluxWriter_BuffersLinesWhileTheEndpointIsDown(t *testing.T) {
+	var mu sync.Mutex
+	var writes []string
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		require.Equal(t, "Token secret", r.Header.Get("Authorization"))
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		writes = append(writes, string(body))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	writer := logmon.NewInfluxWriter(logmon.InfluxWriterOpts{
+		URL:   server.URL + "/write?db=logmon",
+		Token: "secret",
+		Tags:  []string{"host=web 1"},
+	})
+	cleanup, err := writer.Setup()
+	require.NoError(t, err)
+	defer cleanup()
+
+	// The first interval fails to be written, the second one is written along with it:
+	stats := make(chan logmon.TrafficStats, 2)
+	for i := 0; i < 2; i++ {
+		s := logmon.NewEmptyTrafficStats()
+		s.Update(logmon.LogEntry{ReqMethod: "GET", ReqPath: "/api/users", StatusCode: 200, Bytes: 100})
+		s.Time = time.Unix(1596326400+int64(i)*10, 0)
+		stats <- s
+	}
+	close(stats)
+
+	alert := givenAnAlert(true)
+	alert.Time = time.Unix(1596326405, 0)
+	alerts := make(chan logmon.ThresholdAlert, 1)
+	alerts <- alert
+	close(alerts)
+
+	writer.Run(context.Background(), stats, alerts)
+
+	// The alert might be written with the second interval or on shutdown:
+	require.NotEmpty(t, writes)
+	first := strings.Split(writes[0], "\n")
+	require.Contains(t, first, `logmon_requests,host=web\ 1 total=1i,bytes=100i 1596326400000000000`, "the failed write is retried")
+	require.Contains(t, first, `logmon_requests,host=web\ 1 total=1i,bytes=100i 1596326410000000000`)
+
+	lines := strings.Split(strings.Join(writes, "\n"), "\n")
+	require.Contains(t, lines, `logmon_sections,section=/api,host=web\ 1 hits=1i 1596326410000000000`)
+	require.Contains(t, lines, `logmon_methods,method=GET,host=web\ 1 hits=1i 1596326410000000000`)
+	require.Contains(t, lines, `logmon_statuses,class=2xx,host=web\ 1 hits=1i 1596326410000000000`)
+	require.Contains(t, lines, `logmon_alerts,kind=high_traffic,host=web\ 1 open=true,silenced=false,hits=12.5,summary="high traffic alert triggered - hits = 12.50 req/s" 1596326405000000000`)
+}
+
+func TestInfluxWriter_DoesNotHoldBackTheStreamsOnASlowEndpoint(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	writer := logmon.NewInfluxWriter(logmon.InfluxWriterOpts{URL: server.URL + "/write?db=logmon"})
+	cleanup, err := writer.Setup()
+	require.NoError(t, err)
+	defer cleanup()
+
+	stats := make(chan logmon.TrafficStats)
+	alerts := make(chan logmon.ThresholdAlert)
+	done := make(chan struct{})
+	go func() {
+		writer.Run(context.Background(), stats, alerts)
+		close(done)
+	}()
+
+	// The stats are consumed while the endpoint holds the first write:
+	for i := 0; i < 3; i++ {
+		select {
+		case stats <- logmon.NewEmptyTrafficStats():
+		case <-time.After(time.Second):
+			t.Fatal("the writer holds back the stats stream")
+		}
+	}
+
+	close(release)
+	close(stats)
+	close(alerts)
+	<-done
+}
+
+func TestInfluxWriter_FailsWithInvalidURLs(t *testing.T) {
+	writer := logmon.NewInfluxWriter(logmon.InfluxWriterOpts{URL: "tcp://localhost:8086"})
+	_, err := writer.Setup()
+	require.Error(t, err)
+}
@@ -0,0 +1,292 @@
+package logmon
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	ui "github.com/gizak/termui/v3"
+	"github.com/gizak/termui/v3/widgets"
+)
+
+// Default layouts of the terminal UI. See ParseLayout.
+const (
+	DefaultLayout        = "Traffic*2: traffic, config; Rates*2: chart*2, errors; Alerts*2: alerts, history; Sections*4: sections+clients, status+methods+slos"
+	DefaultCompactLayout = "Traffic*4: traffic, errors; Traffic*6: chart; Alerts*4: alerts; Alerts*6: history; Sections: sections, clients; HTTP: status, methods; SLOs: slos; Setup: config"
+)
+
+// LayoutPanels are the names of the panels of the terminal UI, for layouts.
+var LayoutPanels = []string{"traffic", "config", "chart", "errors", "alerts", "history", "sections", "clients", "status", "methods", "slos"}
+
+// Layout defines the panels of the terminal UI: rows of columns, each column stacking panels on top of each other.
+// Rows and columns take a share of the screen proportional to their weights. The panels left out are not displayed.
+type Layout struct {
+	Rows []LayoutRow
+}
+
+// LayoutRow is a row of a layout. The consecutive rows with the same name form a tab of the compact layout.
+type LayoutRow struct {
+	Name    string
+	Weight  float64
+	Columns []LayoutColumn
+}
+
+// LayoutColumn is a column of a row. Its panels share its height evenly.
+type LayoutColumn struct {
+	Weight float64
+	Panels []string
+}
+
+// ParseLayout parses a layout defined as rows separated by semicolons, such as
+// "Traffic*2: traffic, config; Alerts*3: alerts, history+slos".
+// A row is a name and a weight followed by a colon, both optional, then its columns separated by commas.
+// A column is a panel, or several panels separated by + signs, optionally followed by a weight.
+// Weights are written as *<number> and default to 1. A row without a name is named after its first panel.
+func ParseLayout(definition string) (Layout, error) {
+	var layout Layout
+	displayed := make(map[string]bool)
+	for _, r := range strings.Split(definition, ";") {
+		if strings.TrimSpace(r) == "" {
+			continue
+		}
+
+		row := LayoutRow{Weight: 1}
+		columns := r
+		if i := strings.Index(r, ":"); i >= 0 {
+			name, weight, err := parseWeight(r[:i])
+			if err != nil {
+				return Layout{}, fmt.Errorf("invalid row %q: %w", strings.TrimSpace(r), err)
+			}
+			row.Name, row.Weight, columns = name, weight, r[i+1:]
+		}
+
+		for _, c := range strings.Split(columns, ",") {
+			panels, weight, err := parseWeight(c)
+			if err != nil {
+				return Layout{}, fmt.Errorf("invalid column %q: %w", strings.TrimSpace(c), err)
+			}
+
+			column := LayoutColumn{Weight: weight}
+			for _, p := range strings.Split(panels, "+") {
+				p = strings.ToLower(strings.TrimSpace(p))
+				if !isLayoutPanel(p) {
+					return Layout{}, fmt.Errorf("unknown panel %q: expected one of %s", p, strings.Join(LayoutPanels, ", "))
+				}
+				if displayed[p] {
+					return Layout{}, fmt.Errorf("panel %q is displayed twice", p)
+				}
+				displayed[p] = true
+				column.Panels = append(column.Panels, p)
+			}
+			row.Columns = append(row.Columns, column)
+		}
+
+		if row.Name == "" {
+			first := row.Columns[0].Panels[0]
+			row.Name = strings.ToUpper(first[:1]) + first[1:]
+		}
+		layout.Rows = append(layout.Rows, row)
+	}
+
+	if len(layout.Rows) == 0 {
+		return Layout{}, fmt.Errorf("empty layout: expected at least one panel")
+	}
+	return layout, nil
+}
+
+// String returns the definition of the layout.
+func (l Layout) String() string {
+	var rows []string
+	for _, r := range l.Rows {
+		var columns []string
+		for _, c := range r.Columns {
+			columns = append(columns, withWeight(strings.Join(c.Panels, "+"), c.Weight))
+		}
+		rows = append(rows, fmt.Sprintf("%s: %s", withWeight(r.Name, r.Weight), strings.Join(columns, ", ")))
+	}
+	return strings.Join(rows, "; ")
+}
+
+// parseWeight splits an item of a layout into its value and its weight, 1 if omitted.
+func parseWeight(item string) (string, float64, error) {
+	item = strings.TrimSpace(item)
+	i := strings.LastIndex(item, "*")
+	if i < 0 {
+		return item, 1, nil
+	}
+
+	weight, err := strconv.ParseFloat(strings.TrimSpace(item[i+1:]), 64)
+	if err != nil || weight <= 0 {
+		return "", 0, fmt.Errorf("invalid weight %q: expected a positive number", strings.TrimSpace(item[i+1:]))
+	}
+	return strings.TrimSpace(item[:i]), weight, nil
+}
+
+func withWeight(value string, weight float64) string {
+	if weight == 1 {
+		return value
+	}
+	return fmt.Sprintf("%s*%g", value, weight)
+}
+
+func isLayoutPanel(name string) bool {
+	for _, p := range LayoutPanels {
+		if p == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Terminals narrower than compactWidth or shorter than compactHeight get the compact layout,
+// where the panels are grouped into tabs.
+const (
+	compactWidth  = 100
+	compactHeight = 30
+)
+
+// tabsHeight is the height of the tab bar of the compact layout.
+const tabsHeight = 3
+
+// screenPage is a group of panels displayed at once.
+type screenPage struct {
+	name   string
+	grid   *ui.Grid
+	panels []*widgets.List // Panels that can be focused, in reading order.
+}
+
+// buildPage arranges the panels of the screen along rows of a layout.
+func (s *screen) buildPage(name string, rows []LayoutRow) screenPage {
+	page := screenPage{name: name, grid: ui.NewGrid()}
+
+	var height float64
+	for _, r := range rows {
+		height += r.Weight
+	}
+
+	var gridRows []interface{}
+	for _, r := range rows {
+		var width float64
+		for _, c := range r.Columns {
+			width += c.Weight
+		}
+
+		var columns []interface{}
+		for _, c := range r.Columns {
+			var stacked []interface{}
+			for _, name := range c.Panels {
+				widget, panel := s.widget(name)
+				if panel != nil {
+					page.panels = append(page.panels, panel)
+				}
+				stacked = append(stacked, ui.NewRow(1.0/float64(len(c.Panels)), widget))
+			}
+			columns = append(columns, ui.NewCol(c.Weight/width, stacked...))
+		}
+		gridRows = append(gridRows, ui.NewRow(r.Weight/height, columns...))
+	}
+	page.grid.Set(gridRows...)
+
+	return page
+}
+
+// buildCompactPages groups the consecutive rows of the compact layout with the same name into tabs.
+func (s *screen) buildCompactPages() []screenPage {
+	var pages []screenPage
+	rows := s.u.compactLayout.Rows
+	for start := 0; start < len(rows); {
+		end := start + 1
+		for end < len(rows) && rows[end].Name == rows[start].Name {
+			end++
+		}
+		pages = append(pages, s.buildPage(rows[start].Name, rows[start:end]))
+		start = end
+	}
+	return pages
+}
+
+// widget returns a panel of the screen by its name in the layouts, along with the list to focus if it is one.
+func (s *screen) widget(name string) (ui.Drawable, *widgets.List) {
+	switch name {
+	case "chart":
+		return s.chart, nil
+	case "errors":
+		return s.sparklines, nil
+	}
+
+	panel := map[string]*widgets.List{
+		"traffic":  s.traffic,
+		"config":   s.config,
+		"alerts":   s.alerts,
+		"history":  s.history,
+		"sections": s.sections,
+		"clients":  s.clients,
+		"status":   s.status,
+		"methods":  s.methods,
+		"slos":     s.slos,
+	}[name]
+	return panel, panel
+}
+
+func (u terminalUI) buildTabsWidget(pages []screenPage) *widgets.TabPane {
+	var names []string
+	for i, page := range pages {
+		names = append(names, fmt.Sprintf("%d %s", i+1, page.name))
+	}
+
+	tabs := widgets.NewTabPane(names...)
+	tabs.Title = "[ and ] to switch"
+	tabs.ActiveTabStyle = u.theme.style(u.theme.Focus)
+
+	return tabs
+}
+
+// resize lays the views out for a terminal size, in the compact layout if the terminal is small.
+// The focused panel stays focused when the layout changes, if it is displayed.
+func (s *screen) resize(width, height int) {
+	focused := s.focused()
+
+	s.compact = width < compactWidth || height < compactHeight
+	s.full.grid.SetRect(0, 0, width, height)
+	s.tabs.SetRect(0, 0, width, tabsHeight)
+	for _, page := range s.pages {
+		page.grid.SetRect(0, tabsHeight, width, height)
+	}
+	s.drill.grid.SetRect(0, 0, width, height)
+	s.prompt.SetRect(0, height-4, width, height)
+
+	helpWidth := 90
+	if helpWidth > width {
+		helpWidth = width
+	}
+	lines := s.u.helpLines(helpWidth - 2)
+	s.helpBox.Text = strings.Join(lines, "\n")
+	helpHeight := len(lines) + 2
+	if helpHeight > height {
+		helpHeight = height
+	}
+	x, y := (width-helpWidth)/2, (height-helpHeight)/2
+	if x < 0 {
+		x = 0
+	}
+	if y < 0 {
+		y = 0
+	}
+	s.helpBox.SetRect(x, y, x+helpWidth, y+helpHeight)
+
+	if s.section == "" {
+		s.focusPanel(focused)
+	}
+}
+
+// selectPage displays a tab of the compact layout.
+func (s *screen) selectPage(page int) {
+	if !s.compact || s.section != "" || page < 0 || page >= len(s.pages) {
+		return
+	}
+
+	s.page = page
+	s.tabs.ActiveTabIndex = page
+	s.focus = 0
+	s.applyFocus()
+}
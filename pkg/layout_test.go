@@ -0,0 +1,202 @@
+package logmon_test
+
+import (
+	"image"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	logmon "github.com/jjrumi/accesslogmonitor/pkg"
+)
+
+func TestParseLayout(t *testing.T) {
+	layout, err := logmon.ParseLayout("Traffic*2: traffic, config; chart*2, errors; Alerts: alerts+history*0.5")
+	require.NoError(t, err)
+
+	expected := logmon.Layout{Rows: []logmon.LayoutRow{
+		{Name: "Traffic", Weight: 2, Columns: []logmon.LayoutColumn{
+			{Weight: 1, Panels: []string{"traffic"}},
+			{Weight: 1, Panels: []string{"config"}},
+		}},
+		{Name: "Chart", Weight: 1, Columns: []logmon.LayoutColumn{
+			{Weight: 2, Panels: []string{"chart"}},
+			{Weight: 1, Panels: []string{"errors"}},
+		}},
+		{Name: "Alerts", Weight: 1, Columns: []logmon.LayoutColumn{
+			{Weight: 0.5, Panels: []string{"alerts", "history"}},
+		}},
+	}}
+	require.Equal(t, expected, layout)
+	require.Equal(t, "Traffic*2: traffic, config; Chart: chart*2, errors; Alerts: alerts+history*0.5", layout.String())
+}
+
+func TestParseLayout_DefaultLayouts(t *testing.T) {
+	for _, definition := range []string{logmon.DefaultLayout, logmon.DefaultCompactLayout} {
+		layout, err := logmon.ParseLayout(definition)
+		require.NoError(t, err)
+		require.Equal(t, definition, layout.String())
+	}
+}
+
+func TestParseLayout_ReportsErrors(t *testing.T) {
+	tests := map[string]struct {
+		definition string
+		error      string
+	}{
+		"empty layout":       {" ; ", "empty layout"},
+		"unknown panel":      {"traffic, graph", `unknown panel "graph"`},
+		"empty column":       {"traffic,, config", `unknown panel ""`},
+		"panel twice":        {"traffic; alerts+traffic", `panel "traffic" is displayed twice`},
+		"invalid row weight": {"Traffic*x: traffic", `invalid row "Traffic*x: traffic": invalid weight "x"`},
+		"negative weight":    {"traffic*-1", `invalid column "traffic*-1": invalid weight "-1"`},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := logmon.ParseLayout(tc.definition)
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tc.error)
+		})
+	}
+}
+
+func TestScreen_SwitchesToTheCompactLayoutOnSmallTerminals(t *testing.T) {
+	tests := map[string]struct {
+		width, height int
+		compact       bool
+	}{
+		"large":          {120, 40, false},
+		"smallest full":  {100, 30, false},
+		"narrow":         {99, 40, true},
+		"short":          {120, 29, true},
+		"narrow & short": {80, 24, true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			s := givenAScreen(t, tc.width, tc.height)
+			require.Equal(t, tc.compact, s.Compact())
+		})
+	}
+}
+
+func TestScreen_LaysThePanelsOut(t *testing.T) {
+	tests := map[string]struct {
+		width, height int
+		page          int
+		rects         map[string]image.Rectangle
+	}{
+		"full layout": {
+			width: 100, height: 40,
+			rects: map[string]image.Rectangle{
+				"traffic": image.Rect(0, 0, 50, 10),
+				"config":  image.Rect(50, 0, 100, 10),
+				"alerts":  image.Rect(0, 10, 100, 25),
+				"history": image.Rect(0, 25, 100, 40),
+			},
+		},
+		"full layout, wider": {
+			width: 160, height: 50,
+			rects: map[string]image.Rectangle{
+				"traffic": image.Rect(0, 0, 80, 12),
+				"config":  image.Rect(80, 0, 160, 12),
+				"alerts":  image.Rect(0, 12, 160, 31),
+				"history": image.Rect(0, 31, 160, 50),
+			},
+		},
+		"compact layout, below the tabs": {
+			width: 80, height: 30,
+			rects: map[string]image.Rectangle{
+				"traffic": image.Rect(0, 3, 80, 17),
+				"config":  image.Rect(0, 17, 80, 30),
+			},
+		},
+		"compact layout, another tab": {
+			width: 80, height: 30, page: 1,
+			rects: map[string]image.Rectangle{
+				"alerts":  image.Rect(0, 3, 40, 30),
+				"history": image.Rect(40, 3, 80, 30),
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			s := givenAScreen(t, tc.width, tc.height)
+			s.SelectPage(tc.page)
+			require.Equal(t, tc.rects, s.Rects())
+		})
+	}
+}
+
+func TestScreen_SelectPage(t *testing.T) {
+	s := givenAScreen(t, 80, 30)
+	s.SelectPage(0)
+	require.Equal(t, 0, s.Page())
+	require.Equal(t, "traffic", s.Focused(), "the first panel of a tab is focused")
+
+	s.SelectPage(1)
+	require.Equal(t, 1, s.Page())
+	require.Equal(t, "alerts", s.Focused())
+
+	s.SelectPage(2)
+	s.SelectPage(-1)
+	require.Equal(t, 1, s.Page(), "tabs out of range are ignored")
+
+	s.Resize(120, 40)
+	s.SelectPage(0)
+	require.Equal(t, "alerts", s.Focused(), "tabs are ignored in the full layout")
+}
+
+func TestScreen_FocusAcrossPages(t *testing.T) {
+	s := givenAScreen(t, 80, 30)
+	require.Equal(t, 1, s.Page(), "the alert history is focused first, on its tab")
+	require.Equal(t, "history", s.Focused())
+
+	s.FocusPanel("config")
+	require.Equal(t, 0, s.Page(), "the tab of the panel is displayed")
+	require.Equal(t, "config", s.Focused())
+
+	s.Resize(120, 40)
+	require.False(t, s.Compact())
+	require.Equal(t, "config", s.Focused(), "the focus stays on the panel in the full layout")
+
+	s.FocusPanel("history")
+	s.Resize(80, 30)
+	require.Equal(t, 1, s.Page(), "the focus stays on the panel in the compact layout")
+	require.Equal(t, "history", s.Focused())
+
+	s.FocusPanel("sections")
+	require.Equal(t, 1, s.Page(), "panels not in the layout are not displayed")
+	require.Equal(t, "alerts", s.Focused())
+}
+
+func TestScreen_FitsTheHelpInTheTerminal(t *testing.T) {
+	tests := map[string]struct {
+		width, height int
+		help          image.Rectangle
+	}{
+		"large":          {120, 40, image.Rect(15, 11, 105, 28)},
+		"narrow & short": {80, 24, image.Rect(0, 3, 80, 21)},
+		"tiny":           {60, 12, image.Rect(0, 0, 60, 12)},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			s := givenAScreen(t, tc.width, tc.height)
+			help, lines := s.Help()
+			require.Equal(t, tc.help, help)
+			for _, line := range lines {
+				require.True(t, len([]rune(displayed(line))) <= help.Dx()-2, "the line %q fits in the help", displayed(line))
+			}
+		})
+	}
+}
+
+// givenAScreen creates a screen of a terminal of the given size, with a full layout of two rows
+// and a compact layout of two tabs.
+func givenAScreen(t *testing.T, width, height int) logmon.Screen {
+	s, err := logmon.NewScreen("traffic, config; Alerts*3: alerts+history", "Traffic: traffic; Traffic: config; Alerts: alerts, history", width, height)
+	require.NoError(t, err)
+	return s
+}
@@ -0,0 +1,202 @@
+package logmon
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"sync"
+)
+
+// lineFormat renders traffic stats and alerts as the lines of a text protocol.
+type lineFormat interface {
+	stats(s TrafficStats) []string
+	alert(a ThresholdAlert) []string
+}
+
+// lineTransport delivers batches of lines to an endpoint.
+type lineTransport interface {
+	setup() (func(), error)
+	write(ctx context.Context, lines []string) error
+}
+
+const (
+	defaultBatchSize = 500
+	defaultMaxBuffer = 50000
+)
+
+// lineWriter implements the StatsSink interface for line based protocols.
+// It buffers the lines of every interval and alert, and flushes them in batches once per interval.
+// The flushes run in the background, so a slow or unreachable endpoint never holds back the streams.
+// Lines of a failed flush stay in the buffer and are retried on the next flush,
+// so an endpoint can be down for a while without losing data. Once full, the oldest lines are dropped.
+type lineWriter struct {
+	name      string
+	format    lineFormat
+	transport lineTransport
+	batchSize int
+	maxBuffer int
+
+	mu     sync.Mutex
+	buffer []string      // Lines not sent yet, oldest first. Guarded by mu.
+	flushc chan struct{} // Signalled on every interval.
+}
+
+// newLineWriter creates a lineWriter. Default sizes are used for batchSize and maxBuffer below 1.
+func newLineWriter(name string, format lineFormat, transport lineTransport, batchSize, maxBuffer int) *lineWriter {
+	if batchSize < 1 {
+		batchSize = defaultBatchSize
+	}
+	if maxBuffer < 1 {
+		maxBuffer = defaultMaxBuffer
+	}
+
+	return &lineWriter{
+		name:      name,
+		format:    format,
+		transport: transport,
+		batchSize: batchSize,
+		maxBuffer: maxBuffer,
+		flushc:    make(chan struct{}, 1),
+	}
+}
+
+// Name identifies the sink.
+func (w *lineWriter) Name() string {
+	return w.name
+}
+
+// Setup prepares the transport. It returns a callback to release it.
+func (w *lineWriter) Setup() (func(), error) {
+	return w.transport.setup()
+}
+
+// Run consumes traffic stats and alerts and writes them, until both streams are closed.
+// Alerts are written along with the next interval. Once both streams are closed, the lines left are flushed.
+func (w *lineWriter) Run(ctx context.Context, stats <-chan TrafficStats, alerts <-chan ThresholdAlert) {
+	closing := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		w.sendLines(ctx, closing)
+		close(done)
+	}()
+
+LOOP:
+	for stats != nil || alerts != nil {
+		select {
+		case s, ok := <-stats:
+			if !ok {
+				stats = nil
+				continue
+			}
+			w.push(w.format.stats(s))
+			select {
+			case w.flushc <- struct{}{}:
+			default: // A flush is pending already.
+			}
+		case a, ok := <-alerts:
+			if !ok {
+				alerts = nil
+				continue
+			}
+			w.push(w.format.alert(a))
+		case <-ctx.Done():
+			break LOOP
+		}
+	}
+
+	close(closing)
+	<-done
+
+	w.mu.Lock()
+	unsent := len(w.buffer)
+	w.mu.Unlock()
+	log.Printf("clean up: %s writer stopped with %d lines unsent", w.name, unsent)
+}
+
+// sendLines flushes the buffer on every interval, until the context is done.
+// Once closing is closed, it flushes the buffer one last time.
+func (w *lineWriter) sendLines(ctx context.Context, closing <-chan struct{}) {
+	for {
+		select {
+		case <-w.flushc:
+			w.flush(ctx)
+		case <-closing:
+			select {
+			case <-w.flushc:
+				w.flush(ctx) // The flush of the last interval.
+			default:
+			}
+			if ctx.Err() == nil {
+				w.flush(ctx)
+			}
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// push appends lines to the buffer. Once full, the oldest lines are dropped.
+func (w *lineWriter) push(lines []string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buffer = append(w.buffer, lines...)
+	if dropped := len(w.buffer) - w.maxBuffer; dropped > 0 {
+		log.Printf("error writing to %s: buffer full, %d lines dropped", w.name, dropped)
+		w.buffer = w.buffer[dropped:]
+	}
+}
+
+// flush writes the buffered lines in batches. It stops on the first failed batch.
+// The buffer is not locked while writing: the lines pushed meanwhile are sent by the next flush.
+func (w *lineWriter) flush(ctx context.Context) {
+	w.mu.Lock()
+	pending := w.buffer
+	w.buffer = nil
+	w.mu.Unlock()
+
+	for len(pending) > 0 {
+		n := w.batchSize
+		if n > len(pending) {
+			n = len(pending)
+		}
+
+		if err := w.transport.write(ctx, pending[:n]); err != nil {
+			log.Printf("error writing to %s, %d lines buffered: %v", w.name, len(pending), err)
+			break
+		}
+		pending = pending[n:]
+	}
+	if len(pending) == 0 {
+		return
+	}
+
+	// Put the lines not sent back in front of the ones pushed meanwhile:
+	w.mu.Lock()
+	buffer := w.buffer
+	w.buffer = append(append([]string(nil), pending...), buffer...)
+	w.mu.Unlock()
+	w.push(nil)
+}
+
+// packLines joins lines with newlines into packets of up to max bytes.
+// A line longer than max gets a packet of its own.
+func packLines(lines []string, max int) [][]byte {
+	var packets [][]byte
+	var packet bytes.Buffer
+	for _, line := range lines {
+		if packet.Len() > 0 && packet.Len()+1+len(line) > max {
+			packets = append(packets, append([]byte(nil), packet.Bytes()...))
+			packet.Reset()
+		}
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(line)
+	}
+	if packet.Len() > 0 {
+		packets = append(packets, packet.Bytes())
+	}
+	return packets
+}
@@ -0,0 +1,157 @@
+package logmon
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaintenanceWindow defines a recurring period during which alerts are silenced.
+// It starts on a cron schedule and lasts for a fixed duration.
+type MaintenanceWindow struct {
+	schedule cronSchedule
+	duration time.Duration
+	spec     string
+}
+
+// ParseMaintenanceWindow creates a MaintenanceWindow from a definition like "0 2 * * 0 2h":
+// a cron schedule (minute hour day-of-month month day-of-week) followed by a Go duration.
+// E.g. "0 2 * * 0 2h" is every Sunday from 02:00 to 04:00, "*/30 9-17 * * 1-5 5m" the first 5 minutes
+// of every half hour during office hours.
+func ParseMaintenanceWindow(definition string) (MaintenanceWindow, error) {
+	fields := strings.Fields(definition)
+	if len(fields) != 6 {
+		return MaintenanceWindow{}, fmt.Errorf("invalid maintenance window %q: expected a cron schedule and a duration", definition)
+	}
+
+	schedule, err := parseCronSchedule(fields[:5])
+	if err != nil {
+		return MaintenanceWindow{}, fmt.Errorf("invalid maintenance window %q: %w", definition, err)
+	}
+
+	duration, err := time.ParseDuration(fields[5])
+	if err != nil || duration < time.Minute {
+		return MaintenanceWindow{}, fmt.Errorf("invalid maintenance window %q: duration must be at least one minute", definition)
+	}
+
+	return MaintenanceWindow{schedule: schedule, duration: duration, spec: strings.Join(fields, " ")}, nil
+}
+
+// Active tells whether the given time is within the window.
+// It looks back for a start of the schedule within the duration of the window.
+func (w MaintenanceWindow) Active(at time.Time) bool {
+	for start := at.Truncate(time.Minute); at.Sub(start) < w.duration; start = start.Add(-time.Minute) {
+		if w.schedule.matches(start) {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns the window as in its definition.
+func (w MaintenanceWindow) String() string {
+	return w.spec
+}
+
+// cronSchedule matches the minutes of a cron schedule. Every field is a bit set of the allowed values.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	anyDOM, anyDOW                bool
+}
+
+// cronFields are the bounds of the fields of a cron schedule.
+var cronFields = []struct {
+	name     string
+	min, max int
+}{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7}, // Both 0 and 7 are Sunday.
+}
+
+func parseCronSchedule(fields []string) (cronSchedule, error) {
+	var sets [5]uint64
+	for i, field := range fields {
+		set, err := parseCronField(field, cronFields[i].min, cronFields[i].max)
+		if err != nil {
+			return cronSchedule{}, fmt.Errorf("%s: %w", cronFields[i].name, err)
+		}
+		sets[i] = set
+	}
+
+	if sets[4]&(1<<7) != 0 {
+		sets[4] |= 1
+	}
+
+	return cronSchedule{
+		minute: sets[0], hour: sets[1], dom: sets[2], month: sets[3], dow: sets[4],
+		anyDOM: fields[2] == "*", anyDOW: fields[4] == "*",
+	}, nil
+}
+
+// parseCronField parses a comma separated list of values, ranges (a-b) and steps (*/n, a-b/n or a/n).
+// As in cron, a step from a value runs up to the maximum, e.g. 5/10 is 5,15,25...
+func parseCronField(field string, min, max int) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		i := strings.Index(part, "/")
+		if i >= 0 {
+			var err error
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step %q", part)
+			}
+			part = part[:i]
+		}
+
+		from, to := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if from, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("invalid value %q", part)
+			}
+			to = from
+			if i >= 0 {
+				to = max
+			}
+			if len(bounds) == 2 {
+				if to, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, fmt.Errorf("invalid range %q", part)
+				}
+			}
+		}
+		if from < min || to > max || from > to {
+			return 0, fmt.Errorf("%q out of range %d-%d", part, min, max)
+		}
+
+		for v := from; v <= to; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+	return set, nil
+}
+
+// matches tells whether the schedule fires at the minute of the given time.
+// As in cron, when both days are restricted, either of them matches.
+func (s cronSchedule) matches(t time.Time) bool {
+	if s.minute&(1<<uint(t.Minute())) == 0 || s.hour&(1<<uint(t.Hour())) == 0 || s.month&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	switch {
+	case s.anyDOM && s.anyDOW:
+		return true
+	case s.anyDOM:
+		return dow
+	case s.anyDOW:
+		return dom
+	}
+	return dom || dow
+}
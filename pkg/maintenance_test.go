@@ -0,0 +1,100 @@
+package logmon_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	logmon "github.com/jjrumi/accesslogmonitor/pkg"
+)
+
+func TestMaintenanceWindow_Active(t *testing.T) {
+	// Sunday, 2 August 2020:
+	sunday := func(hour, min int) time.Time {
+		return time.Date(2020, 8, 2, hour, min, 0, 0, time.UTC)
+	}
+
+	for name, tc := range map[string]struct {
+		definition string
+		at         time.Time
+
+		succeeds bool
+		active   bool
+	}{
+		"it is active since the start of the schedule": {
+			definition: "0 2 * * 0 2h",
+			at:         sunday(2, 0),
+			succeeds:   true,
+			active:     true,
+		},
+		"it is active for the duration of the window": {
+			definition: "0 2 * * 0 2h",
+			at:         sunday(3, 59),
+			succeeds:   true,
+			active:     true,
+		},
+		"it is inactive once the duration is over": {
+			definition: "0 2 * * 0 2h",
+			at:         sunday(4, 0),
+			succeeds:   true,
+			active:     false,
+		},
+		"it is inactive on other days of the week": {
+			definition: "0 2 * * 1-5 2h",
+			at:         sunday(3, 0),
+			succeeds:   true,
+			active:     false,
+		},
+		"it supports steps and lists": {
+			definition: "*/30 1,3 * * * 5m",
+			at:         sunday(3, 34),
+			succeeds:   true,
+			active:     true,
+		},
+		"it supports steps from a value": {
+			definition: "5/10 3 * * * 1m",
+			at:         sunday(3, 25),
+			succeeds:   true,
+			active:     true,
+		},
+		"it does not match off the steps from a value": {
+			definition: "5/10 3 * * * 1m",
+			at:         sunday(3, 10),
+			succeeds:   true,
+			active:     false,
+		},
+		"it matches either day when both are restricted": {
+			definition: "0 0 15 * 0 24h",
+			at:         sunday(12, 0),
+			succeeds:   true,
+			active:     true,
+		},
+		"it spans across days": {
+			definition: "0 22 * * 6 4h",
+			at:         sunday(1, 0),
+			succeeds:   true,
+			active:     true,
+		},
+		"it fails without a duration": {
+			definition: "0 2 * * 0",
+			succeeds:   false,
+		},
+		"it fails with values out of range": {
+			definition: "0 24 * * 0 1h",
+			succeeds:   false,
+		},
+		"it fails with invalid steps": {
+			definition: "*/0 2 * * 0 1h",
+			succeeds:   false,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			w, err := logmon.ParseMaintenanceWindow(tc.definition)
+			require.Equal(t, tc.succeeds, err == nil)
+			if tc.succeeds {
+				require.Equal(t, tc.active, w.Active(tc.at))
+			}
+		})
+	}
+}
@@ -0,0 +1,349 @@
+package logmon
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StatsSink consumes traffic stats and alerts, and ships them to an external metrics system.
+type StatsSink interface {
+	Name() string
+	Setup() (func(), error)
+	Run(ctx context.Context, stats <-chan TrafficStats, alerts <-chan ThresholdAlert)
+}
+
+// MetricsExporter is a StatsSink that serves the traffic stats and alerts as Prometheus metrics.
+type MetricsExporter interface {
+	StatsSink
+	http.Handler
+}
+
+// MetricsExporterOpts defines the options required to build a MetricsExporter.
+type MetricsExporterOpts struct {
+	Addr            string // Address to serve /metrics on, e.g. ":9100".
+	RefreshInterval int    // In seconds.
+	MaxSections     int    // Sections with their own label value, "other" included. The rest are counted as "other".
+	Hubs            []*Hub // Hubs to expose the buffers and drops of their subscribers.
+}
+
+const (
+	defaultMaxSections = 50
+	maxMethods         = 20
+	otherLabel         = "other"
+)
+
+// NewMetricsExporter creates a MetricsExporter.
+func NewMetricsExporter(opts MetricsExporterOpts) MetricsExporter {
+	maxSections := opts.MaxSections
+	if maxSections < 1 {
+		maxSections = defaultMaxSections
+	}
+
+	return &metricsExporter{
+		addr:        opts.Addr,
+		interval:    time.Duration(opts.RefreshInterval) * time.Second,
+		start:       time.Now(),
+		sections:    newBoundedCounter(maxSections),
+		methods:     newBoundedCounter(maxMethods),
+		statuses:    make(map[string]float64),
+		open:        make(map[AlertKind]map[string]bool),
+		transitions: make(map[alertTransition]float64),
+		hubs:        opts.Hubs,
+	}
+}
+
+// metricsExporter implements the MetricsExporter interface.
+// Traffic is exposed as counters accumulated over all the intervals, as Prometheus expects.
+type metricsExporter struct {
+	addr     string
+	interval time.Duration
+	start    time.Time
+	server   *http.Server
+
+	mu           sync.Mutex
+	requests     float64
+	bytes        float64
+	rate         float64 // Requests per second of the last interval.
+	intervals    float64
+	lastInterval time.Time
+	sections     *boundedCounter
+	methods      *boundedCounter
+	statuses     map[string]float64
+	open         map[AlertKind]map[string]bool // IDs of the open alerts of every kind.
+	transitions  map[alertTransition]float64
+	hubs         []*Hub
+}
+
+// alertTransition is the label set of the alert transitions counter.
+type alertTransition struct {
+	kind  AlertKind
+	state string
+}
+
+// Name identifies the sink.
+func (m *metricsExporter) Name() string {
+	return "prometheus"
+}
+
+// Setup starts serving the metrics on /metrics.
+// It returns a callback to stop the HTTP server.
+func (m *metricsExporter) Setup() (func(), error) {
+	listener, err := net.Listen("tcp", m.addr)
+	if err != nil {
+		return nil, fmt.Errorf("listen for metrics: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m)
+	m.server = &http.Server{Handler: mux}
+	go func() {
+		if err := m.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("error serving metrics: %v", err)
+		}
+	}()
+
+	cleanup := func() {
+		log.Printf("clean up: stop metrics server...")
+		m.server.Close()
+	}
+
+	return cleanup, nil
+}
+
+// Run consumes traffic stats and alerts to update the metrics, until both streams are closed.
+func (m *metricsExporter) Run(ctx context.Context, stats <-chan TrafficStats, alerts <-chan ThresholdAlert) {
+LOOP:
+	for stats != nil || alerts != nil {
+		select {
+		case s, ok := <-stats:
+			if !ok {
+				stats = nil
+				continue
+			}
+			m.observeStats(s)
+		case a, ok := <-alerts:
+			if !ok {
+				alerts = nil
+				continue
+			}
+			m.observeAlert(a)
+		case <-ctx.Done():
+			break LOOP
+		}
+	}
+	log.Printf("clean up: metrics exporter stopped")
+}
+
+func (m *metricsExporter) observeStats(s TrafficStats) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests += float64(s.TotalReqs)
+	m.bytes += float64(s.Bytes)
+	if m.interval > 0 {
+		m.rate = float64(s.TotalReqs) / m.interval.Seconds()
+	}
+	m.intervals++
+	m.lastInterval = s.Time
+
+	for section, hits := range s.SectionHits {
+		m.sections.add(section, float64(hits))
+	}
+	for method, hits := range s.MethodHits {
+		m.methods.add(method, float64(hits))
+	}
+	for class, hits := range s.StatusClassHits {
+		m.statuses[class] += float64(hits)
+	}
+}
+
+func (m *metricsExporter) observeAlert(a ThresholdAlert) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.open[a.Kind] == nil {
+		m.open[a.Kind] = make(map[string]bool)
+	}
+
+	state := "recovered"
+	if a.Open {
+		state = "open"
+		m.open[a.Kind][a.ID()] = true
+	} else {
+		delete(m.open[a.Kind], a.ID())
+	}
+	m.transitions[alertTransition{kind: a.Kind, state: state}]++
+}
+
+// ServeHTTP writes the metrics in the Prometheus text format,
+// or in the OpenMetrics text format when the scraper accepts it.
+func (m *metricsExporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	mw := &metricsWriter{openMetrics: strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text")}
+	m.write(mw)
+
+	if mw.openMetrics {
+		w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	}
+	_, _ = w.Write(mw.buf.Bytes())
+}
+
+func (m *metricsExporter) write(w *metricsWriter) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	w.family("logmon_requests", "counter", "Requests read from the log file.")
+	w.sample(nil, m.requests)
+	w.family("logmon_section_requests", "counter", "Requests by section. Sections beyond the limit are counted as other.")
+	for _, section := range sortedKeys(m.sections.counts) {
+		w.sample([]string{"section", section}, m.sections.counts[section])
+	}
+	w.family("logmon_method_requests", "counter", "Requests by HTTP method.")
+	for _, method := range sortedKeys(m.methods.counts) {
+		w.sample([]string{"method", method}, m.methods.counts[method])
+	}
+	w.family("logmon_status_responses", "counter", "Responses by HTTP status class.")
+	for _, class := range sortedKeys(m.statuses) {
+		w.sample([]string{"class", class}, m.statuses[class])
+	}
+	w.family("logmon_response_bytes", "counter", "Bytes transferred in the responses.")
+	w.sample(nil, m.bytes)
+	w.family("logmon_requests_per_second", "gauge", "Requests per second during the last interval.")
+	w.sample(nil, m.rate)
+
+	w.family("logmon_alerts_open", "gauge", "Open alerts by kind.")
+	for kind := HighTraffic; kind <= Abuse; kind++ {
+		w.sample([]string{"kind", kindLabel(kind)}, float64(len(m.open[kind])))
+	}
+	w.family("logmon_alert_transitions", "counter", "Alerts triggered and recovered by kind.")
+	for kind := HighTraffic; kind <= Abuse; kind++ {
+		for _, state := range []string{"open", "recovered"} {
+			w.sample([]string{"kind", kindLabel(kind), "state", state}, m.transitions[alertTransition{kind: kind, state: state}])
+		}
+	}
+
+	w.family("logmon_intervals", "counter", "Refresh intervals processed.")
+	w.sample(nil, m.intervals)
+	w.family("logmon_last_interval_timestamp_seconds", "gauge", "End of the last interval processed, as a Unix time.")
+	w.sample(nil, unixSeconds(m.lastInterval))
+	w.family("logmon_start_time_seconds", "gauge", "Start of the monitor, as a Unix time.")
+	w.sample(nil, unixSeconds(m.start))
+
+	var subscribers []SubscriberStats
+	for _, hub := range m.hubs {
+		subscribers = append(subscribers, hub.Stats()...)
+	}
+	w.family("logmon_hub_buffered_messages", "gauge", "Messages buffered for a subscriber of a hub.")
+	for _, s := range subscribers {
+		w.sample([]string{"hub", s.Hub, "subscriber", s.Subscriber}, float64(s.Buffered))
+	}
+	w.family("logmon_hub_dropped_messages", "counter", "Messages dropped for a subscriber of a hub because its buffer was full.")
+	for _, s := range subscribers {
+		w.sample([]string{"hub", s.Hub, "subscriber", s.Subscriber}, float64(s.Dropped))
+	}
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	w.family("go_goroutines", "gauge", "Number of goroutines that currently exist.")
+	w.sample(nil, float64(runtime.NumGoroutine()))
+	w.family("go_memstats_heap_alloc_bytes", "gauge", "Number of heap bytes allocated and still in use.")
+	w.sample(nil, float64(mem.HeapAlloc))
+
+	w.end()
+}
+
+func kindLabel(kind AlertKind) string {
+	text, _ := kind.MarshalText()
+	return string(text)
+}
+
+func unixSeconds(t time.Time) float64 {
+	if t.IsZero() {
+		return 0
+	}
+	return float64(t.UnixNano()) / 1e9
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// boundedCounter counts by label value, up to a maximum number of label values to bound the cardinality.
+// Once full, new label values are counted as "other". Known label values keep being counted, so counters never go down.
+type boundedCounter struct {
+	max    int
+	counts map[string]float64
+}
+
+func newBoundedCounter(max int) *boundedCounter {
+	return &boundedCounter{max: max, counts: make(map[string]float64)}
+}
+
+func (c *boundedCounter) add(label string, n float64) {
+	if _, ok := c.counts[label]; !ok && len(c.counts) >= c.max-1 {
+		label = otherLabel
+	}
+	c.counts[label] += n
+}
+
+// metricsWriter writes metric families in the Prometheus or OpenMetrics text formats.
+type metricsWriter struct {
+	buf         bytes.Buffer
+	openMetrics bool
+	name        string // Name of the samples of the current family.
+}
+
+// family starts a metric family. Counters are given without their _total suffix.
+func (w *metricsWriter) family(name, typ, help string) {
+	w.name = name
+	if typ == "counter" {
+		w.name += "_total"
+		if !w.openMetrics {
+			name = w.name
+		}
+	}
+	fmt.Fprintf(&w.buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// sample writes a sample of the current family with the given label name and value pairs.
+func (w *metricsWriter) sample(labels []string, value float64) {
+	w.buf.WriteString(w.name)
+	if len(labels) > 0 {
+		w.buf.WriteByte('{')
+		for i := 0; i < len(labels); i += 2 {
+			if i > 0 {
+				w.buf.WriteByte(',')
+			}
+			fmt.Fprintf(&w.buf, "%s=\"%s\"", labels[i], labelEscaper.Replace(labels[i+1]))
+		}
+		w.buf.WriteByte('}')
+	}
+	fmt.Fprintf(&w.buf, " %s\n", strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+// end terminates the exposition.
+func (w *metricsWriter) end() {
+	if w.openMetrics {
+		w.buf.WriteString("# EOF\n")
+	}
+}
+
+// labelEscaper escapes label values as required by the text formats.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
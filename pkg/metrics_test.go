@@ -0,0 +1,78 @@
+package logmon_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	logmon "github.com/jjrumi/accesslogmonitor/pkg"
+)
+
+func TestMetricsExporter_ExposesTrafficAndAlerts(t *testing.T) {
+	exporter := logmon.NewMetricsExporter(logmon.MetricsExporterOpts{RefreshInterval: 10, MaxSections: 3})
+
+	// Every interval hits a new section, so only the first ones get their own label:
+	stats := make(chan logmon.TrafficStats, 4)
+	for _, path := range []string{"/api/users", "/api/posts", "/blog", "/static/app.js"} {
+		s := logmon.NewEmptyTrafficStats()
+		s.Update(logmon.LogEntry{ReqMethod: "GET", ReqPath: path, StatusCode: 200, Bytes: 100})
+		s.Update(logmon.LogEntry{ReqMethod: "POST", ReqPath: path, StatusCode: 503, Bytes: 10})
+		s.Time = time.Unix(1596326400, 0)
+		stats <- s
+	}
+	close(stats)
+
+	alerts := make(chan logmon.ThresholdAlert, 3)
+	alerts <- logmon.ThresholdAlert{Kind: logmon.Abuse, Name: "10.0.0.1", Open: true}
+	alerts <- logmon.ThresholdAlert{Kind: logmon.Abuse, Name: "10.0.0.2", Open: true}
+	alerts <- logmon.ThresholdAlert{Kind: logmon.Abuse, Name: "10.0.0.1", Open: false}
+	close(alerts)
+
+	exporter.Run(context.Background(), stats, alerts)
+
+	rec := httptest.NewRecorder()
+	exporter.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	require.Equal(t, "text/plain; version=0.0.4; charset=utf-8", rec.Header().Get("Content-Type"))
+
+	body := rec.Body.String()
+	for _, line := range []string{
+		"# TYPE logmon_requests_total counter",
+		"logmon_requests_total 8",
+		`logmon_section_requests_total{section="/api"} 4`,
+		`logmon_section_requests_total{section="/blog"} 2`,
+		`logmon_section_requests_total{section="other"} 2`,
+		`logmon_method_requests_total{method="POST"} 4`,
+		`logmon_status_responses_total{class="5xx"} 4`,
+		"logmon_response_bytes_total 440",
+		"logmon_requests_per_second 0.2",
+		`logmon_alerts_open{kind="abuse"} 1`,
+		`logmon_alerts_open{kind="high_traffic"} 0`,
+		`logmon_alert_transitions_total{kind="abuse",state="open"} 2`,
+		`logmon_alert_transitions_total{kind="abuse",state="recovered"} 1`,
+		"logmon_intervals_total 4",
+		"logmon_last_interval_timestamp_seconds 1.5963264e+09",
+	} {
+		require.Contains(t, body, line+"\n")
+	}
+	require.NotContains(t, body, `section="/static"`, "sections beyond the limit are counted as other")
+	require.NotContains(t, body, "# EOF")
+}
+
+func TestMetricsExporter_NegotiatesOpenMetrics(t *testing.T) {
+	exporter := logmon.NewMetricsExporter(logmon.MetricsExporterOpts{RefreshInterval: 10})
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text; version=1.0.0,text/plain;q=0.5")
+	rec := httptest.NewRecorder()
+	exporter.ServeHTTP(rec, req)
+
+	body := rec.Body.String()
+	require.True(t, strings.HasPrefix(rec.Header().Get("Content-Type"), "application/openmetrics-text"))
+	require.Contains(t, body, "# TYPE logmon_requests counter\n", "counter families have no _total suffix")
+	require.Contains(t, body, "logmon_requests_total 0\n", "counter samples have a _total suffix")
+	require.True(t, strings.HasSuffix(body, "# EOF\n"))
+}
@@ -6,66 +6,247 @@ import (
 	"io"
 	"io/ioutil"
 	"log"
+	"os"
 	"sync"
+	"time"
 )
 
 // MonitorOpts defines the options required to build a Monitor.
 type MonitorOpts struct {
-	LogFilePath     string
+	Sources         []LogSource // Log files to monitor.
 	RefreshInterval int
 	AlertThreshold  int
 	AlertWindow     int
+	AlertFloor      int
+	NoDataTimeout   int
+	AnomalySigmas   float64
+	AnomalyAlpha    float64
+	AnomalySeasonal bool
+	SpikePercent    int
+	SpikeWindow     int
+	SLOs            []SLO
+	ClientKey       ClientKey
+	ClientCapacity  int
+	Windows         []time.Duration // Periods of the rolling windows of the traffic stats.
+	ClientRate      int
+	ClientErrors    int
+	Sinks           []Sink
+	HistoryPath     string           // File to record the alerts into. No history is recorded if empty.
+	History         []ThresholdAlert // Alerts recorded by previous runs.
+	SilencesPath    string           // File to keep the silences into. Alerts cannot be silenced if empty.
+	SilenceDuration time.Duration    // Duration of the silences created from the UI.
+	Maintenance     []MaintenanceWindow
+	MetricsAddr     string         // Address to serve Prometheus metrics on. No metrics are served if empty.
+	MetricsSections int            // Sections with their own label value in the metrics.
+	DashboardAddr   string         // Address to serve the web dashboard on. Disabled if empty.
+	APIAddr         string         // Address to serve the query API on. Disabled if empty.
+	APIRetention    time.Duration  // Period of traffic stats kept for the query API.
+	StorePath       string         // Directory to persist the traffic stats into. Disabled if empty.
+	StoreRetention  StatsStoreOpts // Retentions of the resolutions of the store.
+	Filter          Filter         // Filter of the log entries aggregated into traffic stats, editable from the UI.
+	StatsSinks      []StatsSink
+	Layout          Layout                    // Panels of the terminal UI. DefaultLayout if empty.
+	CompactLayout   Layout                    // Panels of the terminal UI on small terminals. DefaultCompactLayout if empty.
+	Theme           Theme                     // Colours of the terminal UI. DefaultTheme if empty.
+	Headless        bool                      // Write the stats and alerts on stdout instead of running the terminal UI.
+	OutputFormat    string                    // Format of the headless output: JSONFormat or LogfmtFormat.
+	Subscribers     map[string]SubscriberOpts // Buffers and overflow policies of the consumers of the hubs, by hub/consumer.
+	Config          Config                    // Configuration the options are built from, to diff the reloaded ones against.
+	Reloads         <-chan ConfigReload       // Configurations reloaded while the monitor runs. No reloads if nil.
 }
 
 // Monitor is a log monitor composed of:
-// - a file watcher which detects changes in the log file and produces a stream of LogEntry
+// - file watchers which detect changes in the log files and produce a merged stream of LogEntry
+// - an entry filter which drops the LogEntry not matching the filter set from the command line or the UI
 // - a traffic supervisor which consumes the stream of LogEntry and produces a stream of TrafficStats
 // - an alert supervisor which consumes the stream of TrafficStats and produces a stream of ThresholdAlert
+// - a silencer which marks the alerts matched by a silence or a maintenance window
+// - a notifier which consumes the stream of ThresholdAlert and delivers them to external sinks
+// - an optional alert history which consumes the stream of ThresholdAlert and records them into a file
+// - optional stats sinks which ship the TrafficStats and ThresholdAlert streams to metrics systems, e.g. Prometheus
 // - an UI which displays information consumed from the TrafficStats and ThresholdAlert streams
+// - hubs which broadcast the TrafficStats and ThresholdAlert streams to their consumers
+// - a reloader which applies the configurations reloaded to the components above while they run
 type Monitor struct {
-	fileWatcher LogEntryProducer
+	sources     *sourceWatchers
+	filter      EntryFilter
 	traffic     TrafficSupervisor
 	alert       AlertSupervisor
+	silencer    Silencer
+	notifier    Notifier
+	history     AlertHistory
+	statsSinks  []StatsSink
 	ui          UI
+	statsHub    *Hub
+	alertsHub   *Hub
+	subscribers map[string]SubscriberOpts
+	config      Config
+	reloads     <-chan ConfigReload
 }
 
 // NewMonitor creates the Monitor type.
 func NewMonitor(opts MonitorOpts) *Monitor {
-	producer := NewLogEntryProducer(
-		ProducerOpts{
-			opts.LogFilePath,
-			io.SeekEnd,
-			log.New(ioutil.Discard, "", 0),
-			NewW3CommonLogParser(),
-		},
-	)
+	filter := NewEntryFilter(EntryFilterOpts{Filter: opts.Filter})
+	sources := newSourceWatchers(opts.Sources)
+	traffic := NewTrafficSupervisor(trafficSupervisorOpts(opts, sources))
+	alert := NewAlertsSupervisor(alertSupervisorOpts(opts))
 
-	traffic := NewTrafficSupervisor(
-		TrafficSupervisorOpts{opts.RefreshInterval * 1000 /* in milliseconds */},
-	)
+	var silences *SilenceStore
+	if opts.SilencesPath != "" {
+		silences = NewSilenceStore(opts.SilencesPath)
+	}
+	silencer := NewSilencer(SilencerOpts{Store: silences, Maintenance: opts.Maintenance})
 
-	alert := NewAlertsSupervisor(
-		AlertSupervisorOpts{opts.AlertThreshold, opts.RefreshInterval, opts.AlertWindow},
-	)
+	var ui UI
+	if opts.Headless {
+		ui = NewHeadlessUI(HeadlessUIOpts{Output: os.Stdout, Format: opts.OutputFormat, Refresh: opts.RefreshInterval})
+	} else {
+		ui = NewUI(UIOpts{
+			Refresh:        opts.RefreshInterval,
+			AlertThreshold: opts.AlertThreshold,
+			AlertWindow:    opts.AlertWindow,
+			AlertFloor:     opts.AlertFloor,
+			NoDataTimeout:  opts.NoDataTimeout,
+			AnomalySigmas:  opts.AnomalySigmas,
+			SpikePercent:   opts.SpikePercent,
+			SLOs:           opts.SLOs,
+			ClientRate:     opts.ClientRate,
+			ClientErrors:   opts.ClientErrors,
+			History:        opts.History,
+			Silences:       silences,
+			SilenceFor:     opts.SilenceDuration,
+			Maintenance:    opts.Maintenance,
+			Filter:         filter,
+			Layout:         opts.Layout,
+			CompactLayout:  opts.CompactLayout,
+			Theme:          opts.Theme,
+		})
+	}
 
-	ui := NewUI(
-		UIOpts{Refresh: opts.RefreshInterval, AlertThreshold: opts.AlertThreshold, AlertWindow: opts.AlertWindow},
-	)
+	notifier := NewNotifier(NotifierOpts{Sinks: opts.Sinks})
+
+	var history AlertHistory
+	if opts.HistoryPath != "" {
+		history = NewAlertHistory(AlertHistoryOpts{Path: opts.HistoryPath})
+	}
 
-	return &Monitor{fileWatcher: producer, traffic: traffic, alert: alert, ui: ui}
+	statsHub, alertsHub := NewHub("stats"), NewHub("alerts")
+
+	// The store is set up before the sinks reading from it:
+	var store StatsStore
+	var statsSinks []StatsSink
+	if opts.StorePath != "" {
+		storeOpts := opts.StoreRetention
+		storeOpts.Dir = opts.StorePath
+		storeOpts.RefreshInterval = opts.RefreshInterval
+		store = NewStatsStore(storeOpts)
+		statsSinks = append(statsSinks, store)
+	}
+	statsSinks = append(statsSinks, opts.StatsSinks...)
+	if opts.MetricsAddr != "" {
+		statsSinks = append(statsSinks, NewMetricsExporter(MetricsExporterOpts{
+			Addr:            opts.MetricsAddr,
+			RefreshInterval: opts.RefreshInterval,
+			MaxSections:     opts.MetricsSections,
+			Hubs:            []*Hub{statsHub, alertsHub},
+		}))
+	}
+	if opts.DashboardAddr != "" {
+		statsSinks = append(statsSinks, NewDashboard(DashboardOpts{
+			Addr:            opts.DashboardAddr,
+			RefreshInterval: opts.RefreshInterval,
+			AlertThreshold:  opts.AlertThreshold,
+			AlertWindow:     opts.AlertWindow,
+			History:         opts.History,
+			Store:           store,
+		}))
+	}
+	if opts.APIAddr != "" {
+		statsSinks = append(statsSinks, NewQueryAPI(QueryAPIOpts{
+			Addr:            opts.APIAddr,
+			RefreshInterval: opts.RefreshInterval,
+			Retention:       opts.APIRetention,
+			History:         opts.History,
+			Store:           store,
+		}))
+	}
+
+	return &Monitor{
+		sources:     sources,
+		filter:      filter,
+		traffic:     traffic,
+		alert:       alert,
+		silencer:    silencer,
+		notifier:    notifier,
+		history:     history,
+		statsSinks:  statsSinks,
+		ui:          ui,
+		statsHub:    statsHub,
+		alertsHub:   alertsHub,
+		subscribers: opts.Subscribers,
+		config:      opts.Config,
+		reloads:     opts.Reloads,
+	}
+}
+
+func trafficSupervisorOpts(opts MonitorOpts, sources *sourceWatchers) TrafficSupervisorOpts {
+	return TrafficSupervisorOpts{
+		RefreshInterval: opts.RefreshInterval * 1000, /* in milliseconds */
+		ClientKey:       opts.ClientKey,
+		ClientCapacity:  opts.ClientCapacity,
+		Windows:         opts.Windows,
+		SLOs:            opts.SLOs,
+		LastRead:        sources.reads.lastRead,
+	}
+}
+
+func alertSupervisorOpts(opts MonitorOpts) AlertSupervisorOpts {
+	return AlertSupervisorOpts{
+		AlertThreshold:  opts.AlertThreshold,
+		RefreshInterval: opts.RefreshInterval,
+		AlertWindow:     opts.AlertWindow,
+		AlertFloor:      opts.AlertFloor,
+		NoDataTimeout:   opts.NoDataTimeout,
+		AnomalySigmas:   opts.AnomalySigmas,
+		AnomalyAlpha:    opts.AnomalyAlpha,
+		AnomalySeasonal: opts.AnomalySeasonal,
+		SpikePercent:    opts.SpikePercent,
+		SpikeWindow:     opts.SpikeWindow,
+		ClientRate:      opts.ClientRate,
+		ClientErrors:    opts.ClientErrors,
+		OpenAlerts:      OpenAlerts(opts.History),
+	}
 }
 
 // Run executes all the components of the log monitor.
 // It orchestrates the setup, error handling and execution of the components.
-// The file watcher, traffic supervisor and alert supervisor run on their own goroutine.
+// The file watchers, entry filter, traffic supervisor, alert supervisor, silencer and notifier run on their own goroutine.
+// The streams of TrafficStats and ThresholdAlert are broadcast to their consumers through hubs.
 // The UI runs on the main goroutine and captures interruption signals.
+// The configurations reloaded are applied while the components run, and reported by the UI.
 // On shutdown, it waits for all components to stop before exiting.
 func (m Monitor) Run(parentCtx context.Context) error {
-	cleanupProducer, err := m.fileWatcher.Setup()
+	cleanupSources, err := m.sources.setup()
 	if err != nil {
-		return fmt.Errorf("setup file watcher: %w", err)
+		return err
+	}
+	defer cleanupSources()
+
+	if m.history != nil {
+		cleanupHistory, err := m.history.Setup()
+		if err != nil {
+			return fmt.Errorf("setup alert history: %w", err)
+		}
+		defer cleanupHistory()
+	}
+
+	for _, sink := range m.statsSinks {
+		cleanupSink, err := sink.Setup()
+		if err != nil {
+			return fmt.Errorf("setup stats sink %s: %w", sink.Name(), err)
+		}
+		defer cleanupSink()
 	}
-	defer cleanupProducer()
 
 	cleanupUI, err := m.ui.Setup()
 	if err != nil {
@@ -76,22 +257,163 @@ func (m Monitor) Run(parentCtx context.Context) error {
 	ctx, cancel := context.WithCancel(parentCtx)
 	var wg sync.WaitGroup
 
+	// Subscribe every consumer before anything is published:
+	statsForAlerts := m.subscribeStats(ctx, &wg, "alerts")
+	statsForUI := m.subscribeStats(ctx, &wg, "ui")
+	alertsForUI := m.subscribeAlerts(ctx, &wg, "ui")
+	m.launchAlertConsumers(ctx, &wg)
+	m.launchStatsSinks(ctx, &wg)
+
 	// Launch each component on a different goroutine:
-	logEntries := m.launchLogEntryProducer(ctx, &wg)
-	statsForAlerts, statsForUI := m.launchTrafficSupervisor(ctx, &wg, logEntries)
+	logEntries := m.sources.launch(ctx, &wg)
+	filtered := m.launchEntryFilter(ctx, &wg, logEntries)
+	stats := m.launchTrafficSupervisor(ctx, &wg, filtered)
+	m.launchPublisher(ctx, &wg, m.statsHub, func() (interface{}, bool) {
+		s, ok := <-stats
+		return s, ok
+	})
 	alerts := m.launchAlertManager(ctx, &wg, statsForAlerts)
+	silenced := m.launchSilencer(ctx, &wg, alerts)
+	m.launchPublisher(ctx, &wg, m.alertsHub, func() (interface{}, bool) {
+		a, ok := <-silenced
+		return a, ok
+	})
+	m.launchReloader(ctx, &wg)
 
 	// Launch the UI in the main goroutine.
 	// UI loops until an interrupt signal is captured.
-	m.ui.Run(ctx, statsForUI, alerts)
+	m.ui.Run(ctx, statsForUI, alertsForUI)
 
 	// On shutdown, wait for all components to stop before exiting.
 	cancel()
 	wg.Wait()
 
+	for _, hub := range []*Hub{m.statsHub, m.alertsHub} {
+		for _, s := range hub.Stats() {
+			log.Printf("clean up: %s/%s subscriber dropped %d messages", s.Hub, s.Subscriber, s.Dropped)
+		}
+	}
+
 	return nil
 }
 
+// launchReloader applies the configurations reloaded while the monitor runs, in turn.
+func (m Monitor) launchReloader(ctx context.Context, wg *sync.WaitGroup) {
+	if m.reloads == nil {
+		return
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		config := m.config
+		for {
+			select {
+			case r, ok := <-m.reloads:
+				if !ok {
+					return
+				}
+				config = m.reload(config, r)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// reload applies a configuration reloaded over the current one, and reports how it went to the UI and the dashboard.
+// Either every change is applied, or none is: the sources are added first, since they can fail.
+// The sections only applied on restart are kept as they are. See DiffConfig.
+// It returns the configuration the monitor runs with from then on.
+func (m Monitor) reload(current Config, r ConfigReload) Config {
+	report := ReloadReport{Time: time.Now(), Err: r.Err}
+	defer func() {
+		log.Print(report.Summary())
+		m.ui.Reload(report)
+		for _, sink := range m.statsSinks {
+			if dashboard, ok := sink.(Dashboard); ok {
+				dashboard.Reload(report)
+			}
+		}
+	}()
+	if r.Err != nil {
+		return current
+	}
+
+	live := liveConfig(current, r.Config)
+	opts, err := live.MonitorOpts()
+	if err != nil {
+		report.Err = err
+		return current
+	}
+
+	diff := DiffConfig(current, r.Config)
+	if err := m.sources.apply(diff, opts.Sources); err != nil {
+		report.Err = err
+		return current
+	}
+	if diff.Filter {
+		m.filter.SetFilter(opts.Filter)
+	}
+	if diff.Traffic {
+		m.traffic.Reconfigure(trafficSupervisorOpts(opts, m.sources))
+	}
+	if diff.Alerts {
+		m.alert.Reconfigure(alertSupervisorOpts(opts))
+	}
+	if diff.Notifiers {
+		m.notifier.SetSinks(opts.Sinks)
+	}
+	if diff.Silences {
+		m.silencer.SetMaintenance(opts.Maintenance)
+	}
+
+	report.Changes, report.Restart, report.Opts = diff.Changes(), diff.Restart, opts
+	return live
+}
+
+// launchAlertConsumers launches the notifier and the alert history, subscribed to the alerts hub.
+func (m Monitor) launchAlertConsumers(ctx context.Context, wg *sync.WaitGroup) {
+	alertsForNotifier := m.subscribeAlerts(ctx, wg, "notifier")
+	wg.Add(1)
+	go func() {
+		m.notifier.Run(ctx, alertsForNotifier)
+		wg.Done()
+	}()
+
+	if m.history != nil {
+		alertsForHistory := m.subscribeAlerts(ctx, wg, "history")
+		wg.Add(1)
+		go func() {
+			m.history.Run(ctx, alertsForHistory)
+			wg.Done()
+		}()
+	}
+}
+
+// launchStatsSinks launches the stats sinks, subscribed to both hubs.
+func (m Monitor) launchStatsSinks(ctx context.Context, wg *sync.WaitGroup) {
+	for _, sink := range m.statsSinks {
+		stats := m.subscribeStats(ctx, wg, sink.Name())
+		alerts := m.subscribeAlerts(ctx, wg, sink.Name())
+		wg.Add(1)
+		go func(sink StatsSink) {
+			sink.Run(ctx, stats, alerts)
+			wg.Done()
+		}(sink)
+	}
+}
+
+func (m Monitor) launchSilencer(ctx context.Context, wg *sync.WaitGroup, alerts chan ThresholdAlert) chan ThresholdAlert {
+	silenced := make(chan ThresholdAlert)
+	wg.Add(1)
+	go func() {
+		m.silencer.Run(ctx, alerts, silenced)
+		wg.Done()
+	}()
+	return silenced
+}
+
 func (m Monitor) launchAlertManager(ctx context.Context, wg *sync.WaitGroup, statsForAlerts chan TrafficStats) chan ThresholdAlert {
 	alerts := make(chan ThresholdAlert)
 	wg.Add(1)
@@ -102,41 +424,304 @@ func (m Monitor) launchAlertManager(ctx context.Context, wg *sync.WaitGroup, sta
 	return alerts
 }
 
-func (m Monitor) launchTrafficSupervisor(ctx context.Context, wg *sync.WaitGroup, logEntries chan LogEntry) (chan TrafficStats, chan TrafficStats) {
+func (m Monitor) launchTrafficSupervisor(ctx context.Context, wg *sync.WaitGroup, logEntries chan LogEntry) chan TrafficStats {
 	trafficStats := make(chan TrafficStats)
 	wg.Add(1)
 	go func() {
 		m.traffic.Run(ctx, logEntries, trafficStats)
 		wg.Done()
 	}()
-
-	return broadcastTrafficStats(ctx, trafficStats)
+	return trafficStats
 }
 
-func (m Monitor) launchLogEntryProducer(ctx context.Context, wg *sync.WaitGroup) chan LogEntry {
-	logEntries := make(chan LogEntry)
+func (m Monitor) launchEntryFilter(ctx context.Context, wg *sync.WaitGroup, logEntries chan LogEntry) chan LogEntry {
+	filtered := make(chan LogEntry)
 	wg.Add(1)
 	go func() {
-		m.fileWatcher.Run(ctx, logEntries)
+		m.filter.Run(ctx, logEntries, filtered)
 		wg.Done()
 	}()
-	return logEntries
+	return filtered
+}
+
+// sourceWatchers are the file watchers of the sources, whose streams of LogEntry are merged into a single one.
+// Sources can be added and removed while they run.
+type sourceWatchers struct {
+	mu       sync.Mutex
+	paths    []string                  // Sources monitored on startup, in order.
+	watchers map[string]*sourceWatcher // By path.
+	ctx      context.Context           // Context of the watchers, once launched.
+	wg       *sync.WaitGroup
+	merged   chan LogEntry
+	running  sync.WaitGroup // Watchers producing into the merged stream.
+	stopped  bool           // Whether the merged stream is being closed: no watcher can be added.
+	reads    *lineClock     // Time any watcher last read a line.
+}
+
+// sourceWatcher is the file watcher of a source.
+type sourceWatcher struct {
+	producer LogEntryProducer
+	cleanup  func()
+	stop     context.CancelFunc
+	done     chan struct{} // Closed once the file watcher is stopped and drained.
+}
+
+func newSourceWatchers(sources []LogSource) *sourceWatchers {
+	w := &sourceWatchers{watchers: make(map[string]*sourceWatcher), reads: newLineClock()}
+	for _, source := range sources {
+		w.paths = append(w.paths, source.Path)
+		w.watchers[source.Path] = &sourceWatcher{producer: w.newProducer(source)}
+	}
+	return w
+}
+
+func (w *sourceWatchers) newProducer(source LogSource) LogEntryProducer {
+	return NewLogEntryProducer(
+		ProducerOpts{
+			source.Path,
+			io.SeekEnd,
+			log.New(ioutil.Discard, "", 0),
+			source.Parser,
+			w.reads.touch,
+		},
+	)
+}
+
+// setup sets up the file watchers of the sources monitored on startup.
+// It returns a callback to clean up the file watchers running on shutdown.
+func (w *sourceWatchers) setup() (func(), error) {
+	for _, path := range w.paths {
+		watcher := w.watchers[path]
+		cleanup, err := watcher.producer.Setup()
+		if err != nil {
+			w.cleanup()
+			return nil, fmt.Errorf("setup file watcher: %w", err)
+		}
+		watcher.cleanup = cleanup
+	}
+	return w.cleanup, nil
+}
+
+func (w *sourceWatchers) cleanup() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, watcher := range w.watchers {
+		if watcher.cleanup != nil {
+			watcher.cleanup()
+		}
+	}
+}
+
+// launch launches the file watchers, and merges their streams of LogEntry.
+// The merged stream is closed once the context is done and every file watcher is stopped.
+func (w *sourceWatchers) launch(ctx context.Context, wg *sync.WaitGroup) chan LogEntry {
+	w.mu.Lock()
+	w.ctx, w.wg, w.merged = ctx, wg, make(chan LogEntry)
+	for _, watcher := range w.watchers {
+		w.start(watcher)
+	}
+	w.mu.Unlock()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		<-ctx.Done()
+		w.mu.Lock()
+		w.stopped = true
+		w.mu.Unlock()
+		w.running.Wait()
+		close(w.merged)
+	}()
+	return w.merged
 }
 
-// broadcastTrafficStats broadcasts the messages from the input channel into two output channels.
-func broadcastTrafficStats(ctx context.Context, input chan TrafficStats) (chan TrafficStats, chan TrafficStats) {
-	output1 := make(chan TrafficStats)
-	output2 := make(chan TrafficStats)
+// start launches a file watcher, until the context is done or the watcher is stopped. The lock must be held.
+func (w *sourceWatchers) start(watcher *sourceWatcher) {
+	ctx, stop := context.WithCancel(w.ctx)
+	watcher.stop, watcher.done = stop, make(chan struct{})
+	entries := make(chan LogEntry)
+	w.wg.Add(2)
+	w.running.Add(1)
+	go func() {
+		watcher.producer.Run(ctx, entries)
+		w.wg.Done()
+	}()
 	go func() {
+		defer w.wg.Done()
+		defer w.running.Done()
+		defer close(watcher.done)
+		// Keep draining the file watcher once it is stopped, so it is not blocked until it stops:
+		for entry := range entries {
+			select {
+			case w.merged <- entry:
+			case <-ctx.Done():
+			}
+		}
+	}()
+}
+
+// apply adds, removes and updates the sources of a config reload.
+// If a source cannot be added, the ones just added are removed again and nothing else changes.
+func (w *sourceWatchers) apply(diff ConfigDiff, sources []LogSource) error {
+	parsers := make(map[string]LogParser)
+	for _, source := range sources {
+		parsers[source.Path] = source.Parser
+	}
+
+	var added []string
+	for _, source := range diff.AddedSources {
+		if err := w.add(LogSource{Path: source.Path, Parser: parsers[source.Path]}); err != nil {
+			for _, path := range added {
+				w.remove(path)
+			}
+			return err
+		}
+		added = append(added, source.Path)
+	}
+	for _, source := range diff.RemovedSources {
+		w.remove(source.Path)
+	}
+	for _, source := range diff.Parsers {
+		w.setParser(source.Path, parsers[source.Path])
+	}
+	return nil
+}
+
+// add sets up and launches the file watcher of a new source.
+func (w *sourceWatchers) add(source LogSource) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.stopped {
+		return fmt.Errorf("add source %s: the monitor is stopping", source.Path)
+	}
+	if _, ok := w.watchers[source.Path]; ok {
+		return fmt.Errorf("add source %s: already monitored", source.Path)
+	}
+
+	watcher := &sourceWatcher{producer: w.newProducer(source)}
+	cleanup, err := watcher.producer.Setup()
+	if err != nil {
+		return fmt.Errorf("setup file watcher: %w", err)
+	}
+	watcher.cleanup = cleanup
+	w.watchers[source.Path] = watcher
+	w.start(watcher)
+	log.Printf("source %s added", source.Path)
+	return nil
+}
+
+// remove stops the file watcher of a source, and cleans it up.
+func (w *sourceWatchers) remove(path string) {
+	w.mu.Lock()
+	watcher, ok := w.watchers[path]
+	delete(w.watchers, path)
+	w.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	watcher.stop()
+	<-watcher.done
+	watcher.cleanup()
+	log.Printf("source %s removed", path)
+}
+
+func (w *sourceWatchers) setParser(path string, parser LogParser) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if watcher, ok := w.watchers[path]; ok {
+		watcher.producer.SetParser(parser)
+	}
+}
+
+// launchPublisher publishes the messages of a stream into a hub.
+// The hub is closed once the stream is closed or the context is done.
+func (m Monitor) launchPublisher(ctx context.Context, wg *sync.WaitGroup, hub *Hub, next func() (interface{}, bool)) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer hub.Close()
 		for {
+			msg, ok := next()
+			if !ok || !hub.Publish(ctx, msg) {
+				return
+			}
+		}
+	}()
+}
+
+// subscribeStats subscribes a consumer to the stats hub.
+// It returns its stream of TrafficStats, closed along with the hub.
+func (m Monitor) subscribeStats(ctx context.Context, wg *sync.WaitGroup, name string) chan TrafficStats {
+	sub := m.statsHub.Subscribe(name, m.subscriberOpts(m.statsHub, name))
+	stats := make(chan TrafficStats)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(stats)
+		for msg := range sub.C() {
+			select {
+			case stats <- msg.(TrafficStats):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return stats
+}
+
+// subscribeAlerts subscribes a consumer to the alerts hub.
+// It returns its stream of ThresholdAlert, closed along with the hub.
+func (m Monitor) subscribeAlerts(ctx context.Context, wg *sync.WaitGroup, name string) chan ThresholdAlert {
+	sub := m.alertsHub.Subscribe(name, m.subscriberOpts(m.alertsHub, name))
+	alerts := make(chan ThresholdAlert)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(alerts)
+		for msg := range sub.C() {
 			select {
-			case msg := <-input:
-				output1 <- msg
-				output2 <- msg
+			case alerts <- msg.(ThresholdAlert):
 			case <-ctx.Done():
 				return
 			}
 		}
 	}()
-	return output1, output2
+	return alerts
+}
+
+// subscriberOpts returns the buffer and overflow policy of a consumer of a hub:
+// the ones configured, the default ones of the consumer, or the default ones of the hub for the stats sinks.
+func (m Monitor) subscriberOpts(hub *Hub, name string) SubscriberOpts {
+	key := hub.name + "/" + name
+	if opts, ok := m.subscribers[key]; ok {
+		return opts
+	}
+	if opts, ok := defaultSubscribers[key]; ok {
+		return opts
+	}
+	return defaultHubSubscribers[hub.name]
+}
+
+// defaultSubscribers are the buffers and overflow policies of the consumers of the hubs, by hub/consumer.
+// The alerting consumers, the alert panels, the query API and the store block, so they never miss a message.
+// The UI drops old stats rather than holding back the alert supervisor on a slow render.
+// The stats sinks get the defaults of the hub: see defaultHubSubscribers.
+var defaultSubscribers = map[string]SubscriberOpts{
+	"stats/alerts":     {Buffer: 10, Overflow: Block},
+	"stats/ui":         {Buffer: 10, Overflow: DropOldest},
+	"alerts/ui":        {Buffer: 100, Overflow: Block},
+	"alerts/notifier":  {Buffer: 100, Overflow: Block},
+	"alerts/history":   {Buffer: 100, Overflow: Block},
+	"alerts/dashboard": {Buffer: 100, Overflow: Block},
+	"stats/api":        {Buffer: 100, Overflow: Block},
+	"alerts/api":       {Buffer: 100, Overflow: Block},
+	"stats/store":      {Buffer: 100, Overflow: Block},
+}
+
+// defaultHubSubscribers are the buffers and overflow policies of the stats sinks, by hub.
+// Their alert streams block, so no alert transition is missed; their stats streams drop the oldest stats.
+var defaultHubSubscribers = map[string]SubscriberOpts{
+	"stats":  {Buffer: 100, Overflow: DropOldest},
+	"alerts": {Buffer: 100, Overflow: Block},
 }
@@ -0,0 +1,475 @@
+package logmon
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// Notifier consumes alerts and delivers them to external sinks.
+// Its sinks can be replaced while it runs.
+type Notifier interface {
+	Run(ctx context.Context, alerts <-chan ThresholdAlert)
+	SetSinks(sinks []Sink)
+}
+
+// Sink delivers alerts to an external destination.
+type Sink interface {
+	Name() string
+	Notify(ctx context.Context, alert ThresholdAlert) error
+}
+
+// NotifierOpts defines the options required to build a Notifier.
+type NotifierOpts struct {
+	Sinks []Sink
+}
+
+// NewNotifier creates a Notifier.
+func NewNotifier(opts NotifierOpts) Notifier {
+	return &notifier{sinks: opts.Sinks}
+}
+
+// notifier implements the Notifier interface.
+type notifier struct {
+	mu    sync.RWMutex
+	sinks []Sink
+}
+
+// Run consumes alerts and delivers every alert to every sink. Silenced alerts are not delivered.
+// Every sink has a worker delivering its alerts one at a time, retries included, in the order they are consumed:
+// an alert and its recovery always reach the sink in order. The queue of a worker is unbounded, so a slow sink holds
+// back neither the alerts stream nor the other sinks. The sinks with the same name share their worker, so the
+// alerts keep their order when the sinks are replaced.
+// Once the alerts stream is closed, it waits for the workers to deliver their queues. On shutdown, the alerts not
+// delivered yet are dropped.
+func (n *notifier) Run(ctx context.Context, alerts <-chan ThresholdAlert) {
+	var wg sync.WaitGroup
+	queues := make(map[string]*deliveryQueue) // By sink name.
+
+LOOP:
+	for {
+		select {
+		case a, ok := <-alerts:
+			if !ok {
+				break LOOP
+			}
+			if a.Silenced {
+				log.Printf("silenced: %v", a.ID())
+				continue
+			}
+
+			for _, sink := range n.currentSinks() {
+				queue, ok := queues[sink.Name()]
+				if !ok {
+					queue = newDeliveryQueue()
+					queues[sink.Name()] = queue
+					wg.Add(1)
+					go func() {
+						n.work(ctx, queue)
+						wg.Done()
+					}()
+				}
+				queue.push(delivery{sink: sink, alert: a})
+			}
+		case <-ctx.Done():
+			break LOOP
+		}
+	}
+
+	for _, queue := range queues {
+		queue.close()
+	}
+	wg.Wait() // Wait for the workers to deliver their queues.
+	log.Printf("clean up: notifier stopped")
+}
+
+// SetSinks replaces the sinks. They deliver the alerts consumed from then on.
+// The alerts queued carry on with the former sinks.
+func (n *notifier) SetSinks(sinks []Sink) {
+	n.mu.Lock()
+	n.sinks = sinks
+	n.mu.Unlock()
+	log.Printf("notifier sinks replaced: %d sinks", len(sinks))
+}
+
+func (n *notifier) currentSinks() []Sink {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.sinks
+}
+
+// work delivers the alerts of a queue in order, until it is closed and empty or the context is done.
+func (n *notifier) work(ctx context.Context, queue *deliveryQueue) {
+	for {
+		d, ok := queue.pop(ctx)
+		if !ok {
+			return
+		}
+
+		if err := d.sink.Notify(ctx, d.alert); err != nil {
+			log.Printf("error notifying %s: %v", d.sink.Name(), err)
+			continue
+		}
+		log.Printf("notified %s: %v", d.sink.Name(), d.alert.ID())
+	}
+}
+
+// delivery is an alert to deliver to a sink.
+type delivery struct {
+	sink  Sink
+	alert ThresholdAlert
+}
+
+// deliveryQueue is an unbounded FIFO queue of deliveries, safe for concurrent use.
+type deliveryQueue struct {
+	mu      sync.Mutex
+	pending *list.List    // Deliveries not started yet, oldest first.
+	closed  bool          // Whether no more deliveries are pushed.
+	ready   chan struct{} // Signalled on every push and on close.
+}
+
+func newDeliveryQueue() *deliveryQueue {
+	return &deliveryQueue{pending: list.New(), ready: make(chan struct{}, 1)}
+}
+
+func (q *deliveryQueue) push(d delivery) {
+	q.mu.Lock()
+	q.pending.PushBack(d)
+	q.mu.Unlock()
+	q.signal()
+}
+
+// close tells the queue no more deliveries are pushed: pop fails once it is empty.
+func (q *deliveryQueue) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+	q.signal()
+}
+
+func (q *deliveryQueue) signal() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// pop waits for the oldest delivery. It fails once the queue is closed and empty, or the context is done.
+func (q *deliveryQueue) pop(ctx context.Context) (delivery, bool) {
+	for ctx.Err() == nil {
+		q.mu.Lock()
+		e := q.pending.Front()
+		if e != nil {
+			q.pending.Remove(e)
+		}
+		closed := q.closed
+		q.mu.Unlock()
+
+		if e != nil {
+			return e.Value.(delivery), true
+		}
+		if closed {
+			break
+		}
+		select {
+		case <-q.ready:
+		case <-ctx.Done():
+		}
+	}
+	return delivery{}, false
+}
+
+// WebhookSinkOpts defines the options required to build a webhook Sink.
+type WebhookSinkOpts struct {
+	URL      string
+	Retries  int                // Number of retries after a failed delivery.
+	Backoff  time.Duration      // Wait before the first retry. It doubles on every retry.
+	Timeout  time.Duration      // Timeout of every request.
+	Template *template.Template // Renders the payload of every alert. The alert as JSON if nil.
+	Key      string             // Key available to the template, e.g. a PagerDuty routing key.
+}
+
+// NewWebhookSink creates a Sink that posts alerts as JSON to a URL.
+// The payload can be tailored to the receiver with a template: see LoadPayloadTemplate.
+func NewWebhookSink(opts WebhookSinkOpts) Sink {
+	if opts.Backoff <= 0 {
+		opts.Backoff = time.Second
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+
+	return &webhookSink{
+		url:      opts.URL,
+		retries:  opts.Retries,
+		backoff:  opts.Backoff,
+		client:   &http.Client{Timeout: opts.Timeout},
+		template: opts.Template,
+		key:      opts.Key,
+	}
+}
+
+// webhookSink implements the Sink interface with HTTP requests.
+type webhookSink struct {
+	url      string
+	retries  int
+	backoff  time.Duration
+	client   *http.Client
+	template *template.Template
+	key      string
+}
+
+// Name identifies the sink.
+func (w *webhookSink) Name() string {
+	return "webhook " + w.url
+}
+
+// Notify posts the alert. Failed deliveries are retried with an exponential backoff.
+func (w *webhookSink) Notify(ctx context.Context, alert ThresholdAlert) error {
+	body, err := w.payload(alert)
+	if err != nil {
+		return err
+	}
+
+	return retry(ctx, w.retries, w.backoff, func() error {
+		return w.post(ctx, body)
+	})
+}
+
+func (w *webhookSink) payload(alert ThresholdAlert) ([]byte, error) {
+	if w.template != nil {
+		return renderPayload(w.template, alert, w.key)
+	}
+
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return nil, fmt.Errorf("encode alert: %w", err)
+	}
+	return body, nil
+}
+
+func (w *webhookSink) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("post alert: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("post alert: unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// retry calls fn until it succeeds, the retries are exhausted or the context is done.
+// The wait between calls starts at backoff and doubles on every retry.
+func retry(ctx context.Context, retries int, backoff time.Duration, fn func() error) error {
+	err := fn()
+	for i := 0; err != nil && i < retries; i++ {
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return fmt.Errorf("%v: %w", err, ctx.Err())
+		}
+
+		backoff *= 2
+		err = fn()
+	}
+	return err
+}
+
+// ExecSinkOpts defines the options required to build an exec Sink.
+type ExecSinkOpts struct {
+	Command string // Shell command to run on every alert.
+}
+
+// NewExecSink creates a Sink that runs a shell command on every alert.
+// The alert is given to the command as JSON on its standard input and as LOGMON_ALERT_* environment variables.
+func NewExecSink(opts ExecSinkOpts) Sink {
+	return &execSink{command: opts.Command}
+}
+
+// execSink implements the Sink interface with a shell command.
+type execSink struct {
+	command string
+}
+
+// Name identifies the sink.
+func (e *execSink) Name() string {
+	return "exec " + e.command
+}
+
+// Notify runs the command with the alert.
+func (e *execSink) Notify(ctx context.Context, alert ThresholdAlert) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return fmt.Errorf("encode alert: %w", err)
+	}
+
+	kind, _ := alert.Kind.MarshalText()
+	cmd := exec.CommandContext(ctx, "sh", "-c", e.command)
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Env = append(os.Environ(),
+		"LOGMON_ALERT_ID="+alert.ID(),
+		"LOGMON_ALERT_KIND="+string(kind),
+		"LOGMON_ALERT_NAME="+alert.Name,
+		"LOGMON_ALERT_OPEN="+strconv.FormatBool(alert.Open),
+		"LOGMON_ALERT_HITS="+strconv.FormatFloat(alert.Hits, 'f', 2, 64),
+		"LOGMON_ALERT_TIME="+alert.Time.Format(time.RFC3339),
+		"LOGMON_ALERT_SUMMARY="+alert.Summary(),
+	)
+
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("run command: %w: %s", err, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+// SMTPSinkOpts defines the options required to build an SMTP Sink.
+type SMTPSinkOpts struct {
+	Addr     string // SMTP server as host:port.
+	From     string
+	To       []string
+	Username string // Authenticate with PLAIN auth when given.
+	Password string
+	Timeout  time.Duration // Timeout of every email, from dialing the server to the end of the session.
+}
+
+// NewSMTPSink creates a Sink that emails alerts.
+func NewSMTPSink(opts SMTPSinkOpts) Sink {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+
+	host := opts.Addr
+	if i := strings.LastIndex(host, ":"); i >= 0 {
+		host = host[:i]
+	}
+	var auth smtp.Auth
+	if opts.Username != "" {
+		auth = smtp.PlainAuth("", opts.Username, opts.Password, host)
+	}
+
+	return &smtpSink{addr: opts.Addr, host: host, from: opts.From, to: opts.To, auth: auth, timeout: opts.Timeout}
+}
+
+// smtpSink implements the Sink interface with emails.
+type smtpSink struct {
+	addr    string
+	host    string
+	from    string
+	to      []string
+	auth    smtp.Auth
+	timeout time.Duration
+}
+
+// Name identifies the sink.
+func (s *smtpSink) Name() string {
+	return "smtp " + s.addr
+}
+
+// Notify emails the alert to all the recipients.
+// It gives up once the timeout expires or the context is done, even if the server stalls.
+func (s *smtpSink) Notify(ctx context.Context, alert ThresholdAlert) error {
+	subject := "[logmon] " + alert.Summary()
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", s.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(s.to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&msg, "Date: %s\r\n", alert.Time.Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "Content-Type: text/plain; charset=utf-8\r\n")
+	fmt.Fprintf(&msg, "\r\n%s\r\nat %s\r\n", alert.Summary(), alert.Time.Format(time.RFC1123))
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	if err := s.send(ctx, msg.Bytes()); err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return fmt.Errorf("send email: %w", err)
+	}
+	return nil
+}
+
+// send talks to the server as smtp.SendMail does, over a connection closed once the context is done.
+func (s *smtpSink) send(ctx context.Context, msg []byte) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	sent := make(chan struct{})
+	defer close(sent)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close() // Unblocks the session if the context is cancelled before the deadline.
+		case <-sent:
+		}
+	}()
+
+	c, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: s.host}); err != nil {
+			return err
+		}
+	}
+	if s.auth != nil {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return fmt.Errorf("server does not support AUTH")
+		}
+		if err := c.Auth(s.auth); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(s.from); err != nil {
+		return err
+	}
+	for _, to := range s.to {
+		if err := c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
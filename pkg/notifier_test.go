@@ -0,0 +1,225 @@
+package logmon_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	logmon "github.com/jjrumi/accesslogmonitor/pkg"
+)
+
+func TestNotifier_DeliversAlertsToAllSinks(t *testing.T) {
+	sinkA, sinkB := &recordingSink{}, &recordingSink{}
+	notifier := logmon.NewNotifier(logmon.NotifierOpts{Sinks: []logmon.Sink{sinkA, sinkB}})
+
+	// Fill up alerts channel with test data:
+	alerts := make(chan logmon.ThresholdAlert, 2)
+	alerts <- givenAnAlert(true)
+	alerts <- givenAnAlert(false)
+	close(alerts)
+
+	// Run notifier until all the deliveries are done:
+	notifier.Run(context.Background(), alerts)
+
+	require.Len(t, sinkA.received(), 2, "all alerts delivered to the first sink")
+	require.Len(t, sinkB.received(), 2, "all alerts delivered to the second sink")
+}
+
+func TestNotifier_DeliversTheAlertsOfASinkInOrder(t *testing.T) {
+	// A sink slower to deliver open alerts, e.g. retrying them:
+	slow := &recordingSink{delay: func(a logmon.ThresholdAlert) time.Duration {
+		if a.Open {
+			return 50 * time.Millisecond
+		}
+		return 0
+	}}
+	fast := &recordingSink{}
+	notifier := logmon.NewNotifier(logmon.NotifierOpts{Sinks: []logmon.Sink{slow, fast}})
+
+	alerts := make(chan logmon.ThresholdAlert, 4)
+	alerts <- givenAnAlert(true)
+	alerts <- givenAnAlert(false)
+	alerts <- givenAnAlert(true)
+	alerts <- givenAnAlert(false)
+	close(alerts)
+	notifier.Run(context.Background(), alerts)
+
+	for _, sink := range []*recordingSink{slow, fast} {
+		var states []bool
+		for _, a := range sink.received() {
+			states = append(states, a.Open)
+		}
+		require.Equal(t, []bool{true, false, true, false}, states, "every recovery is delivered after its alert")
+	}
+}
+
+func TestWebhookSink_RetriesFailedDeliveries(t *testing.T) {
+	var mu sync.Mutex
+	attempts := 0
+	var received logmon.ThresholdAlert
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		attempts++
+		if attempts < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		require.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+	}))
+	defer server.Close()
+
+	sink := logmon.NewWebhookSink(logmon.WebhookSinkOpts{URL: server.URL, Retries: 2, Backoff: time.Millisecond})
+	alert := givenAnAlert(true)
+	err := sink.Notify(context.Background(), alert)
+
+	require.NoError(t, err, "delivery succeeds on the last retry")
+	require.Equal(t, 3, attempts, "delivery was attempted three times")
+	require.Equal(t, alert.ID(), received.ID(), "the alert is posted as JSON")
+	require.True(t, received.Open, "the alert is posted as JSON")
+}
+
+func TestWebhookSink_FailsOnceRetriesAreExhausted(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	sink := logmon.NewWebhookSink(logmon.WebhookSinkOpts{URL: server.URL, Retries: 1, Backoff: time.Millisecond})
+	err := sink.Notify(context.Background(), givenAnAlert(true))
+
+	require.Error(t, err, "delivery fails once retries are exhausted")
+}
+
+func TestExecSink_RunsCommandWithTheAlert(t *testing.T) {
+	dir, err := ioutil.TempDir("", "exec_sink_*")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	sink := logmon.NewExecSink(logmon.ExecSinkOpts{
+		Command: `cat > ` + dir + `/stdin.json && echo "$LOGMON_ALERT_ID $LOGMON_ALERT_OPEN" > ` + dir + `/env.txt`,
+	})
+	alert := givenAnAlert(true)
+	require.NoError(t, sink.Notify(context.Background(), alert))
+
+	env, err := ioutil.ReadFile(dir + "/env.txt")
+	require.NoError(t, err)
+	require.Equal(t, "high traffic true\n", string(env), "the alert is given as env vars")
+
+	var received logmon.ThresholdAlert
+	stdin, err := ioutil.ReadFile(dir + "/stdin.json")
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(stdin, &received))
+	require.Equal(t, alert.Hits, received.Hits, "the alert is given as JSON on stdin")
+}
+
+func TestExecSink_FailsWithFailingCommands(t *testing.T) {
+	sink := logmon.NewExecSink(logmon.ExecSinkOpts{Command: "echo boom && exit 1"})
+	err := sink.Notify(context.Background(), givenAnAlert(true))
+
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "boom", "the output of the command is reported")
+}
+
+func TestSMTPSink_EmailsTheAlert(t *testing.T) {
+	addr, messages, stop := givenAnSMTPServer(t)
+	defer stop()
+
+	sink := logmon.NewSMTPSink(logmon.SMTPSinkOpts{Addr: addr, From: "logmon@localhost", To: []string{"ops@localhost"}})
+	require.NoError(t, sink.Notify(context.Background(), givenAnAlert(true)))
+
+	msg := <-messages
+	require.Equal(t, "logmon@localhost", msg.from)
+	require.Equal(t, []string{"ops@localhost"}, msg.to)
+	require.Contains(t, msg.data, "Subject: [logmon] high traffic alert triggered - hits = 12.50 req/s")
+}
+
+func TestSMTPSink_GivesUpOnAStalledServer(t *testing.T) {
+	tests := map[string]struct {
+		timeout time.Duration
+		cancel  bool
+	}{
+		"context cancelled": {timeout: time.Minute, cancel: true},
+		"timeout":           {timeout: 100 * time.Millisecond},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			// The server accepts the connection, and never replies:
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			require.NoError(t, err)
+			defer listener.Close()
+			go func() {
+				conn, err := listener.Accept()
+				if err == nil {
+					defer conn.Close()
+					_, _ = ioutil.ReadAll(conn)
+				}
+			}()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tc.cancel {
+				time.AfterFunc(100*time.Millisecond, cancel)
+			}
+			sink := logmon.NewSMTPSink(logmon.SMTPSinkOpts{
+				Addr:    listener.Addr().String(),
+				From:    "logmon@localhost",
+				To:      []string{"ops@localhost"},
+				Timeout: tc.timeout,
+			})
+
+			notified := make(chan error)
+			go func() { notified <- sink.Notify(ctx, givenAnAlert(true)) }()
+			select {
+			case err := <-notified:
+				require.Error(t, err)
+			case <-time.After(5 * time.Second):
+				require.Fail(t, "Notify does not return")
+			}
+		})
+	}
+}
+
+// givenAnAlert creates a high traffic alert.
+func givenAnAlert(open bool) logmon.ThresholdAlert {
+	return logmon.ThresholdAlert{Kind: logmon.HighTraffic, Open: open, Hits: 12.5, Time: time.Now()}
+}
+
+// recordingSink is a Sink that keeps the alerts it receives, optionally after a delay.
+type recordingSink struct {
+	mu     sync.Mutex
+	alerts []logmon.ThresholdAlert
+	delay  func(a logmon.ThresholdAlert) time.Duration
+}
+
+func (s *recordingSink) Name() string {
+	return "recording"
+}
+
+func (s *recordingSink) Notify(_ context.Context, alert logmon.ThresholdAlert) error {
+	if s.delay != nil {
+		time.Sleep(s.delay(alert))
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.alerts = append(s.alerts, alert)
+	return nil
+}
+
+func (s *recordingSink) received() []logmon.ThresholdAlert {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]logmon.ThresholdAlert(nil), s.alerts...)
+}
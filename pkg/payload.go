@@ -0,0 +1,100 @@
+package logmon
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"text/template"
+	"time"
+)
+
+// TemplateData is the data available to the payload templates of a webhook:
+// - every field and method of the alert, e.g. {{.Hits}}, {{.ID}} or {{.Summary}}.
+// - the key given to the webhook, e.g. the routing key of a PagerDuty integration.
+type TemplateData struct {
+	ThresholdAlert
+	Key string
+}
+
+// payloadFuncs are the helper functions available to the payload templates.
+var payloadFuncs = template.FuncMap{
+	// json encodes a value as JSON, e.g. to quote strings.
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	// rfc3339 formats a time as in "2006-01-02T15:04:05Z07:00".
+	"rfc3339": func(t time.Time) string {
+		return t.Format(time.RFC3339)
+	},
+}
+
+// builtinTemplates are payload templates for well known webhook receivers.
+var builtinTemplates = map[string]string{
+	// Slack incoming webhooks: https://api.slack.com/messaging/webhooks
+	"slack": `{
+  "text": {{if .Open}}{{json (printf ":rotating_light: %s" .Summary)}}{{else}}{{json (printf ":white_check_mark: %s" .Summary)}}{{end}},
+  "attachments": [
+    {
+      "color": "{{if .Open}}danger{{else}}good{{end}}",
+      "fields": [
+        {"title": "Alert", "value": {{json .ID}}, "short": true},
+        {"title": "State", "value": "{{if .Open}}triggered{{else}}recovered{{end}}", "short": true},
+        {"title": "Hits", "value": "{{printf "%.2f" .Hits}} req/s", "short": true}
+      ],
+      "ts": {{.Time.Unix}}
+    }
+  ]
+}
+`,
+	// PagerDuty Events API v2: https://developer.pagerduty.com/docs/events-api-v2/trigger-events/
+	// A recovered alert resolves the incident of its open alert, as both share the dedup key.
+	"pagerduty": `{
+  "routing_key": {{json .Key}},
+  "event_action": "{{if .Open}}trigger{{else}}resolve{{end}}",
+  "dedup_key": {{json (printf "logmon/%s" .ID)}}{{if .Open}},
+  "payload": {
+    "summary": {{json .Summary}},
+    "source": "logmon",
+    "severity": "critical",
+    "timestamp": "{{rfc3339 .Time}}",
+    "class": {{json .Kind}},
+    "custom_details": {{json .ThresholdAlert}}
+  }{{end}}
+}
+`,
+}
+
+// LoadPayloadTemplate creates a payload template for a webhook.
+// The spec is the name of a built-in template ("slack" or "pagerduty") or the path of a Go text/template file.
+func LoadPayloadTemplate(spec string) (*template.Template, error) {
+	text, ok := builtinTemplates[spec]
+	if !ok {
+		content, err := ioutil.ReadFile(spec)
+		if err != nil {
+			return nil, fmt.Errorf("read payload template: %w", err)
+		}
+		text = string(content)
+	}
+
+	return ParsePayloadTemplate(spec, text)
+}
+
+// ParsePayloadTemplate creates a payload template for a webhook from a Go text/template.
+func ParsePayloadTemplate(name string, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Funcs(payloadFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("parse payload template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// renderPayload executes a payload template with an alert.
+func renderPayload(tmpl *template.Template, alert ThresholdAlert, key string) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, TemplateData{ThresholdAlert: alert, Key: key}); err != nil {
+		return nil, fmt.Errorf("render payload: %w", err)
+	}
+	return buf.Bytes(), nil
+}
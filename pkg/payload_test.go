@@ -0,0 +1,187 @@
+package logmon_test
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	logmon "github.com/jjrumi/accesslogmonitor/pkg"
+)
+
+// update rewrites the golden files with the current payloads: go test ./pkg -run Payload -update
+var update = flag.Bool("update", false, "update golden files")
+
+func TestPayloadTemplates(t *testing.T) {
+	at := time.Date(2020, time.April, 26, 13, 9, 7, 0, time.UTC)
+	open := logmon.ThresholdAlert{Kind: logmon.Abuse, Name: "10.0.0.1", Open: true, Hits: 12.5, Errors: 0.8, Time: at}
+	recovered := logmon.ThresholdAlert{Kind: logmon.Abuse, Name: "10.0.0.1", Open: false, Hits: 1.5, Time: at.Add(time.Minute)}
+	custom, err := logmon.ParsePayloadTemplate("custom", `{{.ID}} is {{if .Open}}open{{else}}closed{{end}} at {{rfc3339 .Time}}`)
+	require.NoError(t, err)
+
+	for name, tc := range map[string]struct {
+		template string
+		alert    logmon.ThresholdAlert
+		golden   string
+		isJSON   bool
+	}{
+		"slack message of an open alert": {
+			template: "slack",
+			alert:    open,
+			golden:   "slack_open.json",
+			isJSON:   true,
+		},
+		"slack message of a recovered alert": {
+			template: "slack",
+			alert:    recovered,
+			golden:   "slack_recovered.json",
+			isJSON:   true,
+		},
+		"pagerduty event triggered by an open alert": {
+			template: "pagerduty",
+			alert:    open,
+			golden:   "pagerduty_trigger.json",
+			isJSON:   true,
+		},
+		"pagerduty event resolved by a recovered alert": {
+			template: "pagerduty",
+			alert:    recovered,
+			golden:   "pagerduty_resolve.json",
+			isJSON:   true,
+		},
+		"user supplied template": {
+			alert:  open,
+			golden: "custom.txt",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			tmpl := custom
+			if tc.template != "" {
+				tmpl, err = logmon.LoadPayloadTemplate(tc.template)
+				require.NoError(t, err)
+			}
+
+			payload := postToWebhook(t, logmon.WebhookSinkOpts{Template: tmpl, Key: "routing-key"}, tc.alert)
+			if tc.isJSON {
+				require.True(t, json.Valid(payload), "payload is valid JSON: %s", payload)
+			}
+
+			golden := filepath.Join("testdata", "golden", tc.golden)
+			if *update {
+				require.NoError(t, ioutil.WriteFile(golden, payload, 0644))
+			}
+			expected, err := ioutil.ReadFile(golden)
+			require.NoError(t, err)
+			require.Equal(t, string(expected), string(payload))
+		})
+	}
+}
+
+// TestPayloadTemplates_MatchTheReceivers checks every format against a payload written by hand from the docs of its
+// receiver, unlike the golden files, which are written by the templates themselves.
+func TestPayloadTemplates_MatchTheReceivers(t *testing.T) {
+	at := time.Date(2021, time.January, 2, 3, 4, 5, 0, time.UTC) // 1609556645 in Unix time.
+	open := logmon.ThresholdAlert{Kind: logmon.HighTraffic, Open: true, Hits: 20, Time: at}
+	recovered := logmon.ThresholdAlert{Kind: logmon.HighTraffic, Open: false, Hits: 2.25, Time: at}
+
+	for name, tc := range map[string]struct {
+		template string
+		alert    logmon.ThresholdAlert
+		expected string
+	}{
+		"slack": {
+			template: "slack",
+			alert:    open,
+			expected: `{
+				"text": ":rotating_light: high traffic alert triggered - hits = 20.00 req/s",
+				"attachments": [{
+					"color": "danger",
+					"fields": [
+						{"title": "Alert", "value": "high traffic", "short": true},
+						{"title": "State", "value": "triggered", "short": true},
+						{"title": "Hits", "value": "20.00 req/s", "short": true}
+					],
+					"ts": 1609556645
+				}]
+			}`,
+		},
+		"pagerduty trigger": {
+			template: "pagerduty",
+			alert:    open,
+			expected: `{
+				"routing_key": "R0UT1NGKEY",
+				"event_action": "trigger",
+				"dedup_key": "logmon/high traffic",
+				"payload": {
+					"summary": "high traffic alert triggered - hits = 20.00 req/s",
+					"source": "logmon",
+					"severity": "critical",
+					"timestamp": "2021-01-02T03:04:05Z",
+					"class": "high_traffic",
+					"custom_details": {"kind": "high_traffic", "open": true, "hits": 20, "time": "2021-01-02T03:04:05Z"}
+				}
+			}`,
+		},
+		"pagerduty resolve": {
+			template: "pagerduty",
+			alert:    recovered,
+			expected: `{"routing_key": "R0UT1NGKEY", "event_action": "resolve", "dedup_key": "logmon/high traffic"}`,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			tmpl, err := logmon.LoadPayloadTemplate(tc.template)
+			require.NoError(t, err)
+
+			payload := postToWebhook(t, logmon.WebhookSinkOpts{Template: tmpl, Key: "R0UT1NGKEY"}, tc.alert)
+			require.JSONEq(t, tc.expected, string(payload))
+		})
+	}
+
+	custom, err := logmon.ParsePayloadTemplate("custom", `{{.Kind}} {{printf "%.1f" .Hits}} {{.Key}} {{.Time.Unix}}`)
+	require.NoError(t, err)
+	payload := postToWebhook(t, logmon.WebhookSinkOpts{Template: custom, Key: "k"}, recovered)
+	require.Equal(t, "high traffic 2.2 k 1609556645", string(payload), "kinds print as text, and 2.25 rounds half to even")
+}
+
+func TestPayloadTemplates_PagerDutyDedupKey(t *testing.T) {
+	tmpl, err := logmon.LoadPayloadTemplate("pagerduty")
+	require.NoError(t, err)
+
+	var trigger, resolve struct {
+		DedupKey string `json:"dedup_key"`
+	}
+	alert := givenAnAlert(true)
+	require.NoError(t, json.Unmarshal(postToWebhook(t, logmon.WebhookSinkOpts{Template: tmpl}, alert), &trigger))
+	alert.Open = false
+	require.NoError(t, json.Unmarshal(postToWebhook(t, logmon.WebhookSinkOpts{Template: tmpl}, alert), &resolve))
+
+	require.Equal(t, trigger.DedupKey, resolve.DedupKey, "a recovered alert resolves the incident of its open alert")
+}
+
+func TestLoadPayloadTemplate_FailsWithInvalidTemplates(t *testing.T) {
+	_, err := logmon.LoadPayloadTemplate("testdata/missing.tmpl")
+	require.Error(t, err, "templates must exist")
+
+	_, err = logmon.ParsePayloadTemplate("invalid", "{{.Open")
+	require.Error(t, err, "templates must be valid")
+}
+
+// postToWebhook delivers an alert to a webhook sink and returns the posted payload.
+func postToWebhook(t *testing.T, opts logmon.WebhookSinkOpts, alert logmon.ThresholdAlert) []byte {
+	var payload []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	opts.URL = server.URL
+	require.NoError(t, logmon.NewWebhookSink(opts).Notify(context.Background(), alert))
+	return payload
+}
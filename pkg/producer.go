@@ -7,6 +7,9 @@ import (
 	"log"
 	"regexp"
 	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/nxadm/tail"
 )
@@ -50,10 +53,18 @@ func NewLogEntry(
 	}
 }
 
+// LogSource is a log file to monitor, along with the parser of its lines.
+type LogSource struct {
+	Path   string
+	Parser LogParser
+}
+
 // LogEntryProducer watches a log file and produces a LogEntry for each new line.
+// Its parser can be replaced while it runs.
 type LogEntryProducer interface {
 	Setup() (func(), error)
 	Run(ctx context.Context, entries chan<- LogEntry)
+	SetParser(parser LogParser)
 }
 
 // ProducerOpts defines the options required to build a LogEntryProducer.
@@ -62,6 +73,7 @@ type ProducerOpts struct {
 	TailWhence  int // From where start tailing: [io.SeekStart, io.SeekCurrent, io.SeekEnd]
 	TailLogger  *log.Logger
 	LogParser   LogParser
+	OnLine      func(read time.Time) // Called on every line read, before parsing it. Optional.
 }
 
 // logEntryProducer implements the LogEntryProducer interface.
@@ -70,7 +82,9 @@ type logEntryProducer struct {
 	filename string
 	tailCfg  tail.Config
 	tail     *tail.Tail
+	mu       sync.RWMutex
 	parser   LogParser
+	onLine   func(read time.Time)
 }
 
 // NewLogEntryProducer creates a LogEntryProducer.
@@ -87,6 +101,7 @@ func NewLogEntryProducer(opts ProducerOpts) LogEntryProducer {
 		filename: opts.LogFilePath,
 		tailCfg:  tailCfg,
 		parser:   opts.LogParser,
+		onLine:   opts.OnLine,
 	}
 }
 
@@ -108,16 +123,23 @@ func (p *logEntryProducer) Setup() (func(), error) {
 }
 
 // Run consumes new lines from the file watcher and produces LogEntry into an output channel.
-func (p logEntryProducer) Run(ctx context.Context, entries chan<- LogEntry) {
+// If the file watcher stops delivering lines, the output channel is kept open until the context is done.
+// That way, the rest of the pipeline keeps running and can report the silent source.
+func (p *logEntryProducer) Run(ctx context.Context, entries chan<- LogEntry) {
 LOOP:
 	for {
 		select {
 		case line, ok := <-p.tail.Lines:
 			if !ok {
+				log.Printf("file watcher stopped: %v", p.tail.Err())
+				<-ctx.Done()
 				break LOOP
 			}
 
-			entry, err := p.parser.Parse(line.Text)
+			if p.onLine != nil {
+				p.onLine(line.Time)
+			}
+			entry, err := p.currentParser().Parse(line.Text)
 			if err != nil {
 				log.Printf("error parsing log line: %v", err)
 				continue
@@ -133,6 +155,41 @@ LOOP:
 	close(entries)
 }
 
+// SetParser replaces the parser. It applies to the lines read from then on.
+func (p *logEntryProducer) SetParser(parser LogParser) {
+	p.mu.Lock()
+	p.parser = parser
+	p.mu.Unlock()
+	log.Printf("parser of %s replaced", p.filename)
+}
+
+func (p *logEntryProducer) currentParser() LogParser {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.parser
+}
+
+// lineClock records the time the sources last read a line, whether it is parsed and aggregated or not.
+// It tells a silent source apart from a source whose lines are all dropped. It is safe for concurrent use.
+type lineClock struct {
+	last int64 // Unix time, in nanoseconds.
+}
+
+// newLineClock creates a lineClock, as if a line was just read: the sources are silent from then on.
+func newLineClock() *lineClock {
+	c := &lineClock{}
+	c.touch(time.Now())
+	return c
+}
+
+func (c *lineClock) touch(read time.Time) {
+	atomic.StoreInt64(&c.last, read.UnixNano())
+}
+
+func (c *lineClock) lastRead() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&c.last))
+}
+
 // LogParser defines a log parser that produces a LogEntry from a log line.
 type LogParser interface {
 	Parse(line string) (entry LogEntry, err error)
@@ -154,6 +211,34 @@ func NewW3CommonLogParser() LogParser {
 	}
 }
 
+// NewW3CombinedLogParser builds a parser of the combined log format: the common one followed by the referer and
+// the user agent of the request, which are dropped.
+func NewW3CombinedLogParser() LogParser {
+	return w3CommonLogParser{
+		logLineRegexp: regexp.MustCompile(
+			// Capture groups in: remotehost rfc931 authuser [date] "request" status bytes "referer" "user agent"
+			`^(\S+) (\S+) (\S+) \[([^]]+)] "(\S+) ([^"]+) (\S+)" ([0-9]{3}) ([0-9]+|-) "[^"]*" "[^"]*"$`,
+		),
+	}
+}
+
+// Log formats of the parsers built by NewLogParser.
+const (
+	CommonLogFormat   = "common"
+	CombinedLogFormat = "combined"
+)
+
+// NewLogParser builds the parser of a log format: CommonLogFormat or CombinedLogFormat.
+func NewLogParser(format string) (LogParser, error) {
+	switch format {
+	case CommonLogFormat:
+		return NewW3CommonLogParser(), nil
+	case CombinedLogFormat:
+		return NewW3CombinedLogParser(), nil
+	}
+	return nil, fmt.Errorf("invalid log format %q: expected %s or %s", format, CommonLogFormat, CombinedLogFormat)
+}
+
 // Parse uses regexp to capture groups in a log file the following format:
 // https://www.w3.org/Daemon/User/Config/Logging.html#common-logfile-format
 // example input:
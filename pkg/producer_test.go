@@ -8,6 +8,7 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/nxadm/tail"
 	"github.com/stretchr/testify/require"
@@ -94,6 +95,39 @@ func TestLogEntryProducer_ContextCancellation(t *testing.T) {
 	require.True(t, count < len(fixtures.raws), "not all the written lines were read")
 }
 
+func TestLogEntryProducer_ReportsUnparsableLines(t *testing.T) {
+	file, err := ioutil.TempFile("", "logfile_*")
+	require.NoError(t, err)
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	reads := make(chan time.Time, 1)
+	opts := logmon.ProducerOpts{
+		LogFilePath: file.Name(),
+		TailWhence:  io.SeekStart,
+		TailLogger:  tail.DiscardingLogger,
+		LogParser:   logmon.NewW3CommonLogParser(),
+		OnLine:      func(read time.Time) { reads <- read },
+	}
+	producer := logmon.NewLogEntryProducer(opts)
+	cleanup, err := producer.Setup()
+	require.NoError(t, err)
+	defer cleanup()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	entries := make(chan logmon.LogEntry)
+	go producer.Run(ctx, entries)
+
+	appendToFile(file, "invalid-log-entry")
+	select {
+	case read := <-reads:
+		require.False(t, read.IsZero(), "the line is read, even if it cannot be parsed")
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "the unparsable line is not reported")
+	}
+}
+
 func setupFileAndProducer(t *testing.T) (*os.File, <-chan logmon.LogEntry, context.CancelFunc, func()) {
 	// Create a temp log file:
 	file, err := ioutil.TempFile("", "logfile_*")
@@ -168,3 +202,19 @@ func TestW3CommonLogParser(t *testing.T) {
 		})
 	}
 }
+
+func TestW3CombinedLogParser(t *testing.T) {
+	parser, err := logmon.NewLogParser(logmon.CombinedLogFormat)
+	require.NoError(t, err)
+	entry, raw := fixtures.GetOneAtRandom()
+
+	read, err := parser.Parse(raw + ` "https://example.com/" "Mozilla/5.0 (X11; Linux x86_64)"`)
+	require.NoError(t, err)
+	require.True(t, equalLogEntries(read, entry))
+
+	_, err = parser.Parse(raw)
+	require.Error(t, err, "the referer and the user agent are required")
+
+	_, err = logmon.NewLogParser("json")
+	require.EqualError(t, err, `invalid log format "json": expected common or combined`)
+}
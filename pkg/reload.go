@@ -0,0 +1,204 @@
+package logmon
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ConfigReload is a configuration reloaded while the monitor runs, e.g. on SIGHUP, or the error reloading it.
+type ConfigReload struct {
+	Config Config
+	Err    error
+}
+
+// ReloadReport tells how a configuration reload went. It is reported by the UI.
+type ReloadReport struct {
+	Time    time.Time
+	Err     error       // Why the configuration was not applied. Nothing was applied if set.
+	Changes []string    // Changes applied live.
+	Restart []string    // Sections changed that are only applied on restart.
+	Opts    MonitorOpts // Options of the configuration applied.
+}
+
+// Summary describes the outcome of the reload in plain text.
+func (r ReloadReport) Summary() string {
+	if r.Err != nil {
+		return fmt.Sprintf("config reload failed: %v", r.Err)
+	}
+
+	summary := "config reloaded, no changes"
+	if len(r.Changes) > 0 {
+		summary = "config reloaded: " + strings.Join(r.Changes, ", ")
+	}
+	if len(r.Restart) > 0 {
+		summary += "; restart to apply " + strings.Join(r.Restart, ", ")
+	}
+	return summary
+}
+
+// ConfigDiff tells what changed between two configurations, to apply the new one to a running monitor.
+type ConfigDiff struct {
+	AddedSources   []SourceConfig
+	RemovedSources []SourceConfig
+	Parsers        []SourceConfig // Sources kept, with another parser.
+	Filter         bool
+	Traffic        bool // Refresh interval, rolling windows, clients or SLOs.
+	Alerts         bool // Alert rules or refresh interval.
+	Notifiers      bool
+	Silences       bool     // Maintenance windows or duration of the silences created from the UI.
+	Restart        []string // Sections changed that are only applied on restart, e.g. "outputs".
+}
+
+// restartSections are the sections of a configuration that cannot be applied to a running monitor.
+var restartSections = []struct {
+	path    string
+	section func(c *Config) interface{} // Pointer to the section.
+}{
+	{"history", func(c *Config) interface{} { return &c.History }},
+	{"silences.path", func(c *Config) interface{} { return &c.Silences.Path }},
+	{"outputs", func(c *Config) interface{} { return &c.Outputs }},
+	{"subscribers", func(c *Config) interface{} { return &c.Subscribers }},
+	{"ui", func(c *Config) interface{} { return &c.UI }},
+}
+
+// DiffConfig compares a configuration against the one it replaces.
+// The outputs that are enabled keep computing their rates with the former refresh interval until a restart.
+func DiffConfig(old, new Config) ConfigDiff {
+	var d ConfigDiff
+
+	oldSources := make(map[string]SourceConfig)
+	for _, s := range old.Sources {
+		oldSources[s.Path] = s
+	}
+	newSources := make(map[string]bool)
+	for _, s := range new.Sources {
+		newSources[s.Path] = true
+		previous, ok := oldSources[s.Path]
+		switch {
+		case !ok:
+			d.AddedSources = append(d.AddedSources, s)
+		case previous.Parser != s.Parser:
+			d.Parsers = append(d.Parsers, s)
+		}
+	}
+	for _, s := range old.Sources {
+		if !newSources[s.Path] {
+			d.RemovedSources = append(d.RemovedSources, s)
+		}
+	}
+
+	refresh := old.Refresh != new.Refresh
+	d.Filter = old.Filter != new.Filter
+	d.Traffic = refresh || !reflect.DeepEqual(old.Windows, new.Windows) || old.Clients != new.Clients ||
+		!reflect.DeepEqual(old.Alerts.SLOs, new.Alerts.SLOs)
+	d.Alerts = refresh || !reflect.DeepEqual(old.Alerts, new.Alerts)
+	d.Notifiers = !reflect.DeepEqual(old.Notifiers, new.Notifiers)
+	d.Silences = old.Silences.For != new.Silences.For || !reflect.DeepEqual(old.Silences.Maintenance, new.Silences.Maintenance)
+
+	for _, s := range restartSections {
+		if !reflect.DeepEqual(s.section(&old), s.section(&new)) {
+			d.Restart = append(d.Restart, s.path)
+		}
+	}
+	o := new.Outputs
+	if refresh && (o.Metrics.Addr != "" || o.Dashboard.Addr != "" || o.API.Addr != "" || o.Store.Path != "") {
+		d.Restart = append(d.Restart, "refresh of the outputs")
+	}
+	return d
+}
+
+// Changes describes the changes applied live, e.g. "source /var/log/app.log added".
+func (d ConfigDiff) Changes() []string {
+	var changes []string
+	for _, s := range d.AddedSources {
+		changes = append(changes, fmt.Sprintf("source %s added", s.Path))
+	}
+	for _, s := range d.RemovedSources {
+		changes = append(changes, fmt.Sprintf("source %s removed", s.Path))
+	}
+	for _, s := range d.Parsers {
+		changes = append(changes, fmt.Sprintf("parser of %s replaced", s.Path))
+	}
+	for _, c := range []struct {
+		changed bool
+		name    string
+	}{
+		{d.Filter, "filter"},
+		{d.Traffic, "traffic"},
+		{d.Alerts, "alerts"},
+		{d.Notifiers, "notifiers"},
+		{d.Silences, "silences"},
+	} {
+		if c.changed {
+			changes = append(changes, c.name)
+		}
+	}
+	return changes
+}
+
+// liveConfig returns the configuration a running monitor ends up with once a new one is applied:
+// the new one, with the sections only applied on restart kept from the old one.
+// That way, they are still reported on the next reloads until a restart.
+func liveConfig(old, new Config) Config {
+	live := new
+	for _, s := range restartSections {
+		reflect.ValueOf(s.section(&live)).Elem().Set(reflect.ValueOf(s.section(&old)).Elem())
+	}
+	return live
+}
+
+// pendingOpts hands the latest options set on a running component over to its goroutine, which applies them in turn.
+// Options set before the previous ones are applied replace them, unless they are combined with update.
+type pendingOpts struct {
+	mu    sync.Mutex
+	opts  interface{}
+	ready chan struct{} // Receives once options are pending.
+}
+
+func newPendingOpts() *pendingOpts {
+	return &pendingOpts{ready: make(chan struct{}, 1)}
+}
+
+// set makes options pending, without waiting for them to be applied.
+func (p *pendingOpts) set(opts interface{}) {
+	p.update(func(interface{}) interface{} { return opts })
+}
+
+// update makes the options returned by f pending, given the ones still pending if any, or else nil.
+func (p *pendingOpts) update(f func(pending interface{}) interface{}) {
+	p.mu.Lock()
+	p.opts = f(p.opts)
+	p.mu.Unlock()
+
+	select {
+	case p.ready <- struct{}{}:
+	default: // Already signalled.
+	}
+}
+
+// take returns the pending options, once ready receives. It returns nil if they were already taken.
+func (p *pendingOpts) take() interface{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	opts := p.opts
+	p.opts = nil
+	return opts
+}
+
+// queueReload makes a reload report pending on a UI along with the ones not reported yet, rather than replacing them:
+// a failed reload does not hide a previous one that changed the options, e.g. the refresh interval.
+func queueReload(p *pendingOpts, report ReloadReport) {
+	p.update(func(pending interface{}) interface{} {
+		reports, _ := pending.([]ReloadReport)
+		return append(reports, report)
+	})
+}
+
+// takeReloads returns the reload reports pending on a UI, in order.
+func takeReloads(p *pendingOpts) []ReloadReport {
+	reports, _ := p.take().([]ReloadReport)
+	return reports
+}
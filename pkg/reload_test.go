@@ -0,0 +1,292 @@
+package logmon_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	logmon "github.com/jjrumi/accesslogmonitor/pkg"
+)
+
+func TestDiffConfig(t *testing.T) {
+	tests := map[string]struct {
+		change          func(c *logmon.Config)
+		expectedChanges []string
+		expectedRestart []string
+	}{
+		"unchanged": {
+			change: func(c *logmon.Config) {},
+		},
+		"sources": {
+			change: func(c *logmon.Config) {
+				c.Sources = []logmon.SourceConfig{
+					{Path: "/var/log/b.log", Parser: "other"},
+					{Path: "/var/log/c.log", Parser: logmon.CommonLogFormat},
+				}
+			},
+			expectedChanges: []string{
+				"source /var/log/c.log added",
+				"source /var/log/a.log removed",
+				"parser of /var/log/b.log replaced",
+			},
+		},
+		"alert rules": {
+			change:          func(c *logmon.Config) { c.Alerts.Threshold = 20 },
+			expectedChanges: []string{"alerts"},
+		},
+		"slos": {
+			change:          func(c *logmon.Config) { c.Alerts.SLOs = []string{"availability:99.9:720h"} },
+			expectedChanges: []string{"traffic", "alerts"},
+		},
+		"refresh interval": {
+			change:          func(c *logmon.Config) { c.Refresh = 5 },
+			expectedChanges: []string{"traffic", "alerts"},
+			expectedRestart: []string{"refresh of the outputs"},
+		},
+		"restart only": {
+			change: func(c *logmon.Config) {
+				c.History = "/tmp/history.jsonl"
+				c.UI.Theme = "monochrome"
+			},
+			expectedRestart: []string{"history", "ui"},
+		},
+		"filter, notifiers and silences": {
+			change: func(c *logmon.Config) {
+				c.Filter = "status >= 500"
+				c.Notifiers = []logmon.NotifierConfig{{Type: logmon.ExecNotifier, Command: "true"}}
+				c.Silences.Maintenance = []string{"0 2 * * 0 2h"}
+			},
+			expectedChanges: []string{"filter", "notifiers", "silences"},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			old := logmon.DefaultConfig()
+			old.Sources = []logmon.SourceConfig{
+				{Path: "/var/log/a.log", Parser: logmon.CommonLogFormat},
+				{Path: "/var/log/b.log", Parser: logmon.CommonLogFormat},
+			}
+			old.Outputs.Metrics.Addr = ":9100"
+			new := old
+			tc.change(&new)
+
+			diff := logmon.DiffConfig(old, new)
+			require.Equal(t, tc.expectedChanges, diff.Changes())
+			require.Equal(t, tc.expectedRestart, diff.Restart)
+		})
+	}
+}
+
+func TestReloadReport_Summary(t *testing.T) {
+	tests := map[string]struct {
+		report   logmon.ReloadReport
+		expected string
+	}{
+		"no changes": {logmon.ReloadReport{}, "config reloaded, no changes"},
+		"changes": {
+			logmon.ReloadReport{Changes: []string{"filter", "alerts"}, Restart: []string{"outputs"}},
+			"config reloaded: filter, alerts; restart to apply outputs",
+		},
+		"failure": {
+			logmon.ReloadReport{Err: errors.New("line 2: refresh: must be a positive number of seconds")},
+			"config reload failed: line 2: refresh: must be a positive number of seconds",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			tc.report.Time = time.Now()
+			require.Equal(t, tc.expected, tc.report.Summary())
+		})
+	}
+}
+
+func TestLiveConfig_KeepsTheSectionsAppliedOnRestart(t *testing.T) {
+	old := logmon.DefaultConfig()
+	old.Outputs.Metrics.Addr = ":9100"
+	new := old
+	new.Alerts.Threshold = 20
+	new.History = "/tmp/history.jsonl"
+	new.Outputs.Metrics.Addr = ":9200"
+	new.UI.Theme = "monochrome"
+
+	live := logmon.LiveConfig(old, new)
+	require.Equal(t, 20, live.Alerts.Threshold, "the live sections are applied")
+	require.Equal(t, old.History, live.History)
+	require.Equal(t, old.Outputs, live.Outputs)
+	require.Equal(t, old.UI, live.UI)
+
+	// Reloading the same file again only reports what is still to restart:
+	diff := logmon.DiffConfig(live, new)
+	require.Empty(t, diff.Changes())
+	require.Equal(t, []string{"history", "outputs", "ui"}, diff.Restart)
+}
+
+func TestSourceWatchers_AddAndRemoveSources(t *testing.T) {
+	dir := givenATempDir(t)
+	defer os.RemoveAll(dir)
+	a, b := filepath.Join(dir, "a.log"), filepath.Join(dir, "b.log")
+	givenLogFiles(t, a, b)
+
+	watchers := logmon.NewSourceWatchers([]logmon.LogSource{{Path: a, Parser: logmon.NewW3CommonLogParser()}})
+	cleanup, err := watchers.Setup()
+	require.NoError(t, err)
+	defer cleanup()
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer cancel()
+	entries := watchers.Launch(ctx, &wg)
+	requireFlowsThrough(t, entries, a, "/a")
+
+	require.NoError(t, watchers.Add(logmon.LogSource{Path: b, Parser: logmon.NewW3CommonLogParser()}))
+	require.Error(t, watchers.Add(logmon.LogSource{Path: b, Parser: logmon.NewW3CommonLogParser()}), "a source is only watched once")
+	requireFlowsThrough(t, entries, b, "/b")
+
+	watchers.Remove(a)
+	require.Equal(t, []string{b}, watchers.Paths())
+	appendLogLine(t, a, "/a/removed")
+	requireFlowsThrough(t, entries, b, "/b/kept")
+	requireNoEntry(t, entries, "/a/removed", "the entries of a removed source stop")
+}
+
+func TestSourceWatchers_ApplyRollsTheSourcesAddedBackOnFailure(t *testing.T) {
+	dir := givenATempDir(t)
+	defer os.RemoveAll(dir)
+	a, b := filepath.Join(dir, "a.log"), filepath.Join(dir, "b.log")
+	missing := filepath.Join(dir, "missing", "c.log")
+	givenLogFiles(t, a, b)
+
+	sources := []logmon.LogSource{
+		{Path: a, Parser: logmon.NewW3CommonLogParser()},
+		{Path: b, Parser: logmon.NewW3CommonLogParser()},
+		{Path: missing, Parser: logmon.NewW3CommonLogParser()},
+	}
+	watchers := logmon.NewSourceWatchers(sources[:1])
+	cleanup, err := watchers.Setup()
+	require.NoError(t, err)
+	defer cleanup()
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer cancel()
+	entries := watchers.Launch(ctx, &wg)
+
+	diff := logmon.ConfigDiff{
+		AddedSources:   []logmon.SourceConfig{{Path: b}, {Path: missing}},
+		RemovedSources: []logmon.SourceConfig{{Path: a}},
+	}
+	require.Error(t, watchers.Apply(diff, sources))
+	require.Equal(t, []string{a}, watchers.Paths(), "the source added before the failure is removed, and the others are kept")
+
+	appendLogLine(t, b, "/b")
+	requireFlowsThrough(t, entries, a, "/a")
+	requireNoEntry(t, entries, "/b", "the entries of the source rolled back do not flow through")
+}
+
+func TestMonitor_ReloadAppliesEveryChangeOrNone(t *testing.T) {
+	dir := givenATempDir(t)
+	defer os.RemoveAll(dir)
+	a, b := filepath.Join(dir, "a.log"), filepath.Join(dir, "b.log")
+	givenLogFiles(t, a, b)
+
+	current := logmon.DefaultConfig()
+	current.History, current.Silences.Path = "", ""
+	current.Sources = []logmon.SourceConfig{{Path: a, Parser: logmon.CommonLogFormat}}
+	opts, err := current.MonitorOpts()
+	require.NoError(t, err)
+	monitor := logmon.NewMonitor(opts)
+	cleanup, err := monitor.Sources().Setup()
+	require.NoError(t, err)
+	defer cleanup()
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer cancel()
+	monitor.Sources().Launch(ctx, &wg)
+
+	next := current
+	next.Sources = []logmon.SourceConfig{
+		{Path: a, Parser: logmon.CommonLogFormat},
+		{Path: b, Parser: logmon.CommonLogFormat},
+		{Path: filepath.Join(dir, "missing", "c.log"), Parser: logmon.CommonLogFormat},
+	}
+	next.Filter = "status >= 500"
+	next.Alerts.Threshold = 20
+
+	// A source cannot be added:
+	live := monitor.Reload(current, logmon.ConfigReload{Config: next})
+	require.Equal(t, current, live, "the monitor keeps running with the current configuration")
+	require.Equal(t, []string{a}, monitor.Sources().Paths())
+	require.Empty(t, monitor.Filter().String())
+	reports := monitor.Reloads()
+	require.Len(t, reports, 1)
+	require.Error(t, reports[0].Err)
+	require.Empty(t, reports[0].Changes)
+
+	// Once it can:
+	next.Sources = next.Sources[:2]
+	live = monitor.Reload(current, logmon.ConfigReload{Config: next})
+	require.Equal(t, next, live)
+	require.Equal(t, []string{a, b}, monitor.Sources().Paths())
+	require.Equal(t, "status >= 500", monitor.Filter().String())
+	reports = monitor.Reloads()
+	require.Len(t, reports, 1)
+	require.NoError(t, reports[0].Err)
+	require.Equal(t, []string{"source " + b + " added", "filter", "alerts"}, reports[0].Changes)
+	require.Equal(t, 20, reports[0].Opts.AlertThreshold)
+}
+
+// givenLogFiles creates empty log files.
+func givenLogFiles(t *testing.T, paths ...string) {
+	for _, path := range paths {
+		require.NoError(t, ioutil.WriteFile(path, nil, 0644))
+	}
+}
+
+// appendLogLine appends a line of the common log format with a request of a path to a log file.
+func appendLogLine(t *testing.T, path, reqPath string) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	require.NoError(t, err)
+	defer file.Close()
+	appendToFile(file, `13.42.3.193 - - [26/Apr/2020:13:09:08 +0000] "GET `+reqPath+` HTTP/1.1" 200 5565`)
+}
+
+// requireFlowsThrough appends lines with a request of a path to a log file until one is received.
+// The lines appended before the file watcher gets to the end of the file are skipped.
+func requireFlowsThrough(t *testing.T, entries <-chan logmon.LogEntry, path, reqPath string) {
+	timeout := time.After(5 * time.Second)
+	for {
+		appendLogLine(t, path, reqPath)
+		select {
+		case entry := <-entries:
+			if entry.ReqPath == reqPath {
+				return
+			}
+		case <-time.After(100 * time.Millisecond):
+		case <-timeout:
+			require.Fail(t, "no entry received", "path %s", reqPath)
+		}
+	}
+}
+
+// requireNoEntry checks that no entry with a request of a path is received for a while.
+func requireNoEntry(t *testing.T, entries <-chan logmon.LogEntry, reqPath string, msg string) {
+	timeout := time.After(500 * time.Millisecond)
+	for {
+		select {
+		case entry := <-entries:
+			require.NotEqual(t, reqPath, entry.ReqPath, msg)
+		case <-timeout:
+			return
+		}
+	}
+}
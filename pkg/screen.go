@@ -0,0 +1,490 @@
+package logmon
+
+import (
+	"fmt"
+	"strings"
+
+	ui "github.com/gizak/termui/v3"
+	"github.com/gizak/termui/v3/widgets"
+)
+
+// keyBinding describes the keys of an action, for the help overlay.
+type keyBinding struct {
+	keys   string
+	action string
+}
+
+// keyBindings are the keys handled by the terminal UI.
+var keyBindings = []keyBinding{
+	{"Tab, l, Right", "focus the next panel"},
+	{"h, Left", "focus the previous panel"},
+	{"j, k, Down, Up", "scroll the focused panel"},
+	{"PageDown, PageUp", "scroll the focused panel by half a page"},
+	{"g, G, Home, End", "scroll the focused panel to the top or the bottom"},
+	{"Enter", "drill down into the section selected in the sections panel"},
+	{"Esc, Backspace", "go back from a section, or close this help"},
+	{"s", "silence the alert selected in the alert history panel"},
+	{"w", "switch the traffic and section panels between the last interval and the rolling windows"},
+	{"p, Space", "pause or resume the updates of the panels"},
+	{"/", "edit the filter of the log entries: Enter applies it, Esc cancels"},
+	{"[, ], 1-9", "switch tabs, on small terminals"},
+	{"?", "show or hide this help"},
+	{"q, Ctrl-C", "quit"},
+}
+
+// Titles of the panels whose keys are not told by the help overlay.
+const (
+	configTitle = "Monitor setup values (? for help)"
+	pausedTitle = "Monitor setup values - PAUSED (p to resume)"
+)
+
+// promptTitle is the title of the filter prompt.
+const promptTitle = "Filter, e.g. status >= 500 and path ~ \"^/api\" (Enter to apply, empty for none, Esc to cancel)"
+
+// screen is the state of the terminal UI while it runs: its panels and what they display.
+// The traffic stats and alerts are always recorded, but the panels are not updated while the screen is paused.
+type screen struct {
+	u     terminalUI
+	board *alertBoard
+	rates *rateHistory
+
+	last         TrafficStats // Traffic stats displayed.
+	latest       TrafficStats // Traffic stats received last, displayed once the screen is resumed.
+	received     bool         // Whether any traffic stats were received.
+	view         int          // 0 for the last interval, i for the rolling window i-1.
+	sectionKeys  []string     // Sections listed in the sections panel, in order.
+	section      string       // Section drilled down, if any.
+	paused       bool
+	help         bool
+	editing      bool   // Whether the filter prompt is open.
+	input        []rune // Filter typed in the prompt.
+	focus        int    // Focused panel among the ones displayed by the main view.
+	sectionFocus int    // Focused panel of the section view.
+	compact      bool   // Whether the terminal is small enough for the compact layout.
+	page         int    // Tab displayed by the compact layout.
+
+	traffic    *widgets.List
+	config     *widgets.List
+	chart      *rateChart
+	sparklines *widgets.SparklineGroup
+	alerts     *widgets.List
+	history    *widgets.List
+	sections   *widgets.List
+	clients    *widgets.List
+	status     *widgets.List
+	methods    *widgets.List
+	slos       *widgets.List
+	full       screenPage   // Every panel at once.
+	pages      []screenPage // Tabs of the compact layout.
+	tabs       *widgets.TabPane
+	drill      *sectionView
+	helpBox    *widgets.Paragraph
+	prompt     *widgets.Paragraph
+}
+
+func (u terminalUI) newScreen(width, height int) *screen {
+	u.theme.apply()
+	board := newAlertBoard(u.history)
+	s := &screen{
+		u:          u,
+		board:      board,
+		rates:      newRateHistory(u.refresh),
+		traffic:    u.buildTrafficWidget(),
+		config:     u.buildConfigWidget(),
+		chart:      u.buildRateChart(),
+		sparklines: u.buildErrorSparklines(),
+		alerts:     u.buildAlertsWidget(board),
+		history:    u.buildHistoryWidget(board),
+		sections:   u.buildSectionsWidget(),
+		clients:    u.buildClientsWidget(),
+		status:     u.buildStatusWidget(),
+		methods:    u.buildMethodsWidget(),
+		slos:       u.buildSLOsWidget(),
+		drill:      u.buildSectionView(),
+		helpBox:    u.buildHelpWidget(),
+		prompt:     u.buildPromptWidget(),
+	}
+	s.full = s.buildPage("", u.layout.Rows)
+	s.pages = s.buildCompactPages()
+	s.tabs = u.buildTabsWidget(s.pages)
+
+	// The alert history panel is focused first, to scroll it right away:
+	s.resize(width, height)
+	s.focusPanel(s.history)
+	return s
+}
+
+// panels returns the panels of the main view that can be focused, in reading order.
+func (s *screen) panels() []*widgets.List {
+	return []*widgets.List{s.traffic, s.config, s.alerts, s.history, s.sections, s.clients, s.status, s.methods, s.slos}
+}
+
+// displayed returns the panels displayed by the current view that can be focused, in reading order.
+func (s *screen) displayed() []*widgets.List {
+	switch {
+	case s.section != "":
+		return s.drill.panels()
+	case s.compact:
+		return s.pages[s.page].panels
+	}
+	return s.full.panels
+}
+
+// focused returns the focused panel of the current view, if it displays any.
+func (s *screen) focused() *widgets.List {
+	focus := s.focus
+	if s.section != "" {
+		focus = s.sectionFocus
+	}
+
+	panels := s.displayed()
+	if len(panels) == 0 {
+		return nil
+	}
+	if focus < 0 || focus >= len(panels) {
+		return panels[0]
+	}
+	return panels[focus]
+}
+
+// moveFocus focuses the panel delta positions away from the focused one in the current view.
+func (s *screen) moveFocus(delta int) {
+	n := len(s.displayed())
+	if n == 0 {
+		return
+	}
+	if s.section != "" {
+		s.sectionFocus = (s.sectionFocus + delta + n) % n
+	} else {
+		s.focus = (s.focus + delta + n) % n
+	}
+	s.applyFocus()
+}
+
+// focusPanel focuses a panel of the main view. In the compact layout, it displays the tab of the panel.
+func (s *screen) focusPanel(panel *widgets.List) {
+	if s.compact {
+		for i, page := range s.pages {
+			for _, p := range page.panels {
+				if p == panel {
+					s.page = i
+					s.tabs.ActiveTabIndex = i
+				}
+			}
+		}
+	}
+
+	s.focus = 0
+	for i, p := range s.displayed() {
+		if p == panel {
+			s.focus = i
+		}
+	}
+	s.applyFocus()
+}
+
+// applyFocus highlights the border and the selected row of the focused panel only.
+func (s *screen) applyFocus() {
+	focused := s.focused()
+	style := s.u.theme.style(s.u.theme.Focus)
+	for _, panel := range append(s.panels(), s.drill.panels()...) {
+		panel.BorderStyle = ui.Theme.Block.Border
+		panel.SelectedRowStyle = panel.TextStyle
+		if panel == focused {
+			panel.BorderStyle = style
+			panel.SelectedRowStyle = style
+		}
+	}
+}
+
+// updateStats records traffic stats, and displays them unless the screen is paused.
+func (s *screen) updateStats(stats TrafficStats) {
+	s.latest = stats
+	s.received = true
+	s.rates.add(stats, s.board.isOpen(HighTraffic))
+
+	if !s.paused {
+		s.last = stats
+		s.refreshStats()
+		s.render()
+	}
+}
+
+// updateAlert records an alert, and displays it unless the screen is paused.
+func (s *screen) updateAlert(a ThresholdAlert) {
+	s.board.record(a)
+	if a.Kind == HighTraffic {
+		s.rates.markAlerting(a.Open)
+	}
+
+	if !s.paused {
+		s.refreshAlerts()
+		s.render()
+	}
+}
+
+// reload applies a config reload, and tells how it went in the setup panel.
+// The new refresh interval applies to the rates of the intervals received from then on.
+func (s *screen) reload(r ReloadReport) {
+	s.u = s.u.reloaded(r)
+	s.rates.refresh = s.u.refresh
+
+	s.config.Rows = s.u.formatConfig()
+	s.slos.Rows = s.u.formatSLOs(s.last.SLOs)
+	s.render()
+}
+
+// refreshStats updates the panels of the traffic stats with the last ones received.
+func (s *screen) refreshStats() {
+	if !s.received {
+		return
+	}
+
+	if s.view > len(s.last.Windows) {
+		s.view = 0
+	}
+	selected := s.selectedSection()
+
+	s.config.Rows = s.u.formatConfig()
+	s.sectionKeys = s.u.renderTraffic(s.u.selectView(s.last, s.view), s.traffic, s.sections, s.status, s.methods)
+	s.slos.Rows = s.u.formatSLOs(s.last.SLOs)
+	s.clients.Rows = s.u.formatClients(s.last)
+	s.u.renderRates(s.rates, s.chart, s.sparklines)
+	if s.section != "" {
+		s.u.renderSection(s.drill, s.section, s.u.selectView(s.last, s.view))
+	}
+
+	// Keep the selected section selected, as the sections are sorted again:
+	for i, key := range s.sectionKeys {
+		if key == selected {
+			s.sections.SelectedRow = i + 1
+		}
+	}
+	for _, panel := range append(s.panels(), s.drill.panels()...) {
+		if panel.SelectedRow >= len(panel.Rows) {
+			panel.SelectedRow = len(panel.Rows) - 1
+		}
+	}
+}
+
+// refreshAlerts updates the panels of the alerts with the ones received.
+func (s *screen) refreshAlerts() {
+	s.alerts.Rows = s.u.formatAlerts(s.board)
+	s.history.Rows = s.u.formatHistory(s.board)
+	s.u.renderRates(s.rates, s.chart, s.sparklines)
+}
+
+// selectedSection returns the section selected in the sections panel, if any.
+// The first row of the panel is its header.
+func (s *screen) selectedSection() string {
+	row := s.sections.SelectedRow - 1
+	if row < 0 || row >= len(s.sectionKeys) {
+		return ""
+	}
+	return s.sectionKeys[row]
+}
+
+// render draws the current view, and the overlays on top of it.
+func (s *screen) render() {
+	var overlays []ui.Drawable
+	switch {
+	case s.section != "":
+		overlays = append(overlays, s.drill.grid)
+	case s.compact:
+		overlays = append(overlays, s.tabs, s.pages[s.page].grid)
+	default:
+		overlays = append(overlays, s.full.grid)
+	}
+	if s.help {
+		overlays = append(overlays, s.helpBox)
+	}
+	if s.editing {
+		overlays = append(overlays, s.prompt)
+	}
+	ui.Render(overlays...)
+}
+
+// handleEvent updates the screen on a terminal event. It tells whether to quit.
+func (s *screen) handleEvent(e ui.Event) bool {
+	if e.Type != ui.ResizeEvent {
+		return s.handleKey(e.ID)
+	}
+
+	size := e.Payload.(ui.Resize)
+	s.resize(size.Width, size.Height)
+	ui.Clear()
+
+	// The charts fit as many intervals as their new size allows, once drawn:
+	s.render()
+	if !s.paused {
+		s.u.renderRates(s.rates, s.chart, s.sparklines)
+		s.render()
+	}
+	return false
+}
+
+// handleKey updates the screen on a key press. It tells whether to quit.
+// While the filter prompt is open, the keys are typed into it.
+func (s *screen) handleKey(key string) bool {
+	if key == "<C-c>" {
+		return true
+	}
+	if s.editing {
+		s.editFilter(key)
+		s.render()
+		return false
+	}
+
+	switch key {
+	case "q":
+		return true
+	case "/":
+		if s.u.filter != nil {
+			s.editing = true
+			s.input = []rune(s.u.filter.Filter().String())
+			s.prompt.Text = string(s.input) + "_"
+		}
+	case "?":
+		s.help = !s.help
+	case "<Escape>", "<Backspace>", "<C-<Backspace>>":
+		if s.help {
+			s.help = false
+		} else if s.section != "" {
+			s.section = ""
+			s.applyFocus()
+		}
+	case "<Tab>", "l", "<Right>":
+		s.moveFocus(1)
+	case "h", "<Left>":
+		s.moveFocus(-1)
+	case "]":
+		s.selectPage((s.page + 1) % len(s.pages))
+	case "[":
+		s.selectPage((s.page - 1 + len(s.pages)) % len(s.pages))
+	case "1", "2", "3", "4", "5", "6", "7", "8", "9":
+		s.selectPage(int(key[0] - '1'))
+	case "j", "<Down>", "k", "<Up>", "<PageDown>", "<PageUp>", "g", "<Home>", "G", "<End>":
+		if panel := s.focused(); panel != nil {
+			scroll(panel, key)
+		}
+	case "<Enter>":
+		if section := s.selectedSection(); s.section == "" && s.focused() == s.sections && section != "" {
+			s.section = section
+			s.sectionFocus = 0
+			s.u.renderSection(s.drill, section, s.u.selectView(s.last, s.view))
+			s.applyFocus()
+		}
+	case "s":
+		s.history.Title = s.u.silenceSelected(s.board, s.history.SelectedRow)
+		s.config.Rows = s.u.formatConfig()
+	case "w":
+		s.view = (s.view + 1) % (1 + len(s.last.Windows))
+		s.refreshStats()
+	case "p", "<Space>":
+		s.paused = !s.paused
+		s.config.Title = configTitle
+		if s.paused {
+			s.config.Title = pausedTitle
+		} else {
+			s.last = s.latest
+			s.refreshStats()
+			s.refreshAlerts()
+		}
+	default:
+		return false
+	}
+
+	s.render()
+	return false
+}
+
+// scroll scrolls a panel on a key press.
+func scroll(panel *widgets.List, key string) {
+	switch key {
+	case "j", "<Down>":
+		panel.ScrollDown()
+	case "k", "<Up>":
+		panel.ScrollUp()
+	case "<PageDown>":
+		panel.ScrollHalfPageDown()
+	case "<PageUp>":
+		panel.ScrollHalfPageUp()
+	case "g", "<Home>":
+		panel.ScrollTop()
+	case "G", "<End>":
+		panel.ScrollBottom()
+	}
+}
+
+// editFilter edits the filter typed in the prompt, and applies it on Enter.
+// An invalid filter leaves the prompt open with the error.
+func (s *screen) editFilter(key string) {
+	switch key {
+	case "<Enter>":
+		filter, err := ParseFilter(string(s.input))
+		if err != nil {
+			s.prompt.Text = fmt.Sprintf("%s_\nerror: %v", string(s.input), err)
+			return
+		}
+		s.u.filter.SetFilter(filter)
+		s.editing = false
+		s.config.Rows = s.u.formatConfig()
+		return
+	case "<Escape>":
+		s.editing = false
+		return
+	case "<Backspace>", "<C-<Backspace>>":
+		if len(s.input) > 0 {
+			s.input = s.input[:len(s.input)-1]
+		}
+	case "<C-u>":
+		s.input = nil
+	case "<Space>":
+		s.input = append(s.input, ' ')
+	default:
+		if r := []rune(key); len(r) == 1 {
+			s.input = append(s.input, r[0])
+		}
+	}
+	s.prompt.Text = string(s.input) + "_"
+}
+
+func (u terminalUI) buildPromptWidget() *widgets.Paragraph {
+	prompt := widgets.NewParagraph()
+	prompt.Title = promptTitle
+	prompt.BorderStyle = u.theme.style(u.theme.Focus)
+
+	return prompt
+}
+
+func (u terminalUI) buildHelpWidget() *widgets.Paragraph {
+	help := widgets.NewParagraph()
+	help.Title = "Keys (? or Esc to close)"
+	help.WrapText = false
+	help.BorderStyle = u.theme.style(u.theme.Focus)
+
+	return help
+}
+
+// helpLines returns the lines of the help overlay for a width, with the actions wrapped below their column.
+func (u terminalUI) helpLines(width int) []string {
+	const keysWidth = 18
+	indent := strings.Repeat(" ", keysWidth+1)
+
+	var lines []string
+	for _, b := range keyBindings {
+		line := fmt.Sprintf("[%-*s](%s)", keysWidth, b.keys, u.theme.Key)
+		length := keysWidth
+		for _, word := range strings.Fields(b.action) {
+			if length > keysWidth && length+1+len(word) > width {
+				lines = append(lines, line)
+				line, length = indent+word, keysWidth+1+len(word)
+				continue
+			}
+			line += " " + word
+			length += 1 + len(word)
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
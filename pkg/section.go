@@ -0,0 +1,94 @@
+package logmon
+
+import (
+	"fmt"
+
+	ui "github.com/gizak/termui/v3"
+	"github.com/gizak/termui/v3/widgets"
+)
+
+// sectionView displays the traffic of a single section: its methods, statuses, top paths and top clients.
+type sectionView struct {
+	summary  *widgets.List
+	methods  *widgets.List
+	statuses *widgets.List
+	paths    *widgets.List
+	clients  *widgets.List
+	grid     *ui.Grid
+}
+
+func (u terminalUI) buildSectionView() *sectionView {
+	v := &sectionView{
+		summary:  newPanel("Section"),
+		methods:  newPanel("HTTP request methods"),
+		statuses: newPanel("HTTP response status"),
+		paths:    newPanel("Top paths"),
+		clients:  newPanel("Top clients"),
+		grid:     ui.NewGrid(),
+	}
+	v.grid.Set(
+		ui.NewRow(0.3,
+			ui.NewCol(1.0/3, v.summary),
+			ui.NewCol(1.0/3, v.methods),
+			ui.NewCol(1.0/3, v.statuses),
+		),
+		ui.NewRow(0.7,
+			ui.NewCol(1.0/2, v.paths),
+			ui.NewCol(1.0/2, v.clients),
+		),
+	)
+	return v
+}
+
+// panels returns the panels of the view that can be focused, in reading order.
+func (v *sectionView) panels() []*widgets.List {
+	return []*widgets.List{v.summary, v.methods, v.statuses, v.paths, v.clients}
+}
+
+// newPanel creates a list waiting for inputs.
+func newPanel(title string) *widgets.List {
+	panel := widgets.NewList()
+	panel.Title = title
+	panel.WrapText = false
+	panel.SetRect(0, 0, 50, 8)
+	panel.Rows = []string{
+		"",
+		"waiting for inputs...",
+	}
+
+	return panel
+}
+
+// renderSection updates the view with the traffic of a section within a view: the last interval or a rolling window.
+func (u terminalUI) renderSection(v *sectionView, section string, t trafficView) {
+	s, label := t.stats, t.label
+	v.summary.Title = fmt.Sprintf("Section %s - last %s (w to switch, Esc to go back)", section, label)
+	v.methods.Title = fmt.Sprintf("HTTP request methods - last %s", label)
+	v.statuses.Title = fmt.Sprintf("HTTP response status - last %s", label)
+	v.paths.Title = fmt.Sprintf("Top paths - last %s", label)
+	v.clients.Title = fmt.Sprintf("Top clients - last %s", label)
+
+	stats, ok := s.Sections[section]
+	if !ok {
+		for _, panel := range v.panels() {
+			panel.Rows = []string{"", "no requests"}
+		}
+		return
+	}
+
+	var rate float64
+	if t.covered > 0 {
+		rate = float64(s.SectionHits[section]) / t.covered.Seconds()
+	}
+	v.summary.Rows = []string{
+		"",
+		fmt.Sprintf("Total requests: [%v](%s)", s.SectionHits[section], u.theme.Value),
+		fmt.Sprintf("Requests per second: [%.2f](%s)", rate, u.theme.Value),
+		fmt.Sprintf("Bytes transferred: [%v](%s)", stats.Bytes, u.theme.Value),
+	}
+	v.methods.Rows = fromMap(stats.MethodHits).marshalTopList("Hits - HTTP method", 10, u.theme.Value)
+	v.statuses.Rows = fromMap(stats.StatusClassHits).marshalTopList("Hits - HTTP status", 10, u.theme.Value)
+	paths := fromMap(stats.PathHits)
+	v.paths.Rows = paths.marshalTopList("Hits - Path", paths.Len(), u.theme.Value)
+	v.clients.Rows = u.formatClients(TrafficStats{Clients: stats.Clients})
+}
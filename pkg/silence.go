@@ -0,0 +1,316 @@
+package logmon
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Labels returns the labels of the alert that silences can match on: kind, name and id.
+func (a ThresholdAlert) Labels() map[string]string {
+	kind, _ := a.Kind.MarshalText()
+	return map[string]string{"kind": string(kind), "name": a.Name, "id": a.ID()}
+}
+
+// Matcher matches an alert label against a glob pattern, e.g. name=10.0.0.*
+type Matcher struct {
+	Label   string `json:"label"`
+	Pattern string `json:"pattern"`
+}
+
+// Matchers matches alerts that match all of its matchers.
+type Matchers []Matcher
+
+// silenceMatchers returns the Matchers that match exactly the condition of an alert.
+func silenceMatchers(a ThresholdAlert) Matchers {
+	labels := a.Labels()
+	matchers := Matchers{{Label: "kind", Pattern: labels["kind"]}}
+	if a.Name != "" {
+		matchers = append(matchers, Matcher{Label: "name", Pattern: globEscaper.Replace(labels["name"])})
+	}
+	return matchers
+}
+
+// globEscaper escapes the special characters of the glob patterns of the matchers.
+var globEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`)
+
+// ParseMatchers creates Matchers from a definition like "kind=abuse,name=10.0.0.*".
+func ParseMatchers(definition string) (Matchers, error) {
+	var matchers Matchers
+	for _, part := range strings.Split(definition, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("invalid matcher %q: expected label=pattern", part)
+		}
+		if _, err := path.Match(kv[1], ""); err != nil {
+			return nil, fmt.Errorf("invalid matcher %q: %w", part, err)
+		}
+		matchers = append(matchers, Matcher{Label: kv[0], Pattern: kv[1]})
+	}
+	return matchers, nil
+}
+
+// Match tells whether the alert matches all the matchers. No matchers match no alert.
+func (m Matchers) Match(a ThresholdAlert) bool {
+	if len(m) == 0 {
+		return false
+	}
+
+	labels := a.Labels()
+	for _, matcher := range m {
+		if ok, _ := path.Match(matcher.Pattern, labels[matcher.Label]); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns the matchers as in their definition.
+func (m Matchers) String() string {
+	parts := make([]string, 0, len(m))
+	for _, matcher := range m {
+		parts = append(parts, matcher.Label+"="+matcher.Pattern)
+	}
+	return strings.Join(parts, ",")
+}
+
+// Silence mutes the notifications of the alerts it matches until it expires.
+type Silence struct {
+	ID       string    `json:"id"`
+	Matchers Matchers  `json:"matchers"`
+	Expires  time.Time `json:"expires"`
+	Comment  string    `json:"comment,omitempty"`
+}
+
+// NewSilence creates a Silence that lasts for the given duration.
+func NewSilence(matchers Matchers, duration time.Duration, comment string) Silence {
+	id := make([]byte, 4)
+	_, _ = rand.Read(id)
+	return Silence{ID: hex.EncodeToString(id), Matchers: matchers, Expires: time.Now().Add(duration), Comment: comment}
+}
+
+// Active tells whether the silence has not expired at the given time.
+func (s Silence) Active(at time.Time) bool {
+	return at.Before(s.Expires)
+}
+
+// SilenceStore keeps the silences in a JSON file.
+// The file is shared by the running monitor and the silence subcommand.
+type SilenceStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewSilenceStore creates a SilenceStore.
+func NewSilenceStore(path string) *SilenceStore {
+	return &SilenceStore{path: path}
+}
+
+// Load reads all the silences, expired ones included. A missing file has no silences.
+func (s *SilenceStore) Load() ([]Silence, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.load()
+}
+
+// Active reads the silences that have not expired at the given time.
+func (s *SilenceStore) Active(at time.Time) ([]Silence, error) {
+	silences, err := s.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	var active []Silence
+	for _, silence := range silences {
+		if silence.Active(at) {
+			active = append(active, silence)
+		}
+	}
+	return active, nil
+}
+
+// Add stores a new silence. Silences expired for a day are dropped from the file.
+func (s *SilenceStore) Add(silence Silence) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	silences, err := s.load()
+	if err != nil {
+		return err
+	}
+
+	kept := []Silence{silence}
+	for _, old := range silences {
+		if old.Active(time.Now().Add(-24 * time.Hour)) {
+			kept = append(kept, old)
+		}
+	}
+	return s.save(kept)
+}
+
+// Expire ends a silence right away.
+func (s *SilenceStore) Expire(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	silences, err := s.load()
+	if err != nil {
+		return err
+	}
+
+	for i := range silences {
+		if silences[i].ID == id {
+			silences[i].Expires = time.Now()
+			return s.save(silences)
+		}
+	}
+	return fmt.Errorf("silence %q not found", id)
+}
+
+func (s *SilenceStore) load() ([]Silence, error) {
+	content, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read silences: %w", err)
+	}
+
+	var silences []Silence
+	if err := json.Unmarshal(content, &silences); err != nil {
+		return nil, fmt.Errorf("decode silences: %w", err)
+	}
+	return silences, nil
+}
+
+// save writes the silences to a temporary file and renames it, so readers never see a partial file.
+// The directory of the file is created if needed, only accessible by the user, and so is the file.
+func (s *SilenceStore) save(silences []Silence) error {
+	content, err := json.MarshalIndent(silences, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode silences: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return fmt.Errorf("write silences: %w", err)
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), ".silences_*")
+	if err != nil {
+		return fmt.Errorf("write silences: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write silences: %w", err)
+	}
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write silences: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write silences: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("write silences: %w", err)
+	}
+	return nil
+}
+
+// Silencer consumes alerts and marks the silenced ones before passing them on.
+// Its maintenance windows can be replaced while it runs.
+type Silencer interface {
+	Run(ctx context.Context, input <-chan ThresholdAlert, output chan<- ThresholdAlert)
+	SetMaintenance(maintenance []MaintenanceWindow)
+}
+
+// SilencerOpts defines the options required to build a Silencer.
+type SilencerOpts struct {
+	Store       *SilenceStore // Silences created on demand. None if nil.
+	Maintenance []MaintenanceWindow
+}
+
+// NewSilencer creates a Silencer.
+func NewSilencer(opts SilencerOpts) Silencer {
+	return &silencer{store: opts.Store, maintenance: opts.Maintenance}
+}
+
+// silencer implements the Silencer interface.
+type silencer struct {
+	store       *SilenceStore
+	mu          sync.RWMutex
+	maintenance []MaintenanceWindow
+}
+
+// Run consumes alerts, marks the ones matched by an active silence or a maintenance window, and produces them.
+// Silenced alerts are still produced: they are displayed and recorded, but not notified.
+func (s *silencer) Run(ctx context.Context, input <-chan ThresholdAlert, output chan<- ThresholdAlert) {
+LOOP:
+	for {
+		select {
+		case a, ok := <-input:
+			if !ok {
+				break LOOP
+			}
+
+			a.Silenced = s.silenced(a)
+			select {
+			case output <- a:
+			case <-ctx.Done():
+				break LOOP
+			}
+		case <-ctx.Done():
+			break LOOP
+		}
+	}
+
+	log.Printf("clean up: close silenced alerts channel")
+	close(output)
+}
+
+// SetMaintenance replaces the maintenance windows. They apply to the alerts consumed from then on.
+func (s *silencer) SetMaintenance(maintenance []MaintenanceWindow) {
+	s.mu.Lock()
+	s.maintenance = maintenance
+	s.mu.Unlock()
+	log.Printf("maintenance windows replaced: %d windows", len(maintenance))
+}
+
+func (s *silencer) silenced(a ThresholdAlert) bool {
+	s.mu.RLock()
+	maintenance := s.maintenance
+	s.mu.RUnlock()
+	for _, w := range maintenance {
+		if w.Active(a.Time) {
+			log.Printf("alert %s silenced by maintenance window %v", a.ID(), w)
+			return true
+		}
+	}
+
+	if s.store == nil {
+		return false
+	}
+
+	silences, err := s.store.Active(a.Time)
+	if err != nil {
+		log.Printf("error loading silences: %v", err)
+		return false
+	}
+	for _, silence := range silences {
+		if silence.Matchers.Match(a) {
+			log.Printf("alert %s silenced by %s", a.ID(), silence.ID)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,159 @@
+package logmon_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	logmon "github.com/jjrumi/accesslogmonitor/pkg"
+)
+
+func TestMatchers_Match(t *testing.T) {
+	abuse := logmon.ThresholdAlert{Kind: logmon.Abuse, Name: "10.0.0.1", Open: true}
+
+	for name, tc := range map[string]struct {
+		definition string
+
+		succeeds bool
+		matches  bool
+	}{
+		"it matches on the kind": {
+			definition: "kind=abuse",
+			succeeds:   true,
+			matches:    true,
+		},
+		"it matches on glob patterns": {
+			definition: "kind=abuse,name=10.0.0.*",
+			succeeds:   true,
+			matches:    true,
+		},
+		"it requires all matchers to match": {
+			definition: "kind=abuse,name=10.0.1.*",
+			succeeds:   true,
+			matches:    false,
+		},
+		"it matches on the id": {
+			definition: "id=abuse/10.0.0.1",
+			succeeds:   true,
+			matches:    true,
+		},
+		"it fails without a pattern": {
+			definition: "kind",
+			succeeds:   false,
+		},
+		"it fails with invalid patterns": {
+			definition: "name=[10",
+			succeeds:   false,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			matchers, err := logmon.ParseMatchers(tc.definition)
+			require.Equal(t, tc.succeeds, err == nil)
+			require.Equal(t, tc.matches, matchers.Match(abuse))
+		})
+	}
+}
+
+func TestSilenceStore_AddAndExpire(t *testing.T) {
+	dir, err := ioutil.TempDir("", "silences_*")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	store := logmon.NewSilenceStore(filepath.Join(dir, "silences.json"))
+
+	active, err := store.Active(time.Now())
+	require.NoError(t, err, "a missing file has no silences")
+	require.Empty(t, active)
+
+	matchers, err := logmon.ParseMatchers("kind=high_traffic")
+	require.NoError(t, err)
+	silence := logmon.NewSilence(matchers, time.Hour, "deploy")
+	require.NoError(t, store.Add(silence))
+
+	active, err = store.Active(time.Now())
+	require.NoError(t, err)
+	require.Len(t, active, 1, "the silence is active until it expires")
+	require.Equal(t, silence.ID, active[0].ID)
+	require.Equal(t, matchers, active[0].Matchers)
+
+	require.NoError(t, store.Expire(silence.ID))
+	active, err = store.Active(time.Now())
+	require.NoError(t, err)
+	require.Empty(t, active, "an expired silence is no longer active")
+
+	require.Error(t, store.Expire("missing"), "unknown silences cannot be expired")
+}
+
+func TestSilenceStore_KeepsTheFilePrivate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "silences_*")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "logmon", "silences.json")
+	store := logmon.NewSilenceStore(path)
+
+	matchers, err := logmon.ParseMatchers("kind=abuse")
+	require.NoError(t, err)
+	require.NoError(t, store.Add(logmon.NewSilence(matchers, time.Hour, "")))
+
+	info, err := os.Stat(filepath.Dir(path))
+	require.NoError(t, err, "the directory of the file is created")
+	require.Equal(t, os.FileMode(0700), info.Mode().Perm(), "only the user can access the directory")
+	info, err = os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm(), "only the user can access the file")
+}
+
+func TestSilencer_MarksSilencedAlerts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "silences_*")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	store := logmon.NewSilenceStore(filepath.Join(dir, "silences.json"))
+
+	matchers, err := logmon.ParseMatchers("kind=abuse,name=10.0.0.*")
+	require.NoError(t, err)
+	require.NoError(t, store.Add(logmon.NewSilence(matchers, time.Hour, "")))
+
+	// Every Sunday from 02:00 to 04:00:
+	window, err := logmon.ParseMaintenanceWindow("0 2 * * 0 2h")
+	require.NoError(t, err)
+	silencer := logmon.NewSilencer(logmon.SilencerOpts{Store: store, Maintenance: []logmon.MaintenanceWindow{window}})
+
+	now := time.Now()
+	sunday := time.Date(2020, 8, 2, 3, 0, 0, 0, time.Local)
+	input := make(chan logmon.ThresholdAlert, 4)
+	input <- logmon.ThresholdAlert{Kind: logmon.Abuse, Name: "10.0.0.1", Open: true, Time: now}
+	input <- logmon.ThresholdAlert{Kind: logmon.Abuse, Name: "10.0.1.1", Open: true, Time: now}
+	input <- logmon.ThresholdAlert{Kind: logmon.HighTraffic, Open: true, Time: sunday}
+	input <- logmon.ThresholdAlert{Kind: logmon.HighTraffic, Open: false, Time: sunday.Add(2 * time.Hour)}
+	close(input)
+
+	output := make(chan logmon.ThresholdAlert, 4)
+	silencer.Run(context.Background(), input, output)
+
+	var silenced []bool
+	for a := range output {
+		silenced = append(silenced, a.Silenced)
+	}
+	require.Equal(t, []bool{true, false, true, false}, silenced, "alerts matched by a silence or a maintenance window are marked")
+}
+
+func TestNotifier_SkipsSilencedAlerts(t *testing.T) {
+	sink := &recordingSink{}
+	notifier := logmon.NewNotifier(logmon.NotifierOpts{Sinks: []logmon.Sink{sink}})
+
+	silenced := givenAnAlert(true)
+	silenced.Silenced = true
+	alerts := make(chan logmon.ThresholdAlert, 2)
+	alerts <- silenced
+	alerts <- givenAnAlert(false)
+	close(alerts)
+
+	notifier.Run(context.Background(), alerts)
+
+	require.Len(t, sink.received(), 1, "silenced alerts are not delivered")
+	require.False(t, sink.received()[0].Silenced)
+}
@@ -0,0 +1,226 @@
+package logmon
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sloBudgetSlots bounds the memory used to account the error budget of an SLO period.
+const sloBudgetSlots = 720
+
+// SLO defines an availability objective: the ratio of non-5xx responses over all responses.
+type SLO struct {
+	Name   string
+	Target float64       // Ratio of good responses to achieve, e.g. 0.999.
+	Period time.Duration // Period to compute the error budget, e.g. 30 days.
+}
+
+// ParseSLO creates an SLO from a definition like "availability:99.9:720h".
+// The target is given in percent and the period as a Go duration.
+func ParseSLO(definition string) (SLO, error) {
+	parts := strings.Split(definition, ":")
+	if len(parts) != 3 {
+		return SLO{}, fmt.Errorf("invalid slo %q: expected name:target:period", definition)
+	}
+
+	target, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil || target <= 0 || target >= 100 {
+		return SLO{}, fmt.Errorf("invalid slo %q: target must be a percentage between 0 and 100", definition)
+	}
+
+	period, err := time.ParseDuration(parts[2])
+	if err != nil || period <= 0 {
+		return SLO{}, fmt.Errorf("invalid slo %q: period must be a positive duration", definition)
+	}
+
+	return SLO{Name: parts[0], Target: target / 100, Period: period}, nil
+}
+
+// BurnRateWindow defines a multi-window burn rate alert condition.
+// The condition holds when both windows consume the error budget faster than the burn rate.
+// The long window avoids alerting on short blips; the short one makes the alert recover quickly.
+type BurnRateWindow struct {
+	Long     time.Duration
+	Short    time.Duration
+	BurnRate float64
+}
+
+// String returns the windows in a compact form, e.g. "1h0m0s/5m0s".
+func (w BurnRateWindow) String() string {
+	return fmt.Sprintf("%v/%v", w.Long, w.Short)
+}
+
+// DefaultBurnRateWindows alert when 2% of the budget is spent in 1 hour or 5% in 6 hours of a 30 day period.
+var DefaultBurnRateWindows = []BurnRateWindow{
+	{Long: time.Hour, Short: 5 * time.Minute, BurnRate: 14.4},
+	{Long: 6 * time.Hour, Short: 30 * time.Minute, BurnRate: 6},
+}
+
+// SLOStatus is the error budget of an SLO and its burn rates, as of the end of an interval.
+type SLOStatus struct {
+	SLO       SLO
+	Budget    float64          // Ratio of the error budget left within the SLO period. It is negative once exhausted.
+	BurnRates []BurnRateStatus // Burn rates of every alert condition of the SLO.
+}
+
+// BurnRateStatus is the pace at which an SLO consumes its error budget on both windows of an alert condition.
+type BurnRateStatus struct {
+	Window BurnRateWindow
+	Long   float64 // Burn rate on the long window.
+	Short  float64 // Burn rate on the short window.
+}
+
+// Burning tells whether both windows consume the error budget faster than the burn rate of the condition.
+func (b BurnRateStatus) Burning() bool {
+	return b.Long > b.Window.BurnRate && b.Short > b.Window.BurnRate
+}
+
+// sloTracker accounts the requests and errors of an SLO from a stream of TrafficStats.
+type sloTracker struct {
+	slo      SLO
+	windows  []BurnRateWindow
+	interval time.Duration
+	recent   *requestCounter // Every interval within the longest window.
+	period   *requestCounter // The whole SLO period, with coarse slots.
+}
+
+// newSLOTracker creates a sloTracker. The interval is the refresh interval.
+func newSLOTracker(slo SLO, windows []BurnRateWindow, interval time.Duration) *sloTracker {
+	t := &sloTracker{slo: slo, windows: windows, interval: interval}
+
+	var longest time.Duration
+	for _, w := range windows {
+		if w.Long > longest {
+			longest = w.Long
+		}
+	}
+
+	t.recent = newRequestCounter(t.intervals(longest), 0)
+	t.period = newRequestCounter(t.intervals(slo.Period), sloBudgetSlots)
+	return t
+}
+
+// trackSLOs returns the trackers of the given SLOs. The previous trackers of an SLO with the same windows and interval
+// are kept, along with the requests they accounted; the other ones start over.
+func trackSLOs(previous []*sloTracker, slos []SLO, windows []BurnRateWindow, interval time.Duration) []*sloTracker {
+	var trackers []*sloTracker
+	for _, slo := range slos {
+		var tracker *sloTracker
+		for _, p := range previous {
+			if p.slo == slo && p.interval == interval && reflect.DeepEqual(p.windows, windows) {
+				tracker = p
+			}
+		}
+		if tracker == nil {
+			tracker = newSLOTracker(slo, windows, interval)
+		}
+		trackers = append(trackers, tracker)
+	}
+	return trackers
+}
+
+// observe accounts the requests and errors of an interval.
+func (t *sloTracker) observe(s TrafficStats) {
+	errors := s.StatusClassHits["5xx"]
+	t.recent.add(s.TotalReqs, errors)
+	t.period.add(s.TotalReqs, errors)
+}
+
+// burnRate is the pace at which the error budget is consumed within the given window.
+// A burn rate of 1 spends exactly the whole budget over the SLO period.
+func (t *sloTracker) burnRate(window time.Duration) float64 {
+	total, errors := t.recent.sum(t.intervals(window))
+	if total == 0 {
+		return 0
+	}
+
+	return float64(errors) / float64(total) / (1 - t.slo.Target)
+}
+
+// budget is the ratio of the error budget left within the SLO period. It is negative once exhausted.
+func (t *sloTracker) budget() float64 {
+	total, errors := t.period.sum(t.intervals(t.slo.Period))
+	if total == 0 {
+		return 1
+	}
+
+	return 1 - float64(errors)/float64(total)/(1-t.slo.Target)
+}
+
+// status returns the error budget and the burn rates of the SLO, as of the last interval observed.
+func (t *sloTracker) status() SLOStatus {
+	status := SLOStatus{SLO: t.slo, Budget: t.budget()}
+	for _, w := range t.windows {
+		status.BurnRates = append(status.BurnRates, BurnRateStatus{Window: w, Long: t.burnRate(w.Long), Short: t.burnRate(w.Short)})
+	}
+	return status
+}
+
+// intervals converts a duration into a number of refresh intervals.
+func (t *sloTracker) intervals(d time.Duration) int {
+	n := int(math.Ceil(float64(d) / float64(t.interval)))
+	if n < 1 {
+		return 1
+	}
+	return n
+}
+
+// requestCounter accumulates requests and errors over a sliding number of intervals.
+// Consecutive intervals share a slot when there are more intervals than slots, to bound memory.
+type requestCounter struct {
+	total    []int
+	errors   []int
+	perSlot  int // Intervals accumulated in every slot.
+	pos      int // Slot of the current interval.
+	inSlot   int // Intervals already accumulated in the current slot.
+	finished int // Number of slots that have been completely filled.
+}
+
+// newRequestCounter creates a requestCounter for the given number of intervals.
+// Zero maxSlots means one slot per interval.
+func newRequestCounter(intervals int, maxSlots int) *requestCounter {
+	perSlot := 1
+	if maxSlots > 0 && intervals > maxSlots {
+		perSlot = int(math.Ceil(float64(intervals) / float64(maxSlots)))
+	}
+
+	slots := int(math.Ceil(float64(intervals)/float64(perSlot))) + 1 // Plus the slot being filled.
+	return &requestCounter{total: make([]int, slots), errors: make([]int, slots), perSlot: perSlot}
+}
+
+// add accounts the requests and errors of a new interval.
+func (c *requestCounter) add(total int, errors int) {
+	c.total[c.pos] += total
+	c.errors[c.pos] += errors
+	c.inSlot++
+
+	if c.inSlot == c.perSlot {
+		c.pos = (c.pos + 1) % len(c.total)
+		c.total[c.pos], c.errors[c.pos] = 0, 0
+		c.inSlot = 0
+		c.finished++
+	}
+}
+
+// sum adds up the requests and errors of the most recent intervals, rounded up to whole slots.
+func (c *requestCounter) sum(intervals int) (total int, errors int) {
+	slots := int(math.Ceil(float64(intervals-c.inSlot) / float64(c.perSlot)))
+	if slots > c.finished {
+		slots = c.finished
+	}
+	if slots > len(c.total)-1 {
+		slots = len(c.total) - 1
+	}
+
+	total, errors = c.total[c.pos], c.errors[c.pos]
+	for i := 1; i <= slots; i++ {
+		j := (c.pos - i + len(c.total)) % len(c.total)
+		total += c.total[j]
+		errors += c.errors[j]
+	}
+	return total, errors
+}
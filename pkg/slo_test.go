@@ -0,0 +1,45 @@
+package logmon_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	logmon "github.com/jjrumi/accesslogmonitor/pkg"
+)
+
+func TestParseSLO(t *testing.T) {
+	for name, tc := range map[string]struct {
+		definition  string
+		expectedSLO logmon.SLO
+
+		succeeds bool
+	}{
+		"it parses valid definitions": {
+			definition:  "availability:99.9:720h",
+			expectedSLO: logmon.SLO{Name: "availability", Target: 0.999, Period: 720 * time.Hour},
+			succeeds:    true,
+		},
+		"it fails with missing parts": {
+			definition: "availability:99.9",
+			succeeds:   false,
+		},
+		"it fails with targets out of range": {
+			definition: "availability:100:720h",
+			succeeds:   false,
+		},
+		"it fails with invalid periods": {
+			definition: "availability:99.9:30d",
+			succeeds:   false,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			slo, err := logmon.ParseSLO(tc.definition)
+			require.Equal(t, tc.succeeds, err == nil)
+			require.Equal(t, tc.expectedSLO.Name, slo.Name)
+			require.InDelta(t, tc.expectedSLO.Target, slo.Target, 1e-9)
+			require.Equal(t, tc.expectedSLO.Period, slo.Period)
+		})
+	}
+}
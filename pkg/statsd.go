@@ -0,0 +1,205 @@
+package logmon
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// StatsDEmitterOpts defines the options required to build a StatsD StatsSink.
+type StatsDEmitterOpts struct {
+	Addr        string   // StatsD server as host:port.
+	Prefix      string   // Prefix of every metric name, e.g. "logmon".
+	Tags        []string // Tags of every metric as key:value (DogStatsD only).
+	DogStatsD   bool     // Use DogStatsD tags and events instead of encoding the dimensions in the metric names.
+	TopSections int      // Sections with the most requests sent every interval.
+}
+
+const (
+	defaultTopSections = 10
+	maxUDPPacket       = 1432 // Fits in the MTU of most networks.
+)
+
+// NewStatsDEmitter creates a StatsSink that sends every interval and alert to a StatsD or DogStatsD server over UDP.
+func NewStatsDEmitter(opts StatsDEmitterOpts) StatsSink {
+	topSections := opts.TopSections
+	if topSections < 1 {
+		topSections = defaultTopSections
+	}
+
+	prefix := strings.TrimSuffix(opts.Prefix, ".")
+	if prefix != "" {
+		prefix += "."
+	}
+
+	return &statsdEmitter{
+		addr:        opts.Addr,
+		prefix:      prefix,
+		tags:        opts.Tags,
+		dogStatsD:   opts.DogStatsD,
+		topSections: topSections,
+	}
+}
+
+// statsdEmitter implements the StatsSink interface with the StatsD protocol.
+type statsdEmitter struct {
+	addr        string
+	prefix      string
+	tags        []string
+	dogStatsD   bool
+	topSections int
+	conn        net.Conn
+}
+
+// Name identifies the sink.
+func (s *statsdEmitter) Name() string {
+	return "statsd"
+}
+
+// Setup opens the UDP socket. It returns a callback to close it.
+func (s *statsdEmitter) Setup() (func(), error) {
+	var err error
+	s.conn, err = net.Dial("udp", s.addr)
+	if err != nil {
+		return nil, fmt.Errorf("dial statsd: %w", err)
+	}
+
+	cleanup := func() {
+		log.Printf("clean up: close statsd socket...")
+		s.conn.Close()
+	}
+
+	return cleanup, nil
+}
+
+// Run consumes traffic stats and alerts and sends them, until both streams are closed.
+// UDP is fire and forget: failed sends are only logged.
+func (s *statsdEmitter) Run(ctx context.Context, stats <-chan TrafficStats, alerts <-chan ThresholdAlert) {
+LOOP:
+	for stats != nil || alerts != nil {
+		select {
+		case st, ok := <-stats:
+			if !ok {
+				stats = nil
+				continue
+			}
+			s.send(s.formatStats(st))
+		case a, ok := <-alerts:
+			if !ok {
+				alerts = nil
+				continue
+			}
+			s.send(s.formatAlert(a))
+		case <-ctx.Done():
+			break LOOP
+		}
+	}
+	log.Printf("clean up: statsd emitter stopped")
+}
+
+// formatStats renders the counters of an interval, one metric per line.
+func (s *statsdEmitter) formatStats(st TrafficStats) []string {
+	lines := []string{
+		s.metric("requests", st.TotalReqs, "c"),
+		s.metric("bytes", st.Bytes, "c"),
+	}
+	for _, e := range sortedEntries(st.MethodHits, len(st.MethodHits)) {
+		lines = append(lines, s.metric("requests.method", e.val, "c", "method", e.key))
+	}
+	for _, e := range sortedEntries(st.StatusClassHits, len(st.StatusClassHits)) {
+		lines = append(lines, s.metric("responses.status", e.val, "c", "class", e.key))
+	}
+	for _, e := range sortedEntries(st.SectionHits, s.topSections) {
+		lines = append(lines, s.metric("requests.section", e.val, "c", "section", e.key))
+	}
+	return lines
+}
+
+// formatAlert renders an alert transition as a counter, and as an event on DogStatsD.
+func (s *statsdEmitter) formatAlert(a ThresholdAlert) []string {
+	state := "recovered"
+	if a.Open {
+		state = "open"
+	}
+
+	lines := []string{s.metric("alerts", 1, "c", "kind", kindLabel(a.Kind), "state", state)}
+	if s.dogStatsD {
+		title := "logmon " + a.ID() + " " + state
+		text := a.Summary()
+		alertType := "success"
+		if a.Open {
+			alertType = "error"
+		}
+		tags := append([]string{"kind:" + tagValue(kindLabel(a.Kind))}, s.tags...)
+		lines = append(lines, fmt.Sprintf(
+			"_e{%d,%d}:%s|%s|d:%d|t:%s|#%s",
+			len(title), len(text), title, text, a.Time.Unix(), alertType, strings.Join(tags, ","),
+		))
+	}
+	return lines
+}
+
+// metric renders a metric line. The dimensions are label name and value pairs:
+// DogStatsD sends them as tags; plain StatsD appends their values to the metric name.
+func (s *statsdEmitter) metric(name string, value int, typ string, dimensions ...string) string {
+	if !s.dogStatsD {
+		for i := 1; i < len(dimensions); i += 2 {
+			part := metricNameSanitizer.ReplaceAllString(strings.Trim(dimensions[i], "/"), "_")
+			if part == "" {
+				part = "root" // The "/" section.
+			}
+			name += "." + part
+		}
+		return fmt.Sprintf("%s%s:%d|%s", s.prefix, name, value, typ)
+	}
+
+	tags := make([]string, 0, len(dimensions)/2+len(s.tags))
+	for i := 1; i < len(dimensions); i += 2 {
+		tags = append(tags, dimensions[i-1]+":"+tagValue(dimensions[i]))
+	}
+	tags = append(tags, s.tags...)
+
+	line := fmt.Sprintf("%s%s:%d|%s", s.prefix, name, value, typ)
+	if len(tags) > 0 {
+		line += "|#" + strings.Join(tags, ",")
+	}
+	return line
+}
+
+// send packs the lines into as few datagrams as possible.
+func (s *statsdEmitter) send(lines []string) {
+	for _, packet := range packLines(lines, maxUDPPacket) {
+		if _, err := s.conn.Write(packet); err != nil {
+			log.Printf("error sending to statsd: %v", err)
+		}
+	}
+}
+
+// metricNameSanitizer matches the characters not allowed in StatsD metric names.
+var metricNameSanitizer = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// tagValue replaces the characters that delimit DogStatsD tags.
+func tagValue(v string) string {
+	return tagSanitizer.Replace(v)
+}
+
+var tagSanitizer = strings.NewReplacer(",", "_", "|", "_", "#", "_", "\n", "_")
+
+// sortedEntries returns up to max entries of a map, highest value first.
+func sortedEntries(m map[string]int, max int) entries {
+	buf := fromMap(m)
+	sort.Slice(buf, func(i, j int) bool {
+		if buf[i].val == buf[j].val {
+			return buf[i].key < buf[j].key
+		}
+		return buf[i].val > buf[j].val
+	})
+	if len(buf) > max {
+		buf = buf[:max]
+	}
+	return buf
+}
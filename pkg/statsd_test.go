@@ -0,0 +1,88 @@
+package logmon_test
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	logmon "github.com/jjrumi/accesslogmonitor/pkg"
+)
+
+func TestStatsDEmitter_SendsStatsAndAlerts(t *testing.T) {
+	for name, tc := range map[string]struct {
+		opts logmon.StatsDEmitterOpts
+
+		expectedLines []string
+	}{
+		"it encodes the dimensions in the metric names on StatsD": {
+			opts: logmon.StatsDEmitterOpts{Prefix: "logmon", TopSections: 1},
+			expectedLines: []string{
+				"logmon.requests:3|c",
+				"logmon.bytes:300|c",
+				"logmon.requests.method.GET:2|c",
+				"logmon.requests.method.POST:1|c",
+				"logmon.responses.status.2xx:2|c",
+				"logmon.responses.status.5xx:1|c",
+				"logmon.requests.section.api:2|c",
+				"logmon.alerts.high_traffic.open:1|c",
+			},
+		},
+		"it sends tags and events on DogStatsD": {
+			opts: logmon.StatsDEmitterOpts{Prefix: "web.", Tags: []string{"env:test"}, DogStatsD: true, TopSections: 1},
+			expectedLines: []string{
+				"web.requests:3|c|#env:test",
+				"web.bytes:300|c|#env:test",
+				"web.requests.method:2|c|#method:GET,env:test",
+				"web.requests.method:1|c|#method:POST,env:test",
+				"web.responses.status:2|c|#class:2xx,env:test",
+				"web.responses.status:1|c|#class:5xx,env:test",
+				"web.requests.section:2|c|#section:/api,env:test",
+				"web.alerts:1|c|#kind:high_traffic,state:open,env:test",
+				"_e{24,49}:logmon high traffic open|high traffic alert triggered - hits = 12.50 req/s|d:1596326400|t:error|#kind:high_traffic,env:test",
+			},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+			require.NoError(t, err)
+			defer listener.Close()
+
+			tc.opts.Addr = listener.LocalAddr().String()
+			emitter := logmon.NewStatsDEmitter(tc.opts)
+			cleanup, err := emitter.Setup()
+			require.NoError(t, err)
+			defer cleanup()
+
+			s := logmon.NewEmptyTrafficStats()
+			s.Update(logmon.LogEntry{ReqMethod: "GET", ReqPath: "/api/users", StatusCode: 200, Bytes: 100})
+			s.Update(logmon.LogEntry{ReqMethod: "GET", ReqPath: "/api/posts", StatusCode: 200, Bytes: 100})
+			s.Update(logmon.LogEntry{ReqMethod: "POST", ReqPath: "/blog", StatusCode: 500, Bytes: 100})
+			stats := make(chan logmon.TrafficStats, 1)
+			stats <- s
+			close(stats)
+
+			alert := givenAnAlert(true)
+			alert.Time = time.Unix(1596326400, 0)
+			alerts := make(chan logmon.ThresholdAlert, 1)
+			alerts <- alert
+			close(alerts)
+
+			emitter.Run(context.Background(), stats, alerts)
+
+			// Stats and alerts might arrive in any order:
+			var lines []string
+			buf := make([]byte, 65536)
+			for len(lines) < len(tc.expectedLines) {
+				require.NoError(t, listener.SetReadDeadline(time.Now().Add(time.Second)))
+				n, _, err := listener.ReadFrom(buf)
+				require.NoError(t, err)
+				lines = append(lines, strings.Split(string(buf[:n]), "\n")...)
+			}
+			require.ElementsMatch(t, tc.expectedLines, lines)
+		})
+	}
+}
@@ -0,0 +1,482 @@
+package logmon
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StatsStore is a StatsSink that persists every interval on disk, rolled up into coarser resolutions.
+type StatsStore interface {
+	StatsSink
+	// Query returns the intervals ending within [from, to], oldest first, at a resolution: RawResolution,
+	// MinuteResolution or HourResolution. An empty resolution picks the finest one still retained at from.
+	Query(from, to time.Time, resolution string) ([]StoredInterval, error)
+}
+
+// Resolutions of a StatsStore.
+const (
+	RawResolution    = "raw" // The refresh interval.
+	MinuteResolution = "1m"
+	HourResolution   = "1h"
+)
+
+// StatsStoreOpts defines the options required to build a StatsStore.
+type StatsStoreOpts struct {
+	Dir             string
+	RefreshInterval int           // In seconds.
+	RawRetention    time.Duration // Period the intervals are kept at the refresh interval.
+	MinuteRetention time.Duration // Period the 1m rollups are kept.
+	HourRetention   time.Duration // Period the 1h rollups are kept.
+	MaxSections     int           // Sections kept per stored interval. The rest are counted as "other".
+}
+
+const (
+	defaultRawRetention    = 24 * time.Hour
+	defaultMinuteRetention = 7 * 24 * time.Hour
+	defaultHourRetention   = 90 * 24 * time.Hour
+	defaultStoreSections   = 100
+)
+
+// StoredInterval is the traffic of a period, as persisted by a StatsStore.
+type StoredInterval struct {
+	Time     time.Time      `json:"time"`     // End of the period.
+	Duration int            `json:"duration"` // In seconds.
+	Requests int            `json:"requests"`
+	Bytes    int            `json:"bytes"`
+	Sections map[string]int `json:"sections,omitempty"`
+	Methods  map[string]int `json:"methods,omitempty"`
+	Statuses map[string]int `json:"statuses,omitempty"`
+}
+
+// merge adds the traffic of another interval.
+func (i *StoredInterval) merge(o StoredInterval) {
+	i.Requests += o.Requests
+	i.Bytes += o.Bytes
+	for k, v := range o.Sections {
+		i.Sections[k] += v
+	}
+	for k, v := range o.Methods {
+		i.Methods[k] += v
+	}
+	for k, v := range o.Statuses {
+		i.Statuses[k] += v
+	}
+}
+
+// NewStatsStore creates a StatsStore. Default retentions are used for the ones not given.
+func NewStatsStore(opts StatsStoreOpts) StatsStore {
+	retention := func(given, fallback time.Duration) time.Duration {
+		if given <= 0 {
+			return fallback
+		}
+		return given
+	}
+	maxSections := opts.MaxSections
+	if maxSections < 1 {
+		maxSections = defaultStoreSections
+	}
+
+	return &statsStore{
+		dir:         opts.Dir,
+		interval:    opts.RefreshInterval,
+		maxSections: maxSections,
+		raw:         &storeTier{name: RawResolution, segment: time.Hour, retention: retention(opts.RawRetention, defaultRawRetention)},
+		minute: &storeTier{
+			name: MinuteResolution, step: time.Minute, segment: 24 * time.Hour,
+			retention: retention(opts.MinuteRetention, defaultMinuteRetention),
+		},
+		hour: &storeTier{
+			name: HourResolution, step: time.Hour, segment: 30 * 24 * time.Hour,
+			retention: retention(opts.HourRetention, defaultHourRetention),
+		},
+	}
+}
+
+// statsStore implements the StatsStore interface.
+// Every resolution is a directory of append-only segments: files of JSON lines named after the Unix time they start.
+// Whole segments are deleted once they are beyond the retention of their resolution.
+// Rollups being accumulated are not persisted: on startup, they are rebuilt from the finer resolution.
+type statsStore struct {
+	dir         string
+	interval    int
+	maxSections int
+
+	mu     sync.Mutex
+	raw    *storeTier
+	minute *storeTier
+	hour   *storeTier
+}
+
+// storeTier is a resolution of the store.
+type storeTier struct {
+	name      string
+	step      time.Duration   // Period of the rollups. Zero for the raw intervals.
+	segment   time.Duration   // Period of a segment.
+	retention time.Duration   // Period the segments are kept.
+	pending   *StoredInterval // Rollup being accumulated.
+	file      *os.File        // Segment being appended to.
+	start     time.Time       // Start of the segment being appended to.
+	expired   time.Time       // Time of the interval that last expired the segments.
+}
+
+// Name identifies the sink.
+func (s *statsStore) Name() string {
+	return "store"
+}
+
+// Setup creates the directories of the store and rebuilds the rollups interrupted by the last shutdown.
+// It returns a callback to close the segments.
+func (s *statsStore) Setup() (func(), error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, tier := range s.tiers() {
+		if err := os.MkdirAll(filepath.Join(s.dir, tier.name), 0750); err != nil {
+			return nil, fmt.Errorf("create stats store: %w", err)
+		}
+	}
+
+	if err := s.rebuild(s.minute, s.hour); err != nil {
+		return nil, err
+	}
+	if err := s.rebuild(s.raw, s.minute); err != nil {
+		return nil, err
+	}
+
+	cleanup := func() {
+		log.Printf("clean up: close stats store...")
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for _, tier := range s.tiers() {
+			if tier.file != nil {
+				tier.file.Close()
+			}
+		}
+	}
+	return cleanup, nil
+}
+
+// rebuild feeds a rollup with the intervals of the finer resolution stored after its last rollup.
+func (s *statsStore) rebuild(finer, rollup *storeTier) error {
+	stored, err := s.read(rollup, time.Time{}, time.Now(), true)
+	if err != nil {
+		return err
+	}
+	var last time.Time
+	if len(stored) > 0 {
+		last = stored[len(stored)-1].Time
+	}
+
+	intervals, err := s.read(finer, last.Add(time.Nanosecond), time.Now(), false)
+	if err != nil {
+		return err
+	}
+	for _, i := range intervals {
+		if err := s.roll(rollup, i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *statsStore) tiers() []*storeTier {
+	return []*storeTier{s.raw, s.minute, s.hour}
+}
+
+// Run consumes traffic stats and persists them, until the stream is closed. Alerts are discarded.
+func (s *statsStore) Run(ctx context.Context, stats <-chan TrafficStats, alerts <-chan ThresholdAlert) {
+LOOP:
+	for stats != nil || alerts != nil {
+		select {
+		case st, ok := <-stats:
+			if !ok {
+				stats = nil
+				continue
+			}
+			if err := s.add(st); err != nil {
+				log.Printf("error storing stats: %v", err)
+			}
+		case _, ok := <-alerts:
+			if !ok {
+				alerts = nil
+			}
+		case <-ctx.Done():
+			break LOOP
+		}
+	}
+	log.Printf("clean up: stats store stopped")
+}
+
+// add persists an interval and rolls it up.
+func (s *statsStore) add(st TrafficStats) error {
+	i := StoredInterval{
+		Time:     st.Time,
+		Duration: s.interval,
+		Requests: st.TotalReqs,
+		Bytes:    st.Bytes,
+		Sections: boundSections(st.SectionHits, s.maxSections),
+		Methods:  st.MethodHits,
+		Statuses: st.StatusClassHits,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.write(s.raw, i); err != nil {
+		return err
+	}
+	return s.roll(s.minute, i)
+}
+
+// roll adds an interval to a rollup. A complete rollup is persisted, and rolled up into the next resolution.
+func (s *statsStore) roll(tier *storeTier, i StoredInterval) error {
+	end := i.Time.Add(-time.Nanosecond).Truncate(tier.step).Add(tier.step)
+	var complete *StoredInterval
+	if tier.pending != nil && end.After(tier.pending.Time) {
+		complete, tier.pending = tier.pending, nil
+	}
+	if tier.pending == nil {
+		tier.pending = &StoredInterval{
+			Time:     end,
+			Duration: int(tier.step / time.Second),
+			Sections: make(map[string]int),
+			Methods:  make(map[string]int),
+			Statuses: make(map[string]int),
+		}
+	}
+	tier.pending.merge(i) // Late intervals are added to the current rollup.
+
+	if complete == nil {
+		return nil
+	}
+	complete.Sections = boundSections(complete.Sections, s.maxSections)
+	if err := s.write(tier, *complete); err != nil {
+		return err
+	}
+	if tier == s.minute {
+		return s.roll(s.hour, *complete)
+	}
+	return nil
+}
+
+// write appends an interval to the segment it belongs to.
+// Opening a new segment deletes the segments beyond the retention, at most once per segment period: late intervals
+// switching back and forth between segments do not list the directory every time.
+func (s *statsStore) write(tier *storeTier, i StoredInterval) error {
+	start := i.Time.Add(-time.Nanosecond).Truncate(tier.segment)
+	if tier.file == nil || !start.Equal(tier.start) {
+		if tier.file != nil {
+			tier.file.Close()
+		}
+		path := filepath.Join(s.dir, tier.name, strconv.FormatInt(start.Unix(), 10))
+		file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0640)
+		if err != nil {
+			tier.file = nil
+			return fmt.Errorf("open %s segment: %w", tier.name, err)
+		}
+		tier.file, tier.start = file, start
+
+		if i.Time.Sub(tier.expired) >= tier.segment {
+			tier.expired = i.Time
+			if err := s.expire(tier, i.Time); err != nil {
+				log.Printf("error expiring %s segments: %v", tier.name, err)
+			}
+		}
+	}
+
+	line, err := json.Marshal(i)
+	if err != nil {
+		return fmt.Errorf("encode interval: %w", err)
+	}
+	if _, err := tier.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("write %s segment: %w", tier.name, err)
+	}
+	return nil
+}
+
+// expire deletes the segments ending before the retention of the tier.
+func (s *statsStore) expire(tier *storeTier, now time.Time) error {
+	segments, err := s.segments(tier)
+	if err != nil {
+		return err
+	}
+	for _, start := range segments {
+		if start.Add(tier.segment).Before(now.Add(-tier.retention)) {
+			path := filepath.Join(s.dir, tier.name, strconv.FormatInt(start.Unix(), 10))
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// segments returns the start of the segments of a tier, oldest first.
+func (s *statsStore) segments(tier *storeTier) ([]time.Time, error) {
+	files, err := ioutil.ReadDir(filepath.Join(s.dir, tier.name))
+	if err != nil {
+		return nil, fmt.Errorf("list %s segments: %w", tier.name, err)
+	}
+
+	var segments []time.Time
+	for _, f := range files {
+		secs, err := strconv.ParseInt(f.Name(), 10, 64)
+		if err != nil {
+			continue // Not a segment.
+		}
+		segments = append(segments, time.Unix(secs, 0))
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i].Before(segments[j]) })
+	return segments, nil
+}
+
+// Query returns the stored intervals ending within [from, to], oldest first.
+// The store is only locked to list the segments: reading them does not hold back the intervals being stored.
+func (s *statsStore) Query(from, to time.Time, resolution string) ([]StoredInterval, error) {
+	s.mu.Lock()
+	var tier *storeTier
+	switch resolution {
+	case RawResolution:
+		tier = s.raw
+	case MinuteResolution:
+		tier = s.minute
+	case HourResolution:
+		tier = s.hour
+	case "":
+		tier = s.hour
+		for _, t := range []*storeTier{s.raw, s.minute} {
+			if !from.Before(time.Now().Add(-t.retention)) {
+				tier = t
+				break
+			}
+		}
+	default:
+		s.mu.Unlock()
+		return nil, fmt.Errorf("invalid resolution %q: expected %s, %s or %s", resolution, RawResolution, MinuteResolution, HourResolution)
+	}
+	segments, err := s.segments(tier)
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	return s.readSegments(tier, segments, from, to)
+}
+
+// read decodes the intervals of a tier ending within [from, to], oldest first.
+// With last, only the last segment is read.
+func (s *statsStore) read(tier *storeTier, from, to time.Time, last bool) ([]StoredInterval, error) {
+	segments, err := s.segments(tier)
+	if err != nil {
+		return nil, err
+	}
+	if last && len(segments) > 0 {
+		segments = segments[len(segments)-1:]
+	}
+	return s.readSegments(tier, segments, from, to)
+}
+
+// readSegments decodes the intervals of some segments of a tier ending within [from, to], oldest first.
+// Lines cut by a crash or being written are skipped, and so are the segments expired meanwhile.
+func (s *statsStore) readSegments(tier *storeTier, segments []time.Time, from, to time.Time) ([]StoredInterval, error) {
+	intervals := []StoredInterval{}
+	for _, start := range segments {
+		if !start.Add(tier.segment).After(from) || start.After(to) {
+			continue
+		}
+
+		path := filepath.Join(s.dir, tier.name, strconv.FormatInt(start.Unix(), 10))
+		err := readSegment(path, func(i StoredInterval) {
+			if !i.Time.Before(from) && !i.Time.After(to) {
+				intervals = append(intervals, i)
+			}
+		})
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+	sort.SliceStable(intervals, func(i, j int) bool { return intervals[i].Time.Before(intervals[j].Time) })
+	return intervals, nil
+}
+
+func readSegment(path string, fn func(StoredInterval)) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("open segment: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var i StoredInterval
+		if err := json.Unmarshal(scanner.Bytes(), &i); err != nil {
+			log.Printf("skipping invalid line of %s: %v", path, err)
+			continue
+		}
+		fn(i)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read segment %s: %w", path, err)
+	}
+	return nil
+}
+
+// boundSections keeps the max sections with the most hits, and counts the rest as "other".
+func boundSections(sections map[string]int, max int) map[string]int {
+	if len(sections) <= max {
+		return sections
+	}
+
+	bounded := make(map[string]int, max)
+	for _, e := range sortedEntries(sections, max-1) {
+		bounded[e.key] = e.val
+	}
+	for k, v := range sections {
+		if _, ok := bounded[k]; !ok {
+			bounded[otherLabel] += v
+		}
+	}
+	return bounded
+}
+
+// storeRetentionKeys are the resolutions accepted by ParseStoreRetention.
+var storeRetentionKeys = []string{RawResolution, MinuteResolution, HourResolution}
+
+// ParseStoreRetention sets the retentions of StatsStoreOpts from a definition like "raw=24h,1m=168h,1h=2160h".
+func ParseStoreRetention(definition string, opts *StatsStoreOpts) error {
+	for _, part := range strings.Split(definition, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("invalid retention %q: expected resolution=duration", part)
+		}
+		d, err := time.ParseDuration(kv[1])
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid retention %q: expected a positive duration", part)
+		}
+
+		switch kv[0] {
+		case RawResolution:
+			opts.RawRetention = d
+		case MinuteResolution:
+			opts.MinuteRetention = d
+		case HourResolution:
+			opts.HourRetention = d
+		default:
+			return fmt.Errorf("invalid retention %q: resolution must be one of %s", part, strings.Join(storeRetentionKeys, ", "))
+		}
+	}
+	return nil
+}
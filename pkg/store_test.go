@@ -0,0 +1,167 @@
+package logmon_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	logmon "github.com/jjrumi/accesslogmonitor/pkg"
+)
+
+func TestStatsStore_RollsUpIntervals(t *testing.T) {
+	dir := givenATempDir(t)
+	defer os.RemoveAll(dir)
+	base := time.Now().Truncate(time.Hour).Add(-2 * time.Hour)
+
+	// One request every 10 seconds for 62 minutes:
+	var intervals []logmon.TrafficStats
+	for i := 1; i <= 372; i++ {
+		intervals = append(intervals, givenStatsAt(base.Add(time.Duration(i)*10*time.Second), "/api"))
+	}
+	store := logmon.NewStatsStore(logmon.StatsStoreOpts{Dir: dir, RefreshInterval: 10})
+	givenAStoreFedWith(t, store, intervals)
+
+	raw, err := store.Query(base, base.Add(time.Hour), logmon.RawResolution)
+	require.NoError(t, err)
+	require.Len(t, raw, 360)
+	require.Equal(t, 10, raw[0].Duration)
+
+	// The rollup of the last minute is still being accumulated:
+	minutes, err := store.Query(base, base.Add(2*time.Hour), logmon.MinuteResolution)
+	require.NoError(t, err)
+	require.Len(t, minutes, 61)
+	require.Equal(t, base.Add(time.Minute).Unix(), minutes[0].Time.Unix())
+	require.Equal(t, 60, minutes[0].Duration)
+	require.Equal(t, 6, minutes[0].Requests)
+	require.Equal(t, map[string]int{"/api": 6}, minutes[0].Sections)
+
+	hours, err := store.Query(base, base.Add(2*time.Hour), logmon.HourResolution)
+	require.NoError(t, err)
+	require.Len(t, hours, 1)
+	require.Equal(t, 360, hours[0].Requests)
+
+	// After a restart, the rollup of the last minute is rebuilt from the raw intervals:
+	restarted := logmon.NewStatsStore(logmon.StatsStoreOpts{Dir: dir, RefreshInterval: 10})
+	givenAStoreFedWith(t, restarted, []logmon.TrafficStats{givenStatsAt(base.Add(62*time.Minute+10*time.Second), "/api")})
+
+	minutes, err = restarted.Query(base.Add(62*time.Minute), base.Add(62*time.Minute), logmon.MinuteResolution)
+	require.NoError(t, err)
+	require.Len(t, minutes, 1)
+	require.Equal(t, 6, minutes[0].Requests)
+}
+
+func TestStatsStore_DeletesSegmentsBeyondTheRetention(t *testing.T) {
+	dir := givenATempDir(t)
+	defer os.RemoveAll(dir)
+	base := time.Now().Truncate(time.Hour).Add(-3 * time.Hour)
+
+	store := logmon.NewStatsStore(logmon.StatsStoreOpts{Dir: dir, RefreshInterval: 10, RawRetention: 30 * time.Minute})
+	givenAStoreFedWith(t, store, []logmon.TrafficStats{
+		givenStatsAt(base.Add(10*time.Second), "/api"),
+		givenStatsAt(base.Add(time.Hour+10*time.Second), "/api"),
+		givenStatsAt(base.Add(2*time.Hour+10*time.Second), "/api"),
+	})
+
+	raw, err := store.Query(time.Time{}, time.Now(), logmon.RawResolution)
+	require.NoError(t, err)
+	require.Len(t, raw, 2)
+	require.Equal(t, base.Add(time.Hour+10*time.Second).Unix(), raw[0].Time.Unix())
+}
+
+func TestStatsStore_QueriesWhileStoring(t *testing.T) {
+	dir := givenATempDir(t)
+	defer os.RemoveAll(dir)
+	base := time.Now().Truncate(time.Hour).Add(-2 * time.Hour)
+
+	store := logmon.NewStatsStore(logmon.StatsStoreOpts{Dir: dir, RefreshInterval: 10})
+	cleanup, err := store.Setup()
+	require.NoError(t, err)
+	defer cleanup()
+
+	stats := make(chan logmon.TrafficStats)
+	alerts := make(chan logmon.ThresholdAlert)
+	close(alerts)
+	done := make(chan struct{})
+	go func() {
+		store.Run(context.Background(), stats, alerts)
+		close(done)
+	}()
+
+	// Every interval is stored while the store is queried:
+	for i := 1; i <= 720; i++ {
+		stats <- givenStatsAt(base.Add(time.Duration(i)*10*time.Second), "/api")
+		if i%60 == 0 {
+			_, err := store.Query(base, base.Add(2*time.Hour), logmon.RawResolution)
+			require.NoError(t, err)
+		}
+	}
+	close(stats)
+	<-done
+
+	raw, err := store.Query(base, base.Add(2*time.Hour), logmon.RawResolution)
+	require.NoError(t, err)
+	require.Len(t, raw, 720)
+}
+
+func TestStatsStore_QueryFailsWithUnknownResolutions(t *testing.T) {
+	store := logmon.NewStatsStore(logmon.StatsStoreOpts{Dir: "/nonexistent"})
+	_, err := store.Query(time.Time{}, time.Now(), "1d")
+	require.Error(t, err)
+}
+
+func TestParseStoreRetention(t *testing.T) {
+	tests := map[string]struct {
+		definition string
+		expected   logmon.StatsStoreOpts
+		valid      bool
+	}{
+		"all resolutions": {
+			"raw=1h,1m=24h,1h=720h",
+			logmon.StatsStoreOpts{RawRetention: time.Hour, MinuteRetention: 24 * time.Hour, HourRetention: 720 * time.Hour},
+			true,
+		},
+		"some resolutions":   {"1m=48h", logmon.StatsStoreOpts{MinuteRetention: 48 * time.Hour}, true},
+		"unknown resolution": {"1d=48h", logmon.StatsStoreOpts{}, false},
+		"invalid duration":   {"raw=forever", logmon.StatsStoreOpts{}, false},
+		"missing duration":   {"raw", logmon.StatsStoreOpts{}, false},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var opts logmon.StatsStoreOpts
+			err := logmon.ParseStoreRetention(tc.definition, &opts)
+			if !tc.valid {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, opts)
+		})
+	}
+}
+
+func givenATempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "logmon-store")
+	require.NoError(t, err)
+	return dir
+}
+
+// givenAStoreFedWith sets up a store and runs it with some intervals.
+func givenAStoreFedWith(t *testing.T, store logmon.StatsStore, intervals []logmon.TrafficStats) {
+	cleanup, err := store.Setup()
+	require.NoError(t, err)
+	defer cleanup()
+
+	stats := make(chan logmon.TrafficStats, len(intervals))
+	for _, s := range intervals {
+		stats <- s
+	}
+	close(stats)
+	alerts := make(chan logmon.ThresholdAlert)
+	close(alerts)
+	store.Run(context.Background(), stats, alerts)
+}
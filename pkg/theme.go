@@ -0,0 +1,207 @@
+package logmon
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	ui "github.com/gizak/termui/v3"
+)
+
+// Theme defines the colours of the terminal UI. Every field is a termui style, as used by the markup of the panels:
+// comma separated fg:<colour>, bg:<colour> and mod:<bold|underline|reverse> items, e.g. "fg:white,bg:red,mod:bold".
+// Colours are either named (black, red, green, yellow, blue, magenta, cyan, white) or numbers of a 256 colours palette.
+type Theme struct {
+	Name      string `yaml:"-"`
+	Text      string `yaml:"text"`       // Text of the panels.
+	Title     string `yaml:"title"`      // Titles of the panels.
+	Border    string `yaml:"border"`     // Borders of the panels.
+	Focus     string `yaml:"focus"`      // Border and selected row of the focused panel.
+	Value     string `yaml:"value"`      // Figures and names within the text.
+	OK        string `yaml:"ok"`         // Recovered alerts and healthy error budgets.
+	Alert     string `yaml:"alert"`      // Open alerts and exhausted error budgets.
+	Warning   string `yaml:"warning"`    // Silenced alerts and maintenance windows.
+	Key       string `yaml:"key"`        // Keys of the help overlay.
+	Requests  string `yaml:"requests"`   // Line of the requests per second chart. Only its foreground is used.
+	Threshold string `yaml:"threshold"`  // Line of the alert threshold on the chart. Only its foreground is used.
+	Errors4xx string `yaml:"errors4xx"`  // Sparkline of the 4xx responses. Only its foreground is used.
+	Errors5xx string `yaml:"errors5xx"`  // Sparkline of the 5xx responses. Only its foreground is used.
+	AlertBand string `yaml:"alert_band"` // Intervals of the chart with a high traffic alert open. Only its background and modifier are used.
+}
+
+// DefaultTheme is the theme of the UI unless another one is selected.
+var DefaultTheme = Theme{
+	Name:      "default",
+	Text:      "fg:white",
+	Title:     "fg:white",
+	Border:    "fg:white",
+	Focus:     "fg:yellow",
+	Value:     "fg:blue",
+	OK:        "fg:green",
+	Alert:     "fg:red",
+	Warning:   "fg:yellow",
+	Key:       "fg:yellow",
+	Requests:  "fg:cyan",
+	Threshold: "fg:yellow",
+	Errors4xx: "fg:yellow",
+	Errors5xx: "fg:red",
+	AlertBand: "bg:52", // Dark red.
+}
+
+// Themes are the built-in themes, by name.
+// The high contrast and monochrome themes stay readable on projectors and shared screens.
+var Themes = map[string]Theme{
+	DefaultTheme.Name: DefaultTheme,
+	"high-contrast": {
+		Name:      "high-contrast",
+		Text:      "fg:white",
+		Title:     "fg:white,mod:bold",
+		Border:    "fg:white",
+		Focus:     "fg:yellow,mod:bold",
+		Value:     "fg:cyan,mod:bold",
+		OK:        "fg:green,mod:bold",
+		Alert:     "fg:white,bg:red,mod:bold",
+		Warning:   "fg:black,bg:yellow",
+		Key:       "fg:yellow,mod:bold",
+		Requests:  "fg:cyan",
+		Threshold: "fg:magenta",
+		Errors4xx: "fg:yellow",
+		Errors5xx: "fg:red",
+		AlertBand: "bg:red",
+	},
+	"monochrome": {
+		Name:      "monochrome",
+		Text:      "fg:white",
+		Title:     "fg:white,mod:bold",
+		Border:    "fg:white",
+		Focus:     "fg:white,mod:reverse",
+		Value:     "fg:white,mod:bold",
+		OK:        "fg:white",
+		Alert:     "fg:white,mod:reverse",
+		Warning:   "fg:white,mod:underline",
+		Key:       "fg:white,mod:bold",
+		Requests:  "fg:white",
+		Threshold: "fg:white",
+		Errors4xx: "fg:white",
+		Errors5xx: "fg:white",
+		AlertBand: "mod:reverse",
+	},
+}
+
+// LookupTheme returns a built-in theme by name.
+func LookupTheme(name string) (Theme, error) {
+	theme, ok := Themes[name]
+	if !ok {
+		var names []string
+		for n := range Themes {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return Theme{}, fmt.Errorf("unknown theme %q: expected one of %s", name, strings.Join(names, ", "))
+	}
+	return theme, nil
+}
+
+// Validate checks the styles of the theme.
+func (t Theme) Validate() error {
+	styles := []struct {
+		field string
+		style string
+	}{
+		{"text", t.Text},
+		{"title", t.Title},
+		{"border", t.Border},
+		{"focus", t.Focus},
+		{"value", t.Value},
+		{"ok", t.OK},
+		{"alert", t.Alert},
+		{"warning", t.Warning},
+		{"key", t.Key},
+		{"requests", t.Requests},
+		{"threshold", t.Threshold},
+		{"errors4xx", t.Errors4xx},
+		{"errors5xx", t.Errors5xx},
+		{"alert_band", t.AlertBand},
+	}
+	for _, s := range styles {
+		if _, err := parseStyle(s.style); err != nil {
+			return fmt.Errorf("invalid %s style of theme %q: %w", s.field, t.Name, err)
+		}
+	}
+	return nil
+}
+
+// apply makes the theme the default style of the widgets created afterwards.
+func (t Theme) apply() {
+	text := t.style(t.Text)
+	ui.Theme.Default = text
+	ui.Theme.Block.Title = t.style(t.Title)
+	ui.Theme.Block.Border = t.style(t.Border)
+	ui.Theme.List.Text = text
+	ui.Theme.Paragraph.Text = text
+	ui.Theme.Sparkline.Title = t.style(t.Title)
+	ui.Theme.Plot.Axes = text.Fg
+	ui.Theme.Tab.Active = t.style(t.Focus)
+	ui.Theme.Tab.Inactive = text
+}
+
+// style returns a style of the theme. Invalid styles fall back to the default text style: themes are validated
+// before they are used.
+func (t Theme) style(spec string) ui.Style {
+	style, err := parseStyle(spec)
+	if err != nil {
+		return ui.NewStyle(ui.ColorWhite)
+	}
+	return style
+}
+
+// init registers the colours of a 256 colours palette by number, for the markup of the panels.
+func init() {
+	for i := 0; i < 256; i++ {
+		ui.StyleParserColorMap[strconv.Itoa(i)] = ui.Color(i)
+	}
+}
+
+var styleModifiers = map[string]ui.Modifier{
+	"bold":      ui.ModifierBold,
+	"underline": ui.ModifierUnderline,
+	"reverse":   ui.ModifierReverse,
+}
+
+// parseStyle parses a style the way termui parses the markup of the panels, but rejects unknown items.
+func parseStyle(spec string) (ui.Style, error) {
+	style := ui.NewStyle(ui.ColorWhite)
+	if strings.TrimSpace(spec) == "" {
+		return style, fmt.Errorf("empty style")
+	}
+
+	for _, item := range strings.Split(spec, ",") {
+		kv := strings.SplitN(item, ":", 2)
+		if len(kv) != 2 {
+			return style, fmt.Errorf("invalid item %q: expected fg:<colour>, bg:<colour> or mod:<modifier>", item)
+		}
+
+		switch kv[0] {
+		case "fg", "bg":
+			color, ok := ui.StyleParserColorMap[kv[1]]
+			if !ok {
+				return style, fmt.Errorf("unknown colour %q", kv[1])
+			}
+			if kv[0] == "fg" {
+				style.Fg = color
+			} else {
+				style.Bg = color
+			}
+		case "mod":
+			modifier, ok := styleModifiers[kv[1]]
+			if !ok {
+				return style, fmt.Errorf("unknown modifier %q: expected bold, underline or reverse", kv[1])
+			}
+			style.Modifier = modifier
+		default:
+			return style, fmt.Errorf("invalid item %q: expected fg:<colour>, bg:<colour> or mod:<modifier>", item)
+		}
+	}
+	return style, nil
+}
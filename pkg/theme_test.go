@@ -0,0 +1,51 @@
+package logmon_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	logmon "github.com/jjrumi/accesslogmonitor/pkg"
+)
+
+func TestLookupTheme(t *testing.T) {
+	for name := range logmon.Themes {
+		theme, err := logmon.LookupTheme(name)
+		require.NoError(t, err)
+		require.Equal(t, name, theme.Name)
+		require.NoError(t, theme.Validate())
+	}
+
+	_, err := logmon.LookupTheme("solarized")
+	require.EqualError(t, err, `unknown theme "solarized": expected one of default, high-contrast, monochrome`)
+}
+
+func TestTheme_Validate(t *testing.T) {
+	tests := map[string]struct {
+		alert string
+		error string
+	}{
+		"valid style":      {"fg:white,bg:red,mod:bold", ""},
+		"palette colour":   {"fg:196", ""},
+		"empty style":      {"", `invalid alert style of theme "custom": empty style`},
+		"unknown colour":   {"fg:crimson", `unknown colour "crimson"`},
+		"unknown modifier": {"mod:blink", `unknown modifier "blink"`},
+		"invalid item":     {"red", `invalid item "red"`},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			theme := logmon.DefaultTheme
+			theme.Name = "custom"
+			theme.Alert = tc.alert
+
+			err := theme.Validate()
+			if tc.error == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tc.error)
+		})
+	}
+}
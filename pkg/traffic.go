@@ -4,34 +4,100 @@ import (
 	"container/list"
 	"context"
 	"log"
-	"regexp"
+	"strings"
 	"sync"
 	"time"
 )
 
 // TrafficSupervisor consumes log entries and produces traffic stats.
+// It can be reconfigured while it runs.
 type TrafficSupervisor interface {
 	Run(ctx context.Context, entries <-chan LogEntry, stats chan<- TrafficStats)
+	Reconfigure(opts TrafficSupervisorOpts)
 }
 
+// defaultClientCapacity is the number of clients tracked per interval when none is given.
+const defaultClientCapacity = 100
+
+// sectionClientCapacity is the number of clients tracked per section and interval.
+const sectionClientCapacity = 20
+
+// sectionPathCapacity is the number of paths tracked per section and interval.
+const sectionPathCapacity = 50
+
 // NewTrafficSupervisor creates a TrafficSupervisor.
 func NewTrafficSupervisor(opts TrafficSupervisorOpts) TrafficSupervisor {
+	settings := newTrafficSettings(opts)
 	return &trafficSupervisor{
-		refreshInterval: time.Duration(opts.RefreshInterval) * time.Millisecond,
-		entriesBuffer:   list.New(),
+		settings:      settings,
+		entriesBuffer: list.New(),
+		windows:       newRollingWindows(settings.windows, settings.refreshInterval),
+		pending:       newPendingOpts(),
 	}
 }
 
 // TrafficSupervisorOpts defines the options required to build a TrafficSupervisor.
 type TrafficSupervisorOpts struct {
 	RefreshInterval int
+	ClientKey       ClientKey        // How to aggregate the requests of the clients. By remote host if nil.
+	ClientCapacity  int              // Maximum number of clients tracked per interval.
+	Windows         []time.Duration  // Periods of the rolling windows. DefaultWindows if nil.
+	SLOs            []SLO            // SLOs to account the error budgets and burn rates of.
+	BurnRateWindows []BurnRateWindow // Burn rate alert conditions of every SLO. DefaultBurnRateWindows if empty.
+	LastRead        func() time.Time // Time the sources last read a line, parsed or not. Stats get no LastRead if nil.
+}
+
+// trafficSettings are the options of a TrafficSupervisor, with their defaults.
+type trafficSettings struct {
+	refreshInterval time.Duration
+	clientKey       ClientKey
+	clientCapacity  int
+	windows         []time.Duration
+	slos            []SLO
+	burnWindows     []BurnRateWindow
+	lastRead        func() time.Time
+}
+
+func newTrafficSettings(opts TrafficSupervisorOpts) trafficSettings {
+	clientKey := opts.ClientKey
+	if clientKey == nil {
+		clientKey = func(entry LogEntry) string { return entry.RemoteHost }
+	}
+
+	clientCapacity := opts.ClientCapacity
+	if clientCapacity < 1 {
+		clientCapacity = defaultClientCapacity
+	}
+
+	windows := opts.Windows
+	if windows == nil {
+		windows = DefaultWindows
+	}
+
+	burnWindows := opts.BurnRateWindows
+	if len(burnWindows) == 0 {
+		burnWindows = DefaultBurnRateWindows
+	}
+
+	return trafficSettings{
+		refreshInterval: time.Duration(opts.RefreshInterval) * time.Millisecond,
+		clientKey:       clientKey,
+		clientCapacity:  clientCapacity,
+		windows:         windows,
+		slos:            opts.SLOs,
+		burnWindows:     burnWindows,
+		lastRead:        opts.LastRead,
+	}
 }
 
 // trafficSupervisor implements the TrafficSupervisor interface.
 // It stores the log entries of the current refresh interval in a linked-list.
 type trafficSupervisor struct {
-	entriesBuffer   *list.List
-	refreshInterval time.Duration
+	entriesBuffer *list.List
+	settings      trafficSettings // Only accessed by Run. Every interval gets a copy of them.
+	windows       *rollingWindows // Only accessed by the goroutine producing the stats in turn.
+	slos          []*sloTracker   // Only accessed by the goroutine producing the stats in turn.
+	pending       *pendingOpts    // Options set by Reconfigure, applied by Run.
 }
 
 // Run consumes log entries and produces traffic stats.
@@ -39,9 +105,13 @@ type trafficSupervisor struct {
 // Traffic stats generation is scheduled based on the refresh interval.
 // On every refresh interval tick, the current buffer of log entries is used to generate the stats.
 // The log entries buffer is replaced with an empty list that will store the entries of the next interval.
+// Stats are produced in turn, so the rolling windows slide and the stats are sent in order.
+// On reconfiguration, the ticker restarts with the new refresh interval: the entries received since the last tick
+// are part of the first interval with the new options.
 func (t *trafficSupervisor) Run(ctx context.Context, entries <-chan LogEntry, stats chan<- TrafficStats) {
 	var wg sync.WaitGroup
-	ticker := time.NewTicker(t.refreshInterval)
+	ticker := time.NewTicker(t.settings.refreshInterval)
+	var previous chan struct{} // Closed once the stats of the previous interval are sent.
 
 LOOP:
 	for {
@@ -52,14 +122,26 @@ LOOP:
 			}
 
 			t.entriesBuffer.PushFront(entry)
-		case <-ticker.C:
+		case now := <-ticker.C:
 			// Keep a reference to the current list of entries to compute stats.
 			// Create a new list for the next tick.
 			interval := t.entriesBuffer
 			t.entriesBuffer = list.New()
 
+			done := make(chan struct{})
 			wg.Add(1)
-			go t.produceStats(&wg, interval, stats)
+			go t.produceStats(&wg, now, interval, t.settings, previous, done, stats)
+			previous = done
+		case <-t.pending.ready:
+			opts, ok := t.pending.take().(TrafficSupervisorOpts)
+			if !ok {
+				continue
+			}
+
+			t.settings = newTrafficSettings(opts)
+			ticker.Stop()
+			ticker = time.NewTicker(t.settings.refreshInterval)
+			log.Printf("traffic supervisor reconfigured: refresh interval %v", t.settings.refreshInterval)
 		case <-ctx.Done():
 			break LOOP
 		}
@@ -71,11 +153,26 @@ LOOP:
 	ticker.Stop()
 }
 
+// Reconfigure replaces the options. They apply from the next interval on.
+// The rolling windows are resized, keeping the intervals seen so far if the refresh interval is unchanged.
+// The SLOs kept with the same burn rate windows and refresh interval keep their error budgets.
+func (t *trafficSupervisor) Reconfigure(opts TrafficSupervisorOpts) {
+	t.pending.set(opts)
+}
+
 // produceStats considers entries within a time window.
 // it starts consuming the oldest entry and continues up to the given time limit.
 // every consumed entry is freed.
-func (t *trafficSupervisor) produceStats(wg *sync.WaitGroup, interval *list.List, statsC chan<- TrafficStats) {
+// Once the stats of the previous interval are sent, it slides the rolling windows, accounts the SLOs and sends the stats.
+func (t *trafficSupervisor) produceStats(wg *sync.WaitGroup, now time.Time, interval *list.List, settings trafficSettings, previous <-chan struct{}, done chan<- struct{}, statsC chan<- TrafficStats) {
 	stats := NewEmptyTrafficStats()
+	stats.Time = now
+	if settings.lastRead != nil {
+		stats.LastRead = settings.lastRead()
+	}
+	stats.clients = newHeavyHitters(settings.clientCapacity)
+	stats.clientKey = settings.clientKey
+	stats.Sections = make(map[string]*SectionStats)
 
 	count := interval.Len()
 	var e, prev *list.Element
@@ -87,9 +184,29 @@ func (t *trafficSupervisor) produceStats(wg *sync.WaitGroup, interval *list.List
 		interval.Remove(e)
 		e = prev
 	}
+	stats.Clients = stats.clients.top()
+	for _, section := range stats.Sections {
+		section.PathHits = section.paths.hits()
+		section.Clients = section.clients.top()
+	}
+
+	if previous != nil {
+		<-previous
+	}
+	if !t.windows.sized(settings.windows, settings.refreshInterval) {
+		t.windows = t.windows.resize(settings.windows, settings.refreshInterval)
+	}
+	t.windows.add(stats)
+	stats.Windows = t.windows.snapshot()
+	t.slos = trackSLOs(t.slos, settings.slos, settings.burnWindows, settings.refreshInterval)
+	for _, slo := range t.slos {
+		slo.observe(stats)
+		stats.SLOs = append(stats.SLOs, slo.status())
+	}
 
 	log.Printf("send stats from %d entries: %v", count, stats)
 	statsC <- stats
+	close(done)
 	wg.Done()
 }
 
@@ -100,35 +217,80 @@ type TrafficStats struct {
 	StatusClassHits map[string]int
 	Bytes           int
 	TotalReqs       int
-	sectionRegexp   *regexp.Regexp
+	Time            time.Time                // End of the interval.
+	LastRead        time.Time                // Time the sources last read a line, parsed and matching the filter or not.
+	Clients         []ClientHits             // Clients with the most requests, most requested first.
+	Windows         []TrafficWindow          // Rolling windows ending with the interval, shortest first as configured.
+	SLOs            []SLOStatus              // Error budgets and burn rates of the SLOs, as configured.
+	Sections        map[string]*SectionStats // Traffic of every section. Only tracked by the TrafficSupervisor.
+	clients         *heavyHitters
+	clientKey       ClientKey
+}
+
+// SectionStats defines the traffic of a section during an interval.
+type SectionStats struct {
+	MethodHits      map[string]int
+	StatusClassHits map[string]int
+	PathHits        map[string]int // Paths with the most requests. A path might be overestimated, as the Hits of a client.
+	Bytes           int
+	Clients         []ClientHits // Clients with the most requests to the section, most requested first.
+	paths           *heavyHitters
+	clients         *heavyHitters
 }
 
 // NewEmptyTrafficStats creates an empty TrafficStats.
+// It does not track clients: the TrafficSupervisor does it for the stats it produces.
 func NewEmptyTrafficStats() TrafficStats {
 	return TrafficStats{
 		SectionHits:     make(map[string]int),
 		MethodHits:      make(map[string]int),
 		StatusClassHits: make(map[string]int),
-		sectionRegexp:   regexp.MustCompile(`^/[^/]*`),
 	}
 }
 
 // Update updates the traffic stats with a LogEntry.
 func (s *TrafficStats) Update(entry LogEntry) {
-	s.SectionHits[s.parseSection(entry.ReqPath)]++
+	section := sectionOf(entry.ReqPath)
+	status := s.parseStatusClass(entry.StatusCode)
+	s.SectionHits[section]++
 	s.MethodHits[entry.ReqMethod]++
-	s.StatusClassHits[s.parseStatusClass(entry.StatusCode)]++
+	s.StatusClassHits[status]++
 	s.Bytes += entry.Bytes
 	s.TotalReqs++
+
+	if s.clients != nil {
+		s.clients.add(s.clientKey(entry), entry.StatusCode >= 400)
+	}
+
+	if s.Sections != nil {
+		stats, ok := s.Sections[section]
+		if !ok {
+			stats = &SectionStats{
+				MethodHits:      make(map[string]int),
+				StatusClassHits: make(map[string]int),
+				paths:           newHeavyHitters(sectionPathCapacity),
+				clients:         newHeavyHitters(sectionClientCapacity),
+			}
+			s.Sections[section] = stats
+		}
+		stats.MethodHits[entry.ReqMethod]++
+		stats.StatusClassHits[status]++
+		stats.paths.add(entry.ReqPath, entry.StatusCode >= 400)
+		stats.Bytes += entry.Bytes
+		stats.clients.add(s.clientKey(entry), entry.StatusCode >= 400)
+	}
 }
 
-// parseSection finds the section in the given URL path.
-func (s *TrafficStats) parseSection(path string) string {
+// sectionOf finds the section in the given URL path: what is before the second "/".
+// The filters match the same sections.
+func sectionOf(path string) string {
 	if len(path) < 1 || path[0] != '/' {
 		path = "/" + path
 	}
-
-	return s.sectionRegexp.FindString(path)
+	if i := strings.IndexByte(path[1:], '/'); i >= 0 {
+		return path[:i+1]
+	}
+	return path
 }
 
 // parseStatusClass classifies HTTP status codes into classes.
@@ -2,6 +2,7 @@ package logmon_test
 
 import (
 	"context"
+	"fmt"
 	"testing"
 	"time"
 
@@ -69,6 +70,49 @@ func TestTrafficSupervisor_GeneratesStatsWithContinuousTraffic(t *testing.T) {
 	cancel()
 }
 
+func TestTrafficSupervisor_TracksTheTrafficOfEverySection(t *testing.T) {
+	entries := make(chan logmon.LogEntry, 4)
+	entries <- logmon.LogEntry{RemoteHost: "10.0.0.1", ReqMethod: "GET", ReqPath: "/api/users", StatusCode: 200, Bytes: 10}
+	entries <- logmon.LogEntry{RemoteHost: "10.0.0.1", ReqMethod: "GET", ReqPath: "/api/users", StatusCode: 404, Bytes: 5}
+	entries <- logmon.LogEntry{RemoteHost: "10.0.0.2", ReqMethod: "POST", ReqPath: "/api/orders", StatusCode: 201, Bytes: 20}
+	entries <- logmon.LogEntry{RemoteHost: "10.0.0.2", ReqMethod: "GET", ReqPath: "/", StatusCode: 200, Bytes: 1}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stats := make(chan logmon.TrafficStats)
+	go givenATrafficSupervisor(50).Run(ctx, entries, stats)
+
+	data := <-stats
+	require.Len(t, data.Sections, 2)
+	api := data.Sections["/api"]
+	require.Equal(t, map[string]int{"GET": 2, "POST": 1}, api.MethodHits)
+	require.Equal(t, map[string]int{"2xx": 2, "4xx": 1}, api.StatusClassHits)
+	require.Equal(t, map[string]int{"/api/users": 2, "/api/orders": 1}, api.PathHits)
+	require.Equal(t, 35, api.Bytes)
+	require.Equal(t, []logmon.ClientHits{
+		{Client: "10.0.0.1", Hits: 2, Errors: 1},
+		{Client: "10.0.0.2", Hits: 1},
+	}, api.Clients)
+}
+
+func TestTrafficSupervisor_BoundsThePathsOfASection(t *testing.T) {
+	entries := make(chan logmon.LogEntry, 200)
+	for i := 0; i < 100; i++ {
+		entries <- logmon.LogEntry{ReqMethod: "GET", ReqPath: "/api/popular", StatusCode: 200}
+		entries <- logmon.LogEntry{ReqMethod: "GET", ReqPath: fmt.Sprintf("/api/users/%d", i), StatusCode: 200}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stats := make(chan logmon.TrafficStats)
+	go givenATrafficSupervisor(50).Run(ctx, entries, stats)
+
+	data := <-stats
+	api := data.Sections["/api"]
+	require.Len(t, api.PathHits, 50, "the paths tracked per section are bounded")
+	require.Equal(t, 100, api.PathHits["/api/popular"], "the path with the most requests is tracked")
+}
+
 func givenContinuousLogEntryWrites(ctx context.Context, dst chan<- logmon.LogEntry, maxSend int) {
 	count := 0
 	for {
@@ -194,3 +238,43 @@ func TestTrafficStats(t *testing.T) {
 		})
 	}
 }
+
+func TestTrafficSupervisor_AccountsTheSLOs(t *testing.T) {
+	entries := make(chan logmon.LogEntry, 10)
+	for i := 0; i < 10; i++ {
+		status := 200
+		if i%2 == 0 {
+			status = 500
+		}
+		entries <- logmon.LogEntry{ReqMethod: "GET", ReqPath: "/api", StatusCode: status}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	slo := logmon.SLO{Name: "availability", Target: 0.9, Period: time.Hour}
+	window := logmon.BurnRateWindow{Long: time.Second, Short: 50 * time.Millisecond, BurnRate: 2}
+	supervisor := logmon.NewTrafficSupervisor(logmon.TrafficSupervisorOpts{
+		RefreshInterval: 50,
+		SLOs:            []logmon.SLO{slo},
+		BurnRateWindows: []logmon.BurnRateWindow{window},
+	})
+	stats := make(chan logmon.TrafficStats)
+	go supervisor.Run(ctx, entries, stats)
+
+	// 5 errors out of 10 requests ==> 50% errors, burn rate 0.5/0.1 = 5 on both windows:
+	s := <-stats
+	require.Len(t, s.SLOs, 1)
+	require.Equal(t, slo, s.SLOs[0].SLO)
+	require.InDelta(t, -4, s.SLOs[0].Budget, 1e-9, "error budget exhausted: 5 errors out of a budget of 1")
+	require.Len(t, s.SLOs[0].BurnRates, 1)
+	require.InDelta(t, 5, s.SLOs[0].BurnRates[0].Long, 1e-9)
+	require.InDelta(t, 5, s.SLOs[0].BurnRates[0].Short, 1e-9)
+	require.True(t, s.SLOs[0].BurnRates[0].Burning())
+
+	// The next interval has no requests: only the short window recovers.
+	s = <-stats
+	require.InDelta(t, 5, s.SLOs[0].BurnRates[0].Long, 1e-9)
+	require.Equal(t, 0.0, s.SLOs[0].BurnRates[0].Short)
+	require.False(t, s.SLOs[0].BurnRates[0].Burning())
+	require.InDelta(t, -4, s.SLOs[0].Budget, 1e-9, "the budget is spent for the whole period")
+}
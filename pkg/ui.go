@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"sort"
+	"strings"
 	"time"
 
 	ui "github.com/gizak/termui/v3"
@@ -16,23 +17,98 @@ type UIOpts struct {
 	Refresh        int
 	AlertThreshold int
 	AlertWindow    int
+	AlertFloor     int
+	NoDataTimeout  int
+	AnomalySigmas  float64
+	SpikePercent   int
+	SLOs           []SLO
+	ClientRate     int
+	ClientErrors   int
+	History        []ThresholdAlert // Alerts recorded by previous runs, oldest first.
+	Silences       *SilenceStore    // Store of the silences created with the "s" key. Disabled if nil.
+	SilenceFor     time.Duration    // Duration of the silences created with the "s" key.
+	Maintenance    []MaintenanceWindow
+	Filter         EntryFilter // Filter of the log entries, edited with the "/" key. Not editable if nil.
+	Layout         Layout      // Panels of the UI. DefaultLayout if empty.
+	CompactLayout  Layout      // Panels of the UI on small terminals, a tab per row name. DefaultCompactLayout if empty.
+	Theme          Theme       // Colours of the UI. DefaultTheme if empty.
 }
 
-// NewUI creates a UI.
+// maxAlertHistory is the number of alerts kept in the alert history panel.
+const maxAlertHistory = 1000
+
+// UI displays the traffic stats and alerts. It runs until it is told to stop, or its streams are closed.
+// It reports the config reloads, and displays the values of the configuration reloaded.
+type UI interface {
+	Setup() (func(), error)
+	Run(ctx context.Context, stats <-chan TrafficStats, alerts <-chan ThresholdAlert)
+	Reload(report ReloadReport)
+}
+
+// NewUI creates a UI for the terminal.
+// It displays the error budgets of the SLOs accounted by the TrafficSupervisor, the ones the burn rate alerts are on.
 func NewUI(opts UIOpts) UI {
-	return UI{refresh: opts.Refresh, alertThreshold: opts.AlertThreshold, alertWindow: opts.AlertWindow}
+	layout, compactLayout, theme := opts.Layout, opts.CompactLayout, opts.Theme
+	if len(layout.Rows) == 0 {
+		layout, _ = ParseLayout(DefaultLayout)
+	}
+	if len(compactLayout.Rows) == 0 {
+		compactLayout, _ = ParseLayout(DefaultCompactLayout)
+	}
+	if theme.Name == "" {
+		theme = DefaultTheme
+	}
+
+	return terminalUI{
+		refresh:        opts.Refresh,
+		alertThreshold: opts.AlertThreshold,
+		alertWindow:    opts.AlertWindow,
+		alertFloor:     opts.AlertFloor,
+		noDataTimeout:  opts.NoDataTimeout,
+		anomalySigmas:  opts.AnomalySigmas,
+		spikePercent:   opts.SpikePercent,
+		slos:           opts.SLOs,
+		clientRate:     opts.ClientRate,
+		clientErrors:   opts.ClientErrors,
+		history:        opts.History,
+		silences:       opts.Silences,
+		silenceFor:     opts.SilenceFor,
+		maintenance:    opts.Maintenance,
+		filter:         opts.Filter,
+		layout:         layout,
+		compactLayout:  compactLayout,
+		theme:          theme,
+		reloads:        newPendingOpts(),
+	}
 }
 
-// UI holds the configuration values of the monitor to display the information.
+// terminalUI implements the UI interface. It holds the configuration values of the monitor to display the information.
 // It uses a third party library (github.com/gizak/termui) to manipulate the GUI in the console.
-type UI struct {
+type terminalUI struct {
 	refresh        int
 	alertThreshold int
 	alertWindow    int
+	alertFloor     int
+	noDataTimeout  int
+	anomalySigmas  float64
+	spikePercent   int
+	slos           []SLO
+	clientRate     int
+	clientErrors   int
+	history        []ThresholdAlert
+	silences       *SilenceStore
+	silenceFor     time.Duration
+	maintenance    []MaintenanceWindow
+	filter         EntryFilter
+	layout         Layout
+	compactLayout  Layout
+	theme          Theme
+	reloads        *pendingOpts // Reports of the config reloads, applied by Run.
+	reload         ReloadReport // Last config reload, if any.
 }
 
 // Setup configures the UI and returns a callback to cleanup afterwards.
-func (u UI) Setup() (func(), error) {
+func (u terminalUI) Setup() (func(), error) {
 	if err := ui.Init(); err != nil {
 		return nil, fmt.Errorf("initialize termui: %w", err)
 	}
@@ -46,25 +122,18 @@ func (u UI) Setup() (func(), error) {
 }
 
 // Run builds the layout and loops infinitely consuming traffic stats and alerts.
-// It also captures interruption signals.
-func (u UI) Run(ctx context.Context, stats <-chan TrafficStats, alertsBus <-chan ThresholdAlert) {
-	traffic := u.buildTrafficWidget()
-	alerts := u.buildAlertsWidget()
-	sections := u.buildSectionsWidget()
-	status := u.buildStatusWidget()
-	methods := u.buildMethodsWidget()
-	config := u.buildConfigWidget()
-	grid := u.buildUIGrid(traffic, config, sections, status, methods, alerts)
-
-	ui.Render(grid)
+// It also captures interruption signals, the keys to navigate the panels, listed by the help overlay,
+// and the resizes of the terminal.
+func (u terminalUI) Run(ctx context.Context, stats <-chan TrafficStats, alertsBus <-chan ThresholdAlert) {
+	screen := u.newScreen(ui.TerminalDimensions())
+	screen.render()
 	uiEvents := ui.PollEvents()
 
 LOOP:
 	for {
 		select {
 		case e := <-uiEvents:
-			switch e.ID {
-			case "q", "<C-c>":
+			if quit := screen.handleEvent(e); quit {
 				break LOOP
 			}
 		case s, ok := <-stats:
@@ -72,54 +141,55 @@ LOOP:
 				break LOOP
 			}
 
-			config.Rows = u.formatConfig()
-			traffic.Rows = u.formatTraffic(s)
-			sections.Rows = u.formatSections(s)
-			status.Rows = u.formatStatus(s)
-			methods.Rows = u.formatMethods(s)
-
-			ui.Render(grid)
+			screen.updateStats(s)
 		case a, ok := <-alertsBus:
 			if !ok {
 				break LOOP
 			}
 
-			alerts.Rows = u.formatAlerts(a)
-
-			ui.Render(grid)
+			screen.updateAlert(a)
+		case <-u.reloads.ready:
+			for _, r := range takeReloads(u.reloads) {
+				screen.reload(r)
+			}
 		case <-ctx.Done():
 			break LOOP
 		}
 	}
 }
 
-func (u UI) buildUIGrid(traffic *widgets.List, config interface{}, sections *widgets.List, status interface{}, methods interface{}, alerts *widgets.List) *ui.Grid {
-	grid := ui.NewGrid()
-	termWidth, termHeight := ui.TerminalDimensions()
-	grid.SetRect(0, 0, termWidth, termHeight)
-
-	grid.Set(
-		ui.NewRow(0.2,
-			ui.NewCol(1.0/2, traffic),
-			ui.NewCol(1.0/2, config),
-		),
-		ui.NewRow(0.2,
-			ui.NewCol(1.0, alerts),
-		),
-		ui.NewRow(0.6,
-			ui.NewCol(1.0/2, sections),
-			ui.NewCol(1.0/2,
-				ui.NewRow(0.5, status),
-				ui.NewRow(0.5, methods),
-			),
-		),
-	)
-	return grid
-}
-
-func (u UI) buildSectionsWidget() *widgets.List {
+// Reload reports a config reload. The values displayed are updated unless it failed.
+func (u terminalUI) Reload(report ReloadReport) {
+	queueReload(u.reloads, report)
+}
+
+// reloaded returns the UI with the values of a config reload.
+func (u terminalUI) reloaded(r ReloadReport) terminalUI {
+	u.reload = r
+	if r.Err != nil {
+		return u
+	}
+
+	o := r.Opts
+
+	u.refresh = o.RefreshInterval
+	u.alertThreshold = o.AlertThreshold
+	u.alertWindow = o.AlertWindow
+	u.alertFloor = o.AlertFloor
+	u.noDataTimeout = o.NoDataTimeout
+	u.anomalySigmas = o.AnomalySigmas
+	u.spikePercent = o.SpikePercent
+	u.slos = o.SLOs
+	u.clientRate = o.ClientRate
+	u.clientErrors = o.ClientErrors
+	u.silenceFor = o.SilenceDuration
+	u.maintenance = o.Maintenance
+	return u
+}
+
+func (u terminalUI) buildSectionsWidget() *widgets.List {
 	sections := widgets.NewList()
-	sections.Title = "Top 20 sections"
+	sections.Title = "Top sections"
 	sections.WrapText = false
 	sections.SetRect(0, 0, 50, 8)
 	sections.Rows = []string{
@@ -130,7 +200,20 @@ func (u UI) buildSectionsWidget() *widgets.List {
 	return sections
 }
 
-func (u UI) buildTrafficWidget() *widgets.List {
+func (u terminalUI) buildClientsWidget() *widgets.List {
+	clients := widgets.NewList()
+	clients.Title = "Top 20 clients"
+	clients.WrapText = false
+	clients.SetRect(0, 0, 50, 8)
+	clients.Rows = []string{
+		"",
+		"waiting for inputs...",
+	}
+
+	return clients
+}
+
+func (u terminalUI) buildTrafficWidget() *widgets.List {
 	traffic := widgets.NewList()
 	traffic.Title = "Traffic"
 	traffic.WrapText = false
@@ -143,20 +226,51 @@ func (u UI) buildTrafficWidget() *widgets.List {
 	return traffic
 }
 
-func (u UI) buildAlertsWidget() *widgets.List {
+func (u terminalUI) buildAlertsWidget(board *alertBoard) *widgets.List {
 	alerts := widgets.NewList()
-	alerts.Title = "Alerts"
+	alerts.Title = "Open alerts"
 	alerts.WrapText = false
 	alerts.SetRect(0, 0, 50, 8)
-	alerts.Rows = []string{
-		"",
-		"no alerts triggered",
-	}
+	alerts.Rows = u.formatAlerts(board)
 
 	return alerts
 }
 
-func (u UI) buildStatusWidget() *widgets.List {
+func (u terminalUI) buildHistoryWidget(board *alertBoard) *widgets.List {
+	history := widgets.NewList()
+	history.Title = historyTitle
+	history.WrapText = false
+	history.SetRect(0, 0, 50, 8)
+	history.Rows = u.formatHistory(board)
+
+	return history
+}
+
+// historyTitle is the title of the alert history panel, with its keys.
+const historyTitle = "Alert history (s to silence)"
+
+// silenceSelected silences the alert selected in the alert history panel.
+// It returns the title of the panel, telling how it went.
+func (u terminalUI) silenceSelected(board *alertBoard, selected int) string {
+	if u.silences == nil {
+		return historyTitle + " - silences are disabled"
+	}
+	if selected < 0 || selected >= len(board.history) {
+		return historyTitle
+	}
+
+	// The panel shows the newest alert first:
+	a := board.history[len(board.history)-1-selected]
+	silence := NewSilence(silenceMatchers(a), u.silenceFor, "created from the dashboard")
+	if err := u.silences.Add(silence); err != nil {
+		log.Printf("error adding silence: %v", err)
+		return historyTitle + " - silence failed"
+	}
+
+	return fmt.Sprintf("%s - silenced %s for %v", historyTitle, a.ID(), u.silenceFor)
+}
+
+func (u terminalUI) buildStatusWidget() *widgets.List {
 	status := widgets.NewList()
 	status.Title = "HTTP response status"
 	status.WrapText = false
@@ -169,7 +283,7 @@ func (u UI) buildStatusWidget() *widgets.List {
 	return status
 }
 
-func (u UI) buildMethodsWidget() *widgets.List {
+func (u terminalUI) buildMethodsWidget() *widgets.List {
 	methods := widgets.NewList()
 	methods.Title = "HTTP request methods"
 	methods.WrapText = false
@@ -182,9 +296,25 @@ func (u UI) buildMethodsWidget() *widgets.List {
 	return methods
 }
 
-func (u UI) buildConfigWidget() *widgets.List {
+func (u terminalUI) buildSLOsWidget() *widgets.List {
+	slos := widgets.NewList()
+	slos.Title = "SLO error budgets"
+	slos.WrapText = false
+	slos.SetRect(0, 0, 50, 8)
+	slos.Rows = []string{
+		"",
+		"no SLOs defined",
+	}
+	if len(u.slos) > 0 {
+		slos.Rows[1] = "waiting for inputs..."
+	}
+
+	return slos
+}
+
+func (u terminalUI) buildConfigWidget() *widgets.List {
 	config := widgets.NewList()
-	config.Title = "Monitor setup values"
+	config.Title = configTitle
 	config.WrapText = false
 	config.SetRect(0, 0, 50, 8)
 	config.Rows = u.formatConfig()
@@ -192,52 +322,332 @@ func (u UI) buildConfigWidget() *widgets.List {
 	return config
 }
 
-func (u UI) formatConfig() []string {
-	return []string{
+func (u terminalUI) formatConfig() []string {
+	rows := []string{
 		fmt.Sprintf("Current time: %v", time.Now().Format(time.RFC1123)),
-		fmt.Sprintf("Refresh interval: [%v](fg:blue)s", u.refresh),
-		fmt.Sprintf("Alert threshold: [%v](fg:blue)req/s", u.alertThreshold),
-		fmt.Sprintf("Alert window: [%v](fg:blue)s", u.alertWindow),
+		fmt.Sprintf("Refresh interval: [%v](%s)s", u.refresh, u.theme.Value),
+		fmt.Sprintf("Alert threshold: [%v](%s)req/s", u.alertThreshold, u.theme.Value),
+		fmt.Sprintf("Alert window: [%v](%s)s", u.alertWindow, u.theme.Value),
+		fmt.Sprintf("Alert floor: [%v](%s)req/s", u.alertFloor, u.theme.Value),
+		fmt.Sprintf("No data timeout: [%v](%s)s", u.noDataTimeout, u.theme.Value),
+		fmt.Sprintf("Anomaly deviation: [%v](%s)sigma", u.anomalySigmas, u.theme.Value),
+		fmt.Sprintf("Spike change: [%v](%s)%%", u.spikePercent, u.theme.Value),
+		fmt.Sprintf("Client limits: [%v](%s)req/s, [%v](%s)%% errors", u.clientRate, u.theme.Value, u.clientErrors, u.theme.Value),
+		fmt.Sprintf("Theme: [%s](%s)", u.theme.Name, u.theme.Value),
+		u.formatSilences(),
+		u.formatFilter(),
+	}
+	if !u.reload.Time.IsZero() {
+		rows = append(rows, u.formatReload())
+	}
+	return rows
+}
+
+// formatReload tells how the last config reload went. Only the first error is told, the rest are logged.
+func (u terminalUI) formatReload() string {
+	at := u.reload.Time.Format(time.Stamp)
+	if u.reload.Err != nil {
+		errs := strings.Split(u.reload.Err.Error(), "\n")
+		msg := errs[0]
+		if len(errs) > 1 {
+			msg += fmt.Sprintf(" (+%d more)", len(errs)-1)
+		}
+		return fmt.Sprintf("Config: [reload failed %s](%s) - %s", at, u.theme.Alert, escapeMarkup(msg))
+	}
+
+	row := fmt.Sprintf("Config: [reloaded %s](%s) - %d changes", at, u.theme.OK, len(u.reload.Changes))
+	if len(u.reload.Restart) > 0 {
+		row += fmt.Sprintf(", [restart to apply %s](%s)", strings.Join(u.reload.Restart, ", "), u.theme.Warning)
+	}
+	return row
+}
+
+func (u terminalUI) formatFilter() string {
+	if u.filter == nil || u.filter.Filter().String() == "" {
+		return fmt.Sprintf("Filter: [none](%s)", u.theme.Value)
+	}
+	return fmt.Sprintf("Filter: [%s](%s)", escapeMarkup(u.filter.Filter().String()), u.theme.Value)
+}
+
+func (u terminalUI) formatSilences() string {
+	now := time.Now()
+	for _, w := range u.maintenance {
+		if w.Active(now) {
+			return fmt.Sprintf("Silences: [maintenance window %v in progress](%s)", w, u.theme.Warning)
+		}
+	}
+
+	if u.silences == nil {
+		return fmt.Sprintf("Silences: [disabled](%s)", u.theme.Value)
+	}
+	active, err := u.silences.Active(now)
+	if err != nil {
+		log.Printf("error loading silences: %v", err)
+	}
+	return fmt.Sprintf("Silences: [%v](%s) active", len(active), u.theme.Value)
+}
+
+// trafficView is the traffic shown by the traffic panels: the last interval or a rolling window.
+type trafficView struct {
+	label   string // Period of the view, e.g. "5m".
+	stats   TrafficStats
+	rate    float64       // Requests per second.
+	covered time.Duration // Period covered by the traffic.
+}
+
+// selectView returns the view of the last interval, for 0, or of the rolling window view-1.
+func (u terminalUI) selectView(s TrafficStats, view int) trafficView {
+	if view < 1 || view > len(s.Windows) {
+		var rate float64
+		if u.refresh > 0 {
+			rate = float64(s.TotalReqs) / float64(u.refresh)
+		}
+		period := time.Duration(u.refresh) * time.Second
+		return trafficView{label: periodLabel(period), stats: s, rate: rate, covered: period}
+	}
+
+	w := s.Windows[view-1]
+	return trafficView{
+		label: w.Label(),
+		stats: TrafficStats{
+			SectionHits:     w.SectionHits,
+			MethodHits:      w.MethodHits,
+			StatusClassHits: w.StatusClassHits,
+			Bytes:           w.Bytes,
+			TotalReqs:       w.TotalReqs,
+			Sections:        w.Sections,
+		},
+		rate:    w.ReqPerSec(),
+		covered: w.Covered,
 	}
 }
 
-func (u UI) formatTraffic(s TrafficStats) []string {
+// renderTraffic updates the traffic panels with a view.
+// It returns the sections listed in the sections panel, in order.
+func (u terminalUI) renderTraffic(v trafficView, traffic, sections, status, methods *widgets.List) []string {
+	traffic.Title = fmt.Sprintf("Traffic - last %s (w to switch)", v.label)
+	sections.Title = fmt.Sprintf("Top sections - last %s (Enter to drill down)", v.label)
+	status.Title = fmt.Sprintf("HTTP response status - last %s", v.label)
+	methods.Title = fmt.Sprintf("HTTP request methods - last %s", v.label)
+
+	var keys []string
+	traffic.Rows = u.formatTraffic(v)
+	sections.Rows, keys = u.formatSections(v.stats)
+	status.Rows = u.formatStatus(v.stats)
+	methods.Rows = u.formatMethods(v.stats)
+	return keys
+}
+
+func (u terminalUI) formatTraffic(v trafficView) []string {
 	return []string{
 		"",
-		fmt.Sprintf("Total requests: [%v](fg:blue)", s.TotalReqs),
-		fmt.Sprintf("Bytes transferred: [%v](fg:blue)", s.Bytes),
+		fmt.Sprintf("Total requests: [%v](%s)", v.stats.TotalReqs, u.theme.Value),
+		fmt.Sprintf("Requests per second: [%.2f](%s)", v.rate, u.theme.Value),
+		fmt.Sprintf("Bytes transferred: [%v](%s)", v.stats.Bytes, u.theme.Value),
 	}
 }
 
-func (u UI) formatSections(s TrafficStats) []string {
+// formatSections lists every section, to be scrolled. It also returns the sections in the order they are listed.
+func (u terminalUI) formatSections(s TrafficStats) ([]string, []string) {
 	buf := fromMap(s.SectionHits)
+	rows := buf.marshalTopList("Hits - Section", buf.Len(), u.theme.Value)
 
-	return buf.marshalTopList("Hits - Section", 20)
+	return rows, buf.keys()
 }
 
-func (u UI) formatStatus(s TrafficStats) []string {
+func (u terminalUI) formatClients(s TrafficStats) []string {
+	if len(s.Clients) < 1 {
+		return []string{
+			"",
+			"waiting for inputs...",
+		}
+	}
+
+	output := []string{"Hits - Errors - Client"}
+	for i, c := range s.Clients {
+		if i >= 20 {
+			break
+		}
+		output = append(output, fmt.Sprintf("%v - %v - [%v](%s)", c.Hits, c.Errors, escapeMarkup(c.Client), u.theme.Value))
+	}
+	return output
+}
+
+func (u terminalUI) formatStatus(s TrafficStats) []string {
 	buf := fromMap(s.StatusClassHits)
 
-	return buf.marshalTopList("Hits - HTTP status", 10)
+	return buf.marshalTopList("Hits - HTTP status", 10, u.theme.Value)
 }
 
-func (u UI) formatMethods(s TrafficStats) []string {
+func (u terminalUI) formatMethods(s TrafficStats) []string {
 	buf := fromMap(s.MethodHits)
 
-	return buf.marshalTopList("Hits - HTTP method", 10)
+	return buf.marshalTopList("Hits - HTTP method", 10, u.theme.Value)
 }
 
-func (u UI) formatAlerts(a ThresholdAlert) []string {
-	if a.Open {
+// formatSLOs describes the error budgets and burn rates of the SLOs, as accounted by the TrafficSupervisor.
+func (u terminalUI) formatSLOs(statuses []SLOStatus) []string {
+	if len(u.slos) == 0 {
+		return []string{"", "no SLOs defined"}
+	}
+	if len(statuses) == 0 {
+		return []string{"", "waiting for inputs..."}
+	}
+
+	var output []string
+	for _, status := range statuses {
+		style := u.theme.OK
+		if status.Budget < 0.25 {
+			style = u.theme.Alert
+		}
+
+		output = append(output, fmt.Sprintf(
+			"%s - %.3f%% over %v: budget left [%.1f%%](%s)",
+			escapeMarkup(status.SLO.Name), status.SLO.Target*100, status.SLO.Period, status.Budget*100, style,
+		))
+		for _, b := range status.BurnRates {
+			output = append(output, fmt.Sprintf(
+				" - burn rate %v: [%.1fx](%s) / [%.1fx](%s) (alert at %vx)",
+				b.Window, b.Long, u.theme.Value, b.Short, u.theme.Value, b.Window.BurnRate,
+			))
+		}
+	}
+	return output
+}
+
+func (u terminalUI) formatAlerts(board *alertBoard) []string {
+	open := board.openAlerts()
+	if len(open) < 1 {
 		return []string{
 			"",
-			fmt.Sprintf("[!!](fg:red) High traffic generated an alert - hits = [%.2f](fg:red)req/s\n - triggered at %v", a.Hits, a.Time.Format(time.RFC1123)),
+			"no alerts triggered",
 		}
 	}
-	return []string{
-		"",
-		fmt.Sprintf("[OK](fg:green) High traffic alert recovered - hits = [%.2f](fg:green)req/s\n - recovered at %v", a.Hits, a.Time.Format(time.RFC1123)),
+
+	var output []string
+	for _, a := range open {
+		output = append(output, u.formatAlert(a))
+	}
+	return output
+}
+
+func (u terminalUI) formatHistory(board *alertBoard) []string {
+	if len(board.history) < 1 {
+		return []string{
+			"",
+			"no alerts recorded",
+		}
+	}
+
+	// Newest first:
+	output := make([]string, 0, len(board.history))
+	for i := len(board.history) - 1; i >= 0; i-- {
+		output = append(output, u.formatAlert(board.history[i]))
+	}
+	return output
+}
+
+func (u terminalUI) formatAlert(a ThresholdAlert) string {
+	var msg string
+	style := u.alertStyle(a)
+	switch a.Kind {
+	case LowTraffic:
+		msg = fmt.Sprintf("Low traffic - hits = [%.2f](%s)req/s", a.Hits, style)
+	case NoData:
+		msg = fmt.Sprintf("No log lines received for [%v](%s)s - the source might be dead", a.Idle, style)
+		if !a.Open {
+			msg = fmt.Sprintf("Log lines received again - hits = [%.2f](%s)req/s", a.Hits, style)
+		}
+	case Anomaly:
+		msg = fmt.Sprintf(
+			"Traffic anomaly - hits = [%.2f](%s)req/s, expected = [%.2f](%s)req/s (%+.1f sigma)",
+			a.Hits, style, a.Expected, u.theme.Value, a.Deviation,
+		)
+	case Spike:
+		msg = fmt.Sprintf(
+			"Traffic spike - hits = [%.2f](%s)req/s, previously = [%.2f](%s)req/s (%+.0f%%)",
+			a.Hits, style, a.Expected, u.theme.Value, a.Change,
+		)
+	case BurnRate:
+		msg = fmt.Sprintf(
+			"SLO %s burning at [%.1fx](%s) - budget left = [%.1f%%](%s)",
+			escapeMarkup(a.Name), a.Burn, style, a.Budget*100, u.theme.Value,
+		)
+	case Abuse:
+		msg = fmt.Sprintf(
+			"Client [%s](%s) abuse - hits = [%.2f](%s)req/s, errors = %.0f%%",
+			escapeMarkup(a.Name), style, a.Hits, style, a.Errors*100,
+		)
+	default:
+		msg = fmt.Sprintf("High traffic - hits = [%.2f](%s)req/s", a.Hits, style)
+	}
+
+	if a.Silenced {
+		msg += fmt.Sprintf(" [(silenced)](%s)", u.theme.Warning)
+	}
+
+	if a.Open {
+		return fmt.Sprintf("[!!](%s) %v %s generated an alert", u.theme.Alert, a.Time.Format(time.Stamp), msg)
+	}
+	return fmt.Sprintf("[OK](%s) %v %s alert recovered", u.theme.OK, a.Time.Format(time.Stamp), msg)
+}
+
+func (u terminalUI) alertStyle(a ThresholdAlert) string {
+	if a.Open {
+		return u.theme.Alert
+	}
+	return u.theme.OK
+}
+
+// alertBoard keeps the open alerts and the latest alerts received.
+type alertBoard struct {
+	open    map[string]ThresholdAlert
+	history []ThresholdAlert // Oldest first.
+}
+
+// newAlertBoard creates an alertBoard from the alerts recorded by previous runs.
+func newAlertBoard(history []ThresholdAlert) *alertBoard {
+	board := &alertBoard{open: make(map[string]ThresholdAlert)}
+	for _, a := range history {
+		board.record(a)
+	}
+	return board
+}
+
+// record adds an alert to the history and updates the open alerts.
+func (b *alertBoard) record(a ThresholdAlert) {
+	b.history = append(b.history, a)
+	if len(b.history) > maxAlertHistory {
+		b.history = b.history[len(b.history)-maxAlertHistory:]
 	}
+
+	if a.Open {
+		b.open[a.ID()] = a
+	} else {
+		delete(b.open, a.ID())
+	}
+}
+
+// isOpen tells whether an alert of a kind is open.
+func (b *alertBoard) isOpen(kind AlertKind) bool {
+	for _, a := range b.open {
+		if a.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// openAlerts returns the open alerts, most recent first.
+func (b *alertBoard) openAlerts() []ThresholdAlert {
+	open := make([]ThresholdAlert, 0, len(b.open))
+	for _, a := range b.open {
+		open = append(open, a)
+	}
+	sort.Slice(open, func(i, j int) bool {
+		return open[i].Time.After(open[j].Time)
+	})
+	return open
 }
 
 // entry is a helper struct to build sorted list of top values from maps
@@ -260,13 +670,36 @@ func (e entries) Len() int {
 	return len(e)
 }
 func (e entries) Less(i, j int) bool {
+	if e[i].val == e[j].val {
+		return e[i].key > e[j].key // Sorted by key on ties once reversed, so lists do not shuffle between refreshes.
+	}
 	return e[i].val < e[j].val
 }
 func (e entries) Swap(i, j int) {
 	e[i], e[j] = e[j], e[i]
 }
 
-func (e entries) marshalTopList(title string, max int) []string {
+// keys returns the keys of the entries, in order.
+func (e entries) keys() []string {
+	keys := make([]string, 0, len(e))
+	for _, v := range e {
+		keys = append(keys, v.key)
+	}
+	return keys
+}
+
+// markupEscaper replaces the square brackets of a text with lookalikes: termui has no escape sequence for its markup.
+var markupEscaper = strings.NewReplacer("[", "⁅", "]", "⁆")
+
+// escapeMarkup makes a text safe to display within the markup of a panel, e.g. a filter or a path of the logs.
+// Otherwise, its square brackets would break the markup, or style the text.
+func escapeMarkup(text string) string {
+	return markupEscaper.Replace(text)
+}
+
+// marshalTopList sorts the entries, most hits first, and lists up to max of them under a title.
+// The keys are displayed with a style of the theme.
+func (e entries) marshalTopList(title string, max int, style string) []string {
 	if e.Len() < 1 {
 		return []string{
 			"",
@@ -279,7 +712,7 @@ func (e entries) marshalTopList(title string, max int) []string {
 	output := []string{title}
 	count := 0
 	for _, v := range e {
-		output = append(output, fmt.Sprintf("%v - [%v](fg:blue)", v.val, v.key))
+		output = append(output, fmt.Sprintf("%v - [%v](%s)", v.val, escapeMarkup(v.key), style))
 		count++
 		if count >= max {
 			break
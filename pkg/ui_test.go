@@ -0,0 +1,69 @@
+package logmon_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	ui "github.com/gizak/termui/v3"
+	"github.com/stretchr/testify/require"
+
+	logmon "github.com/jjrumi/accesslogmonitor/pkg"
+)
+
+func TestEscapeMarkup(t *testing.T) {
+	tests := map[string]string{
+		"plain text":          `status >= 500`,
+		"unbalanced brackets": `path ~ "^/api[0-9"`,
+		"closing bracket":     `path ~ "]"`,
+		"markup":              `path ~ "[red](fg:red)"`,
+	}
+
+	for name, text := range tests {
+		t.Run(name, func(t *testing.T) {
+			markup := fmt.Sprintf("[%s](fg:green)", logmon.EscapeMarkup(text))
+			cells := ui.ParseStyles(markup, ui.NewStyle(ui.ColorWhite))
+
+			require.Len(t, cells, utf8.RuneCountInString(text), "every character of the text is displayed, and only them")
+			for _, cell := range cells {
+				require.Equal(t, ui.ColorGreen, cell.Style.Fg, "the whole text has the style of the markup")
+			}
+		})
+	}
+}
+
+func TestFormatClients_EscapesTheClients(t *testing.T) {
+	client := `[admin](fg:red,bg:green)`
+	rows := logmon.FormatClients(logmon.TrafficStats{Clients: []logmon.ClientHits{{Client: client, Hits: 10, Errors: 2}}})
+	require.Len(t, rows, 2)
+	require.Equal(t, "10 - 2 - "+logmon.EscapeMarkup(client), displayed(rows[1]))
+}
+
+func TestFormatAlert_EscapesTheNames(t *testing.T) {
+	name := `[admin](fg:red)`
+	for _, kind := range []logmon.AlertKind{logmon.Abuse, logmon.BurnRate} {
+		row := displayed(logmon.FormatAlert(logmon.ThresholdAlert{Kind: kind, Name: name, Open: true, Time: time.Now()}))
+		require.Contains(t, row, logmon.EscapeMarkup(name), "kind %v", kind)
+	}
+}
+
+// displayed returns the text of a row of a panel, without its markup.
+func displayed(row string) string {
+	var text []rune
+	for _, cell := range ui.ParseStyles(row, ui.NewStyle(ui.ColorWhite)) {
+		text = append(text, cell.Rune)
+	}
+	return string(text)
+}
+
+func TestFormatReload_EscapesTheError(t *testing.T) {
+	report := logmon.ReloadReport{
+		Time: time.Date(2020, 8, 2, 0, 0, 10, 0, time.UTC),
+		Err:  errors.New("line 1: filter: invalid filter \"[a](fg:red)\"\nline 2: refresh: must be a positive number of seconds"),
+	}
+
+	expected := "Config: reload failed Aug  2 00:00:10 - " + logmon.EscapeMarkup(`line 1: filter: invalid filter "[a](fg:red)"`) + " (+1 more)"
+	require.Equal(t, expected, displayed(logmon.FormatReload(report)))
+}
@@ -0,0 +1,355 @@
+package logmon
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultWindows are the periods of the rolling windows computed along with every interval.
+var DefaultWindows = []time.Duration{time.Minute, 5 * time.Minute, time.Hour}
+
+// TrafficWindow defines the traffic of a rolling window: the latest intervals within its period.
+// It slides by one interval on every refresh.
+type TrafficWindow struct {
+	Period          time.Duration
+	Covered         time.Duration // Period covered by the intervals seen so far, up to Period.
+	TotalReqs       int
+	Bytes           int
+	SectionHits     map[string]int
+	MethodHits      map[string]int
+	StatusClassHits map[string]int
+	Sections        map[string]*SectionStats // Traffic of every section. Only tracked by the TrafficSupervisor.
+}
+
+// ReqPerSec returns the average requests per second within the covered period.
+func (w TrafficWindow) ReqPerSec() float64 {
+	if w.Covered <= 0 {
+		return 0
+	}
+	return float64(w.TotalReqs) / w.Covered.Seconds()
+}
+
+// Label returns a short name of the period, e.g. "5m".
+func (w TrafficWindow) Label() string {
+	return periodLabel(w.Period)
+}
+
+// periodLabel formats a period without its zero units, e.g. "1h" instead of "1h0m0s".
+func periodLabel(d time.Duration) string {
+	label := d.String()
+	if strings.HasSuffix(label, "m0s") {
+		label = strings.TrimSuffix(label, "0s")
+	}
+	if strings.HasSuffix(label, "h0m") {
+		label = strings.TrimSuffix(label, "0m")
+	}
+	return label
+}
+
+// ParseWindows parses a comma separated list of periods, e.g. "1m,5m,1h".
+func ParseWindows(definition string) ([]time.Duration, error) {
+	var windows []time.Duration
+	for _, part := range strings.Split(definition, ",") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(part))
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid window %q: expected a positive duration", part)
+		}
+		windows = append(windows, d)
+	}
+	return windows, nil
+}
+
+// intervalSummary is the traffic of an interval kept by rollingWindows.
+type intervalSummary struct {
+	TotalReqs       int
+	Bytes           int
+	SectionHits     map[string]int
+	MethodHits      map[string]int
+	StatusClassHits map[string]int
+	Sections        map[string]SectionStats
+}
+
+// rollingWindows aggregates the latest intervals within several periods.
+// The summaries of the intervals are kept in a single ring buffer, as long as the longest period, and every window
+// keeps running sums: sliding a window only adds the newest interval and subtracts the one leaving the window.
+type rollingWindows struct {
+	interval time.Duration
+	ring     []intervalSummary
+	next     int // Position of the next interval.
+	seen     int // Intervals added so far.
+	windows  []*rollingWindow
+}
+
+// rollingWindow is the running sums of a period.
+type rollingWindow struct {
+	capacity int // Intervals within the period.
+	sum      TrafficWindow
+	sections map[string]*sectionSum
+}
+
+// sectionSum is the running sums of the traffic of a section within a period.
+type sectionSum struct {
+	stats   SectionStats
+	clients map[string]ClientHits
+}
+
+func newRollingWindows(periods []time.Duration, interval time.Duration) *rollingWindows {
+	longest := 0
+	var windows []*rollingWindow
+	for _, period := range periods {
+		capacity := int(period / interval)
+		if capacity < 1 {
+			capacity = 1
+		}
+		if capacity > longest {
+			longest = capacity
+		}
+
+		windows = append(windows, &rollingWindow{
+			capacity: capacity,
+			sum: TrafficWindow{
+				Period:          period,
+				SectionHits:     make(map[string]int),
+				MethodHits:      make(map[string]int),
+				StatusClassHits: make(map[string]int),
+			},
+			sections: make(map[string]*sectionSum),
+		})
+	}
+
+	return &rollingWindows{interval: interval, ring: make([]intervalSummary, longest), windows: windows}
+}
+
+// add slides the windows to include an interval.
+func (r *rollingWindows) add(s TrafficStats) {
+	summary := intervalSummary{
+		TotalReqs:       s.TotalReqs,
+		Bytes:           s.Bytes,
+		SectionHits:     s.SectionHits,
+		MethodHits:      s.MethodHits,
+		StatusClassHits: s.StatusClassHits,
+	}
+	if len(s.Sections) > 0 {
+		summary.Sections = make(map[string]SectionStats, len(s.Sections))
+		for name, section := range s.Sections {
+			summary.Sections[name] = SectionStats{ // Without the sketches, only needed while the interval is built.
+				MethodHits:      section.MethodHits,
+				StatusClassHits: section.StatusClassHits,
+				PathHits:        section.PathHits,
+				Bytes:           section.Bytes,
+				Clients:         section.Clients,
+			}
+		}
+	}
+	r.addSummary(summary)
+}
+
+// resize returns rolling windows of other periods.
+// With the same interval, the new windows replay the intervals kept so far, up to their longest period.
+// Otherwise, the intervals kept cannot be split into the new ones, and the new windows start empty.
+func (r *rollingWindows) resize(periods []time.Duration, interval time.Duration) *rollingWindows {
+	resized := newRollingWindows(periods, interval)
+	if interval != r.interval || len(r.ring) == 0 {
+		return resized
+	}
+
+	kept := r.seen
+	if kept > len(r.ring) {
+		kept = len(r.ring)
+	}
+	if kept > len(resized.ring) {
+		kept = len(resized.ring)
+	}
+	for i := kept; i > 0; i-- {
+		resized.addSummary(r.ring[(r.next-i+len(r.ring))%len(r.ring)])
+	}
+	return resized
+}
+
+// sized tells whether the windows have the given periods and interval.
+func (r *rollingWindows) sized(periods []time.Duration, interval time.Duration) bool {
+	if interval != r.interval || len(periods) != len(r.windows) {
+		return false
+	}
+	for i, w := range r.windows {
+		if w.sum.Period != periods[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *rollingWindows) addSummary(summary intervalSummary) {
+	if len(r.ring) == 0 {
+		return
+	}
+
+	for _, w := range r.windows {
+		if r.seen >= w.capacity {
+			w.subtract(r.ring[(r.next-w.capacity+len(r.ring))%len(r.ring)])
+		}
+		w.add(summary)
+		covered := r.seen + 1
+		if covered > w.capacity {
+			covered = w.capacity
+		}
+		w.sum.Covered = time.Duration(covered) * r.interval
+	}
+
+	r.ring[r.next] = summary
+	r.next = (r.next + 1) % len(r.ring)
+	r.seen++
+}
+
+// snapshot returns a copy of the aggregates of every window, safe to share with the consumers of the stats.
+func (r *rollingWindows) snapshot() []TrafficWindow {
+	var snapshot []TrafficWindow
+	for _, w := range r.windows {
+		window := w.sum
+		window.SectionHits = copyHits(w.sum.SectionHits)
+		window.MethodHits = copyHits(w.sum.MethodHits)
+		window.StatusClassHits = copyHits(w.sum.StatusClassHits)
+		if len(w.sections) > 0 {
+			window.Sections = make(map[string]*SectionStats, len(w.sections))
+			for name, sum := range w.sections {
+				window.Sections[name] = sum.snapshot()
+			}
+		}
+		snapshot = append(snapshot, window)
+	}
+	return snapshot
+}
+
+func (w *rollingWindow) add(s intervalSummary) {
+	w.sum.TotalReqs += s.TotalReqs
+	w.sum.Bytes += s.Bytes
+	addHits(w.sum.SectionHits, s.SectionHits)
+	addHits(w.sum.MethodHits, s.MethodHits)
+	addHits(w.sum.StatusClassHits, s.StatusClassHits)
+
+	for name, section := range s.Sections {
+		sum, ok := w.sections[name]
+		if !ok {
+			sum = &sectionSum{
+				stats: SectionStats{
+					MethodHits:      make(map[string]int),
+					StatusClassHits: make(map[string]int),
+					PathHits:        make(map[string]int),
+				},
+				clients: make(map[string]ClientHits),
+			}
+			w.sections[name] = sum
+		}
+		sum.add(section)
+	}
+}
+
+func (w *rollingWindow) subtract(s intervalSummary) {
+	w.sum.TotalReqs -= s.TotalReqs
+	w.sum.Bytes -= s.Bytes
+	subtractHits(w.sum.SectionHits, s.SectionHits)
+	subtractHits(w.sum.MethodHits, s.MethodHits)
+	subtractHits(w.sum.StatusClassHits, s.StatusClassHits)
+
+	for name, section := range s.Sections {
+		if _, ok := w.sum.SectionHits[name]; !ok {
+			delete(w.sections, name) // The section left the window.
+			continue
+		}
+		if sum, ok := w.sections[name]; ok {
+			sum.subtract(section)
+		}
+	}
+}
+
+func (s *sectionSum) add(section SectionStats) {
+	s.stats.Bytes += section.Bytes
+	addHits(s.stats.MethodHits, section.MethodHits)
+	addHits(s.stats.StatusClassHits, section.StatusClassHits)
+	addHits(s.stats.PathHits, section.PathHits)
+	for _, c := range section.Clients {
+		sum := s.clients[c.Client]
+		sum.Client = c.Client
+		sum.Hits += c.Hits
+		sum.Errors += c.Errors
+		sum.Error += c.Error
+		s.clients[c.Client] = sum
+	}
+}
+
+func (s *sectionSum) subtract(section SectionStats) {
+	s.stats.Bytes -= section.Bytes
+	subtractHits(s.stats.MethodHits, section.MethodHits)
+	subtractHits(s.stats.StatusClassHits, section.StatusClassHits)
+	subtractHits(s.stats.PathHits, section.PathHits)
+	for _, c := range section.Clients {
+		sum := s.clients[c.Client]
+		sum.Hits -= c.Hits
+		sum.Errors -= c.Errors
+		sum.Error -= c.Error
+		if sum.Hits <= 0 {
+			delete(s.clients, c.Client)
+			continue
+		}
+		s.clients[c.Client] = sum
+	}
+}
+
+// snapshot returns a copy of the sums. Only the paths and clients with the most requests are listed, as in an interval.
+func (s *sectionSum) snapshot() *SectionStats {
+	paths := make(map[string]int)
+	for _, e := range sortedEntries(s.stats.PathHits, sectionPathCapacity) {
+		paths[e.key] = e.val
+	}
+
+	clients := make([]ClientHits, 0, len(s.clients))
+	for _, c := range s.clients {
+		clients = append(clients, c)
+	}
+	sort.Slice(clients, func(i, j int) bool {
+		if clients[i].Hits == clients[j].Hits {
+			return clients[i].Client < clients[j].Client
+		}
+		return clients[i].Hits > clients[j].Hits
+	})
+	if len(clients) > sectionClientCapacity {
+		clients = clients[:sectionClientCapacity]
+	}
+
+	return &SectionStats{
+		MethodHits:      copyHits(s.stats.MethodHits),
+		StatusClassHits: copyHits(s.stats.StatusClassHits),
+		PathHits:        paths,
+		Bytes:           s.stats.Bytes,
+		Clients:         clients,
+	}
+}
+
+func addHits(dst, src map[string]int) {
+	for k, v := range src {
+		dst[k] += v
+	}
+}
+
+// subtractHits removes the keys down to zero hits, so the maps only keep the keys within the window.
+func subtractHits(dst, src map[string]int) {
+	for k, v := range src {
+		dst[k] -= v
+		if dst[k] <= 0 {
+			delete(dst, k)
+		}
+	}
+}
+
+func copyHits(src map[string]int) map[string]int {
+	dst := make(map[string]int, len(src))
+	for k, v := range src {
+		dst[k] = v
+	}
+	return dst
+}
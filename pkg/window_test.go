@@ -0,0 +1,176 @@
+package logmon_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	logmon "github.com/jjrumi/accesslogmonitor/pkg"
+)
+
+func TestTrafficSupervisor_SlidesRollingWindows(t *testing.T) {
+	entries := make(chan logmon.LogEntry, 3)
+	for i := 0; i < 3; i++ {
+		entries <- logmon.LogEntry{ReqMethod: "GET", ReqPath: "/api", StatusCode: 200, Bytes: 10}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	supervisor := logmon.NewTrafficSupervisor(logmon.TrafficSupervisorOpts{
+		RefreshInterval: 50,
+		Windows:         []time.Duration{100 * time.Millisecond, 150 * time.Millisecond},
+	})
+	stats := make(chan logmon.TrafficStats)
+	go supervisor.Run(ctx, entries, stats)
+
+	// All the requests are in the first interval:
+	expected := [][]int{{3, 3}, {3, 3}, {0, 3}, {0, 0}}
+	for i, totals := range expected {
+		s := <-stats
+		require.Len(t, s.Windows, 2)
+		for w, total := range totals {
+			require.Equal(t, total, s.Windows[w].TotalReqs, "interval %d, window %s", i, s.Windows[w].Label())
+			if total > 0 {
+				require.Equal(t, map[string]int{"/api": total}, s.Windows[w].SectionHits)
+			} else {
+				require.Empty(t, s.Windows[w].SectionHits, "evicted sections are removed")
+			}
+		}
+	}
+}
+
+func TestTrafficSupervisor_TracksTheSectionsOfTheRollingWindows(t *testing.T) {
+	entries := make(chan logmon.LogEntry, 3)
+	entries <- logmon.LogEntry{RemoteHost: "10.0.0.1", ReqMethod: "GET", ReqPath: "/api/users", StatusCode: 200, Bytes: 10}
+	entries <- logmon.LogEntry{RemoteHost: "10.0.0.1", ReqMethod: "GET", ReqPath: "/api/users", StatusCode: 404, Bytes: 5}
+	entries <- logmon.LogEntry{RemoteHost: "10.0.0.2", ReqMethod: "POST", ReqPath: "/api/orders", StatusCode: 201, Bytes: 20}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	supervisor := logmon.NewTrafficSupervisor(logmon.TrafficSupervisorOpts{
+		RefreshInterval: 50,
+		Windows:         []time.Duration{100 * time.Millisecond},
+	})
+	stats := make(chan logmon.TrafficStats)
+	go supervisor.Run(ctx, entries, stats)
+
+	// All the requests are in the first interval, kept by the window along with the second one:
+	for i := 0; i < 2; i++ {
+		s := <-stats
+		api := s.Windows[0].Sections["/api"]
+		require.NotNil(t, api, "interval %d", i)
+		require.Equal(t, map[string]int{"GET": 2, "POST": 1}, api.MethodHits)
+		require.Equal(t, map[string]int{"2xx": 2, "4xx": 1}, api.StatusClassHits)
+		require.Equal(t, map[string]int{"/api/users": 2, "/api/orders": 1}, api.PathHits)
+		require.Equal(t, 35, api.Bytes)
+		require.Equal(t, []logmon.ClientHits{
+			{Client: "10.0.0.1", Hits: 2, Errors: 1},
+			{Client: "10.0.0.2", Hits: 1},
+		}, api.Clients)
+	}
+
+	s := <-stats
+	require.Empty(t, s.Windows[0].Sections, "evicted sections are removed")
+}
+
+func TestTrafficSupervisor_ReconfigureResizesRollingWindows(t *testing.T) {
+	entries := make(chan logmon.LogEntry, 3)
+	for i := 0; i < 3; i++ {
+		entries <- logmon.LogEntry{ReqMethod: "GET", ReqPath: "/api", StatusCode: 200, Bytes: 10}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	supervisor := logmon.NewTrafficSupervisor(logmon.TrafficSupervisorOpts{
+		RefreshInterval: 50,
+		Windows:         []time.Duration{200 * time.Millisecond},
+	})
+	stats := make(chan logmon.TrafficStats)
+	go supervisor.Run(ctx, entries, stats)
+
+	s := <-stats
+	require.Len(t, s.Windows, 1)
+	require.Equal(t, 3, s.Windows[0].TotalReqs)
+
+	supervisor.Reconfigure(logmon.TrafficSupervisorOpts{
+		RefreshInterval: 50,
+		Windows:         []time.Duration{100 * time.Millisecond, 200 * time.Millisecond},
+	})
+	for len(s.Windows) != 2 {
+		s = <-stats
+	}
+
+	// The intervals seen so far are replayed into the new windows:
+	for _, w := range s.Windows {
+		require.Equal(t, 3, w.TotalReqs, "window %s", w.Label())
+	}
+	require.Equal(t, "100ms", s.Windows[0].Label())
+}
+
+func TestTrafficSupervisor_ReconfigureChangesTheRefreshInterval(t *testing.T) {
+	entries := make(chan logmon.LogEntry, 3)
+	for i := 0; i < 3; i++ {
+		entries <- logmon.LogEntry{ReqMethod: "GET", ReqPath: "/api", StatusCode: 200, Bytes: 10}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	supervisor := logmon.NewTrafficSupervisor(logmon.TrafficSupervisorOpts{
+		RefreshInterval: 50,
+		Windows:         []time.Duration{200 * time.Millisecond},
+	})
+	stats := make(chan logmon.TrafficStats)
+	go supervisor.Run(ctx, entries, stats)
+
+	s := <-stats
+	require.Equal(t, 3, s.Windows[0].TotalReqs)
+
+	supervisor.Reconfigure(logmon.TrafficSupervisorOpts{
+		RefreshInterval: 100,
+		Windows:         []time.Duration{200 * time.Millisecond, 400 * time.Millisecond},
+	})
+	for len(s.Windows) != 2 {
+		s = <-stats
+	}
+
+	// The intervals seen so far are of another length: the windows start over.
+	for _, w := range s.Windows {
+		require.Equal(t, 0, w.TotalReqs, "window %s", w.Label())
+		require.Equal(t, 100*time.Millisecond, w.Covered, "window %s", w.Label())
+	}
+
+	next := <-stats
+	require.Equal(t, 200*time.Millisecond, next.Windows[0].Covered)
+	elapsed := next.Time.Sub(s.Time)
+	require.True(t, elapsed >= 90*time.Millisecond, "the stats are produced every 100ms, not %v", elapsed)
+}
+
+func TestTrafficWindow(t *testing.T) {
+	tests := map[string]struct {
+		window logmon.TrafficWindow
+		label  string
+		rate   float64
+	}{
+		"full window":    {logmon.TrafficWindow{Period: 5 * time.Minute, Covered: 5 * time.Minute, TotalReqs: 600}, "5m", 2},
+		"partial window": {logmon.TrafficWindow{Period: time.Hour, Covered: 10 * time.Second, TotalReqs: 50}, "1h", 5},
+		"empty window":   {logmon.TrafficWindow{Period: 90 * time.Second}, "1m30s", 0},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, tc.label, tc.window.Label())
+			require.Equal(t, tc.rate, tc.window.ReqPerSec())
+		})
+	}
+}
+
+func TestParseWindows(t *testing.T) {
+	windows, err := logmon.ParseWindows("1m, 5m,1h")
+	require.NoError(t, err)
+	require.Equal(t, []time.Duration{time.Minute, 5 * time.Minute, time.Hour}, windows)
+
+	_, err = logmon.ParseWindows("1m,soon")
+	require.Error(t, err)
+}